@@ -1,9 +1,11 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/Notwinner0/gvcs/internal/commands"
 	"github.com/Notwinner0/gvcs/internal/repo"
@@ -17,14 +19,31 @@ func main() {
 	initCmd := parser.NewCommand("init", "Initialize a new, empty repository.")
 	initPath := initCmd.String("p", "path", &argparse.Options{Required: false, Default: ".", Help: "Where to create the repository."})
 	catFileCmd := parser.NewCommand("cat-file", "Provide content of repository objects")
-	catFileType := catFileCmd.String("t", "type", &argparse.Options{Required: true, Help: "Specify the type"})
-	catFileObject := catFileCmd.String("o", "object", &argparse.Options{Required: true, Help: "The object to display"})
+	catFileArg := catFileCmd.StringPositional(&argparse.Options{Help: "The expected type, or the object with -t, -s, -e or -p"})
+	catFileObject := catFileCmd.StringPositional(&argparse.Options{Help: "The object to display"})
+	catFileShowType := catFileCmd.Flag("t", "type", &argparse.Options{Help: "Show the object type"})
+	catFileShowSize := catFileCmd.Flag("s", "size", &argparse.Options{Help: "Show the object size"})
+	catFileExists := catFileCmd.Flag("e", "exists", &argparse.Options{Help: "Exit with zero status if the object exists and is valid"})
+	catFilePretty := catFileCmd.Flag("p", "pretty", &argparse.Options{Help: "Pretty-print the object content"})
+	catFileBatch := catFileCmd.Flag("", "batch", &argparse.Options{Help: "Print the header and content of each object named on stdin"})
+	catFileBatchCheck := catFileCmd.Flag("", "batch-check", &argparse.Options{Help: "Print the header of each object named on stdin"})
+	catFileFormat := catFileCmd.String("", "format", &argparse.Options{Help: "Header format for --batch and --batch-check"})
+	catFileBuffer := catFileCmd.Flag("", "buffer", &argparse.Options{Help: "Do not flush the output after each object in batch mode"})
 	hashObjectCmd := parser.NewCommand("hash-object", "Compute object ID and optionally creates a blob from a file")
 	hashObjectType := hashObjectCmd.String("t", "type", &argparse.Options{Default: "blob", Help: "Specify the type"})
 	hashObjectWrite := hashObjectCmd.Flag("w", "write", &argparse.Options{Help: "Actually write the object into the database"})
-	hashObjectPath := hashObjectCmd.StringPositional(&argparse.Options{Required: true, Help: "Read object from <file>"})
+	hashObjectPath := hashObjectCmd.StringPositional(&argparse.Options{Help: "Read object from <file>"})
+	hashObjectStdin := hashObjectCmd.Flag("", "stdin", &argparse.Options{Help: "Read the object from standard input"})
+	hashObjectStdinPaths := hashObjectCmd.Flag("", "stdin-paths", &argparse.Options{Help: "Read file names from standard input, one per line"})
+	hashObjectLiterally := hashObjectCmd.Flag("", "literally", &argparse.Options{Help: "Allow any type and skip validating the content"})
+	hashObjectAttrPath := hashObjectCmd.String("", "path", &argparse.Options{Help: "Apply the filters of this path instead of the file's own"})
+	hashObjectNoFilters := hashObjectCmd.Flag("", "no-filters", &argparse.Options{Help: "Hash the content as is, ignoring attribute filters"})
 	logCmd := parser.NewCommand("log", "Display history of a given commit.")
 	logCommit := logCmd.String("c", "commit", &argparse.Options{Required: false, Default: "HEAD", Help: "Commit to start at."})
+	logPaths := logCmd.StringList("", "path", &argparse.Options{Required: false, Help: "Only show commits that change this path. Can be repeated."})
+	logFollow := logCmd.Flag("", "follow", &argparse.Options{Help: "Follow a single file across renames."})
+	logFindRenames := logCmd.String("M", "find-renames", &argparse.Options{Default: "50%", Help: "Similarity threshold for renames followed by --follow, such as 90%"})
+	logOneline := logCmd.Flag("", "oneline", &argparse.Options{Help: "Print one line per commit instead of a graphviz graph."})
 	lsTreeCmd := parser.NewCommand("ls-tree", "Pretty-print a tree object.")
 	lsTreeRecursive := lsTreeCmd.Flag("r", "recursive", &argparse.Options{Help: "Recurse into sub-trees"})
 	lsTreeObject := lsTreeCmd.StringPositional(&argparse.Options{Required: true, Help: "A tree-ish object."})
@@ -32,6 +51,10 @@ func main() {
 	checkoutCommit := checkoutCmd.StringPositional(&argparse.Options{Required: true, Help: "The commit or tree to checkout."})
 	checkoutPath := checkoutCmd.StringPositional(&argparse.Options{Required: true, Help: "The EMPTY directory to checkout on."})
 	showRefCmd := parser.NewCommand("show-ref", "List references.")
+	showRefPattern := showRefCmd.StringPositional(&argparse.Options{Help: "Only show refs whose trailing components match."})
+	showRefHeads := showRefCmd.Flag("", "heads", &argparse.Options{Help: "Only show branches"})
+	showRefTags := showRefCmd.Flag("", "tags", &argparse.Options{Help: "Only show tags"})
+	showRefVerify := showRefCmd.Flag("", "verify", &argparse.Options{Help: "Show a single ref given by its exact name"})
 	tagCmd := parser.NewCommand("tag", "List and create tags")
 	tagAnnotated := tagCmd.Flag("a", "annotated", &argparse.Options{Help: "Whether to create a tag object"})
 	tagName := tagCmd.String("n", "name", &argparse.Options{Help: "The new tag's name"})
@@ -42,6 +65,8 @@ func main() {
 	lsFilesCmd := parser.NewCommand("ls-files", "List all the staged files")
 	lsFilesVerbose := lsFilesCmd.Flag("v", "verbose", &argparse.Options{Help: "Show everything."})
 	statusCmd := parser.NewCommand("status", "Show the working tree status.")
+	statusFindRenames := statusCmd.String("M", "find-renames", &argparse.Options{Default: "50%", Help: "Similarity threshold for staged renames, such as 90%"})
+	statusNoRenames := statusCmd.Flag("", "no-renames", &argparse.Options{Help: "Show staged renames as a deletion and an addition"})
 	checkIgnoreCmd := parser.NewCommand("check-ignore", "Check path(s) against ignore rules.")
 	checkIgnorePaths := checkIgnoreCmd.StringList("", "paths", &argparse.Options{Required: true, Help: "Paths to check"})
 	rmCmd := parser.NewCommand("rm", "Remove files from the working tree and the index.")
@@ -49,9 +74,190 @@ func main() {
 	addCmd := parser.NewCommand("add", "Add file contents to the index.")
 	addPaths := addCmd.StringList("f", "files", &argparse.Options{Required: true, Help: "Files to add"})
 	commitCmd := parser.NewCommand("commit", "Record changes to the repository.")
-	commitMessage := commitCmd.String("m", "message", &argparse.Options{Required: true, Help: "Message to associate with this commit."})
+	commitMessage := commitCmd.String("m", "message", &argparse.Options{Help: "Message to associate with this commit. Defaults to the one prepared by a stopped cherry-pick or revert."})
+	lfsCmd := parser.NewCommand("lfs", "Store large files outside the object database.")
+	lfsLsFilesCmd := lfsCmd.NewCommand("ls-files", "List LFS-tracked files in a commit.")
+	lfsLsFilesRef := lfsLsFilesCmd.StringPositional(&argparse.Options{Default: "HEAD", Help: "The commit or tree to list."})
+	lfsPruneCmd := lfsCmd.NewCommand("prune", "Delete local LFS content that is no longer referenced.")
+	lfsPruneDryRun := lfsPruneCmd.Flag("d", "dry-run", &argparse.Options{Help: "Only report what would be deleted"})
+	lfsPruneVerifyRemote := lfsPruneCmd.Flag("", "verify-remote", &argparse.Options{Help: "Keep content that is missing from the remote"})
+	lfsPushCmd := lfsCmd.NewCommand("push", "Upload LFS content to the configured lfs.url.")
+	lfsPushRef := lfsPushCmd.StringPositional(&argparse.Options{Default: "HEAD", Help: "The commit whose content to upload."})
+	updateRefCmd := parser.NewCommand("update-ref", "Update the object name stored in a ref safely.")
+	updateRefName := updateRefCmd.StringPositional(&argparse.Options{Help: "The ref to update."})
+	updateRefNew := updateRefCmd.StringPositional(&argparse.Options{Help: "The new value (the expected old value with -d)."})
+	updateRefOld := updateRefCmd.StringPositional(&argparse.Options{Help: "The value the ref must currently have."})
+	updateRefDelete := updateRefCmd.Flag("d", "delete", &argparse.Options{Help: "Delete the ref"})
+	updateRefStdin := updateRefCmd.Flag("", "stdin", &argparse.Options{Help: "Read a batch of updates from standard input"})
+	updateRefMessage := updateRefCmd.String("m", "message", &argparse.Options{Help: "Reason recorded in the reflog"})
+	updateRefNoDeref := updateRefCmd.Flag("", "no-deref", &argparse.Options{Help: "Update symbolic refs themselves"})
+	symbolicRefCmd := parser.NewCommand("symbolic-ref", "Read, modify and delete symbolic refs.")
+	symbolicRefName := symbolicRefCmd.StringPositional(&argparse.Options{Required: true, Help: "The symbolic ref, e.g. HEAD."})
+	symbolicRefTarget := symbolicRefCmd.StringPositional(&argparse.Options{Help: "The ref it should point to."})
+	symbolicRefMessage := symbolicRefCmd.String("m", "message", &argparse.Options{Help: "Reason recorded in the reflog"})
+	symbolicRefShort := symbolicRefCmd.Flag("s", "short", &argparse.Options{Help: "Shorten the ref name, e.g. refs/heads/master to master"})
+	symbolicRefDelete := symbolicRefCmd.Flag("d", "delete", &argparse.Options{Help: "Delete the symbolic ref"})
+	symbolicRefQuiet := symbolicRefCmd.Flag("q", "quiet", &argparse.Options{Help: "Only set the exit status if the ref is not symbolic"})
+	forEachRefCmd := parser.NewCommand("for-each-ref", "Output information on each ref.")
+	forEachRefPatterns := forEachRefCmd.StringList("p", "pattern", &argparse.Options{Help: "Only list refs matching the pattern (repeatable)"})
+	forEachRefSort := forEachRefCmd.StringList("s", "sort", &argparse.Options{Help: "Sort key such as -committerdate (repeatable, last is primary)"})
+	forEachRefFormat := forEachRefCmd.String("f", "format", &argparse.Options{Help: "Format string with %(atom) placeholders"})
+	forEachRefCount := forEachRefCmd.Int("c", "count", &argparse.Options{Help: "Stop after showing this many refs"})
+	forEachRefContains := forEachRefCmd.String("", "contains", &argparse.Options{Help: "Only list refs whose commit contains this commit"})
+	forEachRefMerged := forEachRefCmd.String("", "merged", &argparse.Options{Help: "Only list refs reachable from this commit"})
+	fsckCmd := parser.NewCommand("fsck", "Verify the connectivity and validity of the objects in the database.")
+	fsckUnreachable := fsckCmd.Flag("", "unreachable", &argparse.Options{Help: "Show all unreachable objects, not just dangling ones"})
+	fsckNoDangling := fsckCmd.Flag("", "no-dangling", &argparse.Options{Help: "Do not report dangling objects"})
+	fsckStrict := fsckCmd.Flag("", "strict", &argparse.Options{Help: "Treat warnings such as zero-padded file modes as errors"})
+	pruneCmd := parser.NewCommand("prune", "Prune all unreachable objects from the object database.")
+	pruneExpire := pruneCmd.String("", "expire", &argparse.Options{Default: "2.weeks.ago", Help: "Only prune loose objects older than this date"})
+	pruneDryRun := pruneCmd.Flag("n", "dry-run", &argparse.Options{Help: "Do not remove anything; just report what would be removed"})
+	pruneVerbose := pruneCmd.Flag("v", "verbose", &argparse.Options{Help: "Report all removed objects"})
+	countObjectsCmd := parser.NewCommand("count-objects", "Count unpacked number of objects and their disk consumption.")
+	countObjectsVerbose := countObjectsCmd.Flag("v", "verbose", &argparse.Options{Help: "Also report packs, prunable objects and garbage"})
+	countObjectsHuman := countObjectsCmd.Flag("H", "human-readable", &argparse.Options{Help: "Print sizes in human readable format"})
+	countObjectsStats := countObjectsCmd.Flag("", "stats", &argparse.Options{Help: "Walk the history and report the largest objects and deepest paths"})
+	countObjectsTop := countObjectsCmd.Int("", "top", &argparse.Options{Default: 10, Help: "Number of entries in each --stats table"})
+	revListCmd := parser.NewCommand("rev-list", "Lists commit objects in reverse chronological order.")
+	revListRevision := revListCmd.StringPositional(&argparse.Options{Help: "A revision such as B, ^A, A..B or A...B"})
+	revListRevisions := revListCmd.StringList("r", "revision", &argparse.Options{Help: "Another revision to walk or exclude"})
+	revListNot := revListCmd.StringList("", "not", &argparse.Options{Help: "A revision whose meaning is reversed: excluded, or walked if prefixed with ^"})
+	revListMaxCount := revListCmd.Int("n", "max-count", &argparse.Options{Help: "Limit the number of commits to output"})
+	revListSince := revListCmd.String("", "since", &argparse.Options{Help: "Show commits more recent than a specific date"})
+	revListUntil := revListCmd.String("", "until", &argparse.Options{Help: "Show commits older than a specific date"})
+	revListAuthor := revListCmd.String("", "author", &argparse.Options{Help: "Limit the commits to those whose author matches the pattern"})
+	revListFirstParent := revListCmd.Flag("", "first-parent", &argparse.Options{Help: "Follow only the first parent of merge commits"})
+	revListTopoOrder := revListCmd.Flag("", "topo-order", &argparse.Options{Help: "Show no parents before all of their children, keeping lines of history together"})
+	revListDateOrder := revListCmd.Flag("", "date-order", &argparse.Options{Help: "Show no parents before all of their children, otherwise by commit date"})
+	revListCount := revListCmd.Flag("", "count", &argparse.Options{Help: "Print only the number of commits"})
+	revListObjects := revListCmd.Flag("", "objects", &argparse.Options{Help: "Also list the trees and blobs the commits refer to"})
+	revListPaths := revListCmd.StringList("", "path", &argparse.Options{Help: "Only list commits that change this path"})
+	diffCmd := parser.NewCommand("diff", "Show changes between commits, the index and the working tree.")
+	diffRevA := diffCmd.StringPositional(&argparse.Options{Help: "Commit to compare from, or a range A..B or A...B"})
+	diffRevB := diffCmd.StringPositional(&argparse.Options{Help: "Commit to compare to"})
+	diffCached := diffCmd.Flag("", "cached", &argparse.Options{Help: "Compare the index with a commit, HEAD by default"})
+	diffPaths := diffCmd.StringList("", "path", &argparse.Options{Help: "Only compare this path. Can be repeated."})
+	diffFindRenames := diffCmd.String("M", "find-renames", &argparse.Options{Default: "50%", Help: "Similarity threshold for renames, such as 90%"})
+	diffNoRenames := diffCmd.Flag("", "no-renames", &argparse.Options{Help: "Show renames as a deletion and an addition"})
+	diffFindCopies := diffCmd.Flag("C", "find-copies", &argparse.Options{Help: "Also detect copies of modified files"})
+	diffRenameLimit := diffCmd.Int("l", "rename-limit", &argparse.Options{Default: 1000, Help: "Skip inexact rename detection above this many files"})
+	diffUnified := diffCmd.Int("U", "unified", &argparse.Options{Default: 3, Help: "Lines of context around changes"})
+	diffStat := diffCmd.Flag("", "stat", &argparse.Options{Help: "Show a histogram of changed lines per file"})
+	diffNumstat := diffCmd.Flag("", "numstat", &argparse.Options{Help: "Show added and deleted line counts per file"})
+	diffShortstat := diffCmd.Flag("", "shortstat", &argparse.Options{Help: "Show only the total of changed files and lines"})
+	diffNameOnly := diffCmd.Flag("", "name-only", &argparse.Options{Help: "Show only the names of changed files"})
+	diffNameStatus := diffCmd.Flag("", "name-status", &argparse.Options{Help: "Show the names and status of changed files"})
+	diffPatch := diffCmd.Flag("p", "patch", &argparse.Options{Help: "Show the patch after a --stat, --numstat or --shortstat summary"})
+	diffWordDiff := diffCmd.String("", "word-diff", &argparse.Options{Help: "Show changed words: plain, color, porcelain or none"})
+	diffColorWords := diffCmd.Flag("", "color-words", &argparse.Options{Help: "Show changed words in color, as --word-diff color"})
+
+	showCmd := parser.NewCommand("show", "Show a commit, tag, tree or blob.")
+	showObject := showCmd.StringPositional(&argparse.Options{Help: "The object to show, or <rev>:<path>. Defaults to HEAD"})
+	showUnified := showCmd.Int("U", "unified", &argparse.Options{Default: 3, Help: "Lines of context around changes"})
+	showNoRenames := showCmd.Flag("", "no-renames", &argparse.Options{Help: "Show renames as a deletion and an addition"})
+	showStat := showCmd.Flag("", "stat", &argparse.Options{Help: "Show a histogram of changed lines per file"})
+	showNumstat := showCmd.Flag("", "numstat", &argparse.Options{Help: "Show added and deleted line counts per file"})
+	showShortstat := showCmd.Flag("", "shortstat", &argparse.Options{Help: "Show only the total of changed files and lines"})
+	showNameOnly := showCmd.Flag("", "name-only", &argparse.Options{Help: "Show only the names of changed files"})
+	showNameStatus := showCmd.Flag("", "name-status", &argparse.Options{Help: "Show the names and status of changed files"})
+	showPatch := showCmd.Flag("p", "patch", &argparse.Options{Help: "Show the patch after a --stat, --numstat or --shortstat summary"})
+	showWordDiff := showCmd.String("", "word-diff", &argparse.Options{Help: "Show changed words: plain, color, porcelain or none"})
+	blameCmd := parser.NewCommand("blame", "Show what revision and author last modified each line of a file.")
+	blameFile := blameCmd.StringPositional(&argparse.Options{Required: true, Help: "The file to blame"})
+	blameRev := blameCmd.StringPositional(&argparse.Options{Help: "The commit to blame the file as of. Defaults to the working tree"})
+	blameRanges := blameCmd.StringList("L", "range", &argparse.Options{Help: "Only blame the lines <start>,<end>, as numbers, /regex/ or +/-<count>. Can be repeated."})
+	blamePorcelain := blameCmd.Flag("p", "porcelain", &argparse.Options{Help: "Show the output in a format for scripts"})
+	blameIgnoreWhitespace := blameCmd.Flag("w", "ignore-whitespace", &argparse.Options{Help: "Ignore whitespace when comparing lines"})
+	blameMoves := blameCmd.Flag("M", "moves", &argparse.Options{Help: "Detect lines moved or copied within the file"})
+	cherryPickCmd := parser.NewCommand("cherry-pick", "Apply the changes introduced by existing commits: cherry-pick <commit>...")
+	cherryPickRecordOrigin := cherryPickCmd.Flag("x", "record-origin", &argparse.Options{Help: "Add a \"(cherry picked from commit ...)\" line to the message"})
+	cherryPickContinue := cherryPickCmd.Flag("", "continue", &argparse.Options{Help: "Commit the resolved pick and go on with the rest"})
+	cherryPickAbort := cherryPickCmd.Flag("", "abort", &argparse.Options{Help: "Undo the picks and return to where they started"})
+	cherryPickSkip := cherryPickCmd.Flag("", "skip", &argparse.Options{Help: "Leave out the stopped pick and go on with the rest"})
+	revertCmd := parser.NewCommand("revert", "Commit the reverse of the changes of existing commits: revert <commit>...")
+	revertContinue := revertCmd.Flag("", "continue", &argparse.Options{Help: "Commit the resolved revert and go on with the rest"})
+	revertAbort := revertCmd.Flag("", "abort", &argparse.Options{Help: "Undo the reverts and return to where they started"})
+	revertSkip := revertCmd.Flag("", "skip", &argparse.Options{Help: "Leave out the stopped revert and go on with the rest"})
+	rebaseCmd := parser.NewCommand("rebase", "Replay the commits of the current branch onto a new base.")
+	rebaseUpstream := rebaseCmd.StringPositional(&argparse.Options{Help: "The commit to replay onto, leaving out the commits it already has"})
+	rebaseOnto := rebaseCmd.String("", "onto", &argparse.Options{Help: "Replay onto this commit instead of the upstream"})
+	rebaseExec := rebaseCmd.StringList("x", "exec", &argparse.Options{Help: "Run a shell command after each commit. Can be repeated."})
+	rebaseAutosquash := rebaseCmd.Flag("", "autosquash", &argparse.Options{Help: "Fold \"fixup! \" and \"squash! \" commits into the commits they name"})
+	rebaseTodoFile := rebaseCmd.String("", "todo-file", &argparse.Options{Help: "Take the pick/reword/squash/fixup/drop/exec list from this file, or - for stdin"})
+	rebaseContinue := rebaseCmd.Flag("", "continue", &argparse.Options{Help: "Commit the resolved step and go on with the rest"})
+	rebaseAbort := rebaseCmd.Flag("", "abort", &argparse.Options{Help: "Undo the rebase and return to where it started"})
+	rebaseSkip := rebaseCmd.Flag("", "skip", &argparse.Options{Help: "Leave out the stopped commit and go on with the rest"})
+
+	stashCmd := parser.NewCommand("stash", "Save local changes away and restore them later.")
+	stashPushCmd := stashCmd.NewCommand("push", "Save the local changes as a stash entry and revert them.")
+	stashPushMessage := stashPushCmd.String("m", "message", &argparse.Options{Help: "Describe the entry with this message"})
+	stashPushUntracked := stashPushCmd.Flag("u", "include-untracked", &argparse.Options{Help: "Also save and delete the untracked files that are not ignored"})
+	stashPushPaths := stashPushCmd.StringList("", "path", &argparse.Options{Help: "Only save the changes to this path. Can be repeated."})
+	stashListCmd := stashCmd.NewCommand("list", "List the stash entries.")
+	stashShowCmd := stashCmd.NewCommand("show", "Show the changes saved in a stash entry.")
+	stashShowEntry := stashShowCmd.StringPositional(&argparse.Options{Help: "The entry, stash@{<n>} or <n>. Defaults to the latest"})
+	stashShowPatch := stashShowCmd.Flag("p", "patch", &argparse.Options{Help: "Show the changes as a patch instead of a diffstat"})
+	stashApplyCmd := stashCmd.NewCommand("apply", "Apply the changes of a stash entry to the worktree.")
+	stashApplyEntry := stashApplyCmd.StringPositional(&argparse.Options{Help: "The entry, stash@{<n>} or <n>. Defaults to the latest"})
+	stashPopCmd := stashCmd.NewCommand("pop", "Apply a stash entry and drop it.")
+	stashPopEntry := stashPopCmd.StringPositional(&argparse.Options{Help: "The entry, stash@{<n>} or <n>. Defaults to the latest"})
+	stashDropCmd := stashCmd.NewCommand("drop", "Remove a stash entry.")
+	stashDropEntry := stashDropCmd.StringPositional(&argparse.Options{Help: "The entry, stash@{<n>} or <n>. Defaults to the latest"})
+	stashBranchCmd := stashCmd.NewCommand("branch", "Restore a stash entry on a new branch at the commit it was made on.")
+	stashBranchName := stashBranchCmd.StringPositional(&argparse.Options{Required: true, Help: "The branch to create"})
+	stashBranchEntry := stashBranchCmd.StringPositional(&argparse.Options{Help: "The entry, stash@{<n>} or <n>. Defaults to the latest"})
+
+	cleanCmd := parser.NewCommand("clean", "Remove untracked files from the working tree.")
+	cleanDryRun := cleanCmd.Flag("n", "dry-run", &argparse.Options{Help: "Only show what would be removed"})
+	cleanForce := cleanCmd.Flag("f", "force", &argparse.Options{Help: "Remove the files. Required unless clean.requireForce is false"})
+	cleanDirs := cleanCmd.Flag("d", "directories", &argparse.Options{Help: "Also remove untracked directories"})
+	cleanIgnored := cleanCmd.Flag("x", "ignored", &argparse.Options{Help: "Also remove ignored files"})
+	cleanOnlyIgnored := cleanCmd.Flag("X", "only-ignored", &argparse.Options{Help: "Remove only ignored files"})
+	cleanExclude := cleanCmd.StringList("e", "exclude", &argparse.Options{Help: "Keep the files matching this ignore pattern too. Can be repeated."})
+
+	mvCmd := parser.NewCommand("mv", "Move or rename a file or directory.")
+	mvSources := mvCmd.StringList("s", "source", &argparse.Options{Required: true, Help: "A tracked file or directory to move. Can be repeated."})
+	mvDest := mvCmd.StringPositional(&argparse.Options{Required: true, Help: "The new name, or the directory to move the sources into"})
+	mvForce := mvCmd.Flag("f", "force", &argparse.Options{Help: "Overwrite existing files"})
+	mvSkipErrors := mvCmd.Flag("k", "skip-errors", &argparse.Options{Help: "Leave out the sources that can't be moved instead of failing"})
+	mvDryRun := mvCmd.Flag("n", "dry-run", &argparse.Options{Help: "Only show what would be moved"})
+
+	grepCmd := parser.NewCommand("grep", "Print lines matching a pattern in tracked files.")
+	grepPattern := grepCmd.StringPositional(&argparse.Options{Required: true, Help: "The RE2 regular expression to search for"})
+	grepTreeish := grepCmd.StringPositional(&argparse.Options{Help: "Search the files of this tree-ish instead of the worktree"})
+	grepCached := grepCmd.Flag("", "cached", &argparse.Options{Help: "Search the files in the index instead of the worktree"})
+	grepPaths := grepCmd.StringList("", "path", &argparse.Options{Help: "Only search this path. Can be repeated."})
+	grepFixed := grepCmd.Flag("F", "fixed-strings", &argparse.Options{Help: "Take the pattern as a literal string"})
+	grepIgnoreCase := grepCmd.Flag("i", "ignore-case", &argparse.Options{Help: "Ignore case differences"})
+	grepWord := grepCmd.Flag("w", "word-regexp", &argparse.Options{Help: "Only match the pattern at word boundaries"})
+	grepLineNumbers := grepCmd.Flag("n", "line-number", &argparse.Options{Help: "Prefix lines with their numbers"})
+	grepFilesOnly := grepCmd.Flag("l", "files-with-matches", &argparse.Options{Help: "Only print the names of files that match"})
+	grepCount := grepCmd.Flag("c", "count", &argparse.Options{Help: "Only print how many lines of each file match"})
+	grepAfter := grepCmd.Int("A", "after-context", &argparse.Options{Help: "Print this many lines after each match"})
+	grepBefore := grepCmd.Int("B", "before-context", &argparse.Options{Help: "Print this many lines before each match"})
+	grepContext := grepCmd.Int("C", "context", &argparse.Options{Help: "Print this many lines around each match"})
+
+	archiveCmd := parser.NewCommand("archive", "Create an archive of the files of a tree.")
+	archiveTreeish := archiveCmd.StringPositional(&argparse.Options{Required: true, Help: "The commit, tag or tree to archive"})
+	archiveFormat := archiveCmd.String("", "format", &argparse.Options{Help: "Archive format: tar, tar.gz or zip. Guessed from --output by default"})
+	archivePrefix := archiveCmd.String("", "prefix", &argparse.Options{Help: "Prepend this to every path, such as project/"})
+	archiveOutput := archiveCmd.String("o", "output", &argparse.Options{Help: "Write the archive to this file instead of standard output"})
+	archivePaths := archiveCmd.StringList("", "path", &argparse.Options{Help: "Only archive this path. Can be repeated."})
+
+	describeCmd := parser.NewCommand("describe", "Name a commit after the nearest tag it can reach.")
+	describeRev := describeCmd.StringPositional(&argparse.Options{Help: "The commit to describe. Defaults to HEAD"})
+	describeTags := describeCmd.Flag("", "tags", &argparse.Options{Help: "Also use lightweight tags"})
+	describeContains := describeCmd.Flag("", "contains", &argparse.Options{Help: "Name the commit after a tag that contains it instead"})
+	describeDirty := describeCmd.Flag("", "dirty", &argparse.Options{Help: "Append -dirty if the worktree or index has changes"})
+	describeLong := describeCmd.Flag("", "long", &argparse.Options{Help: "Show the distance and commit even on a tagged commit"})
+	describeAbbrev := describeCmd.Int("", "abbrev", &argparse.Options{Default: 7, Help: "Digits of the commit id to show; 0 for the tag alone"})
+	describeMatch := describeCmd.StringList("", "match", &argparse.Options{Help: "Only use tags matching this glob. Can be repeated."})
+	describeExclude := describeCmd.StringList("", "exclude", &argparse.Options{Help: "Never use tags matching this glob. Can be repeated."})
 	// ... other commands will be added here
-	err := parser.Parse(os.Args)
+	// Commits and ranges for these take any number of positionals
+	args, cherryPickCommits := positionalList(os.Args, "cherry-pick")
+	args, revertCommits := positionalList(args, "revert")
+	err := parser.Parse(args)
 	if err != nil {
 		fmt.Print(parser.Usage(err))
 		return
@@ -66,19 +272,42 @@ func main() {
 		fmt.Printf("Initialized empty gvcs repository in %s\n", *initPath)
 		break
 	case catFileCmd.Happened():
-		err := commands.CmdCatFile(*catFileType, *catFileObject)
+		var err error
+		mode := ""
+		switch {
+		case *catFileShowType:
+			mode = "t"
+		case *catFileShowSize:
+			mode = "s"
+		case *catFileExists:
+			mode = "e"
+		case *catFilePretty:
+			mode = "p"
+		}
+		switch {
+		case *catFileBatch || *catFileBatchCheck:
+			err = commands.CmdCatFileBatch(*catFileBatch, *catFileFormat, *catFileBuffer)
+		case mode != "":
+			err = commands.CmdCatFile(mode, "", *catFileArg)
+		default:
+			err = commands.CmdCatFile("", *catFileArg, *catFileObject)
+		}
+		var exitErr *commands.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
 		if err != nil {
 			log.Fatalf("Error cat-file: %v", err)
 		}
 		break
 	case hashObjectCmd.Happened():
-		err := commands.CmdHashObject(*hashObjectWrite, *hashObjectType, *hashObjectPath)
+		err := commands.CmdHashObject(*hashObjectWrite, *hashObjectType, *hashObjectPath, *hashObjectStdin, *hashObjectStdinPaths, *hashObjectLiterally, *hashObjectAttrPath, *hashObjectNoFilters)
 		if err != nil {
 			log.Fatalf("Error hash-object: %v", err)
 		}
 		break
 	case logCmd.Happened():
-		err := commands.CmdLog(*logCommit)
+		err := commands.CmdLog(*logCommit, *logPaths, *logFollow, *logFindRenames, *logOneline)
 		if err != nil {
 			log.Fatalf("Error log: %v", err)
 		}
@@ -96,7 +325,11 @@ func main() {
 		}
 		break
 	case showRefCmd.Happened():
-		err := commands.CmdShowRef()
+		err := commands.CmdShowRef(*showRefPattern, *showRefHeads, *showRefTags, *showRefVerify)
+		var exitErr *commands.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
 		if err != nil {
 			log.Fatalf("Error show-ref: %v", err)
 		}
@@ -120,7 +353,7 @@ func main() {
 		}
 		break
 	case statusCmd.Happened():
-		err := commands.CmdStatus()
+		err := commands.CmdStatus(*statusFindRenames, *statusNoRenames)
 		if err != nil {
 			log.Fatalf("Error status: %v", err)
 		}
@@ -149,8 +382,270 @@ func main() {
 			log.Fatalf("Error commit: %v", err)
 		}
 		break
+	case lfsLsFilesCmd.Happened():
+		err := commands.CmdLfsLsFiles(*lfsLsFilesRef)
+		if err != nil {
+			log.Fatalf("Error lfs ls-files: %v", err)
+		}
+		break
+	case lfsPruneCmd.Happened():
+		err := commands.CmdLfsPrune(*lfsPruneDryRun, *lfsPruneVerifyRemote)
+		if err != nil {
+			log.Fatalf("Error lfs prune: %v", err)
+		}
+		break
+	case lfsPushCmd.Happened():
+		err := commands.CmdLfsPush(*lfsPushRef)
+		if err != nil {
+			log.Fatalf("Error lfs push: %v", err)
+		}
+		break
+	case updateRefCmd.Happened():
+		err := commands.CmdUpdateRef(*updateRefName, *updateRefNew, *updateRefOld, *updateRefMessage, *updateRefDelete, *updateRefStdin, *updateRefNoDeref)
+		if err != nil {
+			log.Fatalf("Error update-ref: %v", err)
+		}
+		break
+	case symbolicRefCmd.Happened():
+		err := commands.CmdSymbolicRef(*symbolicRefName, *symbolicRefTarget, *symbolicRefMessage, *symbolicRefShort, *symbolicRefDelete, *symbolicRefQuiet)
+		var exitErr *commands.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
+		if err != nil {
+			log.Fatalf("Error symbolic-ref: %v", err)
+		}
+		break
+	case forEachRefCmd.Happened():
+		err := commands.CmdForEachRef(*forEachRefPatterns, *forEachRefSort, *forEachRefFormat, *forEachRefCount, *forEachRefContains, *forEachRefMerged)
+		if err != nil {
+			log.Fatalf("Error for-each-ref: %v", err)
+		}
+		break
+	case fsckCmd.Happened():
+		err := commands.CmdFsck(*fsckUnreachable, *fsckNoDangling, *fsckStrict)
+		var exitErr *commands.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
+		if err != nil {
+			log.Fatalf("Error fsck: %v", err)
+		}
+		break
+	case pruneCmd.Happened():
+		err := commands.CmdPrune(*pruneExpire, *pruneDryRun, *pruneVerbose)
+		if err != nil {
+			log.Fatalf("Error prune: %v", err)
+		}
+		break
+	case countObjectsCmd.Happened():
+		err := commands.CmdCountObjects(*countObjectsVerbose, *countObjectsHuman, *countObjectsStats, *countObjectsTop)
+		if err != nil {
+			log.Fatalf("Error count-objects: %v", err)
+		}
+		break
+	case revListCmd.Happened():
+		var revisions []string
+		if *revListRevision != "" {
+			revisions = append(revisions, *revListRevision)
+		}
+		revisions = append(revisions, *revListRevisions...)
+		err := commands.CmdRevList(revisions, *revListNot, *revListMaxCount, *revListSince, *revListUntil, *revListAuthor,
+			*revListFirstParent, *revListTopoOrder, *revListDateOrder, *revListCount, *revListObjects, *revListPaths)
+		if err != nil {
+			log.Fatalf("Error rev-list: %v", err)
+		}
+		break
+	case diffCmd.Happened():
+		wordDiff := *diffWordDiff
+		if *diffColorWords {
+			wordDiff = "color"
+		}
+		err := commands.CmdDiff(*diffRevA, *diffRevB, commands.DiffOptions{
+			Cached:      *diffCached,
+			Paths:       *diffPaths,
+			FindRenames: *diffFindRenames,
+			NoRenames:   *diffNoRenames,
+			FindCopies:  *diffFindCopies,
+			RenameLimit: *diffRenameLimit,
+			Context:     *diffUnified,
+			WordDiff:    wordDiff,
+			Stat:        *diffStat,
+			Numstat:     *diffNumstat,
+			Shortstat:   *diffShortstat,
+			NameOnly:    *diffNameOnly,
+			NameStatus:  *diffNameStatus,
+			Patch:       *diffPatch,
+		})
+		if err != nil {
+			log.Fatalf("Error diff: %v", err)
+		}
+		break
+	case showCmd.Happened():
+		err := commands.CmdShow(*showObject, commands.DiffOptions{
+			NoRenames:  *showNoRenames,
+			Context:    *showUnified,
+			WordDiff:   *showWordDiff,
+			Stat:       *showStat,
+			Numstat:    *showNumstat,
+			Shortstat:  *showShortstat,
+			NameOnly:   *showNameOnly,
+			NameStatus: *showNameStatus,
+			Patch:      *showPatch,
+		})
+		if err != nil {
+			log.Fatalf("Error show: %v", err)
+		}
+		break
+	case blameCmd.Happened():
+		err := commands.CmdBlame(*blameFile, *blameRev, *blameRanges, *blamePorcelain, *blameIgnoreWhitespace, *blameMoves)
+		if err != nil {
+			log.Fatalf("Error blame: %v", err)
+		}
+		break
+	case cherryPickCmd.Happened():
+		err := commands.CmdCherryPick(cherryPickCommits, *cherryPickRecordOrigin, *cherryPickContinue, *cherryPickAbort, *cherryPickSkip)
+		if err != nil {
+			log.Fatalf("Error cherry-pick: %v", err)
+		}
+		break
+	case revertCmd.Happened():
+		err := commands.CmdRevert(revertCommits, *revertContinue, *revertAbort, *revertSkip)
+		if err != nil {
+			log.Fatalf("Error revert: %v", err)
+		}
+		break
+	case rebaseCmd.Happened():
+		err := commands.CmdRebase(*rebaseUpstream, *rebaseOnto, *rebaseExec, *rebaseAutosquash, *rebaseTodoFile, *rebaseContinue, *rebaseAbort, *rebaseSkip)
+		if err != nil {
+			log.Fatalf("Error rebase: %v", err)
+		}
+		break
+
+	case stashPushCmd.Happened():
+		err := commands.CmdStashPush(*stashPushMessage, *stashPushPaths, *stashPushUntracked)
+		if err != nil {
+			log.Fatalf("Error stash push: %v", err)
+		}
+		break
+	case stashListCmd.Happened():
+		err := commands.CmdStashList()
+		if err != nil {
+			log.Fatalf("Error stash list: %v", err)
+		}
+		break
+	case stashShowCmd.Happened():
+		err := commands.CmdStashShow(*stashShowEntry, *stashShowPatch)
+		if err != nil {
+			log.Fatalf("Error stash show: %v", err)
+		}
+		break
+	case stashApplyCmd.Happened():
+		err := commands.CmdStashApply(*stashApplyEntry)
+		if err != nil {
+			log.Fatalf("Error stash apply: %v", err)
+		}
+		break
+	case stashPopCmd.Happened():
+		err := commands.CmdStashPop(*stashPopEntry)
+		if err != nil {
+			log.Fatalf("Error stash pop: %v", err)
+		}
+		break
+	case stashDropCmd.Happened():
+		err := commands.CmdStashDrop(*stashDropEntry)
+		if err != nil {
+			log.Fatalf("Error stash drop: %v", err)
+		}
+		break
+	case stashBranchCmd.Happened():
+		err := commands.CmdStashBranch(*stashBranchName, *stashBranchEntry)
+		if err != nil {
+			log.Fatalf("Error stash branch: %v", err)
+		}
+		break
+
+	case cleanCmd.Happened():
+		err := commands.CmdClean(*cleanDryRun, *cleanForce, *cleanDirs, *cleanIgnored, *cleanOnlyIgnored, *cleanExclude)
+		if err != nil {
+			log.Fatalf("Error clean: %v", err)
+		}
+		break
+	case mvCmd.Happened():
+		err := commands.CmdMv(*mvSources, *mvDest, *mvForce, *mvSkipErrors, *mvDryRun)
+		if err != nil {
+			log.Fatalf("Error mv: %v", err)
+		}
+		break
+	case grepCmd.Happened():
+		before, after := *grepBefore, *grepAfter
+		if before == 0 {
+			before = *grepContext
+		}
+		if after == 0 {
+			after = *grepContext
+		}
+		err := commands.CmdGrep(*grepPattern, *grepTreeish, commands.GrepOptions{
+			Cached:      *grepCached,
+			Paths:       *grepPaths,
+			Fixed:       *grepFixed,
+			IgnoreCase:  *grepIgnoreCase,
+			Word:        *grepWord,
+			LineNumbers: *grepLineNumbers,
+			FilesOnly:   *grepFilesOnly,
+			Count:       *grepCount,
+			Before:      before,
+			After:       after,
+		})
+		var exitErr *commands.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
+		if err != nil {
+			log.Fatalf("Error grep: %v", err)
+		}
+		break
+	case archiveCmd.Happened():
+		err := commands.CmdArchive(*archiveTreeish, *archiveFormat, *archivePrefix, *archiveOutput, *archivePaths)
+		if err != nil {
+			log.Fatalf("Error archive: %v", err)
+		}
+		break
+	case describeCmd.Happened():
+		err := commands.CmdDescribe(*describeRev, commands.DescribeOptions{
+			Tags:     *describeTags,
+			Contains: *describeContains,
+			Dirty:    *describeDirty,
+			Long:     *describeLong,
+			Abbrev:   *describeAbbrev,
+			Match:    *describeMatch,
+			Exclude:  *describeExclude,
+		})
+		if err != nil {
+			log.Fatalf("Error describe: %v", err)
+		}
+		break
 	// ... other command cases will be here
 	default:
 		log.Fatal("Bad command.")
 	}
 }
+
+// positionalList takes the arguments that are not options out of the
+// command line of command, which argparse can only give a fixed number of
+// positionals. All options of command must be flags without a value.
+func positionalList(args []string, command string) ([]string, []string) {
+	if len(args) < 2 || args[1] != command {
+		return args, nil
+	}
+	kept := args[:2:2]
+	var positionals []string
+	for _, arg := range args[2:] {
+		if strings.HasPrefix(arg, "-") {
+			kept = append(kept, arg)
+		} else {
+			positionals = append(positionals, arg)
+		}
+	}
+	return kept, positionals
+}
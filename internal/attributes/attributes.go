@@ -0,0 +1,210 @@
+package attributes
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/index"
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// Attribute states used in the values returned by CheckAttr.
+const (
+	AttrSet   = "set"
+	AttrUnset = "unset"
+)
+
+type gitattributesRule struct {
+	Pattern string
+	Attrs   map[string]string // "" value means the attribute is reset to unspecified
+}
+
+func gitattributesParse(reader io.Reader) []gitattributesRule {
+	var rules []gitattributesRule
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		rule := gitattributesRule{Pattern: fields[0], Attrs: make(map[string]string)}
+		for _, attr := range fields[1:] {
+			switch {
+			case strings.HasPrefix(attr, "-"):
+				rule.Attrs[attr[1:]] = AttrUnset
+			case strings.HasPrefix(attr, "!"):
+				rule.Attrs[attr[1:]] = ""
+			case strings.Contains(attr, "="):
+				parts := strings.SplitN(attr, "=", 2)
+				rule.Attrs[parts[0]] = parts[1]
+			default:
+				rule.Attrs[attr] = AttrSet
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+type GitAttributes struct {
+	Absolute []gitattributesRule
+	Scoped   map[string][]gitattributesRule // Key is the directory path
+}
+
+// AttributesRead collects attribute rules from .git/info/attributes and from
+// every .gitattributes file known to the index. The worktree copy of a
+// .gitattributes file wins over the staged one, so freshly edited rules apply
+// before they are added.
+func AttributesRead(gitRepo *repo.GitRepository) (*GitAttributes, error) {
+	attrs := &GitAttributes{
+		Scoped: make(map[string][]gitattributesRule),
+	}
+
+	infoFile := repo.RepoPath(gitRepo, "info", "attributes")
+	if f, err := os.Open(infoFile); err == nil {
+		attrs.Absolute = append(attrs.Absolute, gitattributesParse(f)...)
+		f.Close()
+	}
+
+	idx, err := index.IndexRead(gitRepo)
+	if err != nil {
+		return nil, err
+	}
+
+	staged := make(map[string]string) // dir -> blob SHA
+	for _, entry := range idx.Entries {
+		if filepath.Base(entry.Name) == ".gitattributes" {
+			dirName := filepath.Dir(entry.Name)
+			if dirName == "." {
+				dirName = ""
+			}
+			staged[dirName] = entry.SHA
+		}
+	}
+	// The root file is honoured even before it has been staged.
+	if _, ok := staged[""]; !ok {
+		staged[""] = ""
+	}
+
+	for dirName, sha := range staged {
+		worktreeFile := filepath.Join(gitRepo.Worktree, dirName, ".gitattributes")
+		if data, err := os.ReadFile(worktreeFile); err == nil {
+			attrs.Scoped[dirName] = gitattributesParse(bytes.NewReader(data))
+			continue
+		}
+		if sha == "" {
+			continue
+		}
+		obj, err := objects.ObjectRead(gitRepo, sha)
+		if err != nil {
+			return nil, err
+		}
+		data, err := obj.Serialize()
+		if err != nil {
+			return nil, err
+		}
+		attrs.Scoped[dirName] = gitattributesParse(bytes.NewReader(data))
+	}
+
+	return attrs, nil
+}
+
+// AttributesFromTree collects attribute rules from the .gitattributes files
+// recorded in a flattened tree, as returned by objects.TreeToMap.
+func AttributesFromTree(gitRepo *repo.GitRepository, tree map[string]string) (*GitAttributes, error) {
+	attrs := &GitAttributes{
+		Scoped: make(map[string][]gitattributesRule),
+	}
+	for path, sha := range tree {
+		if filepath.Base(path) != ".gitattributes" {
+			continue
+		}
+		obj, err := objects.ObjectRead(gitRepo, sha)
+		if err != nil {
+			return nil, err
+		}
+		data, err := obj.Serialize()
+		if err != nil {
+			return nil, err
+		}
+		dirName := filepath.Dir(path)
+		if dirName == "." {
+			dirName = ""
+		}
+		attrs.Scoped[dirName] = gitattributesParse(bytes.NewReader(data))
+	}
+	return attrs, nil
+}
+
+// attrMatch reports whether a pattern from the .gitattributes file in dir
+// applies to path. Patterns without a slash match the basename at any depth;
+// other patterns, including those with a leading slash, are anchored to dir.
+func attrMatch(pattern, dir, path string) bool {
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	rel := path
+	if dir != "" {
+		prefix := dir + string(os.PathSeparator)
+		if !strings.HasPrefix(path, prefix) {
+			return false
+		}
+		rel = path[len(prefix):]
+	}
+
+	if !anchored {
+		matched, _ := filepath.Match(pattern, filepath.Base(rel))
+		return matched
+	}
+
+	pattern = filepath.FromSlash(pattern)
+	if strings.HasSuffix(pattern, string(os.PathSeparator)+"**") {
+		return strings.HasPrefix(rel, strings.TrimSuffix(pattern, "**"))
+	}
+	matched, _ := filepath.Match(pattern, rel)
+	return matched
+}
+
+// CheckAttr returns the attributes that apply to path. Values are AttrSet,
+// AttrUnset or the string assigned with attr=value.
+func CheckAttr(rules *GitAttributes, path string) map[string]string {
+	ret := make(map[string]string)
+	apply := func(rule gitattributesRule) {
+		for name, value := range rule.Attrs {
+			if value == "" {
+				delete(ret, name)
+			} else {
+				ret[name] = value
+			}
+		}
+	}
+
+	// Scoped rules are applied from the root down to the file's directory,
+	// so deeper .gitattributes files win.
+	dir := ""
+	parts := strings.Split(path, string(os.PathSeparator))
+	for i := 0; i < len(parts); i++ {
+		for _, rule := range rules.Scoped[dir] {
+			if attrMatch(rule.Pattern, dir, path) {
+				apply(rule)
+			}
+		}
+		if i < len(parts)-1 {
+			dir = filepath.Join(dir, parts[i])
+		}
+	}
+
+	// Absolute rules (info/attributes) have the highest precedence.
+	for _, rule := range rules.Absolute {
+		if attrMatch(rule.Pattern, "", path) {
+			apply(rule)
+		}
+	}
+
+	return ret
+}
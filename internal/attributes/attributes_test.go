@@ -0,0 +1,67 @@
+package attributes
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAttrMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		dir     string
+		path    string
+		want    bool
+	}{
+		{"*.bin", "", "a.bin", true},
+		{"*.bin", "", "deep/down/a.bin", true},
+		{"*.bin", "", "a.bin.txt", false},
+		{"*.bin", "sub", "sub/x/a.bin", true},
+		{"*.bin", "sub", "other/a.bin", false},
+		{"/top.bin", "", "top.bin", true},
+		{"/top.bin", "", "sub/top.bin", false},
+		{"assets/*.png", "", "assets/a.png", true},
+		{"assets/*.png", "", "assets/icons/a.png", false},
+		{"assets/*.png", "", "sub/assets/a.png", false},
+		{"assets/*.png", "sub", "sub/assets/a.png", true},
+		{"media/**", "", "media/a/b/c.mp4", true},
+		{"media/**", "", "other/media/c.mp4", false},
+	}
+
+	for _, tt := range tests {
+		if got := attrMatch(tt.pattern, tt.dir, tt.path); got != tt.want {
+			t.Errorf("attrMatch(%q, %q, %q): expected %v, got %v", tt.pattern, tt.dir, tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestCheckAttr(t *testing.T) {
+	rules := &GitAttributes{
+		Absolute: gitattributesParse(strings.NewReader("*.iso -filter\n")),
+		Scoped: map[string][]gitattributesRule{
+			"":    gitattributesParse(strings.NewReader("# large files\n*.bin filter=lfs diff\n*.iso filter=lfs\n*.txt text eol=lf\n")),
+			"sub": gitattributesParse(strings.NewReader("*.bin -diff\n*.txt !eol\n")),
+		},
+	}
+
+	tests := []struct {
+		path string
+		want map[string]string
+	}{
+		{"a.bin", map[string]string{"filter": "lfs", "diff": AttrSet}},
+		// Deeper files override the root
+		{"sub/a.bin", map[string]string{"filter": "lfs", "diff": AttrUnset}},
+		// !attr resets a value set higher up
+		{"sub/a.txt", map[string]string{"text": AttrSet}},
+		{"a.txt", map[string]string{"text": AttrSet, "eol": "lf"}},
+		// info/attributes wins over every .gitattributes file
+		{"sub/a.iso", map[string]string{"filter": AttrUnset}},
+		{"main.go", map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		if got := CheckAttr(rules, tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("CheckAttr(%q): expected %v, got %v", tt.path, tt.want, got)
+		}
+	}
+}
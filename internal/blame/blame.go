@@ -0,0 +1,510 @@
+// Package blame attributes each line of a file to the commit that last
+// changed it.
+package blame
+
+import (
+	"container/heap"
+	"sort"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/diff"
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+	"github.com/Notwinner0/gvcs/internal/revwalk"
+)
+
+// MoveScore is how many alphanumeric characters a run of lines needs
+// before Options.Moves takes it for lines moved within the file.
+const MoveScore = 20
+
+// Options configures Blame.
+type Options struct {
+	Ranges           []Range // the lines to blame; all of them if empty
+	IgnoreWhitespace bool    // compare lines ignoring all whitespace
+	Moves            bool    // find lines moved or copied within the file
+	Renames          diff.RenameOptions
+}
+
+// Entry is a run of lines blamed on one commit.
+type Entry struct {
+	SHA      string // the commit, or "" for lines not yet committed
+	Commit   *objects.GitCommit
+	Path     string // the file's path in that commit
+	Line     int    // where the lines start in that commit's version
+	Final    int    // where they start in the blamed file
+	Count    int
+	Boundary bool // the commit has no parents, so it may not have written the lines
+
+	// The version of the file in the commit's first parent that has one,
+	// if any.
+	Previous     string
+	PreviousPath string
+}
+
+// origin is a version of the file that lines are suspected to come from.
+type origin struct {
+	commit   *revwalk.Commit // nil for the uncommitted version
+	path     string
+	blob     string
+	lines    []string
+	keys     []string // lines as compared
+	pending  []*entry // lines to pass on to the parents
+	previous *origin
+}
+
+// entry is a run of lines of the blamed file and where they are in the
+// version suspected of them.
+type entry struct {
+	final, line, count int
+	origin             *origin
+}
+
+// blamer passes lines down history until each reaches the version that
+// introduced it.
+type blamer struct {
+	gitRepo *repo.GitRepository
+	opts    Options
+	walker  *revwalk.Walker
+	final   []string
+	origins map[string]*origin // by commit and path
+	queue   originQueue
+	seq     int
+	blamed  []*entry
+}
+
+// Blame attributes the lines of data, the content of path in commit, to
+// the commits that introduced them. If uncommitted is set, data is instead
+// a modified version with commit as its parent, and lines it adds are
+// blamed on no commit.
+//
+// Lines go from a version to each parent's version of the file in turn,
+// through a diff, or all at once where the file is unchanged. A file that
+// is not in a parent is looked for among the files the commit deleted,
+// as a rename. Lines a version did not get from a parent are its own.
+func Blame(gitRepo *repo.GitRepository, commit, path string, data []byte, uncommitted bool, opts Options) ([]Entry, error) {
+	b := &blamer{
+		gitRepo: gitRepo,
+		opts:    opts,
+		walker:  revwalk.New(gitRepo, revwalk.Options{}),
+		final:   splitLines(data),
+		origins: make(map[string]*origin),
+	}
+
+	start := &origin{path: path, lines: b.final}
+	if !uncommitted {
+		c, err := b.walker.Lookup(commit)
+		if err != nil {
+			return nil, err
+		}
+		blob, err := objects.TreeLookup(b.gitRepo, commitTree(c), path)
+		if err != nil {
+			return nil, err
+		}
+		start = b.origin(c, path, blob)
+		start.lines = b.final
+	}
+	ranges := opts.Ranges
+	if len(ranges) == 0 && len(b.final) > 0 {
+		ranges = []Range{{0, len(b.final)}}
+	}
+	for _, r := range ranges {
+		start.pending = append(start.pending, &entry{final: r.Start, line: r.Start, count: r.End - r.Start, origin: start})
+	}
+
+	if uncommitted {
+		c, err := b.walker.Lookup(commit)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.pass(start, []*revwalk.Commit{c}); err != nil {
+			return nil, err
+		}
+	} else {
+		b.push(start)
+	}
+	for b.queue.Len() > 0 {
+		o := heap.Pop(&b.queue).(queued).origin
+		parents := make([]*revwalk.Commit, len(o.commit.Parents))
+		for i, p := range o.commit.Parents {
+			var err error
+			if parents[i], err = b.walker.Lookup(p); err != nil {
+				return nil, err
+			}
+		}
+		if err := b.pass(o, parents); err != nil {
+			return nil, err
+		}
+	}
+	return b.entries(), nil
+}
+
+// origin returns the version of path in a commit, creating it on first use.
+func (b *blamer) origin(c *revwalk.Commit, path, blob string) *origin {
+	key := c.SHA + ":" + path
+	o, ok := b.origins[key]
+	if !ok {
+		o = &origin{commit: c, path: path, blob: blob}
+		b.origins[key] = o
+	}
+	return o
+}
+
+// push queues an origin to pass on its lines, newest commit first.
+func (b *blamer) push(o *origin) {
+	b.seq++
+	heap.Push(&b.queue, queued{o, b.seq})
+}
+
+// assign gives lines to an origin, queueing it if it had none waiting.
+func (b *blamer) assign(o *origin, e *entry) {
+	e.origin = o
+	if len(o.pending) == 0 {
+		b.push(o)
+	}
+	o.pending = append(o.pending, e)
+}
+
+// pass gives the lines pending on an origin to the versions of the file
+// in parents, and blames it for the rest.
+func (b *blamer) pass(o *origin, parents []*revwalk.Commit) error {
+	entries := o.pending
+	o.pending = nil
+	sort.Slice(entries, func(i, j int) bool { return entries[i].line < entries[j].line })
+
+	var sources []*origin
+	for _, p := range parents {
+		po, err := b.find(o, p)
+		if err != nil {
+			return err
+		}
+		if po == nil {
+			continue
+		}
+		if po.blob == o.blob {
+			// Unchanged from this parent, which is where all the lines came from
+			for _, e := range entries {
+				b.assign(po, e)
+			}
+			return nil
+		}
+		same := false
+		for _, s := range sources {
+			same = same || s.blob == po.blob
+		}
+		if !same {
+			sources = append(sources, po)
+		}
+	}
+
+	for _, po := range sources {
+		if len(entries) == 0 {
+			break
+		}
+		if o.previous == nil {
+			o.previous = po
+		}
+		var err error
+		if entries, err = b.passDiff(o, po, entries); err != nil {
+			return err
+		}
+	}
+
+	if b.opts.Moves && len(entries) > 0 {
+		var small []*entry
+		entries, small = b.filterSmall(entries)
+		for _, po := range sources {
+			if len(entries) == 0 {
+				break
+			}
+			var err error
+			if entries, small, err = b.passMoves(o, po, entries, small); err != nil {
+				return err
+			}
+		}
+		entries = append(entries, small...)
+	}
+	b.blamed = append(b.blamed, entries...)
+	return nil
+}
+
+// find returns the version of o's file in a parent commit, following a
+// rename, or nil if the parent does not have it.
+func (b *blamer) find(o *origin, p *revwalk.Commit) (*origin, error) {
+	oldTree := commitTree(p)
+	if o.commit == nil {
+		blob, err := objects.TreeLookup(b.gitRepo, oldTree, o.path)
+		if err != nil || blob == "" {
+			return nil, err
+		}
+		return b.origin(p, o.path, blob), nil
+	}
+
+	tree := commitTree(o.commit)
+	changes, err := diff.TreeDiff(b.gitRepo, oldTree, tree, []string{o.path})
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range changes {
+		if c.NewPath != o.path {
+			continue
+		}
+		if c.Status != 'A' {
+			return b.origin(p, o.path, c.OldSHA), nil
+		}
+		return b.findRename(p, oldTree, tree, c)
+	}
+	return b.origin(p, o.path, o.blob), nil
+}
+
+// findRename returns the file a commit renamed to the path that added
+// adds, or nil if it was new.
+func (b *blamer) findRename(p *revwalk.Commit, oldTree, tree string, added diff.Change) (*origin, error) {
+	all, err := diff.TreeDiff(b.gitRepo, oldTree, tree, nil)
+	if err != nil {
+		return nil, err
+	}
+	candidates := []diff.Change{added}
+	for _, c := range all {
+		if c.Status == 'D' {
+			candidates = append(candidates, c)
+		}
+	}
+	renamed, _, err := diff.DetectRenames(b.gitRepo, candidates, b.opts.Renames)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range renamed {
+		if c.Status == 'R' && c.NewPath == added.NewPath {
+			return b.origin(p, c.OldPath, c.OldSHA), nil
+		}
+	}
+	return nil, nil
+}
+
+// passDiff gives a parent version the lines of entries that a diff finds
+// unchanged in it, and returns the rest.
+func (b *blamer) passDiff(o, po *origin, entries []*entry) ([]*entry, error) {
+	oldKeys, err := b.keys(po)
+	if err != nil {
+		return nil, err
+	}
+	newKeys, err := b.keys(o)
+	if err != nil {
+		return nil, err
+	}
+	from := make([]int, len(newKeys))
+	for i := range from {
+		from[i] = -1
+	}
+	for _, e := range diff.Lines(oldKeys, newKeys) {
+		if e.Op == diff.Equal {
+			from[e.NewLine] = e.OldLine
+		}
+	}
+
+	var rest []*entry
+	for _, e := range entries {
+		// Split the entry where lines switch between kept and changed, or
+		// kept lines are not together in the parent
+		for i := 0; i < e.count; {
+			j := i + 1
+			for j < e.count && (from[e.line+j] == -1) == (from[e.line+i] == -1) &&
+				(from[e.line+i] == -1 || from[e.line+j] == from[e.line+i]+j-i) {
+				j++
+			}
+			part := &entry{final: e.final + i, line: e.line + i, count: j - i, origin: o}
+			if from[e.line+i] == -1 {
+				rest = append(rest, part)
+			} else {
+				part.line = from[e.line+i]
+				b.assign(po, part)
+			}
+			i = j
+		}
+	}
+	return rest, nil
+}
+
+// passMoves gives a parent version the runs of lines of entries found
+// anywhere in it, best first, as long as they score above MoveScore. It
+// returns the entries left, and adds the pieces too small to look for to
+// small.
+func (b *blamer) passMoves(o, po *origin, entries, small []*entry) ([]*entry, []*entry, error) {
+	parentKeys, err := b.keys(po)
+	if err != nil {
+		return nil, nil, err
+	}
+	var left []*entry
+	for len(entries) > 0 {
+		var next []*entry
+		for _, e := range entries {
+			begin, at, count := b.findMove(o, e, parentKeys)
+			if count == 0 || b.score(e.final+begin, count) <= MoveScore {
+				left = append(left, e)
+				continue
+			}
+			if begin > 0 {
+				next = append(next, &entry{final: e.final, line: e.line, count: begin, origin: o})
+			}
+			b.assign(po, &entry{final: e.final + begin, line: at, count: count})
+			if end := begin + count; end < e.count {
+				next = append(next, &entry{final: e.final + end, line: e.line + end, count: e.count - end, origin: o})
+			}
+		}
+		var tooSmall []*entry
+		entries, tooSmall = b.filterSmall(next)
+		small = append(small, tooSmall...)
+	}
+	return left, small, nil
+}
+
+// findMove diffs the whole parent version against an entry's lines and
+// returns the best scoring run of lines they share: where it begins in the
+// entry, where it is in the parent, and its length.
+func (b *blamer) findMove(o *origin, e *entry, parentKeys []string) (begin, at, count int) {
+	chunk := o.keys[e.line : e.line+e.count]
+	edits := diff.Lines(parentKeys, chunk)
+	best := 0
+	for i := 0; i < len(edits); {
+		if edits[i].Op != diff.Equal {
+			i++
+			continue
+		}
+		j := i
+		for j < len(edits) && edits[j].Op == diff.Equal {
+			j++
+		}
+		first := edits[i]
+		if score := b.score(e.final+first.NewLine, j-i); score >= best {
+			best = score
+			begin, at, count = first.NewLine, first.OldLine, j-i
+		}
+		i = j
+	}
+	return begin, at, count
+}
+
+// filterSmall splits entries into those worth looking for as moved lines
+// and those scoring too low to be told apart from chance matches.
+func (b *blamer) filterSmall(entries []*entry) (keep, small []*entry) {
+	for _, e := range entries {
+		if b.score(e.final, e.count) <= MoveScore {
+			small = append(small, e)
+		} else {
+			keep = append(keep, e)
+		}
+	}
+	return keep, small
+}
+
+// score rates lines of the blamed file by how distinctive they are: one
+// more than the number of alphanumeric characters in them.
+func (b *blamer) score(final, count int) int {
+	score := 1
+	for _, line := range b.final[final : final+count] {
+		for _, ch := range []byte(line) {
+			if 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9' {
+				score++
+			}
+		}
+	}
+	return score
+}
+
+// keys returns the lines of a version as they are compared, reading the
+// version first if needed.
+func (b *blamer) keys(o *origin) ([]string, error) {
+	if o.keys != nil {
+		return o.keys, nil
+	}
+	if o.lines == nil {
+		data, err := diff.BlobRead(b.gitRepo, o.blob)
+		if err != nil {
+			return nil, err
+		}
+		o.lines = splitLines(data)
+	}
+	o.keys = o.lines
+	if b.opts.IgnoreWhitespace {
+		o.keys = make([]string, len(o.lines))
+		for i, line := range o.lines {
+			o.keys[i] = strings.Join(strings.Fields(line), "")
+		}
+	}
+	return o.keys, nil
+}
+
+// entries returns the blame in order of the blamed file, with runs that
+// continue each other in the same version joined.
+func (b *blamer) entries() []Entry {
+	sort.Slice(b.blamed, func(i, j int) bool { return b.blamed[i].final < b.blamed[j].final })
+	var result []Entry
+	var last *entry
+	for _, e := range b.blamed {
+		if last != nil && last.origin == e.origin && last.final+last.count == e.final && last.line+last.count == e.line {
+			result[len(result)-1].Count += e.count
+			last = e
+			continue
+		}
+		last = e
+		o := e.origin
+		r := Entry{Path: o.path, Line: e.line, Final: e.final, Count: e.count}
+		if o.commit != nil {
+			r.SHA = o.commit.SHA
+			r.Commit = o.commit.Commit
+			r.Boundary = len(o.commit.Parents) == 0
+		}
+		if o.previous != nil {
+			r.Previous = o.previous.commit.SHA
+			r.PreviousPath = o.previous.path
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+// commitTree returns the tree a commit records.
+func commitTree(c *revwalk.Commit) string {
+	if tree := c.Commit.Kvlm["tree"]; len(tree) > 0 {
+		return tree[0]
+	}
+	return ""
+}
+
+// splitLines splits content into lines that keep their newlines.
+func splitLines(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// queued is an origin in the queue, with the order it was added in to
+// break ties.
+type queued struct {
+	origin *origin
+	seq    int
+}
+
+// originQueue orders origins newest commit first.
+type originQueue []queued
+
+func (q originQueue) Len() int { return len(q) }
+func (q originQueue) Less(i, j int) bool {
+	a, b := q[i].origin.commit.Time, q[j].origin.commit.Time
+	if !a.Equal(b) {
+		return a.After(b)
+	}
+	return q[i].seq < q[j].seq
+}
+func (q originQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *originQueue) Push(x interface{}) {
+	*q = append(*q, x.(queued))
+}
+func (q *originQueue) Pop() interface{} {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
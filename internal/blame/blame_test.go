@@ -0,0 +1,166 @@
+package blame
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// testHistory writes commits into a new repository and names them by SHA.
+type testHistory struct {
+	t       *testing.T
+	gitRepo *repo.GitRepository
+	shas    map[string]string
+	names   map[string]string
+}
+
+func newTestHistory(t *testing.T) *testHistory {
+	gitRepo, err := repo.RepoCreate(t.TempDir())
+	if err != nil {
+		t.Fatalf("RepoCreate() failed: %v", err)
+	}
+	return &testHistory{t: t, gitRepo: gitRepo, shas: map[string]string{}, names: map[string]string{}}
+}
+
+// commit writes a commit of a flat tree of files at the given time.
+func (h *testHistory) commit(name string, when int64, files map[string]string, parents ...string) {
+	h.t.Helper()
+	tree := &objects.GitTree{}
+	for path, content := range files {
+		sha, err := objects.ObjectHash(strings.NewReader(content), "blob", h.gitRepo)
+		if err != nil {
+			h.t.Fatalf("ObjectHash() failed: %v", err)
+		}
+		tree.Items = append(tree.Items, objects.GitTreeLeaf{Mode: "100644", Path: path, SHA: sha})
+	}
+	treeSHA, err := objects.ObjectWrite(tree, h.gitRepo)
+	if err != nil {
+		h.t.Fatalf("ObjectWrite() failed: %v", err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "tree %s\n", treeSHA)
+	for _, p := range parents {
+		fmt.Fprintf(&b, "parent %s\n", h.shas[p])
+	}
+	fmt.Fprintf(&b, "author A <a@x> %d +0000\n", when)
+	fmt.Fprintf(&b, "committer C <c@x> %d +0000\n\n%s\n", when, name)
+	sha, err := objects.ObjectHash(strings.NewReader(b.String()), "commit", h.gitRepo)
+	if err != nil {
+		h.t.Fatalf("ObjectHash() failed: %v", err)
+	}
+	h.shas[name] = sha
+	h.names[sha] = name
+}
+
+// blame returns which commit each line of path in a commit is blamed on,
+// as "commit:line" in the commit's version, or "-" where uncommitted.
+func (h *testHistory) blame(commit, path, data string, uncommitted bool, opts Options) string {
+	h.t.Helper()
+	entries, err := Blame(h.gitRepo, h.shas[commit], path, []byte(data), uncommitted, opts)
+	if err != nil {
+		h.t.Fatalf("Blame() failed: %v", err)
+	}
+	var got []string
+	for _, e := range entries {
+		for i := 0; i < e.Count; i++ {
+			if e.SHA == "" {
+				got = append(got, "-")
+				continue
+			}
+			got = append(got, fmt.Sprintf("%s:%d", h.names[e.SHA], e.Line+i+1))
+		}
+	}
+	return strings.Join(got, " ")
+}
+
+func TestBlame(t *testing.T) {
+	// a - b - d - e
+	//  \     /
+	//   c --
+	// b changes a line and d merges in c, which adds one; e reorders the
+	// file and reindents a line, then renames it
+	alpha := "alpha first line of the file\n"
+	beta := "beta second line of the file\n"
+	gamma := "gamma third line of the file\n"
+	h := newTestHistory(t)
+	h.commit("a", 100, map[string]string{"f": alpha + beta + gamma})
+	h.commit("b", 200, map[string]string{"f": alpha + "changed\n" + gamma}, "a")
+	h.commit("c", 300, map[string]string{"f": alpha + beta + gamma + "added\n"}, "a")
+	h.commit("d", 400, map[string]string{"f": alpha + "changed\n" + gamma + "added\n"}, "b", "c")
+	moved := gamma + "  " + alpha + "changed\n" + "added\n"
+	h.commit("e", 500, map[string]string{"g": moved}, "d")
+
+	tests := []struct {
+		name        string
+		commit      string
+		data        string
+		uncommitted bool
+		opts        Options
+		want        string
+	}{
+		{"merge", "d", alpha + "changed\n" + gamma + "added\n", false, Options{}, "a:1 b:2 a:3 c:4"},
+		{"renamed and moved", "e", moved, false, Options{}, "a:3 e:2 e:3 c:4"},
+		{"whitespace", "e", moved, false, Options{IgnoreWhitespace: true}, "e:1 a:1 b:2 c:4"},
+		{"moves", "e", moved, false, Options{Moves: true, IgnoreWhitespace: true}, "a:3 a:1 b:2 c:4"},
+		{"range", "d", alpha + "changed\n" + gamma + "added\n", false, Options{Ranges: []Range{{1, 3}}}, "b:2 a:3"},
+		{"uncommitted", "d", alpha + "changed\n" + "new\n" + gamma + "added\n", true, Options{}, "a:1 b:2 - a:3 c:4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "f"
+			if tt.commit == "e" {
+				path = "g"
+			}
+			if got := h.blame(tt.commit, path, tt.data, tt.uncommitted, tt.opts); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseRanges(t *testing.T) {
+	data := []byte("one\ntwo\nthree\nfour\nfive\n")
+	tests := []struct {
+		name  string
+		specs []string
+		want  []Range
+		err   string
+	}{
+		{"numbers", []string{"2,3"}, []Range{{1, 3}}, ""},
+		{"to end", []string{"4"}, []Range{{3, 5}}, ""},
+		{"past end", []string{"4,9"}, []Range{{3, 5}}, ""},
+		{"count", []string{"2,+2"}, []Range{{1, 3}}, ""},
+		{"count back", []string{"3,-2"}, []Range{{1, 3}}, ""},
+		{"reversed", []string{"3,1"}, []Range{{0, 3}}, ""},
+		{"regex", []string{"/t/,/f/"}, []Range{{1, 4}}, ""},
+		{"regex after previous", []string{"1,2", "/t/,+1"}, []Range{{0, 3}}, ""},
+		{"joined", []string{"4,5", "1,2", "2,3"}, []Range{{0, 5}}, ""},
+		{"zero", []string{"0,2"}, nil, "-L invalid line number: 0"},
+		{"empty", []string{"2,+0"}, nil, "-L invalid empty range"},
+		{"too far", []string{"6"}, nil, "file f has only 5 lines"},
+		{"no match", []string{"/six/"}, nil, "-L parameter 'six' starting at line 1: No match"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRanges(tt.specs, data, "f")
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("Expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRanges() failed: %v", err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
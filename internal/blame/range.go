@@ -0,0 +1,149 @@
+package blame
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Range is a run of lines, from Start up to but not including End,
+// counting from zero.
+type Range struct {
+	Start, End int
+}
+
+// ParseRanges parses the arguments of -L options against the content of
+// the file at path, returning the ranges sorted with overlaps joined. Each is
+// "<start>,<end>", where <start> is a line number or /regex/, and <end> is
+// a line number, /regex/, +<count> or -<count> lines from <start>. An
+// empty <start> is the first line and an empty or missing <end> the last.
+// A regex for <start> is searched for after the previous range, or from
+// the top for ^/regex/; one for <end> after <start>.
+func ParseRanges(specs []string, data []byte, path string) ([]Range, error) {
+	lines := splitLines(data)
+	var ranges []Range
+	from := 0
+	for _, spec := range specs {
+		r, err := parseRange(spec, lines, from)
+		if err != nil {
+			return nil, err
+		}
+		if r.Start >= len(lines) {
+			return nil, fmt.Errorf("file %s has only %d %s", path, len(lines), plural(len(lines), "line", "lines"))
+		}
+		r.End = min(r.End, len(lines))
+		ranges = append(ranges, r)
+		from = r.End
+	}
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+	var joined []Range
+	for _, r := range ranges {
+		if n := len(joined); n > 0 && r.Start <= joined[n-1].End {
+			joined[n-1].End = max(joined[n-1].End, r.End)
+			continue
+		}
+		joined = append(joined, r)
+	}
+	return joined, nil
+}
+
+// parseRange parses one -L argument, searching for a regex start from
+// line from.
+func parseRange(spec string, lines []string, from int) (Range, error) {
+	start, rest, err := parseLine(spec, lines, from, 0)
+	if err != nil {
+		return Range{}, err
+	}
+	if rest == "" {
+		return Range{start, len(lines)}, nil
+	}
+	if rest[0] != ',' {
+		return Range{}, fmt.Errorf("-L invalid range: %s", spec)
+	}
+	rest = rest[1:]
+
+	end := len(lines)
+	switch {
+	case rest == "":
+	case rest[0] == '+' || rest[0] == '-':
+		n, err := strconv.Atoi(rest[1:])
+		if err != nil || n < 0 {
+			return Range{}, fmt.Errorf("-L invalid range: %s", spec)
+		}
+		if n == 0 {
+			return Range{}, errors.New("-L invalid empty range")
+		}
+		if rest[0] == '+' {
+			end = start + n
+		} else {
+			start, end = max(start-n+1, 0), start+1
+		}
+	default:
+		var tail string
+		if end, tail, err = parseLine(rest, lines, start+1, start); err != nil {
+			return Range{}, err
+		}
+		if tail != "" {
+			return Range{}, fmt.Errorf("-L invalid range: %s", spec)
+		}
+		end++
+		if end <= start {
+			start, end = end-1, start+1
+		}
+	}
+	return Range{start, end}, nil
+}
+
+// parseLine parses a line number or /regex/ at the start of s, returning
+// the zero-based line and the rest of s. A regex is searched for from line
+// from, or the top with a leading "^"; an empty s is line empty.
+func parseLine(s string, lines []string, from, empty int) (int, string, error) {
+	if s == "" || s[0] == ',' {
+		return empty, s, nil
+	}
+	if strings.HasPrefix(s, "^/") {
+		s, from = s[1:], 0
+	}
+	if s[0] != '/' {
+		digits := len(s) - len(strings.TrimLeft(s, "0123456789"))
+		n, err := strconv.Atoi(s[:digits])
+		if err != nil || n == 0 {
+			if digits > 0 {
+				s = s[:digits]
+			}
+			return 0, "", fmt.Errorf("-L invalid line number: %s", s)
+		}
+		return n - 1, s[digits:], nil
+	}
+
+	// The pattern ends at the next unescaped slash
+	end := 1
+	for end < len(s) && s[end] != '/' {
+		if s[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	pattern := s[1:min(end, len(s))]
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return 0, "", fmt.Errorf("-L parameter '%s': %v", pattern, err)
+	}
+	for i := from; i < len(lines); i++ {
+		if re.MatchString(lines[i]) {
+			return i, s[min(end+1, len(s)):], nil
+		}
+	}
+	return 0, "", fmt.Errorf("-L parameter '%s' starting at line %d: No match", pattern, from+1)
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
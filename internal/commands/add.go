@@ -1,11 +1,15 @@
 package commands
 
 import (
+	"bytes"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
 
+	"github.com/Notwinner0/gvcs/internal/attributes"
 	"github.com/Notwinner0/gvcs/internal/index"
+	"github.com/Notwinner0/gvcs/internal/lfs"
 	"github.com/Notwinner0/gvcs/internal/objects"
 	"github.com/Notwinner0/gvcs/internal/repo"
 )
@@ -15,7 +19,12 @@ func CmdAdd(paths []string) error {
 	if err != nil {
 		return err
 	}
-	idx, err := index.IndexRead(gitRepo)
+	idx, err := index.IndexLock(gitRepo)
+	if err != nil {
+		return err
+	}
+	defer idx.Unlock()
+	attrs, err := attributes.AttributesRead(gitRepo)
 	if err != nil {
 		return err
 	}
@@ -41,13 +50,12 @@ func CmdAdd(paths []string) error {
 	// Process files to add
 	for _, path := range paths {
 		fullPath := filepath.Join(gitRepo.Worktree, path)
-		f, err := os.Open(fullPath)
+		relPath, err := filepath.Rel(gitRepo.Worktree, fullPath)
 		if err != nil {
 			return err
 		}
 
-		sha, err := objects.ObjectHash(f, "blob", gitRepo)
-		f.Close()
+		sha, err := hashWorktreeFile(gitRepo, attrs, relPath, true)
 		if err != nil {
 			return err
 		}
@@ -60,11 +68,6 @@ func CmdAdd(paths []string) error {
 		// Mode for regular file is 100644
 		mode := uint32(0100644)
 
-		relPath, err := filepath.Rel(gitRepo.Worktree, fullPath)
-		if err != nil {
-			return err
-		}
-
 		entry := &index.GitIndexEntry{
 			CTime: [2]uint32{uint32(stat.ModTime().Unix()), uint32(stat.ModTime().Nanosecond())},
 			MTime: [2]uint32{uint32(stat.ModTime().Unix()), uint32(stat.ModTime().Nanosecond())},
@@ -88,3 +91,37 @@ func CmdAdd(paths []string) error {
 	idx.Entries = keptEntries
 	return index.IndexWrite(gitRepo, idx)
 }
+
+// hashWorktreeFile hashes a worktree file the way it would be staged.
+// Nothing is written unless write is set.
+func hashWorktreeFile(gitRepo *repo.GitRepository, attrs *attributes.GitAttributes, relPath string, write bool) (string, error) {
+	f, err := os.Open(filepath.Join(gitRepo.Worktree, relPath))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var writeRepo *repo.GitRepository
+	if write {
+		writeRepo = gitRepo
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	return hashFiltered(writeRepo, attrs, relPath, f, stat.Size())
+}
+
+// hashFiltered hashes size bytes of content as a blob stored at relPath.
+// Paths with the filter=lfs attribute are replaced by a pointer blob and
+// their content goes to the LFS store of writeRepo, if not nil.
+func hashFiltered(writeRepo *repo.GitRepository, attrs *attributes.GitAttributes, relPath string, r io.Reader, size int64) (string, error) {
+	if attributes.CheckAttr(attrs, relPath)["filter"] == "lfs" {
+		pointer, err := lfs.Clean(writeRepo, r)
+		if err != nil {
+			return "", err
+		}
+		return objects.ObjectHash(bytes.NewReader(pointer.Encode()), "blob", writeRepo)
+	}
+	return objects.ObjectHashStream(r, size, "blob", writeRepo)
+}
@@ -0,0 +1,494 @@
+package commands
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Notwinner0/gvcs/internal/attributes"
+	"github.com/Notwinner0/gvcs/internal/diff"
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// archiveWriter writes the entries of an archive in one format. Paths are
+// "/"-separated, and those of directories end in a slash.
+type archiveWriter interface {
+	writeDir(path string) error
+	writeFile(path, mode string, size int64, r io.Reader) error
+	Close() error
+}
+
+// archiver walks a tree and writes what it selects to an archive.
+type archiver struct {
+	gitRepo *repo.GitRepository
+	attrs   *attributes.GitAttributes
+	specs   []string
+	prefix  string
+	commit  string // the commit archived, "" for a bare tree
+	obj     *objects.GitCommit
+	w       archiveWriter
+}
+
+// CmdArchive is the handler for the archive command. It writes the files
+// of treeish, limited to paths, as a tar, tar.gz or zip archive to output,
+// or to standard output if there is none, each path starting with prefix.
+// Without a format it is guessed from the name of output, defaulting to
+// tar. Entries are written as they are read from the object store.
+//
+// Files and directories with the export-ignore attribute are left out, and
+// those with export-subst have their $Format:...$ placeholders expanded.
+// The id of an archived commit is stored in a pax header of tar archives
+// and in the comment of zip ones, and entries are dated with its commit
+// date.
+func CmdArchive(treeish, format, prefix, output string, paths []string) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+	specs, err := pathspecs(gitRepo, paths)
+	if err != nil {
+		return err
+	}
+	if format == "" {
+		format = archiveFormatGuess(output)
+	}
+	if format != "tar" && format != "tar.gz" && format != "tgz" && format != "zip" {
+		return fmt.Errorf("unknown archive format '%s'", format)
+	}
+
+	tree, err := diffTree(gitRepo, treeish)
+	if err != nil {
+		return err
+	}
+	a := &archiver{gitRepo: gitRepo, specs: specs, prefix: prefix}
+	mtime := time.Now()
+	if sha, err := objects.ObjectFind(gitRepo, treeish, "commit", true); err == nil && sha != "" {
+		obj, err := objects.ObjectRead(gitRepo, sha)
+		if err != nil {
+			return err
+		}
+		a.commit, a.obj = sha, obj.(*objects.GitCommit)
+		sig, err := objects.SignatureParse(showHeader(a.obj.Kvlm, "committer"))
+		if err != nil {
+			return err
+		}
+		mtime = sig.When
+	}
+
+	// Attributes come from the .gitattributes files of the tree itself.
+	// Every path must select something before anything is written.
+	attrFiles := make(map[string]string)
+	matched := make([]bool, len(specs))
+	err = archiveWalk(gitRepo, tree, "", func(path string, leaf objects.GitTreeLeaf) (bool, error) {
+		if strings.HasSuffix(path, "/.gitattributes") || path == ".gitattributes" {
+			attrFiles[filepath.FromSlash(path)] = leaf.SHA
+		}
+		for i, spec := range specs {
+			matched[i] = matched[i] || diff.PathspecMatch([]string{spec}, path)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	for i, ok := range matched {
+		if !ok {
+			return fmt.Errorf("pathspec '%s' did not match any files", paths[i])
+		}
+	}
+	if a.attrs, err = attributes.AttributesFromTree(gitRepo, attrFiles); err != nil {
+		return err
+	}
+
+	if output == "" {
+		return a.write(os.Stdout, format, tree, mtime)
+	}
+	// A failed archive leaves no partial output file behind.
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if err := a.write(f, format, tree, mtime); err != nil {
+		f.Close()
+		os.Remove(output)
+		return err
+	}
+	return f.Close()
+}
+
+// write writes the archive of tree to out.
+func (a *archiver) write(out io.Writer, format, tree string, mtime time.Time) error {
+	buf := bufio.NewWriter(out)
+	var err error
+	if a.w, err = archiveWriterNew(buf, format, a.commit, mtime); err != nil {
+		return err
+	}
+
+	if strings.HasSuffix(a.prefix, "/") {
+		if err := a.w.writeDir(a.prefix); err != nil {
+			return err
+		}
+	}
+	var pending []string
+	err = archiveWalk(a.gitRepo, tree, "", func(path string, leaf objects.GitTreeLeaf) (bool, error) {
+		return a.entry(path, leaf, &pending)
+	})
+	if err != nil {
+		return err
+	}
+	if err := a.w.Close(); err != nil {
+		return err
+	}
+	return buf.Flush()
+}
+
+// entry writes one tree entry, reporting whether to descend into it if it
+// is a directory. A directory that is not selected itself but may hold
+// selected files is held back in pending until one of them is written.
+func (a *archiver) entry(path string, leaf objects.GitTreeLeaf, pending *[]string) (bool, error) {
+	if attributes.CheckAttr(a.attrs, filepath.FromSlash(path))["export-ignore"] == attributes.AttrSet {
+		return false, nil
+	}
+	typ, err := objects.TreeLeafType(leaf.Mode)
+	if err != nil {
+		return false, err
+	}
+
+	// Drop held back directories that were left without a file.
+	for len(*pending) > 0 && !strings.HasPrefix(path, (*pending)[len(*pending)-1]+"/") {
+		*pending = (*pending)[:len(*pending)-1]
+	}
+
+	if !a.selected(path) {
+		if typ == "tree" && diff.PathspecDescend(a.specs, path) {
+			*pending = append(*pending, path)
+			return true, nil
+		}
+		return false, nil
+	}
+	for _, dir := range *pending {
+		if err := a.w.writeDir(a.prefix + dir + "/"); err != nil {
+			return false, err
+		}
+	}
+	*pending = (*pending)[:0]
+	if typ == "tree" {
+		return true, a.w.writeDir(a.prefix + path + "/")
+	}
+
+	// A submodule's commit isn't in this repository; it is archived as
+	// an empty directory.
+	if typ == "commit" {
+		return false, a.w.writeDir(a.prefix + path + "/")
+	}
+	header, r, err := objects.ObjectReader(a.gitRepo, leaf.SHA)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	size, content := header.Size, io.Reader(r)
+
+	// Expanding placeholders changes the size, so only those files are
+	// read whole.
+	if a.obj != nil && leaf.Mode != "120000" && attributes.CheckAttr(a.attrs, filepath.FromSlash(path))["export-subst"] == attributes.AttrSet {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return false, err
+		}
+		data = archiveSubst(data, a.commit, a.obj)
+		size, content = int64(len(data)), bytes.NewReader(data)
+	}
+	return false, a.w.writeFile(a.prefix+path, leaf.Mode, size, content)
+}
+
+// selected reports whether paths select path or a directory holding it.
+func (a *archiver) selected(path string) bool {
+	for {
+		if diff.PathspecMatch(a.specs, path) {
+			return true
+		}
+		i := strings.LastIndex(path, "/")
+		if i == -1 {
+			return false
+		}
+		path = path[:i]
+	}
+}
+
+// archiveWalk calls fn for every entry below tree in tree order, with its
+// "/"-separated path, descending into the directories fn asks for.
+func archiveWalk(gitRepo *repo.GitRepository, tree, dir string, fn func(string, objects.GitTreeLeaf) (bool, error)) error {
+	obj, err := objects.ObjectRead(gitRepo, tree)
+	if err != nil {
+		return err
+	}
+	t, ok := obj.(*objects.GitTree)
+	if !ok {
+		return fmt.Errorf("object %s is not a tree", tree)
+	}
+	for _, leaf := range t.Items {
+		path := dir + leaf.Path
+		descend, err := fn(path, leaf)
+		if err != nil {
+			return err
+		}
+		if typ, _ := objects.TreeLeafType(leaf.Mode); typ == "tree" && descend {
+			if err := archiveWalk(gitRepo, leaf.SHA, path+"/", fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// archiveFormatGuess picks the format from the extension of an output
+// file name.
+func archiveFormatGuess(output string) string {
+	switch {
+	case strings.HasSuffix(output, ".zip"):
+		return "zip"
+	case strings.HasSuffix(output, ".tar.gz"), strings.HasSuffix(output, ".tgz"):
+		return "tar.gz"
+	}
+	return "tar"
+}
+
+func archiveWriterNew(w io.Writer, format, commit string, mtime time.Time) (archiveWriter, error) {
+	if format == "zip" {
+		zw := zip.NewWriter(w)
+		if commit != "" {
+			if err := zw.SetComment(commit); err != nil {
+				return nil, err
+			}
+		}
+		return &zipArchive{zw: zw, mtime: mtime}, nil
+	}
+
+	t := &tarArchive{mtime: mtime}
+	if format == "tar" {
+		t.tw = tar.NewWriter(w)
+	} else {
+		t.gz = gzip.NewWriter(w)
+		t.tw = tar.NewWriter(t.gz)
+	}
+	if commit != "" {
+		err := t.tw.WriteHeader(&tar.Header{
+			Typeflag:   tar.TypeXGlobalHeader,
+			PAXRecords: map[string]string{"comment": commit},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// tarArchive writes a tar archive, compressed if gz is set. Entries are
+// owned by root, with the permissions git gives them.
+type tarArchive struct {
+	tw    *tar.Writer
+	gz    *gzip.Writer
+	mtime time.Time
+}
+
+func (t *tarArchive) header(path string, typ byte, mode int64) *tar.Header {
+	return &tar.Header{Typeflag: typ, Name: path, Mode: mode, ModTime: t.mtime, Uname: "root", Gname: "root"}
+}
+
+func (t *tarArchive) writeDir(path string) error {
+	return t.tw.WriteHeader(t.header(path, tar.TypeDir, 0775))
+}
+
+func (t *tarArchive) writeFile(path, mode string, size int64, r io.Reader) error {
+	if mode == "120000" {
+		target, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		h := t.header(path, tar.TypeSymlink, 0777)
+		h.Linkname = string(target)
+		return t.tw.WriteHeader(h)
+	}
+	h := t.header(path, tar.TypeReg, 0664)
+	if mode == "100755" {
+		h.Mode = 0775
+	}
+	h.Size = size
+	if err := t.tw.WriteHeader(h); err != nil {
+		return err
+	}
+	_, err := io.Copy(t.tw, r)
+	return err
+}
+
+func (t *tarArchive) Close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	if t.gz != nil {
+		return t.gz.Close()
+	}
+	return nil
+}
+
+// zipArchive writes a zip archive with files deflated and Unix modes kept.
+type zipArchive struct {
+	zw    *zip.Writer
+	mtime time.Time
+}
+
+func (z *zipArchive) writeDir(path string) error {
+	h := &zip.FileHeader{Name: path, Method: zip.Store, Modified: z.mtime}
+	h.SetMode(os.ModeDir | 0775)
+	_, err := z.zw.CreateHeader(h)
+	return err
+}
+
+func (z *zipArchive) writeFile(path, mode string, size int64, r io.Reader) error {
+	h := &zip.FileHeader{Name: path, Method: zip.Deflate, Modified: z.mtime}
+	switch mode {
+	case "120000":
+		h.Method = zip.Store
+		h.SetMode(os.ModeSymlink | 0777)
+	case "100755":
+		h.SetMode(0775)
+	default:
+		h.SetMode(0664)
+	}
+	w, err := z.zw.CreateHeader(h)
+	if err != nil {
+		return err
+	}
+	// Unlike tar, zip takes the size from what was written, so a short
+	// object has to be caught here.
+	n, err := io.Copy(w, r)
+	if err == nil && n != size {
+		err = fmt.Errorf("%s: expected %d bytes, read %d", path, size, n)
+	}
+	return err
+}
+
+func (z *zipArchive) Close() error {
+	return z.zw.Close()
+}
+
+// archiveSubst expands the $Format:<format>$ placeholders of data for the
+// commit sha.
+func archiveSubst(data []byte, sha string, commit *objects.GitCommit) []byte {
+	var out bytes.Buffer
+	for {
+		start := bytes.Index(data, []byte("$Format:"))
+		if start == -1 {
+			break
+		}
+		end := bytes.IndexByte(data[start+len("$Format:"):], '$')
+		if end == -1 {
+			break
+		}
+		end += start + len("$Format:")
+		out.Write(data[:start])
+		out.WriteString(archiveFormat(string(data[start+len("$Format:"):end]), sha, commit))
+		data = data[end+1:]
+	}
+	out.Write(data)
+	return out.Bytes()
+}
+
+// archiveFormat expands the placeholders of a pretty format for a commit:
+// %H, %h, %T, %t, %P, %p, %an, %ae, %ad, %aD, %ai, %aI, %at, %as, %ar, the
+// same for the committer with %c, %s, %b, %B, %n and %%. Others are kept
+// as they are.
+func archiveFormat(format, sha string, commit *objects.GitCommit) string {
+	tree := showHeader(commit.Kvlm, "tree")
+	parents := commit.Kvlm["parent"]
+	subject, body := refMessageSplit(commit.Message)
+
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch c := format[i]; c {
+		case 'H':
+			b.WriteString(sha)
+		case 'h':
+			b.WriteString(sha[:7])
+		case 'T':
+			b.WriteString(tree)
+		case 't':
+			b.WriteString(tree[:min(7, len(tree))])
+		case 'P':
+			b.WriteString(strings.Join(parents, " "))
+		case 'p':
+			short := make([]string, len(parents))
+			for j, p := range parents {
+				short[j] = p[:7]
+			}
+			b.WriteString(strings.Join(short, " "))
+		case 's':
+			b.WriteString(subject)
+		case 'b':
+			b.WriteString(body)
+		case 'B':
+			b.WriteString(commit.Message)
+		case 'n':
+			b.WriteByte('\n')
+		case '%':
+			b.WriteByte('%')
+		case 'a', 'c':
+			key := "author"
+			if c == 'c' {
+				key = "committer"
+			}
+			if i+1 < len(format) {
+				if value, ok := archivePerson(showHeader(commit.Kvlm, key), format[i+1]); ok {
+					b.WriteString(value)
+					i++
+					continue
+				}
+			}
+			b.WriteByte('%')
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// archivePerson expands the placeholder %a<c> or %c<c> for an author or
+// committer line.
+func archivePerson(line string, c byte) (string, bool) {
+	sig, err := objects.SignatureParse(line)
+	if err != nil {
+		return "", false
+	}
+	dates := map[byte]string{'d': "default", 'D': "rfc", 'i': "iso", 'I': "iso-strict", 't': "unix", 's': "short", 'r': "relative"}
+	switch c {
+	case 'n':
+		return sig.Name, true
+	case 'e':
+		return sig.Email, true
+	}
+	format, ok := dates[c]
+	if !ok {
+		return "", false
+	}
+	date, err := objects.SignatureFormatDate(sig.When, format)
+	if err != nil {
+		return "", false
+	}
+	return date, true
+}
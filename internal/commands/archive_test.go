@@ -0,0 +1,167 @@
+package commands
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// testArchiveRepo commits a tree with attributes for archive to act on.
+func testArchiveRepo(t *testing.T) (*repo.GitRepository, string) {
+	t.Helper()
+	gitRepo := testRepo(t)
+	commit := testCommit(t, gitRepo, "base",
+		".gitattributes", "secret.txt export-ignore\nversion.txt export-subst\n",
+		"a.txt", "a\n",
+		"big.txt", strings.Repeat("0123456789abcdef", 1<<14),
+		"secret.txt", "secret\n",
+		"version.txt", "commit $Format:%H$ by $Format:%an$\n",
+		"sub/b.txt", "b\n")
+	return gitRepo, commit
+}
+
+// testTar reads a tar archive into a map from entry names to contents.
+func testTar(t *testing.T, r io.Reader) (map[string]string, string) {
+	t.Helper()
+	files := make(map[string]string)
+	comment := ""
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading tar failed: %v", err)
+		}
+		if h.Typeflag == tar.TypeXGlobalHeader {
+			comment = h.PAXRecords["comment"]
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("reading tar failed: %v", err)
+		}
+		files[h.Name] = string(data)
+	}
+	return files, comment
+}
+
+func TestArchive_Tar(t *testing.T) {
+	gitRepo, commit := testArchiveRepo(t)
+	output := filepath.Join(t.TempDir(), "out.tar")
+	if err := CmdArchive("HEAD", "", "p/", output, nil); err != nil {
+		t.Fatalf("CmdArchive() failed: %v", err)
+	}
+	f, err := os.Open(output)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	defer f.Close()
+	files, comment := testTar(t, f)
+
+	if comment != commit {
+		t.Errorf("Expected the pax comment %s, got %q", commit, comment)
+	}
+	want := map[string]string{
+		"p/":               "",
+		"p/.gitattributes": testRead(t, gitRepo, ".gitattributes"),
+		"p/a.txt":          "a\n",
+		"p/big.txt":        testRead(t, gitRepo, "big.txt"),
+		"p/version.txt":    "commit " + commit + " by Test User\n",
+		"p/sub/":           "",
+		"p/sub/b.txt":      "b\n",
+	}
+	if len(files) != len(want) {
+		t.Errorf("Expected %d entries, got %d", len(want), len(files))
+	}
+	for name, content := range want {
+		if got, ok := files[name]; !ok || got != content {
+			t.Errorf("Expected %s to hold %.40q, got %.40q (present %v)", name, content, got, ok)
+		}
+	}
+}
+
+func TestArchive_Formats(t *testing.T) {
+	testArchiveRepo(t)
+	dir := t.TempDir()
+
+	// The format is guessed from the output name
+	tgz := filepath.Join(dir, "out.tgz")
+	if err := CmdArchive("HEAD", "", "", tgz, []string{"sub"}); err != nil {
+		t.Fatalf("CmdArchive() failed: %v", err)
+	}
+	f, err := os.Open(tgz)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip.NewReader() failed: %v", err)
+	}
+	files, _ := testTar(t, gz)
+	if len(files) != 2 || files["sub/"] != "" || files["sub/b.txt"] != "b\n" {
+		t.Errorf("Expected only sub/ and sub/b.txt, got %v", files)
+	}
+
+	zipPath := filepath.Join(dir, "out.zip")
+	if err := CmdArchive("HEAD", "", "", zipPath, []string{"a.txt", "big.txt"}); err != nil {
+		t.Fatalf("CmdArchive() failed: %v", err)
+	}
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		t.Fatalf("zip.OpenReader() failed: %v", err)
+	}
+	defer zr.Close()
+	var names []string
+	for _, zf := range zr.File {
+		names = append(names, zf.Name)
+		rc, err := zf.Open()
+		if err != nil {
+			t.Fatalf("Open() failed: %v", err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("reading %s failed: %v", zf.Name, err)
+		}
+		if zf.Name == "big.txt" && len(data) != 1<<18 {
+			t.Errorf("Expected big.txt to hold %d bytes, got %d", 1<<18, len(data))
+		}
+	}
+	if want := []string{"a.txt", "big.txt"}; !equalStrings(names, want) {
+		t.Errorf("Expected zip entries %v, got %v", want, names)
+	}
+}
+
+func TestArchive_FailureRemovesOutput(t *testing.T) {
+	gitRepo, _ := testArchiveRepo(t)
+	output := filepath.Join(t.TempDir(), "out.tar")
+
+	if err := CmdArchive("HEAD", "", "", output, []string{"nothing"}); err == nil {
+		t.Errorf("Expected a pathspec matching nothing to fail")
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("Expected no output file, got %v", err)
+	}
+
+	// An object gone missing fails the archive half way through
+	sha := testIndexEntry(t, gitRepo, "sub/b.txt").SHA
+	if err := os.Remove(repo.RepoPath(gitRepo, "objects", sha[:2], sha[2:])); err != nil {
+		t.Fatalf("Remove() failed: %v", err)
+	}
+	if err := CmdArchive("HEAD", "", "", output, nil); err == nil {
+		t.Errorf("Expected the missing object to fail the archive")
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("Expected the partial output removed, got %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Notwinner0/gvcs/internal/attributes"
+	"github.com/Notwinner0/gvcs/internal/blame"
+	"github.com/Notwinner0/gvcs/internal/diff"
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// blameUncommitted names the author of lines not committed yet.
+const blameUncommitted = "Not Committed Yet"
+
+// CmdBlame is the handler for the blame command. It shows each line of a
+// file with the commit, author and date that introduced it, as of rev, or
+// of the worktree where rev is empty, where lines not yet committed are
+// shown as such. ranges limit it to the lines given as for -L. porcelain
+// prints the machine-readable format; ignoreWhitespace ignores changes in
+// whitespace, and moves follows lines moved within the file.
+func CmdBlame(file, rev string, ranges []string, porcelain, ignoreWhitespace, moves bool) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+	specs, err := pathspecs(gitRepo, []string{file})
+	if err != nil {
+		return err
+	}
+	path := specs[0]
+
+	uncommitted := rev == ""
+	if uncommitted {
+		rev = "HEAD"
+	}
+	commit, err := objects.ObjectFind(gitRepo, rev, "commit", true)
+	if err != nil {
+		return err
+	}
+	tree, err := diffTree(gitRepo, commit)
+	if err != nil {
+		return err
+	}
+	blob, err := objects.TreeLookup(gitRepo, tree, path)
+	if err != nil {
+		return err
+	}
+	if blob == "" {
+		return fmt.Errorf("no such path %s in %s", path, rev)
+	}
+
+	var data []byte
+	if uncommitted {
+		attrs, err := attributes.AttributesRead(gitRepo)
+		if err != nil {
+			return err
+		}
+		d := &differ{gitRepo: gitRepo, attrs: attrs}
+		data, err = d.worktreeContent(path)
+		if err != nil {
+			return err
+		}
+	} else if data, err = diff.BlobRead(gitRepo, blob); err != nil {
+		return err
+	}
+
+	opts := blame.Options{IgnoreWhitespace: ignoreWhitespace, Moves: moves}
+	if opts.Ranges, err = blame.ParseRanges(ranges, data, path); err != nil {
+		return err
+	}
+	entries, err := blame.Blame(gitRepo, commit, path, data, uncommitted, opts)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	if porcelain {
+		return blamePorcelain(out, entries, lines, path)
+	}
+	return blameDefault(out, entries, lines, path)
+}
+
+// blameInfo is what blame shows about the commit of an entry.
+type blameInfo struct {
+	author, mail string
+	authorTime   time.Time
+	committer    string
+	cmail        string
+	commitTime   time.Time
+	summary      string
+}
+
+// blameCommitInfo reads the identities and subject of an entry's commit,
+// or makes them up for lines not committed yet.
+func blameCommitInfo(e blame.Entry, path string, now time.Time) (blameInfo, error) {
+	if e.Commit == nil {
+		return blameInfo{
+			author: blameUncommitted, mail: "<not.committed.yet>", authorTime: now,
+			committer: blameUncommitted, cmail: "<not.committed.yet>", commitTime: now,
+			summary: fmt.Sprintf("Version of %s from %s", path, path),
+		}, nil
+	}
+	author, err := objects.SignatureParse(showHeader(e.Commit.Kvlm, "author"))
+	if err != nil {
+		return blameInfo{}, err
+	}
+	committer, err := objects.SignatureParse(showHeader(e.Commit.Kvlm, "committer"))
+	if err != nil {
+		return blameInfo{}, err
+	}
+	return blameInfo{
+		author: author.Name, mail: "<" + author.Email + ">", authorTime: author.When,
+		committer: committer.Name, cmail: "<" + committer.Email + ">", commitTime: committer.When,
+		summary: logSubject(e.Commit.Message),
+	}, nil
+}
+
+// blameDefault writes each line after its abbreviated commit, with the
+// commit's path if any line came from another, and its author, date and
+// line number, all in aligned columns. Commits without parents are marked
+// with "^" as boundaries.
+func blameDefault(out io.Writer, entries []blame.Entry, lines []string, path string) error {
+	now := time.Now()
+	infos := make([]blameInfo, len(entries))
+	showName := false
+	nameWidth, authorWidth, last := 0, 0, 0
+	for i, e := range entries {
+		var err error
+		if infos[i], err = blameCommitInfo(e, path, now); err != nil {
+			return err
+		}
+		showName = showName || e.Path != path
+		nameWidth = max(nameWidth, utf8.RuneCountInString(e.Path))
+		authorWidth = max(authorWidth, utf8.RuneCountInString(infos[i].author))
+		last = e.Final + e.Count
+	}
+	lineWidth := len(fmt.Sprint(last))
+
+	for i, e := range entries {
+		sha := strings.Repeat("0", 8)
+		switch {
+		case e.Boundary:
+			sha = "^" + e.SHA[:7]
+		case e.SHA != "":
+			sha = e.SHA[:8]
+		}
+		name := ""
+		if showName {
+			name = " " + e.Path + strings.Repeat(" ", nameWidth-utf8.RuneCountInString(e.Path))
+		}
+		info := infos[i]
+		date, err := objects.SignatureFormatDate(info.authorTime, "iso")
+		if err != nil {
+			return err
+		}
+		padding := strings.Repeat(" ", authorWidth-utf8.RuneCountInString(info.author))
+		for n := e.Final; n < e.Final+e.Count; n++ {
+			line := strings.TrimSuffix(lines[n], "\n")
+			if _, err := fmt.Fprintf(out, "%s%s (%s%s %s %*d) %s\n", sha, name, info.author, padding, date, lineWidth, n+1, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// blamePorcelain writes the blame for scripts: each line after a header of
+// its commit, its line numbers in that commit and in the file, and the
+// size of its group of lines. The first group of each commit also has its
+// details, one per line.
+func blamePorcelain(out io.Writer, entries []blame.Entry, lines []string, path string) error {
+	now := time.Now()
+	shown := make(map[string]bool)
+	for _, e := range entries {
+		sha := e.SHA
+		if sha == "" {
+			sha = strings.Repeat("0", 40)
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s %d %d %d\n", sha, e.Line+1, e.Final+1, e.Count)
+		if !shown[sha] {
+			shown[sha] = true
+			info, err := blameCommitInfo(e, path, now)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&b, "author %s\nauthor-mail %s\nauthor-time %d\nauthor-tz %s\n",
+				info.author, info.mail, info.authorTime.Unix(), info.authorTime.Format("-0700"))
+			fmt.Fprintf(&b, "committer %s\ncommitter-mail %s\ncommitter-time %d\ncommitter-tz %s\n",
+				info.committer, info.cmail, info.commitTime.Unix(), info.commitTime.Format("-0700"))
+			fmt.Fprintf(&b, "summary %s\n", info.summary)
+			if e.Boundary {
+				b.WriteString("boundary\n")
+			}
+			if e.Previous != "" {
+				fmt.Fprintf(&b, "previous %s %s\n", e.Previous, e.PreviousPath)
+			}
+			fmt.Fprintf(&b, "filename %s\n", e.Path)
+		}
+		for n := e.Final; n < e.Final+e.Count; n++ {
+			if n > e.Final {
+				fmt.Fprintf(&b, "%s %d %d\n", sha, e.Line+n-e.Final+1, n+1)
+			}
+			fmt.Fprintf(&b, "\t%s\n", strings.TrimSuffix(lines[n], "\n"))
+		}
+		if _, err := io.WriteString(out, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,37 +1,199 @@
 package commands
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"regexp"
+	"strings"
 
 	"github.com/Notwinner0/gvcs/internal/objects"
 	"github.com/Notwinner0/gvcs/internal/repo"
 )
 
-// CmdCatFile is the handler for the cat-file command.
-func CmdCatFile(objType, object string) error {
+// catFileDefaultFormat is the header printed for each object in batch mode.
+const catFileDefaultFormat = "%(objectname) %(objecttype) %(objectsize)"
+
+var catFileAtomRE = regexp.MustCompile(`%\((\w+)\)`)
+
+// CmdCatFile is the handler for the cat-file command. mode is one of "t"
+// (print the type), "s" (print the size), "e" (only set the exit status)
+// and "p" (pretty-print); without a mode the object is printed raw, after
+// following it to objType.
+func CmdCatFile(mode, objType, object string) error {
+	if object == "" {
+		return errors.New("no object given")
+	}
 	gitRepo, err := repo.RepoFind(".", true)
 	if err != nil {
 		return err
 	}
-	return catFile(gitRepo, object, objType)
+
+	if mode == "" {
+		return catFile(gitRepo, object, objType)
+	}
+
+	sha, err := objects.ObjectFind(gitRepo, object, "", false)
+	if err != nil {
+		if mode == "e" {
+			return &ExitError{Code: 1}
+		}
+		return err
+	}
+	header, r, err := objects.ObjectReader(gitRepo, sha)
+	if err != nil {
+		if mode == "e" {
+			return &ExitError{Code: 1}
+		}
+		return err
+	}
+	defer r.Close()
+
+	switch mode {
+	case "t":
+		fmt.Println(header.Type)
+	case "s":
+		fmt.Println(header.Size)
+	case "e":
+	case "p":
+		if header.Type == "tree" {
+			return catFileTree(gitRepo, sha)
+		}
+		// Commits and tags are already human readable
+		_, err = io.Copy(os.Stdout, r)
+		return err
+	default:
+		return fmt.Errorf("unknown mode -%s", mode)
+	}
+	return nil
 }
 
-func catFile(gitRepo *repo.GitRepository, objName, fmt string) error {
-	// ObjectFind is a placeholder for now
-	sha, err := objects.ObjectFind(gitRepo, objName, fmt, true)
+func catFile(gitRepo *repo.GitRepository, objName, objType string) error {
+	sha, err := objects.ObjectFind(gitRepo, objName, objType, true)
 	if err != nil {
 		return err
 	}
+	if sha == "" {
+		return fmt.Errorf("%s is not a %s", objName, objType)
+	}
+
+	// The stored content is the serialized form, so stream it straight out
+	_, r, err := objects.ObjectReader(gitRepo, sha)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = io.Copy(os.Stdout, r)
+	return err
+}
+
+// catFileTree prints a tree the way ls-tree does.
+func catFileTree(gitRepo *repo.GitRepository, sha string) error {
 	obj, err := objects.ObjectRead(gitRepo, sha)
 	if err != nil {
 		return err
 	}
+	tree, ok := obj.(*objects.GitTree)
+	if !ok {
+		return fmt.Errorf("object %s is not a tree", sha)
+	}
+	for _, item := range tree.Items {
+		objType, err := objects.TreeLeafType(item.Mode)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%06s %s %s\t%s\n", item.Mode, objType, item.SHA, item.Path)
+	}
+	return nil
+}
 
-	data, err := obj.Serialize()
+// CmdCatFileBatch is the handler for cat-file --batch and --batch-check.
+// It reads one object name per line from stdin and prints format for
+// each, followed by the content and a newline if contents is set. Names
+// that match no object print "<name> missing", those matching several
+// "<name> ambiguous". Output is flushed after every object unless buffer
+// is set.
+func CmdCatFileBatch(contents bool, format string, buffer bool) error {
+	gitRepo, err := repo.RepoFind(".", true)
 	if err != nil {
 		return err
 	}
+	if format == "" {
+		format = catFileDefaultFormat
+	}
+	for _, m := range catFileAtomRE.FindAllStringSubmatch(format, -1) {
+		switch m[1] {
+		case "objectname", "objecttype", "objectsize", "rest":
+		default:
+			return fmt.Errorf("unknown format element: %s", m[0])
+		}
+	}
+	// With %(rest), the name ends at the first whitespace
+	splitRest := strings.Contains(format, "%(rest)")
 
-	_, err = os.Stdout.Write(data)
-	return err
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	in := bufio.NewScanner(os.Stdin)
+	in.Buffer(make([]byte, 64*1024), 1024*1024)
+	for in.Scan() {
+		name, rest := strings.TrimRight(in.Text(), "\r"), ""
+		if splitRest {
+			if i := strings.IndexAny(name, " \t"); i != -1 {
+				name, rest = name[:i], strings.TrimLeft(name[i+1:], " \t")
+			}
+		}
+		if err := catFileBatchOne(gitRepo, out, name, rest, format, contents); err != nil {
+			return err
+		}
+		if !buffer {
+			if err := out.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return in.Err()
+}
+
+func catFileBatchOne(gitRepo *repo.GitRepository, out *bufio.Writer, name, rest, format string, contents bool) error {
+	sha, err := objects.ObjectFind(gitRepo, name, "", false)
+	var ambiguous *objects.ObjectAmbiguousError
+	if errors.As(err, &ambiguous) {
+		fmt.Fprintf(out, "%s ambiguous\n", name)
+		return nil
+	}
+	if err != nil {
+		fmt.Fprintf(out, "%s missing\n", name)
+		return nil
+	}
+	header, r, err := objects.ObjectReader(gitRepo, sha)
+	if err != nil {
+		fmt.Fprintf(out, "%s missing\n", name)
+		return nil
+	}
+	defer r.Close()
+
+	line := catFileAtomRE.ReplaceAllStringFunc(format, func(atom string) string {
+		switch atom {
+		case "%(objectname)":
+			return sha
+		case "%(objecttype)":
+			return header.Type
+		case "%(objectsize)":
+			return fmt.Sprint(header.Size)
+		case "%(rest)":
+			return rest
+		}
+		return atom
+	})
+	fmt.Fprintln(out, line)
+	if !contents {
+		return nil
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		return err
+	}
+	return out.WriteByte('\n')
 }
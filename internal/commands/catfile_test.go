@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testStdin makes input the content of stdin until the test ends.
+func testStdin(t *testing.T, input string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stdin")
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	stdin := os.Stdin
+	os.Stdin = f
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		f.Close()
+	})
+}
+
+func TestCatFileBatch(t *testing.T) {
+	gitRepo := testRepo(t)
+	commit := testCommit(t, gitRepo, "first", "a.txt", "hello\n")
+	blob := "ce013625030ba8dba906f756967f9e9ca394464a" // "hello\n"
+	missing := "0123456789012345678901234567890123456789"
+	input := blob + "\nHEAD\n" + missing + "\nno-such-ref\n"
+
+	testStdin(t, input)
+	out, err := testOutput(t, func() error { return CmdCatFileBatch(false, "", false) })
+	if err != nil {
+		t.Fatalf("CmdCatFileBatch() failed: %v", err)
+	}
+	commitSize := strings.TrimSpace(testCatFile(t, "s", commit))
+	want := fmt.Sprintf("%s blob 6\n%s commit %s\n%s missing\nno-such-ref missing\n", blob, commit, commitSize, missing)
+	if out != want {
+		t.Errorf("--batch-check: expected %q, got %q", want, out)
+	}
+
+	testStdin(t, blob+"\n"+missing+"\n")
+	out, err = testOutput(t, func() error { return CmdCatFileBatch(true, "", false) })
+	if err != nil {
+		t.Fatalf("CmdCatFileBatch() failed: %v", err)
+	}
+	if want := blob + " blob 6\nhello\n\n" + missing + " missing\n"; out != want {
+		t.Errorf("--batch: expected %q, got %q", want, out)
+	}
+
+	testStdin(t, blob+" some rest\n")
+	out, err = testOutput(t, func() error { return CmdCatFileBatch(false, "%(objecttype) %(rest)", true) })
+	if err != nil {
+		t.Fatalf("CmdCatFileBatch() failed: %v", err)
+	}
+	if want := "blob some rest\n"; out != want {
+		t.Errorf("custom format: expected %q, got %q", want, out)
+	}
+
+	if err := CmdCatFileBatch(false, "%(objectmode)", false); err == nil {
+		t.Errorf("Expected an unknown format atom to be rejected")
+	}
+}
+
+// testCatFile returns the output of cat-file in the given mode.
+func testCatFile(t *testing.T, mode, object string) string {
+	t.Helper()
+	out, err := testOutput(t, func() error { return CmdCatFile(mode, "", object) })
+	if err != nil {
+		t.Fatalf("CmdCatFile(%s, %s) failed: %v", mode, object, err)
+	}
+	return out
+}
@@ -3,9 +3,12 @@ package commands
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
+	"github.com/Notwinner0/gvcs/internal/attributes"
+	"github.com/Notwinner0/gvcs/internal/lfs"
 	"github.com/Notwinner0/gvcs/internal/objects"
 	"github.com/Notwinner0/gvcs/internal/repo"
 )
@@ -61,35 +64,91 @@ func CmdCheckout(commitRef, path string) error {
 		}
 	}
 
-	return treeCheckout(gitRepo, tree, path)
+	// Attributes come from the tree being checked out, not the current index
+	treeMap, err := objects.TreeToMap(gitRepo, sha, "")
+	if err != nil {
+		return err
+	}
+	attrs, err := attributes.AttributesFromTree(gitRepo, treeMap)
+	if err != nil {
+		return err
+	}
+
+	return treeCheckout(gitRepo, tree, path, "", attrs)
 }
 
-func treeCheckout(gitRepo *repo.GitRepository, tree *objects.GitTree, path string) error {
+func treeCheckout(gitRepo *repo.GitRepository, tree *objects.GitTree, path, prefix string, attrs *attributes.GitAttributes) error {
 	for _, item := range tree.Items {
-		obj, err := objects.ObjectRead(gitRepo, item.SHA)
-		if err != nil {
-			return err
-		}
 		dest := filepath.Join(path, item.Path)
+		relPath := filepath.Join(prefix, item.Path)
 
-		switch o := obj.(type) {
-		case *objects.GitTree:
-			if err := os.Mkdir(dest, 0755); err != nil {
+		// Git writes directories as "40000"
+		switch item.Mode {
+		case "40000", "040000":
+			obj, err := objects.ObjectRead(gitRepo, item.SHA)
+			if err != nil {
 				return err
 			}
-			if err := treeCheckout(gitRepo, o, dest); err != nil {
+			subtree, ok := obj.(*objects.GitTree)
+			if !ok {
+				return fmt.Errorf("object %s is not a tree", item.SHA)
+			}
+			if err := os.Mkdir(dest, 0755); err != nil {
 				return err
 			}
-		case *objects.GitBlob:
-			// @TODO Support symlinks (identified by mode 120000)
-			data, err := o.Serialize()
-			if err != nil {
+			if err := treeCheckout(gitRepo, subtree, dest, relPath, attrs); err != nil {
 				return err
 			}
-			if err := os.WriteFile(dest, data, 0644); err != nil {
+		case "160000":
+			// Submodules are not checked out
+		default:
+			// @TODO Support symlinks (identified by mode 120000)
+			if err := blobCheckout(gitRepo, item.SHA, dest, relPath, attrs); err != nil {
 				return err
 			}
 		}
 	}
 	return nil
 }
+
+// blobCheckout streams a blob to dest, materializing LFS pointers for paths
+// with the filter=lfs attribute.
+func blobCheckout(gitRepo *repo.GitRepository, sha, dest, relPath string, attrs *attributes.GitAttributes) error {
+	header, r, err := objects.ObjectReader(gitRepo, sha)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if header.Type != "blob" {
+		return fmt.Errorf("object %s is not a blob", sha)
+	}
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+
+	if header.Size <= lfs.PointerMaxSize && attributes.CheckAttr(attrs, relPath)["filter"] == "lfs" {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if pointer, perr := lfs.PointerParse(data); perr == nil {
+			err = lfs.Smudge(gitRepo, pointer, f)
+		} else {
+			_, err = f.Write(data)
+		}
+		if err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
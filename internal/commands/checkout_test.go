@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Notwinner0/gvcs/internal/attributes"
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+func TestTreeCheckout_GitSubtreeMode(t *testing.T) {
+	gitRepo, err := repo.RepoCreate(t.TempDir())
+	if err != nil {
+		t.Fatalf("RepoCreate() failed: %v", err)
+	}
+
+	blob := &objects.GitBlob{}
+	blob.Deserialize([]byte("hello\n"))
+	blobSHA, err := objects.ObjectWrite(blob, gitRepo)
+	if err != nil {
+		t.Fatalf("ObjectWrite() failed: %v", err)
+	}
+	subSHA, err := objects.ObjectWrite(&objects.GitTree{Items: []objects.GitTreeLeaf{
+		{Mode: "100644", Path: "file.txt", SHA: blobSHA},
+	}}, gitRepo)
+	if err != nil {
+		t.Fatalf("ObjectWrite() failed: %v", err)
+	}
+	// Trees written by git record directories as "40000"
+	tree := &objects.GitTree{Items: []objects.GitTreeLeaf{
+		{Mode: "40000", Path: "dir", SHA: subSHA},
+		{Mode: "100644", Path: "top.txt", SHA: blobSHA},
+	}}
+	treeSHA, err := objects.ObjectWrite(tree, gitRepo)
+	if err != nil {
+		t.Fatalf("ObjectWrite() failed: %v", err)
+	}
+
+	dest := t.TempDir()
+	if err := treeCheckout(gitRepo, tree, dest, "", &attributes.GitAttributes{}); err != nil {
+		t.Fatalf("treeCheckout() failed: %v", err)
+	}
+	for _, path := range []string{"top.txt", filepath.Join("dir", "file.txt")} {
+		data, err := os.ReadFile(filepath.Join(dest, path))
+		if err != nil {
+			t.Errorf("Expected %s to be checked out: %v", path, err)
+		} else if string(data) != "hello\n" {
+			t.Errorf("Expected %s to hold %q, got %q", path, "hello\n", data)
+		}
+	}
+
+	treeMap, err := objects.TreeToMap(gitRepo, treeSHA, "")
+	if err != nil {
+		t.Fatalf("TreeToMap() failed: %v", err)
+	}
+	if got := treeMap[filepath.Join("dir", "file.txt")]; got != blobSHA {
+		t.Errorf("Expected TreeToMap() to descend into the subtree, got %v", treeMap)
+	}
+}
@@ -0,0 +1,223 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/index"
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+	"github.com/Notwinner0/gvcs/internal/revwalk"
+)
+
+// CmdCherryPick is the handler for the cherry-pick command. It applies the
+// changes of each commit given, in order, on top of HEAD and commits them
+// with their original messages and authors; a range A..B stands for its
+// commits oldest first. recordOrigin adds a line naming the picked commit
+// to each message. A pick that conflicts stops the series until it is
+// resolved and continued with cont, skipped with skip, or the whole series
+// undone with abort.
+func CmdCherryPick(revs []string, recordOrigin, cont, abort, skip bool) error {
+	return sequencerCommand("pick", revs, recordOrigin, cont, abort, skip)
+}
+
+// CmdRevert is the handler for the revert command. It commits the reverse
+// of the changes of each commit given, in order, a range A..B standing for
+// its commits newest first, and stops on conflicts like cherry-pick.
+func CmdRevert(revs []string, cont, abort, skip bool) error {
+	return sequencerCommand("revert", revs, false, cont, abort, skip)
+}
+
+// sequencerCommand starts a series of picks, or acts on the one stopped.
+func sequencerCommand(action string, revs []string, recordOrigin, cont, abort, skip bool) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+	s, err := sequencerLoad(gitRepo)
+	if err != nil {
+		return err
+	}
+	pending, err := sequencerPendingRead(gitRepo)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case cont:
+		if s == nil && pending == nil {
+			return errNoSequence
+		}
+		return sequencerContinue(gitRepo, s, pending)
+	case skip:
+		if s == nil && pending == nil {
+			return errNoSequence
+		}
+		return sequencerSkip(gitRepo, s)
+	case abort:
+		if s == nil && pending == nil {
+			return errNoSequence
+		}
+		return sequencerAbort(gitRepo, s)
+	}
+
+	if len(revs) == 0 {
+		return errors.New("no commit given")
+	}
+	if s != nil || pending != nil {
+		return errors.New("a cherry-pick or revert is already in progress\nuse --continue, --skip or --abort")
+	}
+	head, err := objects.ObjectFind(gitRepo, "HEAD", "commit", true)
+	if err != nil {
+		return err
+	}
+	var todo []sequencerItem
+	for _, rev := range revs {
+		items, err := sequencerItems(gitRepo, action, rev)
+		if err != nil {
+			return err
+		}
+		todo = append(todo, items...)
+	}
+	s = &sequencer{gitRepo: gitRepo, head: head, todo: todo, recordOrigin: recordOrigin}
+	return s.run()
+}
+
+// sequencerItems resolves rev to the commits to pick: the commit it names,
+// or those of a range, oldest first for picks and newest first for
+// reverts.
+func sequencerItems(gitRepo *repo.GitRepository, action, rev string) ([]sequencerItem, error) {
+	var commits []*revwalk.Commit
+	w := revwalk.New(gitRepo, revwalk.Options{Order: revwalk.OrderTopo})
+	if strings.Contains(rev, "..") {
+		if err := w.AddRevisions([]string{rev}); err != nil {
+			return nil, err
+		}
+		walked, err := w.Walk()
+		if err != nil {
+			return nil, err
+		}
+		if len(walked) == 0 {
+			return nil, fmt.Errorf("empty commit set passed: %s", rev)
+		}
+		commits = walked
+		if action == "pick" {
+			for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+				commits[i], commits[j] = commits[j], commits[i]
+			}
+		}
+	} else {
+		sha, err := objects.ObjectFind(gitRepo, rev, "commit", true)
+		if err != nil {
+			return nil, err
+		}
+		if sha == "" {
+			return nil, fmt.Errorf("%s is not a commit", rev)
+		}
+		c, err := w.Lookup(sha)
+		if err != nil {
+			return nil, err
+		}
+		commits = []*revwalk.Commit{c}
+	}
+
+	items := make([]sequencerItem, len(commits))
+	for i, c := range commits {
+		items[i] = sequencerItem{action: action, sha: c.SHA, subject: logSubject(c.Commit.Message)}
+	}
+	return items, nil
+}
+
+// sequencerContinue commits the stopped pick once its conflicts are
+// resolved, unless the user already did, and goes on with the series.
+func sequencerContinue(gitRepo *repo.GitRepository, s *sequencer, pending *sequencerPending) error {
+	idx, err := index.IndexRead(gitRepo)
+	if err != nil {
+		return err
+	}
+	if unmerged := idx.Unmerged(); len(unmerged) > 0 {
+		return fmt.Errorf("you have unmerged files:\n\t%s\nresolve them and mark them with add first", strings.Join(unmerged, "\n\t"))
+	}
+	if pending != nil {
+		head, err := objects.ObjectFind(gitRepo, "HEAD", "commit", true)
+		if err != nil {
+			return err
+		}
+		headTree, err := diffTree(gitRepo, head)
+		if err != nil {
+			return err
+		}
+		tree, err := treeFromIndex(gitRepo, idx)
+		if err != nil {
+			return err
+		}
+		if tree == headTree {
+			return errors.New("nothing to commit\nuse --skip to leave this commit out")
+		}
+		if err := sequencerCommitPending(gitRepo, pending, tree, head); err != nil {
+			return err
+		}
+	}
+	if s == nil {
+		return nil
+	}
+	return s.run()
+}
+
+// sequencerSkip drops the changes of the stopped pick and goes on with the
+// series.
+func sequencerSkip(gitRepo *repo.GitRepository, s *sequencer) error {
+	if err := sequencerReset(gitRepo, "HEAD"); err != nil {
+		return err
+	}
+	if err := sequencerPendingRemove(gitRepo); err != nil {
+		return err
+	}
+	if s == nil {
+		return nil
+	}
+	return s.run()
+}
+
+// sequencerAbort returns HEAD, the index and the worktree to where the
+// series started, and forgets it.
+func sequencerAbort(gitRepo *repo.GitRepository, s *sequencer) error {
+	head, err := objects.ObjectFind(gitRepo, "HEAD", "commit", true)
+	if err != nil {
+		return err
+	}
+	start := head
+	if s != nil {
+		start = s.head
+	}
+	if err := sequencerReset(gitRepo, start); err != nil {
+		return err
+	}
+	if start != head {
+		if err := headUpdate(gitRepo, start, head, "reset: moving to "+start); err != nil {
+			return err
+		}
+	}
+	if err := sequencerPendingRemove(gitRepo); err != nil {
+		return err
+	}
+	if s == nil {
+		return nil
+	}
+	return s.remove()
+}
+
+// sequencerReset sets the index and worktree to the tree of rev.
+func sequencerReset(gitRepo *repo.GitRepository, rev string) error {
+	tree, err := diffTree(gitRepo, rev)
+	if err != nil {
+		return err
+	}
+	idx, err := index.IndexLock(gitRepo)
+	if err != nil {
+		return err
+	}
+	defer idx.Unlock()
+	return worktreeReset(gitRepo, idx, tree)
+}
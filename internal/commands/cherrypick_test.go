@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// testReset moves HEAD to rev and resets the index and worktree to it, as
+// `git reset --hard` does.
+func testReset(t *testing.T, gitRepo *repo.GitRepository, rev string) {
+	t.Helper()
+	head := testResolve(t, gitRepo, "HEAD")
+	sha := testResolve(t, gitRepo, rev)
+	if err := sequencerReset(gitRepo, sha); err != nil {
+		t.Fatalf("sequencerReset() failed: %v", err)
+	}
+	if err := headUpdate(gitRepo, sha, head, "reset: moving to "+rev); err != nil {
+		t.Fatalf("headUpdate() failed: %v", err)
+	}
+}
+
+// testSubjects returns the subjects of the first n commits from HEAD
+// along first parents.
+func testSubjects(t *testing.T, gitRepo *repo.GitRepository, n int) []string {
+	t.Helper()
+	var subjects []string
+	sha := testResolve(t, gitRepo, "HEAD")
+	for i := 0; i < n && sha != ""; i++ {
+		obj, err := objects.ObjectRead(gitRepo, sha)
+		if err != nil {
+			t.Fatalf("ObjectRead() failed: %v", err)
+		}
+		c := obj.(*objects.GitCommit)
+		subjects = append(subjects, logSubject(c.Message))
+		sha = ""
+		if parents := c.Kvlm["parent"]; len(parents) > 0 {
+			sha = parents[0]
+		}
+	}
+	return subjects
+}
+
+func TestCherryPick_SeveralCommits(t *testing.T) {
+	gitRepo := testRepo(t)
+	base := testCommit(t, gitRepo, "base", "a.txt", "a\n", "b.txt", "b\n", "c.txt", "c\n")
+	testCommit(t, gitRepo, "change a", "a.txt", "a1\n")
+	c2 := testCommit(t, gitRepo, "change b", "b.txt", "b1\n")
+	c3 := testCommit(t, gitRepo, "change c", "c.txt", "c1\n")
+	testReset(t, gitRepo, base)
+
+	// Single commits keep the order given; a range expands oldest first
+	if _, err := testOutput(t, func() error {
+		return CmdCherryPick([]string{c3, base + ".." + c2}, false, false, false, false)
+	}); err != nil {
+		t.Fatalf("CmdCherryPick() failed: %v", err)
+	}
+	want := []string{"change b", "change a", "change c", "base"}
+	if got := testSubjects(t, gitRepo, 4); !equalStrings(got, want) {
+		t.Errorf("Expected history %v, got %v", want, got)
+	}
+	for name, content := range map[string]string{"a.txt": "a1\n", "b.txt": "b1\n", "c.txt": "c1\n"} {
+		if got := testRead(t, gitRepo, name); got != content {
+			t.Errorf("Expected %s to hold %q, got %q", name, content, got)
+		}
+	}
+	if s, err := sequencerLoad(gitRepo); err != nil || s != nil {
+		t.Errorf("Expected the finished series to be forgotten, got %v, %v", s, err)
+	}
+	if _, err := testOutput(t, func() error {
+		return CmdCherryPick(nil, false, false, false, false)
+	}); err == nil {
+		t.Errorf("Expected cherry-pick without commits to fail")
+	}
+
+	// Reverting the pick of "change a" and then that of "change b"
+	pickedB := testResolve(t, gitRepo, "HEAD")
+	obj, err := objects.ObjectRead(gitRepo, pickedB)
+	if err != nil {
+		t.Fatalf("ObjectRead() failed: %v", err)
+	}
+	pickedA := obj.(*objects.GitCommit).Kvlm["parent"][0]
+	if _, err := testOutput(t, func() error {
+		return CmdRevert([]string{pickedA, pickedB}, false, false, false)
+	}); err != nil {
+		t.Fatalf("CmdRevert() failed: %v", err)
+	}
+	want = []string{`Revert "change b"`, `Revert "change a"`, "change b"}
+	if got := testSubjects(t, gitRepo, 3); !equalStrings(got, want) {
+		t.Errorf("Expected history %v, got %v", want, got)
+	}
+	if got := testRead(t, gitRepo, "a.txt") + testRead(t, gitRepo, "b.txt"); got != "a\nb\n" {
+		t.Errorf("Expected a.txt and b.txt to be reverted, got %q", got)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,200 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/ignore"
+	"github.com/Notwinner0/gvcs/internal/index"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// cleaner decides which untracked files and directories clean removes.
+type cleaner struct {
+	gitRepo     *repo.GitRepository
+	rules       *ignore.GitIgnore
+	tracked     map[string]bool
+	trackedDirs map[string]bool
+	dirs        bool // -d: also remove untracked directories
+	onlyIgnored bool // -X: remove ignored files only
+}
+
+// CmdClean removes untracked files from the worktree. Ignored files are
+// kept unless ignored or onlyIgnored is set, and excludes add patterns
+// that count as ignored even then. Unless clean.requireForce is false,
+// either force or dryRun must be given.
+func CmdClean(dryRun, force, dirs, ignored, onlyIgnored bool, excludes []string) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+	if ignored && onlyIgnored {
+		return errors.New("-x and -X cannot be used together")
+	}
+	if !dryRun && !force {
+		requireForce, err := gitRepo.Conf.GetBool("clean", "requireforce")
+		if err != nil {
+			return errors.New("clean.requireForce defaults to true and neither -n nor -f given; refusing to clean")
+		}
+		if requireForce {
+			return errors.New("clean.requireForce set to true and neither -n nor -f given; refusing to clean")
+		}
+	}
+
+	idx, err := index.IndexRead(gitRepo)
+	if err != nil {
+		return err
+	}
+	c := &cleaner{
+		gitRepo:     gitRepo,
+		tracked:     make(map[string]bool),
+		trackedDirs: make(map[string]bool),
+		dirs:        dirs,
+		onlyIgnored: onlyIgnored,
+	}
+	for _, e := range idx.Entries {
+		c.tracked[e.Name] = true
+		for dir := path.Dir(e.Name); dir != "."; dir = path.Dir(dir) {
+			c.trackedDirs[dir] = true
+		}
+	}
+	if ignored {
+		c.rules = &ignore.GitIgnore{}
+	} else if c.rules, err = ignore.GitignoreRead(gitRepo); err != nil {
+		return err
+	}
+	c.rules.AddExcludes(excludes)
+
+	items, err := c.list()
+	if err != nil {
+		return err
+	}
+	sort.Strings(items)
+
+	for _, name := range items {
+		if dryRun {
+			fmt.Printf("Would remove %s\n", name)
+			continue
+		}
+		fmt.Printf("Removing %s\n", name)
+		if err := os.RemoveAll(filepath.Join(gitRepo.Worktree, filepath.FromSlash(name))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// list lists what to remove, with directories removed as a whole ending
+// in a slash.
+func (c *cleaner) list() ([]string, error) {
+	var items []string
+	var untrackedDirs []string
+	// Directories holding something that stays, and so not removed whole
+	kept := make(map[string]bool)
+	keep := func(dir string) {
+		for ; dir != "."; dir = path.Dir(dir) {
+			kept[dir] = true
+		}
+	}
+
+	err := worktreeWalk(c.gitRepo, func(name string, dir, nested bool) error {
+		switch {
+		case nested:
+			// Nested repositories are never touched.
+			keep(name)
+		case !dir:
+			if !c.tracked[name] && c.removeFile(name) {
+				items = append(items, name)
+			} else {
+				keep(path.Dir(name))
+			}
+		case c.trackedDirs[name]:
+		case c.onlyIgnored:
+			// -X looks for ignored files in untracked directories even
+			// without -d, but only removes a whole directory with it.
+			if !ignore.CheckIgnoreDir(c.rules, name) {
+				untrackedDirs = append(untrackedDirs, name)
+				return nil
+			}
+			if c.dirs {
+				items = append(items, name+"/")
+			} else {
+				keep(name)
+			}
+			return filepath.SkipDir
+		default:
+			// Otherwise an untracked directory is left alone without -d,
+			// and so is an ignored one.
+			if !c.dirs || ignore.CheckIgnoreDir(c.rules, name) {
+				keep(name)
+				return filepath.SkipDir
+			}
+			untrackedDirs = append(untrackedDirs, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Directories whose files are not listed one by one: those removed as
+	// a whole, and with -X but not -d those holding nothing but ignored
+	// files, which count as ignored themselves. Inner directories come
+	// first, so that what they keep is known for the outer ones.
+	folded := make(map[string]bool)
+	for i := len(untrackedDirs) - 1; i >= 0; i-- {
+		name := untrackedDirs[i]
+		if kept[name] {
+			continue
+		}
+		if c.onlyIgnored && !cleanHolds(items, name) {
+			keep(name)
+			continue
+		}
+		folded[name] = true
+		if c.dirs {
+			items = append(items, name+"/")
+		} else {
+			keep(name)
+		}
+	}
+
+	var listed []string
+	for _, item := range items {
+		inFolded := false
+		for dir := path.Dir(strings.TrimSuffix(item, "/")); dir != "."; dir = path.Dir(dir) {
+			if folded[dir] {
+				inFolded = true
+				break
+			}
+		}
+		if !inFolded {
+			listed = append(listed, item)
+		}
+	}
+	return listed, nil
+}
+
+// cleanHolds reports whether any of items is below dir.
+func cleanHolds(items []string, dir string) bool {
+	for _, item := range items {
+		if strings.HasPrefix(item, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// removeFile reports whether the untracked file name is to be removed.
+func (c *cleaner) removeFile(name string) bool {
+	ignored := ignore.CheckIgnore(c.rules, name)
+	if c.onlyIgnored {
+		return ignored
+	}
+	return !ignored
+}
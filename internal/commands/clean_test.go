@@ -0,0 +1,82 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClean(t *testing.T) {
+	gitRepo := testRepo(t)
+	testCommit(t, gitRepo, "base", "a.txt", "a\n", ".gitignore", "*.log\nbuild/\n", "sub/t.txt", "t\n")
+	for _, name := range []string{"u.txt", "x.log", "sub/u.txt", "dir/v.txt", "dir/w.log", "build/out.o", "logs/only.log"} {
+		testWrite(t, gitRepo, name, name+"\n")
+	}
+	if err := os.MkdirAll(filepath.Join(gitRepo.Worktree, "empty"), 0755); err != nil {
+		t.Fatalf("MkdirAll() failed: %v", err)
+	}
+	testWrite(t, gitRepo, "nested/.git/HEAD", "ref: refs/heads/master\n")
+	testWrite(t, gitRepo, "nested/file.txt", "nested\n")
+
+	tests := []struct {
+		name                       string
+		dirs, ignored, onlyIgnored bool
+		want                       string
+	}{
+		{"untracked files", false, false, false,
+			"Would remove sub/u.txt\nWould remove u.txt\n"},
+		{"-d", true, false, false,
+			"Would remove dir/v.txt\nWould remove empty/\nWould remove sub/u.txt\nWould remove u.txt\n"},
+		{"-x -d", true, true, false,
+			"Would remove build/\nWould remove dir/\nWould remove empty/\nWould remove logs/\nWould remove sub/u.txt\nWould remove u.txt\nWould remove x.log\n"},
+		{"-X", false, false, true,
+			"Would remove dir/w.log\nWould remove x.log\n"},
+		{"-X -d", true, false, true,
+			"Would remove build/\nWould remove dir/w.log\nWould remove logs/\nWould remove x.log\n"},
+	}
+	for _, tt := range tests {
+		out, err := testOutput(t, func() error {
+			return CmdClean(true, false, tt.dirs, tt.ignored, tt.onlyIgnored, nil)
+		})
+		if err != nil {
+			t.Fatalf("%s: CmdClean() failed: %v", tt.name, err)
+		}
+		if out != tt.want {
+			t.Errorf("%s: expected:\n%s\ngot:\n%s", tt.name, tt.want, out)
+		}
+	}
+	// -n only lists
+	if got := testRead(t, gitRepo, "u.txt"); got != "u.txt\n" {
+		t.Errorf("Expected a dry run to keep u.txt, got %q", got)
+	}
+
+	if err := CmdClean(false, false, false, false, false, nil); err == nil {
+		t.Errorf("Expected clean without -n or -f to be refused")
+	}
+	if err := CmdClean(true, false, false, true, true, nil); err == nil {
+		t.Errorf("Expected -x with -X to be refused")
+	}
+
+	// -e adds patterns even with -x
+	out, err := testOutput(t, func() error { return CmdClean(true, false, false, true, false, []string{"u.txt"}) })
+	if err != nil {
+		t.Fatalf("CmdClean() failed: %v", err)
+	}
+	if want := "Would remove x.log\n"; out != want {
+		t.Errorf("-x -e: expected %q, got %q", want, out)
+	}
+
+	if _, err := testOutput(t, func() error { return CmdClean(false, true, true, false, false, nil) }); err != nil {
+		t.Fatalf("CmdClean() failed: %v", err)
+	}
+	for _, name := range []string{"u.txt", "sub/u.txt", "dir/v.txt", "empty"} {
+		if _, err := os.Stat(filepath.Join(gitRepo.Worktree, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s removed, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"a.txt", "sub/t.txt", "x.log", "dir/w.log", "build/out.o", "logs/only.log", "nested/file.txt"} {
+		if testRead(t, gitRepo, name) == "" {
+			t.Errorf("Expected %s kept", name)
+		}
+	}
+}
@@ -15,15 +15,45 @@ import (
 	"github.com/Notwinner0/gvcs/internal/repo"
 )
 
-func commitCreate(gitRepo *repo.GitRepository, tree, parent, message string) (string, error) {
+// commitWrite writes a commit of tree with the given parents, committed by
+// the user now. author is an author line, "Name <email> <time> <zone>", or
+// "" for the user now too.
+func commitWrite(gitRepo *repo.GitRepository, tree string, parents []string, author, message string) (string, error) {
 	commit := &objects.GitCommit{
 		Kvlm: make(map[string][]string),
 	}
 	commit.Kvlm["tree"] = []string{tree}
-	if parent != "" {
-		commit.Kvlm["parent"] = []string{parent}
+	if len(parents) > 0 {
+		commit.Kvlm["parent"] = parents
+	}
+
+	committer, err := userSignature(gitRepo)
+	if err != nil {
+		return "", err
+	}
+	if author == "" {
+		author = committer
+	}
+	commit.Kvlm["author"] = []string{author}
+	commit.Kvlm["committer"] = []string{committer}
+	commit.Message = message
+
+	return objects.ObjectWrite(commit, gitRepo)
+}
+
+// userSignature returns the user's identity with the current time, as an
+// author or committer line has it.
+func userSignature(gitRepo *repo.GitRepository) (string, error) {
+	ident, err := userIdent(gitRepo)
+	if err != nil {
+		return "", err
 	}
+	now := time.Now()
+	return fmt.Sprintf("%s %d %s", ident, now.Unix(), now.Format("-0700")), nil
+}
 
+// userIdent returns "Name <email>" from the repository or global config.
+func userIdent(gitRepo *repo.GitRepository) (string, error) {
 	// Get author name and email from git config (mirror libwyag - no fallbacks)
 	var authorName, authorEmail string
 
@@ -42,15 +72,7 @@ func commitCreate(gitRepo *repo.GitRepository, tree, parent, message string) (st
 	if authorName == "" || authorEmail == "" {
 		return "", errors.New("user name and email not configured")
 	}
-	author := fmt.Sprintf("%s <%s>", authorName, authorEmail)
-
-	timestamp := time.Now().Format("15:04:05 2006 -0700")
-
-	commit.Kvlm["author"] = []string{fmt.Sprintf("%s %d %s", author, time.Now().Unix(), timestamp[len(timestamp)-5:])}
-	commit.Kvlm["committer"] = commit.Kvlm["author"]
-	commit.Message = message
-
-	return objects.ObjectWrite(commit, gitRepo)
+	return fmt.Sprintf("%s <%s>", authorName, authorEmail), nil
 }
 
 // treeFromIndex builds a tree object from the current index.
@@ -71,6 +93,16 @@ func treeFromIndex(gitRepo *repo.GitRepository, idx *index.GitIndex) (string, er
 		dirEntries[dir] = append(dirEntries[dir], leaf)
 	}
 
+	// Directories holding only subdirectories need trees too
+	for dir := range dirEntries {
+		for dir != "" {
+			dir = treeParentDir(dir)
+			if _, ok := dirEntries[dir]; !ok {
+				dirEntries[dir] = nil
+			}
+		}
+	}
+
 	// Build trees from the bottom up
 	var dirs []string
 	for k := range dirEntries {
@@ -88,9 +120,9 @@ func treeFromIndex(gitRepo *repo.GitRepository, idx *index.GitIndex) (string, er
 
 		// Add subtrees that we've already built
 		for subDir, sha := range treeSHAs {
-			if filepath.Dir(subDir) == dir {
+			if subDir != "" && treeParentDir(subDir) == dir {
 				leaf := objects.GitTreeLeaf{
-					Mode: "040000",
+					Mode: "40000",
 					Path: filepath.Base(subDir),
 					SHA:  sha,
 				}
@@ -107,6 +139,19 @@ func treeFromIndex(gitRepo *repo.GitRepository, idx *index.GitIndex) (string, er
 	return treeSHAs[""], nil
 }
 
+// treeParentDir returns the directory containing dir, "" for the top level.
+func treeParentDir(dir string) string {
+	parent := filepath.Dir(dir)
+	if parent == "." {
+		return ""
+	}
+	return parent
+}
+
+// CmdCommit is the handler for the commit command. It records the index
+// as a new commit on top of HEAD. While a cherry-pick or revert is stopped
+// by conflicts, an empty message is taken from the one it prepared, and a
+// cherry-pick keeps the author of the picked commit.
 func CmdCommit(message string) error {
 	gitRepo, err := repo.RepoFind(".", true)
 	if err != nil {
@@ -116,6 +161,9 @@ func CmdCommit(message string) error {
 	if err != nil {
 		return err
 	}
+	if unmerged := idx.Unmerged(); len(unmerged) > 0 {
+		return fmt.Errorf("committing is not possible because you have unmerged files:\n\t%s", strings.Join(unmerged, "\n\t"))
+	}
 
 	// Create trees
 	treeSHA, err := treeFromIndex(gitRepo, idx)
@@ -130,16 +178,50 @@ func CmdCommit(message string) error {
 		parent = ""
 	}
 
+	pending, err := sequencerPendingRead(gitRepo)
+	if err != nil {
+		return err
+	}
+	if message == "" && pending != nil {
+		message = pending.message
+	}
+	if strings.TrimSpace(message) == "" {
+		return errors.New("aborting commit due to empty commit message")
+	}
+
 	// Trim message and add newline (mirror libwyag)
 	message = strings.TrimSpace(message) + "\n"
 
 	// Create the commit object
-	commitSHA, err := commitCreate(gitRepo, treeSHA, parent, message)
+	var parents []string
+	if parent != "" {
+		parents = []string{parent}
+	}
+	author := ""
+	if pending != nil {
+		author = pending.author
+	}
+	commitSHA, err := commitWrite(gitRepo, treeSHA, parents, author, message)
 	if err != nil {
 		return err
 	}
 
-	// Update HEAD
+	reflogMessage := "commit: "
+	switch {
+	case parent == "":
+		reflogMessage = "commit (initial): "
+	case pending != nil && pending.head == sequencerCherryPickHead:
+		reflogMessage = "commit (cherry-pick): "
+	}
+	if err := headUpdate(gitRepo, commitSHA, parent, reflogMessage+logSubject(message)); err != nil {
+		return err
+	}
+	return sequencerPendingRemove(gitRepo)
+}
+
+// headUpdate moves HEAD, or the branch it is on, from old to commit,
+// logging message. old is "" for an unborn branch.
+func headUpdate(gitRepo *repo.GitRepository, commit, old, message string) error {
 	branch, detached, err := refs.BranchGetActive(gitRepo)
 	if err != nil {
 		return err
@@ -151,7 +233,19 @@ func CmdCommit(message string) error {
 		refToUpdate = "refs/heads/" + branch
 	}
 
-	return refs.RefCreate(gitRepo, refToUpdate, commitSHA)
+	// The ref must still be where we found it; if another process moved
+	// it meanwhile, fail instead of silently dropping its commit.
+	expected := old
+	if old == "" {
+		expected = refs.ZeroSHA
+	}
+
+	tx := refs.RefTransactionBegin(gitRepo)
+	tx.Committer, _ = userIdent(gitRepo)
+	if err := tx.Update(refToUpdate, commit, expected, message); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // parseUserConfig parses user name and email from a Git config file
@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"io"
+	"testing"
+
+	"github.com/Notwinner0/gvcs/internal/index"
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+const testBlobSHA = "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"
+
+func newTestIndex(names ...string) *index.GitIndex {
+	idx := &index.GitIndex{Version: 2}
+	for _, name := range names {
+		idx.Entries = append(idx.Entries, &index.GitIndexEntry{Mode: 0100644, SHA: testBlobSHA, Name: name})
+	}
+	return idx
+}
+
+func TestTreeFromIndex_SubtreeMode(t *testing.T) {
+	gitRepo, err := repo.RepoCreate(t.TempDir())
+	if err != nil {
+		t.Fatalf("RepoCreate() failed: %v", err)
+	}
+
+	// "a-b.txt" sorts before the directory "a", which compares as "a/"
+	sha, err := treeFromIndex(gitRepo, newTestIndex("a-b.txt", "a/x.txt"))
+	if err != nil {
+		t.Fatalf("treeFromIndex() failed: %v", err)
+	}
+
+	header, r, err := objects.ObjectReader(gitRepo, sha)
+	if err != nil {
+		t.Fatalf("ObjectReader() failed: %v", err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatalf("reading tree %s failed: %v", sha, err)
+	}
+	if problems := objects.ObjectCheck(header.Type, data); len(problems) != 0 {
+		t.Errorf("Expected a tree fsck accepts, got %v", problems)
+	}
+
+	tree := new(objects.GitTree)
+	if err := tree.Deserialize(data); err != nil {
+		t.Fatalf("Deserialize() failed: %v", err)
+	}
+	if len(tree.Items) != 2 || tree.Items[0].Path != "a-b.txt" || tree.Items[1].Path != "a" {
+		t.Fatalf("Expected entries a-b.txt and a, got %+v", tree.Items)
+	}
+	if mode := tree.Items[1].Mode; mode != "40000" {
+		t.Errorf("Expected subtree mode 40000, got %s", mode)
+	}
+}
+
+func TestTreeFromIndex_DirectoryOfDirectories(t *testing.T) {
+	gitRepo, err := repo.RepoCreate(t.TempDir())
+	if err != nil {
+		t.Fatalf("RepoCreate() failed: %v", err)
+	}
+
+	// "a" holds no files of its own, only the directory "b"
+	sha, err := treeFromIndex(gitRepo, newTestIndex("a/b/c.txt", "d.txt"))
+	if err != nil {
+		t.Fatalf("treeFromIndex() failed: %v", err)
+	}
+	treeMap, err := objects.TreeToMap(gitRepo, sha, "")
+	if err != nil {
+		t.Fatalf("TreeToMap() failed: %v", err)
+	}
+	for _, name := range []string{"a/b/c.txt", "d.txt"} {
+		if treeMap[name] != testBlobSHA {
+			t.Errorf("Expected %s in the tree, got %v", name, treeMap)
+		}
+	}
+}
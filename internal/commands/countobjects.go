@@ -0,0 +1,334 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/refs"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// packFileExts are the files that may accompany a pack.
+var packFileExts = map[string]bool{
+	".pack": true, ".idx": true, ".keep": true, ".bitmap": true, ".rev": true, ".promisor": true,
+}
+
+// CmdCountObjects is the handler for the count-objects command. Sizes are
+// in KiB unless human is set; as in git, loose objects count the disk space
+// they use and packs and garbage their length.
+func CmdCountObjects(verbose, human, stats bool, top int) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+	if stats {
+		return countStats(gitRepo, top, human)
+	}
+
+	packs, err := objects.PackList(gitRepo)
+	if err != nil {
+		return err
+	}
+
+	var count, prunePackable, garbage int
+	var size, sizeGarbage int64
+	addGarbage := func(path string, n int64) {
+		garbage++
+		sizeGarbage += n
+		if verbose {
+			if cwd, err := os.Getwd(); err == nil {
+				if rel, err := filepath.Rel(cwd, path); err == nil {
+					path = rel
+				}
+			}
+			fmt.Fprintf(os.Stderr, "warning: garbage found: %s\n", filepath.ToSlash(path))
+		}
+	}
+
+	root := repo.RepoPath(gitRepo, "objects")
+	dirs, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || !looseDirRE.MatchString(dir.Name()) {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(root, dir.Name()))
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			info, err := f.Info()
+			if err != nil {
+				continue
+			}
+			if !looseFileRE.MatchString(f.Name()) {
+				addGarbage(filepath.Join(root, dir.Name(), f.Name()), info.Size())
+				continue
+			}
+			count++
+			size += repo.DiskUsage(info)
+			sha := dir.Name() + f.Name()
+			for _, p := range packs {
+				if p.Contains(sha) {
+					prunePackable++
+					break
+				}
+			}
+		}
+	}
+
+	// A pack counts only with its index; anything else is garbage
+	var inPack int
+	var sizePack int64
+	packDir := filepath.Join(root, "pack")
+	files, err := os.ReadDir(packDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	names := make(map[string]bool)
+	for _, f := range files {
+		names[f.Name()] = true
+	}
+	for _, f := range files {
+		info, err := f.Info()
+		if err != nil || f.IsDir() {
+			continue
+		}
+		ext := filepath.Ext(f.Name())
+		base := strings.TrimSuffix(f.Name(), ext)
+		switch {
+		case !strings.HasPrefix(f.Name(), "pack-") || !packFileExts[ext]:
+			addGarbage(filepath.Join(packDir, f.Name()), info.Size())
+		case ext == ".pack" && !names[base+".idx"], ext == ".idx" && !names[base+".pack"]:
+			addGarbage(filepath.Join(packDir, f.Name()), info.Size())
+		case ext == ".pack" || ext == ".idx":
+			sizePack += info.Size()
+		}
+	}
+	for _, p := range packs {
+		inPack += len(p.Objects())
+	}
+
+	formatSize := func(n int64) string {
+		if human {
+			return countHumanise(n)
+		}
+		return fmt.Sprint(n / 1024)
+	}
+	if !verbose {
+		if human {
+			fmt.Printf("%d objects, %s\n", count, formatSize(size))
+		} else {
+			fmt.Printf("%d objects, %s kilobytes\n", count, formatSize(size))
+		}
+		return nil
+	}
+	fmt.Printf("count: %d\n", count)
+	fmt.Printf("size: %s\n", formatSize(size))
+	fmt.Printf("in-pack: %d\n", inPack)
+	fmt.Printf("packs: %d\n", len(packs))
+	fmt.Printf("size-pack: %s\n", formatSize(sizePack))
+	fmt.Printf("prune-packable: %d\n", prunePackable)
+	fmt.Printf("garbage: %d\n", garbage)
+	fmt.Printf("size-garbage: %s\n", formatSize(sizeGarbage))
+	return nil
+}
+
+// countHumanise formats a byte count the way git does for -H.
+func countHumanise(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%d.%02d GiB", n>>30, (n&(1<<30-1))*100>>30)
+	case n >= 1<<20:
+		return fmt.Sprintf("%d.%02d MiB", n>>20, (n&(1<<20-1))*100>>20)
+	case n >= 1<<10:
+		return fmt.Sprintf("%d.%02d KiB", n>>10, (n&(1<<10-1))*100>>10)
+	case n == 1:
+		return "1 byte"
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// countTotal accumulates the number and size of one type of object.
+type countTotal struct {
+	count int
+	size  int64
+}
+
+// countEntry is one line of a "largest" table.
+type countEntry struct {
+	value int64
+	sha   string
+	label string
+}
+
+// countStatsState collects statistics while walking the history.
+type countStatsState struct {
+	gitRepo     *repo.GitRepository
+	seen        map[string]bool
+	paths       map[string]bool // paths already listed
+	totals      map[string]*countTotal
+	treeEntries int
+	blobs       []countEntry
+	commits     []countEntry
+	trees       []countEntry // directories by nesting depth
+	longest     []countEntry // file paths by length
+}
+
+// countStats walks every object reachable from HEAD and the refs and
+// reports totals and the largest items, in the spirit of git-sizer. Blob
+// paths are the first ones under which the walk met the blob.
+func countStats(gitRepo *repo.GitRepository, top int, human bool) error {
+	st := &countStatsState{
+		gitRepo: gitRepo,
+		seen:    make(map[string]bool),
+		paths:   make(map[string]bool),
+		totals:  make(map[string]*countTotal),
+	}
+	for _, t := range []string{"commit", "tree", "blob", "tag"} {
+		st.totals[t] = &countTotal{}
+	}
+
+	var tips []string
+	if head, err := refs.RefResolve(gitRepo, "HEAD"); err == nil && head != "" {
+		tips = append(tips, head)
+	}
+	entries, err := refs.RefListSorted(gitRepo)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.SHA != "" {
+			tips = append(tips, e.SHA)
+		}
+	}
+	for _, sha := range tips {
+		if err := st.visit(sha, ""); err != nil {
+			return err
+		}
+	}
+
+	formatSize := func(n int64) string {
+		if human {
+			return countHumanise(n)
+		}
+		return fmt.Sprintf("%d bytes", n)
+	}
+	fmt.Printf("Reachable objects from %d refs:\n", len(tips))
+	for _, t := range []string{"commit", "tree", "blob", "tag"} {
+		total := st.totals[t]
+		fmt.Printf("  %ss: %d (%s)\n", t, total.count, formatSize(total.size))
+	}
+	fmt.Printf("  tree entries: %d\n", st.treeEntries)
+
+	tables := []struct {
+		title   string
+		entries []countEntry
+		format  func(e countEntry) string
+	}{
+		{"Largest blobs", st.blobs, func(e countEntry) string { return formatSize(e.value) }},
+		{"Biggest commits", st.commits, func(e countEntry) string { return formatSize(e.value) }},
+		{"Deepest trees", st.trees, func(e countEntry) string { return fmt.Sprintf("depth %d", e.value) }},
+		{"Longest paths", st.longest, func(e countEntry) string { return fmt.Sprintf("%d chars", e.value) }},
+	}
+	for _, table := range tables {
+		entries := table.entries
+		sort.SliceStable(entries, func(i, j int) bool {
+			if entries[i].value != entries[j].value {
+				return entries[i].value > entries[j].value
+			}
+			return entries[i].label < entries[j].label
+		})
+		if top > 0 && len(entries) > top {
+			entries = entries[:top]
+		}
+		fmt.Printf("\n%s:\n", table.title)
+		for _, e := range entries {
+			fmt.Printf("  %-12s %s  %s\n", table.format(e), e.sha, e.label)
+		}
+	}
+	return nil
+}
+
+// visit records an object and everything it reaches. path is where a tree
+// or blob was found, relative to the root tree.
+func (st *countStatsState) visit(sha, path string) error {
+	if st.seen[sha] {
+		return nil
+	}
+	st.seen[sha] = true
+
+	header, r, err := objects.ObjectReader(st.gitRepo, sha)
+	if err != nil {
+		return err
+	}
+	r.Close()
+	if total, ok := st.totals[header.Type]; ok {
+		total.count++
+		total.size += header.Size
+	}
+	if header.Type == "blob" {
+		st.blobs = append(st.blobs, countEntry{value: header.Size, sha: sha, label: path})
+		return nil
+	}
+
+	obj, err := objects.ObjectRead(st.gitRepo, sha)
+	if err != nil {
+		return err
+	}
+	switch o := obj.(type) {
+	case *objects.GitCommit:
+		subject, _, _ := strings.Cut(strings.TrimSpace(o.Message), "\n")
+		st.commits = append(st.commits, countEntry{value: header.Size, sha: sha, label: subject})
+		for _, tree := range o.Kvlm["tree"] {
+			if err := st.visit(tree, ""); err != nil {
+				return err
+			}
+		}
+		for _, parent := range o.Kvlm["parent"] {
+			if err := st.visit(parent, ""); err != nil {
+				return err
+			}
+		}
+	case *objects.GitTag:
+		for _, target := range o.Kvlm["object"] {
+			if err := st.visit(target, ""); err != nil {
+				return err
+			}
+		}
+	case *objects.GitTree:
+		if path != "" && !st.paths[path+"/"] {
+			st.paths[path+"/"] = true
+			depth := int64(strings.Count(path, "/") + 1)
+			st.trees = append(st.trees, countEntry{value: depth, sha: sha, label: path + "/"})
+		}
+		st.treeEntries += len(o.Items)
+		for _, leaf := range o.Items {
+			childPath := leaf.Path
+			if path != "" {
+				childPath = path + "/" + leaf.Path
+			}
+			switch leaf.Mode {
+			case "40000", "040000":
+			case "160000":
+				// Submodule commits live in another repository
+				continue
+			default:
+				if !st.paths[childPath] {
+					st.paths[childPath] = true
+					st.longest = append(st.longest, countEntry{value: int64(len(childPath)), sha: leaf.SHA, label: childPath})
+				}
+			}
+			if err := st.visit(leaf.SHA, childPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package commands
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// testPackBlobs writes a pack and its version 2 index holding blobs with
+// the given contents. It returns the names of the blobs.
+func testPackBlobs(t *testing.T, gitRepo *repo.GitRepository, contents ...string) []string {
+	t.Helper()
+	var pack bytes.Buffer
+	pack.WriteString("PACK")
+	binary.Write(&pack, binary.BigEndian, uint32(2))
+	binary.Write(&pack, binary.BigEndian, uint32(len(contents)))
+
+	type packed struct {
+		sha    string
+		offset uint32
+		crc    uint32
+	}
+	var entries []packed
+	for _, content := range contents {
+		offset := pack.Len()
+		var entry bytes.Buffer
+		size := len(content)
+		c := byte(3<<4) | byte(size&0x0f) // OBJ_BLOB
+		for size >>= 4; size > 0; size >>= 7 {
+			entry.WriteByte(c | 0x80)
+			c = byte(size & 0x7f)
+		}
+		entry.WriteByte(c)
+		z := zlib.NewWriter(&entry)
+		z.Write([]byte(content))
+		z.Close()
+		pack.Write(entry.Bytes())
+
+		sum := sha1.Sum([]byte(fmt.Sprintf("blob %d\x00%s", len(content), content)))
+		entries = append(entries, packed{hex.EncodeToString(sum[:]), uint32(offset), crc32.ChecksumIEEE(entry.Bytes())})
+	}
+	packSum := sha1.Sum(pack.Bytes())
+	pack.Write(packSum[:])
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].sha < entries[j].sha })
+	var idx bytes.Buffer
+	idx.Write([]byte{0xff, 't', 'O', 'c', 0, 0, 0, 2})
+	var fanout [256]uint32
+	for _, e := range entries {
+		raw, _ := hex.DecodeString(e.sha)
+		for b := int(raw[0]); b < 256; b++ {
+			fanout[b]++
+		}
+	}
+	binary.Write(&idx, binary.BigEndian, fanout)
+	var shas []string
+	for _, e := range entries {
+		raw, _ := hex.DecodeString(e.sha)
+		idx.Write(raw)
+		shas = append(shas, e.sha)
+	}
+	for _, e := range entries {
+		binary.Write(&idx, binary.BigEndian, e.crc)
+	}
+	for _, e := range entries {
+		binary.Write(&idx, binary.BigEndian, e.offset)
+	}
+	idx.Write(packSum[:])
+	idxSum := sha1.Sum(idx.Bytes())
+	idx.Write(idxSum[:])
+
+	dir := repo.RepoPath(gitRepo, "objects", "pack")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("MkdirAll() failed: %v", err)
+	}
+	base := filepath.Join(dir, "pack-"+hex.EncodeToString(packSum[:]))
+	if err := os.WriteFile(base+".pack", pack.Bytes(), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+	if err := os.WriteFile(base+".idx", idx.Bytes(), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+	return shas
+}
+
+func TestCountObjects(t *testing.T) {
+	gitRepo := testRepo(t)
+
+	var loose []string
+	for _, content := range []string{"one\n", "two\n"} {
+		blob := new(objects.GitBlob)
+		blob.Deserialize([]byte(content))
+		sha, err := objects.ObjectWrite(blob, gitRepo)
+		if err != nil {
+			t.Fatalf("ObjectWrite() failed: %v", err)
+		}
+		loose = append(loose, sha)
+	}
+	// "two\n" is both loose and packed
+	testPackBlobs(t, gitRepo, "two\n", "three\n", "four\n")
+	garbage := repo.RepoPath(gitRepo, "objects", loose[0][:2], "tmp_obj_123")
+	if err := os.WriteFile(garbage, make([]byte, 3000), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+
+	var size, sizePack int64
+	for _, sha := range loose {
+		info, err := os.Stat(repo.RepoPath(gitRepo, "objects", sha[:2], sha[2:]))
+		if err != nil {
+			t.Fatalf("Stat() failed: %v", err)
+		}
+		size += repo.DiskUsage(info)
+	}
+	packFiles, _ := filepath.Glob(repo.RepoPath(gitRepo, "objects", "pack", "pack-*"))
+	for _, path := range packFiles {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Stat() failed: %v", err)
+		}
+		sizePack += info.Size()
+	}
+
+	out, err := testOutput(t, func() error { return CmdCountObjects(false, false, false, 0) })
+	if err != nil {
+		t.Fatalf("CmdCountObjects() failed: %v", err)
+	}
+	if want := fmt.Sprintf("2 objects, %d kilobytes\n", size/1024); out != want {
+		t.Errorf("Expected %q, got %q", want, out)
+	}
+
+	out, err = testOutput(t, func() error { return CmdCountObjects(true, false, false, 0) })
+	if err != nil {
+		t.Fatalf("CmdCountObjects() failed: %v", err)
+	}
+	want := strings.Join([]string{
+		"count: 2",
+		fmt.Sprintf("size: %d", size/1024),
+		"in-pack: 3",
+		"packs: 1",
+		fmt.Sprintf("size-pack: %d", sizePack/1024),
+		"prune-packable: 1",
+		"garbage: 1",
+		"size-garbage: 2",
+	}, "\n") + "\n"
+	if out != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, out)
+	}
+}
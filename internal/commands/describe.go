@@ -0,0 +1,351 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Notwinner0/gvcs/internal/diff"
+	"github.com/Notwinner0/gvcs/internal/index"
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/refs"
+	"github.com/Notwinner0/gvcs/internal/repo"
+	"github.com/Notwinner0/gvcs/internal/revwalk"
+)
+
+// DescribeOptions holds the flags of the describe command.
+type DescribeOptions struct {
+	Tags     bool     // also use lightweight tags
+	Contains bool     // name the commit after a tag that contains it
+	Dirty    bool     // mark a worktree with changes
+	Long     bool     // always show the distance and commit, even on a tag
+	Abbrev   int      // digits of the commit id; 0 for the tag alone
+	Match    []string // only use tags matching one of these globs
+	Exclude  []string // never use tags matching one of these globs
+}
+
+// describeCandidates is how many tags reachable from a commit are weighed
+// to find the nearest, as git does by default.
+const describeCandidates = 10
+
+// describeMergeWeight is what following a parent other than the first
+// adds to the distance of a name with contains, so that names going
+// through fewer merges win.
+const describeMergeWeight = 65535
+
+// describeTag is a tag that can name commits.
+type describeTag struct {
+	name      string // without refs/tags/
+	commit    string
+	annotated bool
+	date      time.Time // tagger date, or the commit date of a lightweight tag
+}
+
+// CmdDescribe is the handler for the describe command. It names rev, HEAD
+// by default, after the nearest annotated tag it can reach, or any tag
+// with opts.Tags, as <tag>-<distance>-g<abbreviated id>, where distance
+// counts the commits of rev that the tag doesn't have. A tagged commit is
+// named by its tag alone unless opts.Long is set. With opts.Contains, rev
+// is named after the oldest tag that contains it instead, as <tag>~<n>
+// with ^<n> for parents other than the first.
+func CmdDescribe(rev string, opts DescribeOptions) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+	if opts.Dirty && rev != "" {
+		return errors.New("--dirty is incompatible with commit-ishes")
+	}
+	if opts.Dirty && opts.Contains {
+		return errors.New("--contains and --dirty cannot be used together")
+	}
+	if opts.Long && opts.Abbrev == 0 {
+		return errors.New("--long and --abbrev=0 cannot be used together")
+	}
+	if rev == "" {
+		rev = "HEAD"
+	}
+	target, err := objects.ObjectFind(gitRepo, rev, "commit", true)
+	if err != nil {
+		return err
+	}
+	if target == "" {
+		return fmt.Errorf("%s is not a commit", rev)
+	}
+
+	walker := revwalk.New(gitRepo, revwalk.Options{})
+	tags, err := describeTags(gitRepo, walker, opts)
+	if err != nil {
+		return err
+	}
+
+	var name string
+	if opts.Contains {
+		name, err = describeContains(walker, target, tags)
+	} else {
+		name, err = describeNearest(gitRepo, walker, target, tags, opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.Dirty {
+		dirty, err := describeDirty(gitRepo)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			name += "-dirty"
+		}
+	}
+	fmt.Println(name)
+	return nil
+}
+
+// describeTags lists the tags of commits, in name order, that match and
+// aren't excluded by opts.
+func describeTags(gitRepo *repo.GitRepository, walker *revwalk.Walker, opts DescribeOptions) ([]describeTag, error) {
+	entries, err := refs.RefListSorted(gitRepo)
+	if err != nil {
+		return nil, err
+	}
+	var tags []describeTag
+	for _, e := range entries {
+		name, ok := strings.CutPrefix(e.Name, "refs/tags/")
+		if !ok || e.SHA == "" || !describeMatch(name, opts) {
+			continue
+		}
+		tag := describeTag{name: name}
+		obj, err := objects.ObjectRead(gitRepo, e.SHA)
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := obj.(*objects.GitTag); ok {
+			tag.annotated = true
+			if sig, err := objects.SignatureParse(showHeader(t.Kvlm, "tagger")); err == nil {
+				tag.date = sig.When
+			}
+		}
+		if tag.commit, err = refPeelToCommit(gitRepo, e.SHA); err != nil {
+			return nil, err
+		}
+		if tag.commit == "" {
+			continue
+		}
+		if !tag.annotated {
+			c, err := walker.Lookup(tag.commit)
+			if err != nil {
+				return nil, err
+			}
+			tag.date = c.Time
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// describeMatch reports whether a tag passes the --match and --exclude
+// globs.
+func describeMatch(name string, opts DescribeOptions) bool {
+	for _, pattern := range opts.Exclude {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+	if len(opts.Match) == 0 {
+		return true
+	}
+	for _, pattern := range opts.Match {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// describeNearest names target after the nearest tag it can reach.
+// Walking back newest first, the first tagged commits found are the
+// candidates, and the one leaving the fewest commits of target out of its
+// history wins, the earlier found on a tie.
+func describeNearest(gitRepo *repo.GitRepository, walker *revwalk.Walker, target string, tags []describeTag, opts DescribeOptions) (string, error) {
+	// The tag naming each commit: annotated ones first, then the newest.
+	best := make(map[string]describeTag)
+	unannotated := false
+	for _, tag := range tags {
+		if !tag.annotated && !opts.Tags {
+			unannotated = true
+			continue
+		}
+		if cur, ok := best[tag.commit]; ok {
+			if cur.annotated && !tag.annotated || cur.annotated == tag.annotated && !tag.date.After(cur.date) {
+				continue
+			}
+		}
+		best[tag.commit] = tag
+	}
+	if len(best) == 0 {
+		if unannotated {
+			return "", errors.New("no annotated tags can describe '" + target + "'\nhowever, there were unannotated tags: try --tags")
+		}
+		return "", errors.New("no names found, cannot describe anything")
+	}
+
+	abbrev := target[:min(max(opts.Abbrev, 4), len(target))]
+	if tag, ok := best[target]; ok {
+		if opts.Long && opts.Abbrev > 0 {
+			return fmt.Sprintf("%s-0-g%s", tag.name, abbrev), nil
+		}
+		return tag.name, nil
+	}
+
+	walker.Push(target)
+	walked, err := walker.Walk()
+	if err != nil {
+		return "", err
+	}
+	var candidates []describeTag
+	for _, c := range walked {
+		if tag, ok := best[c.SHA]; ok {
+			candidates = append(candidates, tag)
+			if len(candidates) == describeCandidates {
+				break
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no tags can describe '%s'", target)
+	}
+
+	var nearest describeTag
+	depth := -1
+	for _, tag := range candidates {
+		history, err := revwalk.Ancestors(gitRepo, tag.commit)
+		if err != nil {
+			return "", err
+		}
+		d := 0
+		for _, c := range walked {
+			if !history[c.SHA] {
+				d++
+			}
+		}
+		if depth == -1 || d < depth {
+			nearest, depth = tag, d
+		}
+	}
+	if opts.Abbrev == 0 {
+		return nearest.name, nil
+	}
+	return fmt.Sprintf("%s-%d-g%s", nearest.name, depth, abbrev), nil
+}
+
+// describeName is a name given to a commit by walking back from a tag:
+// tip followed by ~generation.
+type describeName struct {
+	tip        string
+	generation int
+	distance   int
+	date       time.Time // the date of the tag
+}
+
+func (n *describeName) String() string {
+	if n.generation == 0 {
+		return n.tip
+	}
+	return strings.TrimSuffix(n.tip, "^0") + "~" + strconv.Itoa(n.generation)
+}
+
+// better reports whether n is a better name than cur: one from an older
+// tag, or from the same tag through fewer merges and commits.
+func (n *describeName) better(cur *describeName) bool {
+	if cur == nil {
+		return true
+	}
+	return cur.date.After(n.date) || cur.date.Equal(n.date) && cur.distance > n.distance
+}
+
+// describeContains names target after a tag that contains it, walking
+// back from every tag to name the commits on the way. Commits more than a
+// day older than target can't lead to it and aren't named.
+func describeContains(walker *revwalk.Walker, target string, tags []describeTag) (string, error) {
+	t, err := walker.Lookup(target)
+	if err != nil {
+		return "", err
+	}
+	cutoff := t.Time.Add(-24 * time.Hour)
+
+	names := make(map[string]*describeName)
+	type step struct {
+		sha  string
+		name *describeName
+	}
+	for _, tag := range tags {
+		tip := tag.name
+		if tag.annotated {
+			tip += "^0"
+		}
+		stack := []step{{tag.commit, &describeName{tip: tip, date: tag.date}}}
+		for len(stack) > 0 {
+			s := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			c, err := walker.Lookup(s.sha)
+			if err != nil {
+				return "", err
+			}
+			if c.Time.Before(cutoff) || !s.name.better(names[s.sha]) {
+				continue
+			}
+			names[s.sha] = s.name
+
+			// Push the first parent last so it is named first.
+			for i := len(c.Parents) - 1; i >= 0; i-- {
+				n := &describeName{tip: s.name.tip, generation: s.name.generation + 1, distance: s.name.distance + 1, date: s.name.date}
+				if i > 0 {
+					tip := strings.TrimSuffix(s.name.tip, "^0")
+					if s.name.generation > 0 {
+						tip += "~" + strconv.Itoa(s.name.generation)
+					}
+					n = &describeName{tip: tip + "^" + strconv.Itoa(i+1), distance: s.name.distance + describeMergeWeight, date: s.name.date}
+				}
+				stack = append(stack, step{c.Parents[i], n})
+			}
+		}
+	}
+
+	name, ok := names[target]
+	if !ok {
+		return "", fmt.Errorf("cannot describe '%s'", target)
+	}
+	return name.String(), nil
+}
+
+// describeDirty reports whether the index or the worktree has changes from
+// HEAD, as status would show them. Untracked files don't count.
+func describeDirty(gitRepo *repo.GitRepository) (bool, error) {
+	idx, err := index.IndexRead(gitRepo)
+	if err != nil {
+		return false, err
+	}
+	if len(idx.Unmerged()) > 0 {
+		return true, nil
+	}
+	headTree, err := diffTree(gitRepo, "HEAD")
+	if err != nil {
+		return false, err
+	}
+	headFiles, err := diff.TreeFiles(gitRepo, headTree, nil)
+	if err != nil {
+		return false, err
+	}
+	if len(diff.FilesDiff(headFiles, diffIndexFiles(idx, nil))) > 0 {
+		return true, nil
+	}
+	changes, err := worktreeChanges(gitRepo, idx)
+	if err != nil {
+		return false, err
+	}
+	return len(changes) > 0, nil
+}
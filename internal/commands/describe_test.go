@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+)
+
+// testDescribe returns what describe prints for rev, failing the test on
+// an error.
+func testDescribe(t *testing.T, rev string, opts DescribeOptions) string {
+	t.Helper()
+	out, err := testOutput(t, func() error { return CmdDescribe(rev, opts) })
+	if err != nil {
+		t.Fatalf("CmdDescribe(%s, %+v) failed: %v", rev, opts, err)
+	}
+	return strings.TrimSuffix(out, "\n")
+}
+
+func TestDescribe(t *testing.T) {
+	gitRepo := testRepo(t)
+	c1 := testCommit(t, gitRepo, "first", "a.txt", "1\n")
+	c2 := testCommit(t, gitRepo, "second", "a.txt", "2\n")
+	c3 := testCommit(t, gitRepo, "third", "a.txt", "3\n")
+	c4 := testCommit(t, gitRepo, "fourth", "a.txt", "4\n")
+	if _, err := testOutput(t, func() error { return CmdDescribe("", DescribeOptions{Abbrev: 7}) }); err == nil {
+		t.Errorf("Expected describe without tags to fail")
+	}
+	for _, tag := range []struct {
+		name, commit string
+		annotated    bool
+	}{{"v1.0", c1, true}, {"light", c2, false}} {
+		if err := CmdTag(tag.name, tag.commit, tag.annotated); err != nil {
+			t.Fatalf("CmdTag() failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		rev  string
+		opts DescribeOptions
+		want string
+	}{
+		// Only annotated tags by default, lightweight ones too with --tags
+		{"", DescribeOptions{Abbrev: 7}, "v1.0-3-g" + c4[:7]},
+		{"", DescribeOptions{Abbrev: 7, Tags: true}, "light-2-g" + c4[:7]},
+		{c3, DescribeOptions{Abbrev: 7, Tags: true}, "light-1-g" + c3[:7]},
+		{c2, DescribeOptions{Abbrev: 7}, "v1.0-1-g" + c2[:7]},
+		// An exact match is the tag alone unless --long
+		{c1, DescribeOptions{Abbrev: 7}, "v1.0"},
+		{c2, DescribeOptions{Abbrev: 7, Tags: true}, "light"},
+		{c1, DescribeOptions{Abbrev: 7, Long: true}, "v1.0-0-g" + c1[:7]},
+		// --abbrev
+		{"", DescribeOptions{Abbrev: 0}, "v1.0"},
+		{"", DescribeOptions{Abbrev: 12}, "v1.0-3-g" + c4[:12]},
+		{"", DescribeOptions{Abbrev: 2}, "v1.0-3-g" + c4[:4]},
+		// --match and --exclude
+		{"", DescribeOptions{Abbrev: 7, Tags: true, Exclude: []string{"l*"}}, "v1.0-3-g" + c4[:7]},
+		// --contains names a commit after a tag that has it, peeling
+		// annotated ones
+		{c1, DescribeOptions{Contains: true}, "v1.0^0"},
+		{c2, DescribeOptions{Contains: true}, "light"},
+	}
+	for _, tt := range tests {
+		if got := testDescribe(t, tt.rev, tt.opts); got != tt.want {
+			t.Errorf("describe %s %+v: expected %q, got %q", tt.rev, tt.opts, tt.want, got)
+		}
+	}
+
+	_, err := testOutput(t, func() error { return CmdDescribe(c3, DescribeOptions{Abbrev: 7, Match: []string{"light"}}) })
+	if err == nil || !strings.Contains(err.Error(), "try --tags") {
+		t.Errorf("Expected a hint at --tags, got %v", err)
+	}
+	if _, err := testOutput(t, func() error { return CmdDescribe(c3, DescribeOptions{Contains: true}) }); err == nil {
+		t.Errorf("Expected --contains to fail without a tag after the commit")
+	}
+	if err := CmdTag("v2.0", c4, true); err != nil {
+		t.Fatalf("CmdTag() failed: %v", err)
+	}
+	if got := testDescribe(t, c3, DescribeOptions{Contains: true}); got != "v2.0~1" {
+		t.Errorf("describe --contains %s: expected %q, got %q", c3, "v2.0~1", got)
+	}
+	if _, err := testOutput(t, func() error { return CmdDescribe("", DescribeOptions{Long: true}) }); err == nil {
+		t.Errorf("Expected --long with --abbrev=0 to be refused")
+	}
+}
+
+func TestDescribe_Dirty(t *testing.T) {
+	gitRepo := testRepo(t)
+	c1 := testCommit(t, gitRepo, "first", "a.txt", "1\n")
+	if err := CmdTag("v1.0", c1, true); err != nil {
+		t.Fatalf("CmdTag() failed: %v", err)
+	}
+	opts := DescribeOptions{Abbrev: 7, Dirty: true}
+
+	if got := testDescribe(t, "", opts); got != "v1.0" {
+		t.Errorf("Expected a clean worktree to describe as %q, got %q", "v1.0", got)
+	}
+	testWrite(t, gitRepo, "u.txt", "untracked\n")
+	if got := testDescribe(t, "", opts); got != "v1.0" {
+		t.Errorf("Expected untracked files not to count, got %q", got)
+	}
+	testWrite(t, gitRepo, "a.txt", "changed\n")
+	if got := testDescribe(t, "", opts); got != "v1.0-dirty" {
+		t.Errorf("Expected an unstaged change to be dirty, got %q", got)
+	}
+	if err := CmdAdd([]string{"a.txt"}); err != nil {
+		t.Fatalf("CmdAdd() failed: %v", err)
+	}
+	if got := testDescribe(t, "", opts); got != "v1.0-dirty" {
+		t.Errorf("Expected a staged change to be dirty, got %q", got)
+	}
+	if _, err := testOutput(t, func() error { return CmdDescribe(c1, opts) }); err == nil {
+		t.Errorf("Expected --dirty with a commit to be refused")
+	}
+}
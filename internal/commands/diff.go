@@ -0,0 +1,379 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/attributes"
+	"github.com/Notwinner0/gvcs/internal/diff"
+	"github.com/Notwinner0/gvcs/internal/index"
+	"github.com/Notwinner0/gvcs/internal/lfs"
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+	"github.com/Notwinner0/gvcs/internal/revwalk"
+)
+
+// DiffOptions holds the flags of the diff command.
+type DiffOptions struct {
+	Cached      bool     // compare with the index instead of the worktree
+	Paths       []string // limit the comparison to these paths
+	FindRenames string   // similarity threshold for renames, as for -M
+	NoRenames   bool
+	FindCopies  bool
+	RenameLimit int
+	Context     int    // lines of context in patches
+	WordDiff    string // word diff mode, "" for whole lines
+
+	// Summaries shown instead of the patch, or before it with Patch
+	Stat       bool
+	Numstat    bool
+	Shortstat  bool
+	NameOnly   bool
+	NameStatus bool
+	Patch      bool
+}
+
+// CmdDiff is the handler for the diff command. With no commits it compares
+// the index with the worktree; with one, that commit with the worktree, or
+// with the index if opts.Cached is set, where the commit defaults to HEAD.
+// Two commits, or "A..B", compare their trees; "A...B" compares B with the
+// merge base of A and B.
+func CmdDiff(revA, revB string, opts DiffOptions) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+	specs, err := pathspecs(gitRepo, opts.Paths)
+	if err != nil {
+		return err
+	}
+	if revB == "" {
+		if left, right, ok := strings.Cut(revA, "..."); ok {
+			if revA, err = diffMergeBase(gitRepo, left, right); err != nil {
+				return err
+			}
+			revB = diffRevDefault(right)
+		} else if left, right, ok := strings.Cut(revA, ".."); ok {
+			revA, revB = diffRevDefault(left), diffRevDefault(right)
+		}
+	}
+	if opts.Cached && revB != "" {
+		return errors.New("--cached takes at most one commit")
+	}
+
+	d := &differ{gitRepo: gitRepo}
+	var changes []diff.Change
+	switch {
+	case revB != "":
+		oldTree, err := diffTree(gitRepo, revA)
+		if err != nil {
+			return err
+		}
+		newTree, err := diffTree(gitRepo, revB)
+		if err != nil {
+			return err
+		}
+		if changes, err = diff.TreeDiff(gitRepo, oldTree, newTree, specs); err != nil {
+			return err
+		}
+	default:
+		idx, err := index.IndexRead(gitRepo)
+		if err != nil {
+			return err
+		}
+		indexFiles := diffIndexFiles(idx, specs)
+		oldFiles := indexFiles
+		if revA != "" || opts.Cached {
+			tree, err := diffTree(gitRepo, diffRevDefault(revA))
+			if err != nil {
+				return err
+			}
+			if oldFiles, err = diff.TreeFiles(gitRepo, tree, specs); err != nil {
+				return err
+			}
+		}
+		newFiles := indexFiles
+		if !opts.Cached {
+			if newFiles, err = d.worktreeFiles(idx, indexFiles, oldFiles); err != nil {
+				return err
+			}
+		}
+		changes = diff.FilesDiff(oldFiles, newFiles)
+	}
+
+	if changes, err = diffFindRenames(gitRepo, changes, opts); err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	return diffWrite(out, d, changes, opts, "\n")
+}
+
+// diffFindRenames pairs up renames among changes as opts asks.
+func diffFindRenames(gitRepo *repo.GitRepository, changes []diff.Change, opts DiffOptions) ([]diff.Change, error) {
+	if opts.NoRenames {
+		return changes, nil
+	}
+	threshold, err := diff.ParseThreshold(opts.FindRenames)
+	if err != nil {
+		return nil, err
+	}
+	return diffRenames(gitRepo, changes, diff.RenameOptions{Threshold: threshold, Limit: opts.RenameLimit, Copies: opts.FindCopies})
+}
+
+// diffWrite writes changes in the formats opts selects: names, summaries,
+// or patches, which follow a summary after separator if opts.Patch is set.
+func diffWrite(out io.Writer, d *differ, changes []diff.Change, opts DiffOptions, separator string) error {
+	if opts.NameOnly && opts.NameStatus {
+		return errors.New("--name-only and --name-status are mutually exclusive")
+	}
+	wordDiff := diff.WordDiffNone
+	if opts.WordDiff != "" {
+		var err error
+		if wordDiff, err = diff.ParseWordDiff(opts.WordDiff); err != nil {
+			return err
+		}
+	}
+
+	// Listing names replaces every other output
+	if opts.NameOnly || opts.NameStatus {
+		return diff.WriteNameStatus(out, changes, opts.NameOnly)
+	}
+
+	if opts.summary() {
+		stats := make([]diff.FileStat, 0, len(changes))
+		for _, c := range changes {
+			oldData, newData, err := d.contents(c)
+			if err != nil {
+				return err
+			}
+			stats = append(stats, diff.Stat(c, oldData, newData))
+		}
+		if opts.Numstat {
+			if err := diff.WriteNumstat(out, stats); err != nil {
+				return err
+			}
+		}
+		if opts.Stat {
+			if err := diff.WriteStat(out, stats, diffStatWidth); err != nil {
+				return err
+			}
+		}
+		if opts.Shortstat {
+			if err := diff.WriteShortstat(out, stats); err != nil {
+				return err
+			}
+		}
+		if !opts.Patch {
+			return nil
+		}
+		if len(changes) > 0 {
+			if _, err := io.WriteString(out, separator); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, c := range changes {
+		oldData, newData, err := d.contents(c)
+		if err != nil {
+			return err
+		}
+		if err := diff.WritePatch(out, c, oldData, newData, diff.PatchOptions{Context: opts.Context, WordDiff: wordDiff}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// summary reports whether opts asks for a diffstat of any kind.
+func (opts DiffOptions) summary() bool {
+	return opts.Stat || opts.Numstat || opts.Shortstat
+}
+
+// diffStatWidth is the width diffstats are fitted into.
+const diffStatWidth = 80
+
+// diffRenames runs rename detection and warns if it had to cut it short.
+func diffRenames(gitRepo *repo.GitRepository, changes []diff.Change, opts diff.RenameOptions) ([]diff.Change, error) {
+	changes, skipped, err := diff.DetectRenames(gitRepo, changes, opts)
+	if err != nil {
+		return nil, err
+	}
+	if skipped {
+		fmt.Fprintln(os.Stderr, "warning: exhaustive rename detection was skipped due to too many files.")
+	}
+	return changes, nil
+}
+
+// diffRevDefault returns rev, or HEAD for an omitted one.
+func diffRevDefault(rev string) string {
+	if rev == "" {
+		return "HEAD"
+	}
+	return rev
+}
+
+// diffTree resolves a revision to a tree. An unborn HEAD is the empty
+// tree, "".
+func diffTree(gitRepo *repo.GitRepository, rev string) (string, error) {
+	sha, err := objects.ObjectFind(gitRepo, rev, "tree", true)
+	if err != nil {
+		var notFound *objects.ObjectNotFoundError
+		if rev == "HEAD" && errors.As(err, &notFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	if sha == "" {
+		return "", fmt.Errorf("%s is not a tree-ish", rev)
+	}
+	return sha, nil
+}
+
+// diffMergeBase returns the first merge base of two revisions.
+func diffMergeBase(gitRepo *repo.GitRepository, left, right string) (string, error) {
+	shas := make([]string, 2)
+	for i, rev := range []string{diffRevDefault(left), diffRevDefault(right)} {
+		sha, err := objects.ObjectFind(gitRepo, rev, "commit", true)
+		if err != nil {
+			return "", err
+		}
+		if sha == "" {
+			return "", fmt.Errorf("%s is not a commit", rev)
+		}
+		shas[i] = sha
+	}
+	bases, err := revwalk.MergeBases(gitRepo, shas[0], shas[1])
+	if err != nil {
+		return "", err
+	}
+	if len(bases) == 0 {
+		return "", fmt.Errorf("%s and %s have no merge base", left, right)
+	}
+	return bases[0], nil
+}
+
+// diffIndexFiles lists the index entries selected by specs, leaving out
+// the versions of paths with merge conflicts.
+func diffIndexFiles(idx *index.GitIndex, specs []string) map[string]diff.File {
+	files := make(map[string]diff.File)
+	for _, e := range idx.Entries {
+		name := filepath.ToSlash(e.Name)
+		if e.Stage() == index.StageMerged && diff.PathspecMatch(specs, name) {
+			files[name] = diff.File{Mode: fmt.Sprintf("%06o", e.Mode), SHA: e.SHA}
+		}
+	}
+	return files
+}
+
+// differ loads the contents of the files being compared, keeping track of
+// those that only exist in the worktree.
+type differ struct {
+	gitRepo  *repo.GitRepository
+	attrs    *attributes.GitAttributes
+	worktree map[string]bool // paths whose new side is read from the worktree
+}
+
+// worktreeFiles lists the worktree files at the paths of indexFiles and
+// otherFiles. Files whose index entry still matches their mtime are taken
+// to be unchanged; the rest are hashed as add would.
+func (d *differ) worktreeFiles(idx *index.GitIndex, indexFiles, otherFiles map[string]diff.File) (map[string]diff.File, error) {
+	attrs, err := attributes.AttributesRead(d.gitRepo)
+	if err != nil {
+		return nil, err
+	}
+	d.attrs = attrs
+	d.worktree = make(map[string]bool)
+
+	entries := make(map[string]*index.GitIndexEntry)
+	for _, e := range idx.Entries {
+		entries[filepath.ToSlash(e.Name)] = e
+	}
+
+	files := make(map[string]diff.File)
+	check := func(name string, mode string) error {
+		if _, ok := files[name]; ok {
+			return nil
+		}
+		stat, err := os.Stat(filepath.Join(d.gitRepo.Worktree, filepath.FromSlash(name)))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if stat.IsDir() {
+			return nil
+		}
+		if e, ok := entries[name]; ok && worktreeUnchanged(e, stat) {
+			files[name] = diff.File{Mode: mode, SHA: e.SHA}
+			return nil
+		}
+		sha, err := hashWorktreeFile(d.gitRepo, attrs, filepath.FromSlash(name), false)
+		if err != nil {
+			return err
+		}
+		files[name] = diff.File{Mode: mode, SHA: sha}
+		d.worktree[name] = true
+		return nil
+	}
+
+	// Files are staged as they are found, so the index knows their mode
+	for name, f := range indexFiles {
+		if err := check(name, f.Mode); err != nil {
+			return nil, err
+		}
+	}
+	for name, f := range otherFiles {
+		if err := check(name, f.Mode); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// contents returns both sides of a change.
+func (d *differ) contents(c diff.Change) ([]byte, []byte, error) {
+	var oldData, newData []byte
+	var err error
+	if c.OldSHA != "" {
+		if oldData, err = diff.BlobRead(d.gitRepo, c.OldSHA); err != nil {
+			return nil, nil, err
+		}
+	}
+	switch {
+	case c.NewSHA == "":
+	case d.worktree[c.NewPath]:
+		newData, err = d.worktreeContent(c.NewPath)
+	default:
+		newData, err = diff.BlobRead(d.gitRepo, c.NewSHA)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return oldData, newData, nil
+}
+
+// worktreeContent reads a worktree file as it would be staged.
+func (d *differ) worktreeContent(name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(d.gitRepo.Worktree, filepath.FromSlash(name)))
+	if err != nil {
+		return nil, err
+	}
+	if attributes.CheckAttr(d.attrs, filepath.FromSlash(name))["filter"] == "lfs" {
+		pointer, err := lfs.Clean(nil, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return pointer.Encode(), nil
+	}
+	return data, nil
+}
@@ -0,0 +1,580 @@
+package commands
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/refs"
+	"github.com/Notwinner0/gvcs/internal/repo"
+	"github.com/Notwinner0/gvcs/internal/revwalk"
+)
+
+// forEachRefDefaultFormat matches git's default output.
+const forEachRefDefaultFormat = "%(objectname) %(objecttype)\t%(refname)"
+
+// refAtom is one %(...) placeholder of a --format or --sort key.
+type refAtom struct {
+	name     string // e.g. "refname", "committerdate"
+	modifier string // the part after ':', e.g. "short"
+	deref    bool   // "*" prefix: use the object a tag points to
+}
+
+// refFormatPart is either literal text or an atom to expand.
+type refFormatPart struct {
+	literal string
+	atom    *refAtom
+}
+
+// refSortKey is a parsed --sort value; a leading '-' reverses it.
+type refSortKey struct {
+	atom    refAtom
+	reverse bool
+}
+
+// refObject is an object a ref (or its tag) points to, read on demand.
+type refObject struct {
+	sha  string
+	typ  string
+	size int64
+	obj  objects.GitObject // only commits and tags are parsed
+}
+
+// refItem is a ref being listed along with its lazily loaded objects.
+type refItem struct {
+	gitRepo *repo.GitRepository
+	entry   refs.RefEntry
+	head    string // the ref HEAD points to, "" if detached
+	direct  *refObject
+	peeled  *refObject
+}
+
+// CmdForEachRef is the handler for the for-each-ref command.
+func CmdForEachRef(patterns, sortKeys []string, format string, count int, contains, merged string) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+
+	if format == "" {
+		format = forEachRefDefaultFormat
+	}
+	parts, err := refFormatParse(format)
+	if err != nil {
+		return err
+	}
+	keys, err := refSortKeysParse(sortKeys)
+	if err != nil {
+		return err
+	}
+
+	var containsSHA string
+	if contains != "" {
+		if containsSHA, err = objects.ObjectFind(gitRepo, contains, "commit", true); err != nil {
+			return err
+		}
+	}
+	var mergedSet map[string]bool
+	if merged != "" {
+		mergedSHA, err := objects.ObjectFind(gitRepo, merged, "commit", true)
+		if err != nil {
+			return err
+		}
+		if mergedSet, err = revwalk.Ancestors(gitRepo, mergedSHA); err != nil {
+			return err
+		}
+	}
+
+	entries, err := refs.RefListSorted(gitRepo)
+	if err != nil {
+		return err
+	}
+	head, _, err := refs.SymrefRead(gitRepo, "HEAD")
+	if err != nil {
+		return err
+	}
+
+	var items []*refItem
+	for _, e := range entries {
+		if e.SHA == "" || !refPatternsMatch(e.Name, patterns) {
+			continue
+		}
+		item := &refItem{gitRepo: gitRepo, entry: e, head: head}
+
+		if containsSHA != "" || mergedSet != nil {
+			commitSHA, err := refPeelToCommit(gitRepo, e.SHA)
+			if err != nil {
+				return err
+			}
+			if commitSHA == "" {
+				continue
+			}
+			if mergedSet != nil && !mergedSet[commitSHA] {
+				continue
+			}
+			if containsSHA != "" {
+				ancestors, err := revwalk.Ancestors(gitRepo, commitSHA)
+				if err != nil {
+					return err
+				}
+				if !ancestors[containsSHA] {
+					continue
+				}
+			}
+		}
+		items = append(items, item)
+	}
+
+	if err := refItemsSort(items, keys); err != nil {
+		return err
+	}
+	if count > 0 && len(items) > count {
+		items = items[:count]
+	}
+
+	for _, item := range items {
+		var b strings.Builder
+		for _, part := range parts {
+			if part.atom == nil {
+				b.WriteString(part.literal)
+				continue
+			}
+			value, err := item.value(*part.atom)
+			if err != nil {
+				return err
+			}
+			b.WriteString(value)
+		}
+		fmt.Println(b.String())
+	}
+	return nil
+}
+
+// refFormatParse splits a --format string into literals and atoms. "%%" is
+// a literal percent sign and "%xx" a hex-escaped byte.
+func refFormatParse(format string) ([]refFormatPart, error) {
+	var parts []refFormatPart
+	var literal strings.Builder
+	flush := func() {
+		if literal.Len() > 0 {
+			parts = append(parts, refFormatPart{literal: literal.String()})
+			literal.Reset()
+		}
+	}
+
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' || i+1 >= len(format) {
+			literal.WriteByte(c)
+			continue
+		}
+		switch next := format[i+1]; {
+		case next == '%':
+			literal.WriteByte('%')
+			i++
+		case next == '(':
+			end := strings.IndexByte(format[i:], ')')
+			if end == -1 {
+				return nil, fmt.Errorf("malformed format string %s", format[i:])
+			}
+			atom, err := refAtomParse(format[i+2 : i+end])
+			if err != nil {
+				return nil, err
+			}
+			flush()
+			parts = append(parts, refFormatPart{atom: &atom})
+			i += end
+		default:
+			if i+2 < len(format) {
+				if b, err := hex.DecodeString(format[i+1 : i+3]); err == nil {
+					literal.Write(b)
+					i += 2
+					continue
+				}
+			}
+			literal.WriteByte(c)
+		}
+	}
+	flush()
+	return parts, nil
+}
+
+// refAtomParse parses the inside of a %(...) placeholder.
+func refAtomParse(spec string) (refAtom, error) {
+	atom := refAtom{}
+	if strings.HasPrefix(spec, "*") {
+		atom.deref = true
+		spec = spec[1:]
+	}
+	atom.name, atom.modifier, _ = strings.Cut(spec, ":")
+
+	switch atom.name {
+	case "refname", "symref", "upstream", "HEAD",
+		"objectname", "objecttype", "objectsize", "tree", "parent",
+		"object", "type", "tag", "subject", "body", "contents":
+		return atom, nil
+	}
+	if _, field, ok := refPersonAtom(atom.name); ok && (field != "date" || atom.modifier == "" || refDateFormatValid(atom.modifier)) {
+		return atom, nil
+	}
+	return atom, fmt.Errorf("unknown field name: %s", spec)
+}
+
+// refPersonAtom splits atoms such as "taggername" into the header they read
+// ("tagger") and the part of it they show ("name", "email", "date" or "").
+func refPersonAtom(name string) (string, string, bool) {
+	for _, who := range []string{"author", "committer", "tagger", "creator"} {
+		if rest, ok := strings.CutPrefix(name, who); ok {
+			switch rest {
+			case "", "name", "email", "date":
+				return who, rest, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+func refDateFormatValid(format string) bool {
+	_, err := objects.SignatureFormatDate(time.Time{}, format)
+	return err == nil
+}
+
+// refSortKeysParse parses --sort values. Like git, the last key is the
+// primary one; refname is always the final tie-breaker.
+func refSortKeysParse(sortKeys []string) ([]refSortKey, error) {
+	var keys []refSortKey
+	for i := len(sortKeys) - 1; i >= 0; i-- {
+		spec := sortKeys[i]
+		key := refSortKey{}
+		if strings.HasPrefix(spec, "-") {
+			key.reverse = true
+			spec = spec[1:]
+		}
+		atom, err := refAtomParse(spec)
+		if err != nil {
+			return nil, err
+		}
+		key.atom = atom
+		keys = append(keys, key)
+	}
+	return append(keys, refSortKey{atom: refAtom{name: "refname"}}), nil
+}
+
+// refItemsSort orders items by the sort keys. Dates and sizes compare as
+// numbers, everything else as strings.
+func refItemsSort(items []*refItem, keys []refSortKey) error {
+	type sortValue struct {
+		text   string
+		number int64
+	}
+	values := make(map[*refItem][]sortValue, len(items))
+	for _, item := range items {
+		for _, key := range keys {
+			atom := key.atom
+			_, field, isPerson := refPersonAtom(atom.name)
+			numeric := atom.name == "objectsize" || (isPerson && field == "date")
+			if numeric && atom.name != "objectsize" {
+				atom.modifier = "unix"
+			}
+			text, err := item.value(atom)
+			if err != nil {
+				return err
+			}
+			v := sortValue{text: text}
+			if numeric {
+				v.number, _ = strconv.ParseInt(text, 10, 64)
+				v.text = ""
+			}
+			values[item] = append(values[item], v)
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := values[items[i]], values[items[j]]
+		for k, key := range keys {
+			if a[k] == b[k] {
+				continue
+			}
+			less := a[k].number < b[k].number || (a[k].number == b[k].number && a[k].text < b[k].text)
+			if key.reverse {
+				return !less
+			}
+			return less
+		}
+		return false
+	})
+	return nil
+}
+
+// refPatternsMatch reports whether name matches any of the patterns. A
+// pattern matches a ref exactly, as a leading path prefix, or as a glob
+// whose wildcards do not cross '/'. No patterns match everything.
+func refPatternsMatch(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if strings.ContainsAny(pattern, "*?[") {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+			continue
+		}
+		pattern = strings.TrimSuffix(pattern, "/")
+		if name == pattern || strings.HasPrefix(name, pattern+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// value expands a single atom for the item.
+func (it *refItem) value(atom refAtom) (string, error) {
+	switch atom.name {
+	case "refname":
+		return refNameModify(it.entry.Name, atom.modifier)
+	case "symref":
+		if it.entry.Symref == "" {
+			return "", nil
+		}
+		return refNameModify(it.entry.Symref, atom.modifier)
+	case "upstream":
+		upstream := branchUpstream(it.gitRepo, it.entry.Name)
+		if upstream == "" {
+			return "", nil
+		}
+		return refNameModify(upstream, atom.modifier)
+	case "HEAD":
+		if it.entry.Name == it.head {
+			return "*", nil
+		}
+		return " ", nil
+	}
+
+	obj, err := it.object(atom.deref)
+	if err != nil || obj == nil {
+		return "", err
+	}
+
+	switch atom.name {
+	case "objectname":
+		switch {
+		case atom.modifier == "":
+			return obj.sha, nil
+		case atom.modifier == "short":
+			return obj.sha[:7], nil
+		case strings.HasPrefix(atom.modifier, "short="):
+			n, err := strconv.Atoi(atom.modifier[6:])
+			if err != nil || n < 1 {
+				return "", fmt.Errorf("invalid length in %%(objectname:%s)", atom.modifier)
+			}
+			return obj.sha[:min(max(n, 4), len(obj.sha))], nil
+		}
+		return "", fmt.Errorf("unrecognized %%(objectname) argument: %s", atom.modifier)
+	case "objecttype":
+		return obj.typ, nil
+	case "objectsize":
+		return strconv.FormatInt(obj.size, 10), nil
+	}
+
+	kvlm, message := refObjectKvlm(obj)
+	first := func(key string) string {
+		if values := kvlm[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	switch atom.name {
+	case "tree":
+		return first("tree"), nil
+	case "parent":
+		return strings.Join(kvlm["parent"], " "), nil
+	case "object", "type", "tag":
+		if obj.typ != "tag" {
+			return "", nil
+		}
+		return first(atom.name), nil
+	case "subject", "body", "contents":
+		subject, body := refMessageSplit(message)
+		switch {
+		case atom.name == "subject" || atom.modifier == "subject":
+			return subject, nil
+		case atom.name == "body" || atom.modifier == "body":
+			return body, nil
+		}
+		return message, nil
+	}
+
+	who, field, _ := refPersonAtom(atom.name)
+	if who == "creator" {
+		who = "committer"
+		if obj.typ == "tag" {
+			who = "tagger"
+		}
+	}
+	line := first(who)
+	if line == "" {
+		return "", nil
+	}
+	sig, err := objects.SignatureParse(line)
+	if err != nil {
+		// Leave malformed identities out rather than failing the listing
+		return "", nil
+	}
+	switch field {
+	case "name":
+		return sig.Name, nil
+	case "email":
+		return "<" + sig.Email + ">", nil
+	case "date":
+		if sig.When.IsZero() {
+			return "", nil
+		}
+		return objects.SignatureFormatDate(sig.When, atom.modifier)
+	}
+	return line, nil
+}
+
+// object returns what the ref points to, or with deref what that tag
+// points to. Dereferencing a non-tag yields nil.
+func (it *refItem) object(deref bool) (*refObject, error) {
+	if it.direct == nil {
+		obj, err := refObjectLoad(it.gitRepo, it.entry.SHA)
+		if err != nil {
+			return nil, err
+		}
+		it.direct = obj
+	}
+	if !deref {
+		return it.direct, nil
+	}
+	if it.direct.typ != "tag" {
+		return nil, nil
+	}
+	if it.peeled == nil {
+		kvlm, _ := refObjectKvlm(it.direct)
+		if len(kvlm["object"]) == 0 {
+			return nil, fmt.Errorf("tag %s has no object", it.direct.sha)
+		}
+		obj, err := refObjectLoad(it.gitRepo, kvlm["object"][0])
+		if err != nil {
+			return nil, err
+		}
+		it.peeled = obj
+	}
+	return it.peeled, nil
+}
+
+// refObjectLoad reads an object's header, and the object itself if it is a
+// commit or tag. Trees and blobs are never parsed just to be listed.
+func refObjectLoad(gitRepo *repo.GitRepository, sha string) (*refObject, error) {
+	header, r, err := objects.ObjectReader(gitRepo, sha)
+	if err != nil {
+		return nil, err
+	}
+	r.Close()
+
+	ret := &refObject{sha: sha, typ: header.Type, size: header.Size}
+	if header.Type == "commit" || header.Type == "tag" {
+		if ret.obj, err = objects.ObjectRead(gitRepo, sha); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+func refObjectKvlm(obj *refObject) (map[string][]string, string) {
+	switch o := obj.obj.(type) {
+	case *objects.GitCommit:
+		return o.Kvlm, o.Message
+	case *objects.GitTag:
+		return o.Kvlm, o.Message
+	}
+	return nil, ""
+}
+
+// refMessageSplit returns the subject (the first paragraph on one line) and
+// the body of a commit or tag message.
+func refMessageSplit(message string) (string, string) {
+	message = strings.TrimLeft(message, "\n")
+	subject, body, _ := strings.Cut(message, "\n\n")
+	subject = strings.Join(strings.Fields(strings.ReplaceAll(subject, "\n", " ")), " ")
+	return subject, strings.TrimLeft(body, "\n")
+}
+
+// refNameModify applies a refname modifier: "short", "lstrip=N" (alias
+// "strip=N") or "rstrip=N". A negative N keeps that many components.
+func refNameModify(name, modifier string) (string, error) {
+	switch {
+	case modifier == "":
+		return name, nil
+	case modifier == "short":
+		return refs.RefShorten(name), nil
+	}
+
+	kind, arg, _ := strings.Cut(modifier, "=")
+	n, err := strconv.Atoi(arg)
+	if err != nil || (kind != "lstrip" && kind != "strip" && kind != "rstrip") {
+		return "", fmt.Errorf("unrecognized refname argument: %s", modifier)
+	}
+	parts := strings.Split(name, "/")
+	if n < 0 {
+		n = max(len(parts)+n, 0)
+	}
+	n = min(n, len(parts))
+	if kind == "rstrip" {
+		return strings.Join(parts[:len(parts)-n], "/"), nil
+	}
+	return strings.Join(parts[n:], "/"), nil
+}
+
+// branchUpstream returns the remote-tracking ref a local branch is set up
+// to follow via branch.<name>.remote and branch.<name>.merge, or "".
+func branchUpstream(gitRepo *repo.GitRepository, ref string) string {
+	branch, ok := strings.CutPrefix(ref, "refs/heads/")
+	if !ok {
+		return ""
+	}
+	section := fmt.Sprintf("branch \"%s\"", branch)
+	remote, err := gitRepo.Conf.Get(section, "remote")
+	if err != nil || remote == "" {
+		return ""
+	}
+	merge, err := gitRepo.Conf.Get(section, "merge")
+	if err != nil || merge == "" {
+		return ""
+	}
+	if remote == "." {
+		return merge
+	}
+	return "refs/remotes/" + remote + "/" + strings.TrimPrefix(merge, "refs/heads/")
+}
+
+// refPeelToCommit follows tags from sha down to a commit; "" if the chain
+// ends in something else.
+func refPeelToCommit(gitRepo *repo.GitRepository, sha string) (string, error) {
+	for {
+		obj, err := refObjectLoad(gitRepo, sha)
+		if err != nil {
+			return "", err
+		}
+		switch obj.typ {
+		case "commit":
+			return sha, nil
+		case "tag":
+			kvlm, _ := refObjectKvlm(obj)
+			if len(kvlm["object"]) == 0 {
+				return "", nil
+			}
+			sha = kvlm["object"][0]
+		default:
+			return "", nil
+		}
+	}
+}
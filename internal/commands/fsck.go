@@ -0,0 +1,323 @@
+package commands
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/reachable"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+var (
+	looseDirRE  = regexp.MustCompile(`^[0-9a-f]{2}$`)
+	looseFileRE = regexp.MustCompile(`^[0-9a-f]{38}$`)
+)
+
+// fsckLink is a reference from one object to another.
+type fsckLink struct {
+	sha string
+	typ string // the type the referring object expects
+}
+
+// fsckObject is what fsck learned about a stored object.
+type fsckObject struct {
+	typ        string // "" if the object could not be read
+	links      []fsckLink
+	reachable  bool
+	referenced bool
+}
+
+// fsckState collects objects and findings. Each finding is printed on its
+// own line in `git fsck` format.
+type fsckState struct {
+	gitRepo *repo.GitRepository
+	objects map[string]*fsckObject
+	strict  bool
+	errors  int
+	missing map[string]bool
+}
+
+func (st *fsckState) errorf(format string, args ...interface{}) {
+	st.errors++
+	fmt.Printf(format+"\n", args...)
+}
+
+// CmdFsck is the handler for the fsck command. It exits non-zero if any
+// object is corrupt or missing.
+func CmdFsck(unreachable, noDangling, strict bool) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+
+	st := &fsckState{
+		gitRepo: gitRepo,
+		objects: make(map[string]*fsckObject),
+		strict:  strict,
+		missing: make(map[string]bool),
+	}
+	if err := st.checkLoose(); err != nil {
+		return err
+	}
+	if err := st.checkPacks(); err != nil {
+		return err
+	}
+	if err := st.checkConnectivity(unreachable, noDangling); err != nil {
+		return err
+	}
+
+	if st.errors > 0 {
+		return &ExitError{Code: 1}
+	}
+	return nil
+}
+
+// checkLoose re-hashes every loose object.
+func (st *fsckState) checkLoose() error {
+	root := repo.RepoPath(st.gitRepo, "objects")
+	dirs, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || !looseDirRE.MatchString(dir.Name()) {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(root, dir.Name()))
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if !looseFileRE.MatchString(f.Name()) {
+				fmt.Printf("warning: garbage found: %s\n", filepath.ToSlash(filepath.Join("objects", dir.Name(), f.Name())))
+				continue
+			}
+			st.checkLooseObject(dir.Name() + f.Name())
+		}
+	}
+	return nil
+}
+
+func (st *fsckState) checkLooseObject(sha string) {
+	// Unreadable objects still count as present so they are not also
+	// reported as missing
+	st.objects[sha] = &fsckObject{}
+
+	header, r, err := objects.ObjectReader(st.gitRepo, sha)
+	if err != nil {
+		st.errorf("error: %s: object corrupt or missing: %v", sha, err)
+		return
+	}
+	defer r.Close()
+
+	h := sha1.New()
+	fmt.Fprintf(h, "%s %d\x00", header.Type, header.Size)
+	// Only commits, trees and tags are kept for structural checks
+	var content bytes.Buffer
+	w := io.Writer(h)
+	if header.Type != "blob" {
+		w = io.MultiWriter(h, &content)
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		st.errorf("error: %s: object corrupt or missing: %v", sha, err)
+		return
+	}
+	st.checkObject(sha, header.Type, hex.EncodeToString(h.Sum(nil)), content.Bytes())
+}
+
+// checkPacks verifies pack checksums and re-hashes every packed object.
+func (st *fsckState) checkPacks() error {
+	packs, err := objects.PackList(st.gitRepo)
+	if err != nil {
+		return err
+	}
+	for _, p := range packs {
+		if err := p.Verify(); err != nil {
+			st.errorf("error: %v", err)
+		}
+		for _, sha := range p.Objects() {
+			if _, ok := st.objects[sha]; ok {
+				continue
+			}
+			st.objects[sha] = &fsckObject{}
+			objType, data, err := p.ReadObject(st.gitRepo, sha)
+			if err != nil {
+				st.errorf("error: %s: object corrupt or missing: %v", sha, err)
+				continue
+			}
+			h := sha1.New()
+			fmt.Fprintf(h, "%s %d\x00", objType, len(data))
+			h.Write(data)
+			st.checkObject(sha, objType, hex.EncodeToString(h.Sum(nil)), data)
+		}
+	}
+	return nil
+}
+
+// checkObject records an object whose content hashed to actual and runs
+// the structural checks on it.
+func (st *fsckState) checkObject(sha, objType, actual string, data []byte) {
+	obj := st.objects[sha]
+	if actual != sha {
+		st.errorf("error: %s: hash mismatch, content hashes to %s", sha, actual)
+		return
+	}
+
+	problems := objects.ObjectCheck(objType, data)
+	broken := false
+	for _, p := range problems {
+		if p.Warning && !st.strict {
+			fmt.Printf("warning in %s %s: %s\n", objType, sha, p)
+			continue
+		}
+		st.errorf("error in %s %s: %s", objType, sha, p)
+		broken = broken || p.ID == "badTree" || p.ID == "badType"
+	}
+	if broken {
+		return
+	}
+	obj.typ = objType
+	obj.links = fsckLinks(objType, data)
+}
+
+// fsckLinks lists the objects an object refers to.
+func fsckLinks(objType string, data []byte) []fsckLink {
+	var links []fsckLink
+	switch objType {
+	case "commit":
+		c := new(objects.GitCommit)
+		if c.Deserialize(data) != nil {
+			return nil
+		}
+		for _, tree := range c.Kvlm["tree"] {
+			links = append(links, fsckLink{sha: tree, typ: "tree"})
+		}
+		for _, parent := range c.Kvlm["parent"] {
+			links = append(links, fsckLink{sha: parent, typ: "commit"})
+		}
+	case "tag":
+		t := new(objects.GitTag)
+		if t.Deserialize(data) != nil || len(t.Kvlm["object"]) == 0 || len(t.Kvlm["type"]) == 0 {
+			return nil
+		}
+		links = append(links, fsckLink{sha: t.Kvlm["object"][0], typ: t.Kvlm["type"][0]})
+	case "tree":
+		t := new(objects.GitTree)
+		if t.Deserialize(data) != nil {
+			return nil
+		}
+		for _, leaf := range t.Items {
+			switch leaf.Mode {
+			case "40000", "040000":
+				links = append(links, fsckLink{sha: leaf.SHA, typ: "tree"})
+			case "160000":
+				// Submodule commits live in another repository
+			default:
+				links = append(links, fsckLink{sha: leaf.SHA, typ: "blob"})
+			}
+		}
+	}
+	return links
+}
+
+// checkConnectivity walks from every root and reports broken links, then
+// the objects nothing reaches.
+func (st *fsckState) checkConnectivity(unreachable, noDangling bool) error {
+	roots, err := reachable.RootList(st.gitRepo)
+	if err != nil {
+		return err
+	}
+
+	var queue []string
+	for _, root := range roots {
+		obj, ok := st.objects[root.SHA]
+		if !ok {
+			if strings.Contains(root.Name, "@{") {
+				st.errorf("error: %s: invalid reflog entry %s", root.Name, root.SHA)
+			} else {
+				st.errorf("error: %s: invalid sha1 pointer %s", root.Name, root.SHA)
+			}
+			continue
+		}
+		if !obj.reachable {
+			obj.reachable = true
+			queue = append(queue, root.SHA)
+		}
+	}
+
+	for len(queue) > 0 {
+		sha := queue[0]
+		queue = queue[1:]
+		obj := st.objects[sha]
+		for _, link := range obj.links {
+			if !st.follow(sha, obj, link) {
+				continue
+			}
+			target := st.objects[link.sha]
+			if !target.reachable {
+				target.reachable = true
+				queue = append(queue, link.sha)
+			}
+		}
+	}
+
+	// Links from unreachable objects decide what is dangling; broken ones
+	// are reported too, as git does
+	shas := make([]string, 0, len(st.objects))
+	for sha := range st.objects {
+		shas = append(shas, sha)
+	}
+	sort.Strings(shas)
+	for _, sha := range shas {
+		obj := st.objects[sha]
+		if obj.reachable {
+			continue
+		}
+		for _, link := range obj.links {
+			st.follow(sha, obj, link)
+		}
+	}
+
+	for _, sha := range shas {
+		obj := st.objects[sha]
+		if obj.reachable || obj.typ == "" {
+			continue
+		}
+		switch {
+		case unreachable:
+			fmt.Printf("unreachable %s %s\n", obj.typ, sha)
+		case !obj.referenced && !noDangling:
+			fmt.Printf("dangling %s %s\n", obj.typ, sha)
+		}
+	}
+	return nil
+}
+
+// follow checks one link and marks its target as referenced. It reports
+// false if the target is missing or of the wrong type.
+func (st *fsckState) follow(sha string, obj *fsckObject, link fsckLink) bool {
+	target, ok := st.objects[link.sha]
+	if !ok {
+		if !st.missing[link.sha] {
+			st.missing[link.sha] = true
+			st.errorf("broken link from %s %s to %s %s", obj.typ, sha, link.typ, link.sha)
+			st.errorf("missing %s %s", link.typ, link.sha)
+		}
+		return false
+	}
+	target.referenced = true
+	if target.typ != "" && target.typ != link.typ {
+		st.errorf("error in %s %s: badObjectType: %s is a %s, not a %s", obj.typ, sha, link.sha, target.typ, link.typ)
+		return false
+	}
+	return true
+}
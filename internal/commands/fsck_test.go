@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+func TestFsck_CommitWithoutBlankLine(t *testing.T) {
+	gitRepo, err := repo.RepoCreate(t.TempDir())
+	if err != nil {
+		t.Fatalf("RepoCreate() failed: %v", err)
+	}
+
+	// Stored as `hash-object --literally -w` would, bypassing validation
+	data := []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\nauthor A <a@b> 1 +0000\ncommitter A <a@b> 1 +0000")
+	w, err := objects.NewObjectWriter(gitRepo, "commit", int64(len(data)))
+	if err != nil {
+		t.Fatalf("NewObjectWriter() failed: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	sha, err := w.Commit()
+	if err != nil {
+		t.Fatalf("Commit() failed: %v", err)
+	}
+
+	st := &fsckState{
+		gitRepo: gitRepo,
+		objects: make(map[string]*fsckObject),
+		missing: make(map[string]bool),
+	}
+	if err := st.checkLoose(); err != nil {
+		t.Fatalf("checkLoose() failed: %v", err)
+	}
+	if st.errors == 0 {
+		t.Errorf("Expected the corrupt commit %s to be reported", sha)
+	}
+	if err := st.checkConnectivity(false, false); err != nil {
+		t.Fatalf("checkConnectivity() failed: %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/Notwinner0/gvcs/internal/diff"
+	"github.com/Notwinner0/gvcs/internal/grep"
+	"github.com/Notwinner0/gvcs/internal/index"
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// GrepOptions holds the flags of the grep command.
+type GrepOptions struct {
+	Cached bool     // search the index instead of the worktree
+	Paths  []string // limit the search to these paths
+
+	// How the pattern matches
+	Fixed      bool
+	IgnoreCase bool
+	Word       bool
+
+	// What is printed
+	LineNumbers   bool
+	FilesOnly     bool
+	Count         bool
+	Before, After int
+}
+
+// grepFile is a file to search: its name as printed, and either the blob
+// holding it or the worktree path to read it from.
+type grepFile struct {
+	name string
+	sha  string
+	path string
+}
+
+// grepResult is what searching a file printed, ready once done is closed.
+type grepResult struct {
+	out     bytes.Buffer
+	matched bool
+	err     error
+	done    chan struct{}
+}
+
+// CmdGrep is the handler for the grep command. It prints the lines of the
+// tracked files matching pattern, an RE2 regexp, as they are in the
+// worktree, the index with opts.Cached, or the tree of treeish. Binary
+// files are skipped. Files are read and searched in parallel, and printed
+// in path order. It fails with status 1 if nothing matches.
+func CmdGrep(pattern, treeish string, opts GrepOptions) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+	re, err := grep.Compile(pattern, opts.Fixed, opts.IgnoreCase, opts.Word)
+	if err != nil {
+		return err
+	}
+	specs, err := pathspecs(gitRepo, opts.Paths)
+	if err != nil {
+		return err
+	}
+	files, err := grepFiles(gitRepo, treeish, specs, opts.Cached)
+	if err != nil {
+		return err
+	}
+
+	results := make([]*grepResult, len(files))
+	for i := range results {
+		results[i] = &grepResult{done: make(chan struct{})}
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range runtime.NumCPU() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				r := results[i]
+				r.matched, r.err = grepSearch(gitRepo, files[i], &r.out, re, opts)
+				close(r.done)
+			}
+		}()
+	}
+
+	// Feed the workers from a goroutine of its own so results are
+	// printed as soon as they are ready, and stop feeding them on error.
+	stop := make(chan struct{})
+	go func() {
+		defer close(jobs)
+		for i := range files {
+			select {
+			case jobs <- i:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	defer wg.Wait()
+	defer close(stop)
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	context := (opts.Before > 0 || opts.After > 0) && !opts.FilesOnly && !opts.Count
+	matched := false
+	for _, r := range results {
+		<-r.done
+		if r.err != nil {
+			return r.err
+		}
+		if !r.matched {
+			continue
+		}
+		if matched && context {
+			if _, err := io.WriteString(out, "--\n"); err != nil {
+				return err
+			}
+		}
+		matched = true
+		if _, err := r.out.WriteTo(out); err != nil {
+			return err
+		}
+	}
+	if !matched {
+		return &ExitError{Code: 1}
+	}
+	return nil
+}
+
+// grepFiles lists the files selected by specs in path order: those of the
+// tree of treeish if there is one, or else the index entries, read from the
+// worktree unless cached is set. Symlinks and submodules are left out.
+func grepFiles(gitRepo *repo.GitRepository, treeish string, specs []string, cached bool) ([]grepFile, error) {
+	var files []grepFile
+	if treeish != "" {
+		if cached {
+			return nil, fmt.Errorf("--cached can't be used with a tree-ish")
+		}
+		tree, err := diffTree(gitRepo, treeish)
+		if err != nil {
+			return nil, err
+		}
+		treeFiles, err := diff.TreeFiles(gitRepo, tree, specs)
+		if err != nil {
+			return nil, err
+		}
+		for name, f := range treeFiles {
+			if f.Mode != "160000" && f.Mode != "120000" {
+				files = append(files, grepFile{name: treeish + ":" + name, sha: f.SHA})
+			}
+		}
+	} else {
+		idx, err := index.IndexRead(gitRepo)
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool)
+		for _, e := range idx.Entries {
+			name := filepath.ToSlash(e.Name)
+			if seen[name] || e.Mode == 0160000 || e.Mode == 0120000 || !diff.PathspecMatch(specs, name) {
+				continue
+			}
+			// An unmerged file is searched once, in the worktree; there
+			// is no one version of it in the index.
+			if cached && e.Stage() != index.StageMerged {
+				continue
+			}
+			seen[name] = true
+			f := grepFile{name: name, sha: e.SHA}
+			if !cached {
+				f = grepFile{name: name, path: filepath.Join(gitRepo.Worktree, e.Name)}
+			}
+			files = append(files, f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	return files, nil
+}
+
+// grepSearch reads a file and writes its matching lines to w. Files that
+// are binary, or missing from the worktree, have none.
+func grepSearch(gitRepo *repo.GitRepository, f grepFile, w io.Writer, re *regexp.Regexp, opts GrepOptions) (bool, error) {
+	var data []byte
+	switch {
+	case f.sha != "":
+		obj, err := objects.ObjectRead(gitRepo, f.sha)
+		if err != nil {
+			return false, err
+		}
+		if data, err = obj.Serialize(); err != nil {
+			return false, err
+		}
+	default:
+		var err error
+		data, err = os.ReadFile(f.path)
+		if os.IsNotExist(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+	if diff.IsBinary(data) {
+		return false, nil
+	}
+	return grep.Grep(w, f.name, data, re, grep.Options{
+		LineNumbers: opts.LineNumbers,
+		Before:      opts.Before,
+		After:       opts.After,
+		FilesOnly:   opts.FilesOnly,
+		Count:       opts.Count,
+	})
+}
@@ -1,35 +1,128 @@
 package commands
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/Notwinner0/gvcs/internal/attributes"
 	"github.com/Notwinner0/gvcs/internal/objects"
 	"github.com/Notwinner0/gvcs/internal/repo"
 )
 
-func CmdHashObject(write bool, objType, path string) error {
-	var gitRepo *repo.GitRepository
-	var err error
+// CmdHashObject is the handler for the hash-object command. It hashes
+// path, the content of stdin, or every path listed on stdin, and prints
+// one SHA per line.
+//
+// Commits, trees and tags are validated unless literally is set, which
+// also allows any type name. Blobs go through the filters their path's
+// attributes select, such as LFS; attrPath overrides the path used for
+// this, and noFilters disables it.
+func CmdHashObject(write bool, objType, path string, stdin, stdinPaths, literally bool, attrPath string, noFilters bool) error {
+	if stdin && stdinPaths {
+		return errors.New("--stdin and --stdin-paths are incompatible")
+	}
+	if (stdin || stdinPaths) == (path != "") {
+		return errors.New("give exactly one of <file>, --stdin or --stdin-paths")
+	}
 
+	// A repository is only needed to write and to read attributes
+	gitRepo, err := repo.RepoFind(".", write)
+	if err != nil {
+		return err
+	}
+	var writeRepo *repo.GitRepository
 	if write {
-		gitRepo, err = repo.RepoFind(".", true)
+		writeRepo = gitRepo
+	}
+	var attrs *attributes.GitAttributes
+	if gitRepo != nil && objType == "blob" && !noFilters {
+		attrs, err = attributes.AttributesRead(gitRepo)
 		if err != nil {
 			return err
 		}
 	}
 
-	f, err := os.Open(path)
-	if err != nil {
-		return err
+	hashPath := func(path string) (string, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		stat, err := f.Stat()
+		if err != nil {
+			return "", err
+		}
+		relPath := attrPath
+		if relPath == "" && attrs != nil {
+			relPath = hashObjectRelPath(gitRepo, path)
+		}
+		return hashObject(writeRepo, attrs, objType, relPath, literally, f, stat.Size())
 	}
-	defer f.Close()
 
-	sha, err := objects.ObjectHash(f, objType, gitRepo)
-	if err != nil {
-		return err
+	switch {
+	case stdin:
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		sha, err := hashObject(writeRepo, attrs, objType, attrPath, literally, bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return err
+		}
+		fmt.Println(sha)
+	case stdinPaths:
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			line := strings.TrimRight(scanner.Text(), "\r")
+			if line == "" {
+				continue
+			}
+			sha, err := hashPath(line)
+			if err != nil {
+				return fmt.Errorf("%s: %v", line, err)
+			}
+			fmt.Println(sha)
+		}
+		return scanner.Err()
+	default:
+		sha, err := hashPath(path)
+		if err != nil {
+			return err
+		}
+		fmt.Println(sha)
 	}
-
-	fmt.Println(sha)
 	return nil
 }
+
+// hashObject hashes size bytes from r. relPath selects the filters for a
+// blob; it may be empty.
+func hashObject(writeRepo *repo.GitRepository, attrs *attributes.GitAttributes, objType, relPath string, literally bool, r io.Reader, size int64) (string, error) {
+	switch {
+	case objType == "blob" && attrs != nil && relPath != "":
+		return hashFiltered(writeRepo, attrs, relPath, r, size)
+	case objType == "blob" || literally:
+		// Blobs and literal objects need no parsing, so stream them
+		return objects.ObjectHashStream(r, size, objType, writeRepo)
+	}
+	return objects.ObjectHash(r, objType, writeRepo)
+}
+
+// hashObjectRelPath returns path relative to the worktree, or "" if it
+// lies outside.
+func hashObjectRelPath(gitRepo *repo.GitRepository, path string) string {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	relPath, err := filepath.Rel(gitRepo.Worktree, absPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	return relPath
+}
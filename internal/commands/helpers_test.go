@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Notwinner0/gvcs/internal/index"
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// testRepo creates a repository with a configured user and makes its
+// worktree the current directory, where the commands look for it.
+func testRepo(t *testing.T) *repo.GitRepository {
+	t.Helper()
+	gitRepo, err := repo.RepoCreate(t.TempDir())
+	if err != nil {
+		t.Fatalf("RepoCreate() failed: %v", err)
+	}
+	f, err := os.OpenFile(repo.RepoPath(gitRepo, "config"), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("opening config failed: %v", err)
+	}
+	f.WriteString("[user]\nname = Test User\nemail = test@example.com\n")
+	f.Close()
+	t.Chdir(gitRepo.Worktree)
+	return gitRepo
+}
+
+// testWrite writes a worktree file, creating its directories.
+func testWrite(t *testing.T, gitRepo *repo.GitRepository, name, content string) {
+	t.Helper()
+	path := filepath.Join(gitRepo.Worktree, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("MkdirAll() failed: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+}
+
+// testRead returns the content of a worktree file, "" if it is missing.
+func testRead(t *testing.T, gitRepo *repo.GitRepository, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(gitRepo.Worktree, filepath.FromSlash(name)))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("ReadFile() failed: %v", err)
+	}
+	return string(data)
+}
+
+// testCommit writes files, given as name and content pairs, stages them
+// and commits. It returns the new commit.
+func testCommit(t *testing.T, gitRepo *repo.GitRepository, message string, files ...string) string {
+	t.Helper()
+	var paths []string
+	for i := 0; i+1 < len(files); i += 2 {
+		testWrite(t, gitRepo, files[i], files[i+1])
+		paths = append(paths, filepath.FromSlash(files[i]))
+	}
+	if err := CmdAdd(paths); err != nil {
+		t.Fatalf("CmdAdd() failed: %v", err)
+	}
+	if err := CmdCommit(message); err != nil {
+		t.Fatalf("CmdCommit() failed: %v", err)
+	}
+	return testResolve(t, gitRepo, "HEAD")
+}
+
+// testResolve resolves a name to an object, failing the test if it does
+// not exist.
+func testResolve(t *testing.T, gitRepo *repo.GitRepository, name string) string {
+	t.Helper()
+	sha, err := objects.ObjectFind(gitRepo, name, "", true)
+	if err != nil {
+		t.Fatalf("resolving %s failed: %v", name, err)
+	}
+	return sha
+}
+
+// testStaged returns the content staged for a file, "" if it is not in
+// the index.
+func testStaged(t *testing.T, gitRepo *repo.GitRepository, name string) string {
+	t.Helper()
+	idx, err := index.IndexRead(gitRepo)
+	if err != nil {
+		t.Fatalf("IndexRead() failed: %v", err)
+	}
+	for _, e := range idx.Entries {
+		if filepath.ToSlash(e.Name) != name {
+			continue
+		}
+		obj, err := objects.ObjectRead(gitRepo, e.SHA)
+		if err != nil {
+			t.Fatalf("ObjectRead() failed: %v", err)
+		}
+		data, err := obj.Serialize()
+		if err != nil {
+			t.Fatalf("Serialize() failed: %v", err)
+		}
+		return string(data)
+	}
+	return ""
+}
+
+// testOutput runs fn and returns what it printed to stdout.
+func testOutput(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe() failed: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- data
+	}()
+	err = fn()
+	os.Stdout = stdout
+	w.Close()
+	out := <-done
+	r.Close()
+	return string(out), err
+}
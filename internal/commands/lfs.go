@@ -0,0 +1,259 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/Notwinner0/gvcs/internal/attributes"
+	"github.com/Notwinner0/gvcs/internal/index"
+	"github.com/Notwinner0/gvcs/internal/lfs"
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/refs"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// CmdLfsLsFiles lists the LFS-tracked files in a commit or tree.
+func CmdLfsLsFiles(ref string) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+	treeMap, err := objects.TreeToMap(gitRepo, ref, "")
+	if err != nil {
+		return err
+	}
+	pointers, err := lfsPointers(gitRepo, treeMap)
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	for path := range pointers {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		p := pointers[path]
+		// '*' means the content is present locally, '-' that only the pointer is
+		marker := "-"
+		if lfs.ObjectExists(gitRepo, p.Oid) {
+			marker = "*"
+		}
+		fmt.Printf("%s %s %s\n", p.Oid[0:10], marker, path)
+	}
+	return nil
+}
+
+// CmdLfsPrune deletes local LFS content that is not referenced by the index
+// or by the tree of any ref.
+func CmdLfsPrune(dryRun, verifyRemote bool) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+
+	retained, err := lfsRetained(gitRepo)
+	if err != nil {
+		return err
+	}
+
+	var transfer lfs.Transfer
+	if verifyRemote {
+		transfer, err = lfs.TransferFor(gitRepo)
+		if err != nil {
+			return err
+		}
+		if transfer == nil {
+			return fmt.Errorf("--verify-remote needs lfs.url to be configured")
+		}
+	}
+
+	oids, err := lfs.ObjectList(gitRepo)
+	if err != nil {
+		return err
+	}
+	sort.Strings(oids)
+
+	for _, oid := range oids {
+		if retained[oid] {
+			continue
+		}
+		if transfer != nil {
+			exists, err := transfer.Exists(oid)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				fmt.Printf("keeping %s: not on remote\n", oid)
+				continue
+			}
+		}
+		if dryRun {
+			fmt.Printf("would prune %s\n", oid)
+			continue
+		}
+		if err := os.Remove(lfs.ObjectPath(gitRepo, oid)); err != nil {
+			return err
+		}
+		fmt.Printf("pruned %s\n", oid)
+	}
+	return nil
+}
+
+// CmdLfsPush uploads the LFS content referenced by a commit to the
+// configured transfer backend.
+func CmdLfsPush(ref string) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+	transfer, err := lfs.TransferFor(gitRepo)
+	if err != nil {
+		return err
+	}
+	if transfer == nil {
+		return fmt.Errorf("no lfs.url configured")
+	}
+
+	treeMap, err := objects.TreeToMap(gitRepo, ref, "")
+	if err != nil {
+		return err
+	}
+	pointers, err := lfsPointers(gitRepo, treeMap)
+	if err != nil {
+		return err
+	}
+	for _, p := range pointers {
+		if err := lfs.Push(gitRepo, transfer, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lfsPointers returns the parsed pointers of every LFS-tracked path in a
+// flattened tree, using the attributes recorded in that same tree.
+func lfsPointers(gitRepo *repo.GitRepository, treeMap map[string]string) (map[string]*lfs.Pointer, error) {
+	attrs, err := attributes.AttributesFromTree(gitRepo, treeMap)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]*lfs.Pointer)
+	for path, sha := range treeMap {
+		if attributes.CheckAttr(attrs, path)["filter"] != "lfs" {
+			continue
+		}
+		p, err := lfsPointerRead(gitRepo, sha)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			ret[path] = p
+		}
+	}
+	return ret, nil
+}
+
+// lfsPointerRead reads a blob and parses it as an LFS pointer. It returns
+// nil without an error for content that is not a pointer, such as a file
+// committed before it was tracked; blobs too large to be pointers are
+// rejected without being read.
+func lfsPointerRead(gitRepo *repo.GitRepository, sha string) (*lfs.Pointer, error) {
+	header, r, err := objects.ObjectReader(gitRepo, sha)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if header.Type != "blob" || header.Size > lfs.PointerMaxSize {
+		return nil, nil
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if p, err := lfs.PointerParse(data); err == nil {
+		return p, nil
+	}
+	return nil, nil
+}
+
+// lfsRetained collects the oids that prune must keep: everything pointed to
+// by the index, HEAD and every ref.
+func lfsRetained(gitRepo *repo.GitRepository) (map[string]bool, error) {
+	retained := make(map[string]bool)
+
+	idx, err := index.IndexRead(gitRepo)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range idx.Entries {
+		if entry.Mode&0170000 == 0160000 {
+			// Submodule commits live in another repository
+			continue
+		}
+		p, err := lfsPointerRead(gitRepo, entry.SHA)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			retained[p.Oid] = true
+		}
+	}
+
+	refList, err := refs.RefList(gitRepo, "")
+	if err != nil {
+		return nil, err
+	}
+	// HEAD is unborn in an empty repository
+	var tips []string
+	head, err := refs.RefResolve(gitRepo, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	if head != "" {
+		tips = append(tips, head)
+	}
+	var collect func(refs map[string]interface{})
+	collect = func(refMap map[string]interface{}) {
+		for _, v := range refMap {
+			switch val := v.(type) {
+			case string:
+				tips = append(tips, val)
+			case refs.Symref:
+				if val.SHA != "" {
+					tips = append(tips, val.SHA)
+				}
+			case map[string]interface{}:
+				collect(val)
+			}
+		}
+	}
+	collect(refList)
+
+	for _, tip := range tips {
+		tree, err := objects.ObjectFind(gitRepo, tip, "tree", true)
+		if err != nil {
+			return nil, err
+		}
+		if tree == "" {
+			// A ref to a blob
+			continue
+		}
+		treeMap, err := objects.TreeToMap(gitRepo, tree, "")
+		if err != nil {
+			return nil, err
+		}
+		pointers, err := lfsPointers(gitRepo, treeMap)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range pointers {
+			retained[p.Oid] = true
+		}
+	}
+	return retained, nil
+}
@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Notwinner0/gvcs/internal/lfs"
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+func TestLfsPointers(t *testing.T) {
+	gitRepo, err := repo.RepoCreate(t.TempDir())
+	if err != nil {
+		t.Fatalf("RepoCreate() failed: %v", err)
+	}
+	blobWrite := func(data string) string {
+		blob := new(objects.GitBlob)
+		blob.Deserialize([]byte(data))
+		sha, err := objects.ObjectWrite(blob, gitRepo)
+		if err != nil {
+			t.Fatalf("ObjectWrite() failed: %v", err)
+		}
+		return sha
+	}
+
+	pointer := &lfs.Pointer{Oid: strings.Repeat("ab", 32), Size: 12}
+	treeMap := map[string]string{
+		".gitattributes": blobWrite("*.bin filter=lfs\n"),
+		"big.bin":        blobWrite(string(pointer.Encode())),
+		// Committed before the path was tracked
+		"raw.bin":  blobWrite("not a pointer\n"),
+		"main.txt": blobWrite(string(pointer.Encode())),
+	}
+	pointers, err := lfsPointers(gitRepo, treeMap)
+	if err != nil {
+		t.Fatalf("lfsPointers() failed: %v", err)
+	}
+	if len(pointers) != 1 || pointers["big.bin"] == nil || pointers["big.bin"].Oid != pointer.Oid {
+		t.Errorf("Expected only big.bin to be listed, got %v", pointers)
+	}
+
+	// An unreadable object must fail the listing instead of shortening it
+	treeMap["missing.bin"] = strings.Repeat("1", 40)
+	if _, err := lfsPointers(gitRepo, treeMap); err == nil {
+		t.Errorf("Expected lfsPointers() to report the missing object")
+	}
+}
@@ -1,71 +1,79 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
-	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/diff"
 	"github.com/Notwinner0/gvcs/internal/repo"
+	"github.com/Notwinner0/gvcs/internal/revwalk"
 )
 
-// CmdLog is the handler for the log command.
-func CmdLog(commitRef string) error {
+// CmdLog is the handler for the log command. It prints the history of a
+// commit as a graphviz graph, or one line per commit with oneline.
+//
+// With paths, only commits that change them are shown, and merges that
+// took the paths unchanged from one parent are followed down that parent
+// only. follow tracks a single file across renames whose similarity is at
+// least findRenames, as for diff -M.
+func CmdLog(commitRef string, paths []string, follow bool, findRenames string, oneline bool) error {
 	gitRepo, err := repo.RepoFind(".", true)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("digraph gvcslog{")
-	fmt.Println("  node[shape=rect]")
-
-	sha, err := objects.ObjectFind(gitRepo, commitRef, "", true)
+	specs, err := pathspecs(gitRepo, paths)
 	if err != nil {
 		return err
 	}
+	if follow && len(specs) != 1 {
+		return errors.New("--follow requires exactly one path")
+	}
 
-	seen := make(map[string]bool)
-	err = logGraphviz(gitRepo, sha, seen)
+	threshold, err := diff.ParseThreshold(findRenames)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("}")
-	return nil
-}
-
-func logGraphviz(gitRepo *repo.GitRepository, sha string, seen map[string]bool) error {
-	if seen[sha] {
-		return nil
+	opts := revwalk.Options{Paths: specs, Follow: follow, Renames: diff.RenameOptions{Threshold: threshold}}
+	walker := revwalk.New(gitRepo, opts)
+	if err := walker.AddRevisions([]string{commitRef}); err != nil {
+		return err
 	}
-	seen[sha] = true
-
-	obj, err := objects.ObjectRead(gitRepo, sha)
+	commits, err := walker.Walk()
 	if err != nil {
 		return err
 	}
-	commit, ok := obj.(*objects.GitCommit)
-	if !ok {
-		return fmt.Errorf("object %s is not a commit", sha)
-	}
 
-	message := strings.TrimSpace(commit.Message)
-	// Escape backslashes and quotes for dot format
-	message = strings.ReplaceAll(message, "\\", "\\\\")
-	message = strings.ReplaceAll(message, "\"", "\\\"")
-	if idx := strings.Index(message, "\n"); idx != -1 {
-		message = message[:idx] // Keep only the first line
+	if oneline {
+		for _, c := range commits {
+			fmt.Printf("%s %s\n", c.SHA[:7], logSubject(c.Commit.Message))
+		}
+		return nil
 	}
 
-	fmt.Printf("  c_%s [label=\"%s: %s\"]\n", sha, sha[0:7], message)
-
-	if parents, ok := commit.Kvlm["parent"]; ok {
-		for _, p := range parents {
-			p = strings.TrimSpace(p)
-			fmt.Printf("  c_%s -> c_%s;\n", sha, p)
-			if err := logGraphviz(gitRepo, p, seen); err != nil {
-				return err
-			}
+	fmt.Println("digraph gvcslog{")
+	fmt.Println("  node[shape=rect]")
+	for _, c := range commits {
+		// Escape backslashes and quotes for dot format
+		message := logSubject(c.Commit.Message)
+		message = strings.ReplaceAll(message, "\\", "\\\\")
+		message = strings.ReplaceAll(message, "\"", "\\\"")
+		fmt.Printf("  c_%s [label=\"%s: %s\"]\n", c.SHA, c.SHA[0:7], message)
+		for _, p := range walker.Parents(c) {
+			fmt.Printf("  c_%s -> c_%s;\n", c.SHA, p)
 		}
 	}
+	fmt.Println("}")
 	return nil
 }
+
+// logSubject returns the first line of a commit message.
+func logSubject(message string) string {
+	message = strings.TrimSpace(message)
+	if idx := strings.Index(message, "\n"); idx != -1 {
+		message = message[:idx]
+	}
+	return message
+}
@@ -31,18 +31,9 @@ func lsTree(gitRepo *repo.GitRepository, ref string, recursive bool, prefix stri
 	}
 
 	for _, item := range tree.Items {
-		var objType string
-		switch item.Mode {
-		case "040000":
-			objType = "tree"
-		case "100644", "100755":
-			objType = "blob"
-		case "120000":
-			objType = "blob" // Symlink
-		case "160000":
-			objType = "commit" // Submodule
-		default:
-			return fmt.Errorf("weird tree leaf mode %s", item.Mode)
+		objType, err := objects.TreeLeafType(item.Mode)
+		if err != nil {
+			return err
 		}
 
 		fullPath := filepath.Join(prefix, item.Path)
@@ -52,7 +43,7 @@ func lsTree(gitRepo *repo.GitRepository, ref string, recursive bool, prefix stri
 				return err
 			}
 		} else {
-			fmt.Printf("%s %s %s\t%s\n", item.Mode, objType, item.SHA, fullPath)
+			fmt.Printf("%06s %s %s\t%s\n", item.Mode, objType, item.SHA, fullPath)
 		}
 	}
 	return nil
@@ -0,0 +1,213 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/index"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// mvMove is one path moved by mv. A directory is renamed on disk as a
+// whole, and each of the index entries below it is a move of its own.
+type mvMove struct {
+	src, dst string
+	dir      bool
+}
+
+// CmdMv moves the tracked files and directories in sources to dest, or into
+// it if it is a directory, on disk and in the index. Index entries keep
+// their stat info and mode, so a moved file that was unchanged still is.
+// force lets a source overwrite an existing file, skipErrors leaves out the
+// sources that can't be moved instead of failing, and dryRun only shows
+// what would be moved.
+func CmdMv(sources []string, dest string, force, skipErrors, dryRun bool) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+	idx, err := index.IndexLock(gitRepo)
+	if err != nil {
+		return err
+	}
+	defer idx.Unlock()
+
+	entries := make(map[string][]*index.GitIndexEntry)
+	for _, e := range idx.Entries {
+		entries[e.Name] = append(entries[e.Name], e)
+	}
+
+	dest, err = mvPath(gitRepo, dest)
+	if err != nil {
+		return err
+	}
+	destDir := false
+	if info, err := os.Lstat(mvFull(gitRepo, dest)); err == nil && info.IsDir() {
+		destDir = true
+	}
+	if len(sources) > 1 && !destDir {
+		return fmt.Errorf("destination '%s' is not a directory", dest)
+	}
+
+	var moves, files []mvMove
+	targets := make(map[string]bool)
+	for _, src := range sources {
+		src, err := mvPath(gitRepo, src)
+		if err != nil {
+			return err
+		}
+		dst := dest
+		if destDir {
+			dst = path.Join(dest, path.Base(src))
+		}
+		if dryRun {
+			fmt.Printf("Checking rename of '%s' to '%s'\n", src, dst)
+		}
+
+		sub, bad := mvCheck(gitRepo, entries, src, dst, force)
+		if bad == "" && targets[dst] {
+			bad = "multiple sources for the same target"
+		}
+		if bad != "" {
+			if skipErrors {
+				continue
+			}
+			return fmt.Errorf("%s, source=%s, destination=%s", bad, src, dst)
+		}
+		targets[dst] = true
+
+		if sub == nil {
+			moves = append(moves, mvMove{src: src, dst: dst})
+			continue
+		}
+		moves = append(moves, mvMove{src: src, dst: dst, dir: true})
+		for _, name := range sub {
+			files = append(files, mvMove{src: name, dst: dst + strings.TrimPrefix(name, src)})
+		}
+	}
+	if dryRun {
+		for _, m := range files {
+			fmt.Printf("Checking rename of '%s' to '%s'\n", m.src, m.dst)
+		}
+	}
+	moves = append(moves, files...)
+
+	for _, m := range moves {
+		if dryRun {
+			fmt.Printf("Renaming %s to %s\n", m.src, m.dst)
+			continue
+		}
+		// The entries below a directory went with it.
+		if !mvInDir(m, moves) {
+			if err := os.Rename(mvFull(gitRepo, m.src), mvFull(gitRepo, m.dst)); err != nil {
+				return err
+			}
+		}
+		if m.dir {
+			continue
+		}
+		// An overwritten file is no longer tracked under its own name.
+		delete(entries, m.dst)
+		for _, e := range entries[m.src] {
+			e.Name = m.dst
+		}
+		entries[m.dst] = entries[m.src]
+		delete(entries, m.src)
+	}
+	if dryRun {
+		return nil
+	}
+
+	idx.Entries = idx.Entries[:0]
+	for _, es := range entries {
+		idx.Entries = append(idx.Entries, es...)
+	}
+	worktreeSort(idx.Entries)
+	return index.IndexWrite(gitRepo, idx)
+}
+
+// mvCheck checks that src can be moved to dst, returning what is wrong if
+// it can't. For a directory it also returns the tracked files below it.
+func mvCheck(gitRepo *repo.GitRepository, entries map[string][]*index.GitIndexEntry, src, dst string, force bool) ([]string, string) {
+	info, err := os.Lstat(mvFull(gitRepo, src))
+	if err != nil {
+		return nil, "bad source"
+	}
+	if dst == src || strings.HasPrefix(dst, src+"/") {
+		return nil, "can not move directory into itself"
+	}
+	if _, err := os.Stat(mvFull(gitRepo, path.Dir(dst))); err != nil {
+		return nil, "destination directory does not exist"
+	}
+
+	if info.IsDir() {
+		if _, err := os.Lstat(mvFull(gitRepo, dst)); err == nil {
+			return nil, "cannot move directory over file"
+		}
+		var sub []string
+		for name, es := range entries {
+			if !strings.HasPrefix(name, src+"/") {
+				continue
+			}
+			if len(es) > 1 || es[0].Stage() != index.StageMerged {
+				return nil, "conflicted"
+			}
+			sub = append(sub, name)
+		}
+		if len(sub) == 0 {
+			return nil, "source directory is empty"
+		}
+		sort.Strings(sub)
+		return sub, ""
+	}
+
+	es := entries[src]
+	if es == nil {
+		return nil, "not under version control"
+	}
+	if len(es) > 1 || es[0].Stage() != index.StageMerged {
+		return nil, "conflicted"
+	}
+	if target, err := os.Lstat(mvFull(gitRepo, dst)); err == nil {
+		if !force {
+			return nil, "destination exists"
+		}
+		// Only files can overwrite each other.
+		if target.IsDir() {
+			return nil, "Cannot overwrite"
+		}
+	}
+	return nil, ""
+}
+
+// mvInDir reports whether m is an entry below one of the directories
+// moved, which is renamed with it.
+func mvInDir(m mvMove, moves []mvMove) bool {
+	for _, d := range moves {
+		if d.dir && strings.HasPrefix(m.src, d.src+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// mvPath turns a path relative to the current directory into an index
+// name, "" for the worktree itself.
+func mvPath(gitRepo *repo.GitRepository, p string) (string, error) {
+	specs, err := pathspecs(gitRepo, []string{p})
+	if err != nil {
+		return "", err
+	}
+	if specs[0] == "." {
+		return "", nil
+	}
+	return specs[0], nil
+}
+
+func mvFull(gitRepo *repo.GitRepository, name string) string {
+	return filepath.Join(gitRepo.Worktree, filepath.FromSlash(name))
+}
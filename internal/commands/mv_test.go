@@ -0,0 +1,180 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Notwinner0/gvcs/internal/index"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// testIndexEntry returns the index entry of name, or nil.
+func testIndexEntry(t *testing.T, gitRepo *repo.GitRepository, name string) *index.GitIndexEntry {
+	t.Helper()
+	idx, err := index.IndexRead(gitRepo)
+	if err != nil {
+		t.Fatalf("IndexRead() failed: %v", err)
+	}
+	for _, e := range idx.Entries {
+		if filepath.ToSlash(e.Name) == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// testMv runs mv, returning its output.
+func testMv(t *testing.T, sources []string, dest string, force, skipErrors, dryRun bool) (string, error) {
+	t.Helper()
+	return testOutput(t, func() error { return CmdMv(sources, dest, force, skipErrors, dryRun) })
+}
+
+func TestMv_Directory(t *testing.T) {
+	gitRepo := testRepo(t)
+	testCommit(t, gitRepo, "base", "sub/a.txt", "a\n", "sub/deep/b.txt", "b\n", "c.txt", "c\n")
+
+	if _, err := testMv(t, []string{"sub"}, "moved", false, false, false); err != nil {
+		t.Fatalf("CmdMv() failed: %v", err)
+	}
+	for name, content := range map[string]string{"moved/a.txt": "a\n", "moved/deep/b.txt": "b\n"} {
+		if got := testRead(t, gitRepo, name); got != content {
+			t.Errorf("Expected %s to hold %q, got %q", name, content, got)
+		}
+		if got := testStaged(t, gitRepo, name); got != content {
+			t.Errorf("Expected %q staged for %s, got %q", content, name, got)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(gitRepo.Worktree, "sub")); !os.IsNotExist(err) {
+		t.Errorf("Expected sub to be gone, got %v", err)
+	}
+	if e := testIndexEntry(t, gitRepo, "sub/a.txt"); e != nil {
+		t.Errorf("Expected sub/a.txt out of the index")
+	}
+
+	// Into an existing directory
+	if _, err := testMv(t, []string{"moved"}, "moved/deep", false, false, false); err == nil {
+		t.Errorf("Expected moving a directory into itself to fail")
+	}
+	if _, err := testMv(t, []string{"c.txt"}, "moved", false, false, false); err != nil {
+		t.Fatalf("CmdMv() failed: %v", err)
+	}
+	if got := testStaged(t, gitRepo, "moved/c.txt"); got != "c\n" {
+		t.Errorf("Expected c.txt moved into moved/, got %q", got)
+	}
+}
+
+func TestMv_KeepsEntry(t *testing.T) {
+	gitRepo := testRepo(t)
+	testCommit(t, gitRepo, "base", "run.sh", "echo\n")
+	idx, err := index.IndexLock(gitRepo)
+	if err != nil {
+		t.Fatalf("IndexLock() failed: %v", err)
+	}
+	idx.Entries[0].Mode = 0100755
+	if err := index.IndexWrite(gitRepo, idx); err != nil {
+		t.Fatalf("IndexWrite() failed: %v", err)
+	}
+	before := *testIndexEntry(t, gitRepo, "run.sh")
+
+	if _, err := testMv(t, []string{"run.sh"}, "tool.sh", false, false, false); err != nil {
+		t.Fatalf("CmdMv() failed: %v", err)
+	}
+	after := testIndexEntry(t, gitRepo, "tool.sh")
+	if after == nil {
+		t.Fatalf("Expected tool.sh in the index")
+	}
+	if after.Mode != before.Mode || after.SHA != before.SHA || after.MTime != before.MTime || after.FSize != before.FSize {
+		t.Errorf("Expected the entry kept as %+v, got %+v", before, *after)
+	}
+	idx, err = index.IndexRead(gitRepo)
+	if err != nil {
+		t.Fatalf("IndexRead() failed: %v", err)
+	}
+	if changes, err := worktreeChanges(gitRepo, idx); err != nil || len(changes) > 0 {
+		t.Errorf("Expected the moved file unchanged, got %v, %v", changes, err)
+	}
+}
+
+func TestMv_Errors(t *testing.T) {
+	gitRepo := testRepo(t)
+	testCommit(t, gitRepo, "base", "a.txt", "a\n", "b.txt", "b\n", "sub/a.txt", "sub a\n", "dir/d.txt", "d\n")
+	testWrite(t, gitRepo, "u.txt", "u\n")
+
+	_, err := testMv(t, []string{"u.txt"}, "v.txt", false, false, false)
+	if err == nil || !strings.Contains(err.Error(), "not under version control") {
+		t.Errorf("Expected an untracked source to be refused, got %v", err)
+	}
+	if got := testRead(t, gitRepo, "u.txt"); got != "u\n" {
+		t.Errorf("Expected u.txt left in place, got %q", got)
+	}
+
+	_, err = testMv(t, []string{"a.txt", "sub/a.txt"}, "dir", false, false, false)
+	if err == nil || !strings.Contains(err.Error(), "multiple sources for the same target") {
+		t.Errorf("Expected two sources for dir/a.txt to be refused, got %v", err)
+	}
+	if got := testStaged(t, gitRepo, "a.txt"); got != "a\n" {
+		t.Errorf("Expected nothing moved, got %q staged for a.txt", got)
+	}
+
+	// -f overwrites a file
+	if _, err := testMv(t, []string{"a.txt"}, "b.txt", false, false, false); err == nil {
+		t.Errorf("Expected an existing destination to be refused")
+	}
+	if _, err := testMv(t, []string{"a.txt"}, "b.txt", true, false, false); err != nil {
+		t.Fatalf("CmdMv() with force failed: %v", err)
+	}
+	if got := testRead(t, gitRepo, "b.txt") + testStaged(t, gitRepo, "b.txt"); got != "a\na\n" {
+		t.Errorf("Expected b.txt overwritten by a.txt, got %q", got)
+	}
+	if e := testIndexEntry(t, gitRepo, "a.txt"); e != nil {
+		t.Errorf("Expected a.txt out of the index")
+	}
+
+	// -k leaves out the sources that can't be moved
+	if _, err := testMv(t, []string{"u.txt", "missing.txt", "b.txt", "sub/a.txt"}, "dir", false, true, false); err != nil {
+		t.Fatalf("CmdMv() with skipErrors failed: %v", err)
+	}
+	for name, content := range map[string]string{"dir/b.txt": "a\n", "dir/a.txt": "sub a\n"} {
+		if got := testStaged(t, gitRepo, name); got != content {
+			t.Errorf("Expected %q staged for %s, got %q", content, name, got)
+		}
+	}
+	if got := testRead(t, gitRepo, "u.txt"); got != "u\n" {
+		t.Errorf("Expected u.txt left in place, got %q", got)
+	}
+}
+
+func TestMv_DryRun(t *testing.T) {
+	gitRepo := testRepo(t)
+	testCommit(t, gitRepo, "base", "a.txt", "a\n")
+	before, err := os.ReadFile(repo.RepoPath(gitRepo, "index"))
+	if err != nil {
+		t.Fatalf("ReadFile() failed: %v", err)
+	}
+
+	out, err := testMv(t, []string{"a.txt"}, "z.txt", false, false, true)
+	if err != nil {
+		t.Fatalf("CmdMv() failed: %v", err)
+	}
+	if want := "Checking rename of 'a.txt' to 'z.txt'\nRenaming a.txt to z.txt\n"; out != want {
+		t.Errorf("Expected %q, got %q", want, out)
+	}
+	if got := testRead(t, gitRepo, "a.txt"); got != "a\n" {
+		t.Errorf("Expected a.txt left in place, got %q", got)
+	}
+	if got := testRead(t, gitRepo, "z.txt"); got != "" {
+		t.Errorf("Expected no z.txt, got %q", got)
+	}
+	after, err := os.ReadFile(repo.RepoPath(gitRepo, "index"))
+	if err != nil {
+		t.Fatalf("ReadFile() failed: %v", err)
+	}
+	if string(before) != string(after) {
+		t.Errorf("Expected the index unchanged")
+	}
+	if _, err := os.Stat(repo.RepoPath(gitRepo, "index.lock")); !os.IsNotExist(err) {
+		t.Errorf("Expected index.lock released, got %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package commands
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// pathspecs turns paths given relative to the current directory into
+// "/"-separated paths relative to the worktree, as trees name them.
+// Glob characters pass through unchanged.
+func pathspecs(gitRepo *repo.GitRepository, paths []string) ([]string, error) {
+	var specs []string
+	for _, p := range paths {
+		absPath, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		relPath, err := filepath.Rel(gitRepo.Worktree, absPath)
+		if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("%s: outside repository", p)
+		}
+		specs = append(specs, filepath.ToSlash(relPath))
+	}
+	return specs, nil
+}
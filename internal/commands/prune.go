@@ -0,0 +1,146 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Notwinner0/gvcs/internal/date"
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/reachable"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// pruneCandidate is an unreachable loose object.
+type pruneCandidate struct {
+	sha  string
+	path string
+}
+
+// CmdPrune is the handler for the prune command. It removes unreachable
+// loose objects last modified before expire.
+//
+// A concurrent writer may be creating an object or reusing an old one
+// while prune runs. New objects are recent, and writers touch objects they
+// find already stored, so both survive the grace period. Objects reachable
+// from recent unreachable objects are kept too, as a commit in progress
+// may need them, and every file is checked again just before removal.
+func CmdPrune(expire string, dryRun, verbose bool) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+	expireTime, err := date.Parse(expire, time.Now())
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	roots, err := reachable.RootList(gitRepo)
+	if err != nil {
+		return err
+	}
+	for _, root := range roots {
+		if err := reachable.Mark(gitRepo, seen, root.SHA, false); err != nil {
+			return fmt.Errorf("%s: %v", root.Name, err)
+		}
+	}
+
+	root := repo.RepoPath(gitRepo, "objects")
+	var candidates []pruneCandidate
+	var recent []string
+	dirs, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || !looseDirRE.MatchString(dir.Name()) {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(root, dir.Name()))
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			sha := dir.Name() + f.Name()
+			if !looseFileRE.MatchString(f.Name()) || seen[sha] {
+				continue
+			}
+			path := filepath.Join(root, dir.Name(), f.Name())
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			if info.ModTime().Before(expireTime) {
+				candidates = append(candidates, pruneCandidate{sha: sha, path: path})
+			} else {
+				recent = append(recent, sha)
+			}
+		}
+	}
+	for _, sha := range recent {
+		if err := reachable.Mark(gitRepo, seen, sha, true); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range candidates {
+		if seen[c.sha] {
+			continue
+		}
+		// The object may have been reused since the scan
+		info, err := os.Stat(c.path)
+		if err != nil || !info.ModTime().Before(expireTime) {
+			continue
+		}
+		if dryRun || verbose {
+			objType := "unknown"
+			if header, r, err := objects.ObjectReader(gitRepo, c.sha); err == nil {
+				objType = header.Type
+				r.Close()
+			}
+			fmt.Printf("%s %s\n", c.sha, objType)
+		}
+		if dryRun {
+			continue
+		}
+		if err := os.Remove(c.path); err != nil {
+			return err
+		}
+		// Fails harmlessly unless this was the last object of its directory
+		os.Remove(filepath.Dir(c.path))
+	}
+
+	return pruneTemporary(root, expireTime, dryRun, verbose)
+}
+
+// pruneTemporary removes the temporary files writers that crashed left in
+// the object store.
+func pruneTemporary(root string, expireTime time.Time, dryRun, verbose bool) error {
+	files, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasPrefix(f.Name(), "tmp_obj_") {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil || !info.ModTime().Before(expireTime) {
+			continue
+		}
+		path := filepath.Join(root, f.Name())
+		if dryRun || verbose {
+			fmt.Printf("Removing stale temporary file %s\n", filepath.ToSlash(filepath.Join("objects", f.Name())))
+		}
+		if dryRun {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
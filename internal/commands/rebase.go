@@ -0,0 +1,819 @@
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/diff"
+	"github.com/Notwinner0/gvcs/internal/index"
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/refs"
+	"github.com/Notwinner0/gvcs/internal/repo"
+	"github.com/Notwinner0/gvcs/internal/revwalk"
+)
+
+// The directory in the gitdir holding the state of a rebase in progress,
+// and the file naming the commit whose pick stopped it.
+const (
+	rebaseDir  = "rebase-merge"
+	rebaseHead = "REBASE_HEAD"
+)
+
+// rebaseActions maps the actions of a todo list, and their one-letter
+// abbreviations, to their names.
+var rebaseActions = map[string]string{
+	"pick": "pick", "p": "pick",
+	"reword": "reword", "r": "reword",
+	"squash": "squash", "s": "squash",
+	"fixup": "fixup", "f": "fixup",
+	"drop": "drop", "d": "drop",
+	"exec": "exec", "x": "exec",
+}
+
+// rebaseStep is a line of a rebase todo list.
+type rebaseStep struct {
+	action string // "pick", "reword", "squash", "fixup", "drop" or "exec"
+	sha    string // the commit, "" for exec
+	arg    string // the subject of the commit, or the command to exec
+}
+
+func (s rebaseStep) String() string {
+	if s.action == "exec" {
+		return "exec " + s.arg
+	}
+	return fmt.Sprintf("%s %s %s", s.action, s.sha, s.arg)
+}
+
+// rebase is a series of commits being replayed onto a new base, with HEAD
+// detached until they all are. Its state lives in .git/rebase-merge, so a
+// stopped step can be resolved and continued, skipped, or the whole rebase
+// aborted.
+type rebase struct {
+	gitRepo  *repo.GitRepository
+	headName string // the branch being rebased, "" for a detached HEAD
+	onto     string
+	origHead string // HEAD when the rebase started
+	todo     []rebaseStep
+	done     []rebaseStep // the last one is the step in progress
+}
+
+// CmdRebase is the handler for the rebase command. It replays the commits
+// of HEAD that upstream lacks onto upstream, or onto the commit onto names,
+// and moves the branch to the result. The list of steps is one pick per
+// commit, oldest first; autosquash moves "fixup! " and "squash! " commits
+// after the commits they name, exec runs a shell command after each commit,
+// and todoFile ("-" for stdin) gives the list outright. A step that
+// conflicts or fails stops the rebase until it is resolved and continued
+// with cont, skipped with skip, or the rebase undone with abort.
+func CmdRebase(upstream, onto string, execCmds []string, autosquash bool, todoFile string, cont, abort, skip bool) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+	r, err := rebaseLoad(gitRepo)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case cont:
+		if r == nil {
+			return errNoRebase
+		}
+		return r.cont()
+	case skip:
+		if r == nil {
+			return errNoRebase
+		}
+		return r.skip()
+	case abort:
+		if r == nil {
+			return errNoRebase
+		}
+		return r.abort()
+	}
+
+	if r != nil {
+		return errors.New("a rebase is already in progress\nuse --continue, --skip or --abort")
+	}
+	if pending, err := sequencerPendingRead(gitRepo); err != nil {
+		return err
+	} else if pending != nil {
+		return errors.New("a cherry-pick or revert is in progress\nfinish it with --continue or --abort first")
+	}
+	if upstream == "" {
+		return errors.New("no upstream given")
+	}
+	if todoFile != "" && (len(execCmds) > 0 || autosquash) {
+		return errors.New("--todo-file cannot be used with --exec or --autosquash")
+	}
+	upstreamSHA, err := objects.ObjectFind(gitRepo, upstream, "commit", true)
+	if err != nil {
+		return err
+	}
+	if upstreamSHA == "" {
+		return fmt.Errorf("invalid upstream %s", upstream)
+	}
+	ontoName, ontoSHA := upstream, upstreamSHA
+	if onto != "" {
+		if ontoSHA, err = objects.ObjectFind(gitRepo, onto, "commit", true); err != nil {
+			return err
+		}
+		if ontoSHA == "" {
+			return fmt.Errorf("invalid onto %s", onto)
+		}
+		ontoName = onto
+	}
+
+	head, err := objects.ObjectFind(gitRepo, "HEAD", "commit", true)
+	if err != nil {
+		return err
+	}
+	branch, detached, err := refs.BranchGetActive(gitRepo)
+	if err != nil {
+		return err
+	}
+	headName := ""
+	if !detached {
+		headName = "refs/heads/" + branch
+	}
+	if err := rebaseClean(gitRepo, head); err != nil {
+		return err
+	}
+
+	var todo []rebaseStep
+	if todoFile != "" {
+		if todo, err = rebaseTodoRead(gitRepo, todoFile); err != nil {
+			return err
+		}
+		if len(todo) == 0 {
+			return errors.New("nothing to do")
+		}
+	} else {
+		bases, err := revwalk.MergeBases(gitRepo, upstreamSHA, head)
+		if err != nil {
+			return err
+		}
+		if len(bases) == 1 && bases[0] == ontoSHA && len(execCmds) == 0 && !autosquash {
+			fmt.Printf("Current branch %s is up to date.\n", branch)
+			return nil
+		}
+		if todo, err = rebaseTodoBuild(gitRepo, upstreamSHA, head, execCmds, autosquash); err != nil {
+			return err
+		}
+	}
+	if err := rebaseTodoCheck(todo); err != nil {
+		return err
+	}
+
+	r = &rebase{gitRepo: gitRepo, headName: headName, onto: ontoSHA, origHead: head, todo: todo}
+	if err := r.save(); err != nil {
+		return err
+	}
+	if err := os.WriteFile(repo.RepoPath(gitRepo, "ORIG_HEAD"), []byte(head+"\n"), 0644); err != nil {
+		return err
+	}
+	if err := rebaseCheckout(gitRepo, ontoSHA, head, "rebase (start): checkout "+ontoName); err != nil {
+		if rerr := r.remove(); rerr != nil {
+			return rerr
+		}
+		return err
+	}
+	return r.run()
+}
+
+// rebaseClean fails if the index or the worktree has changes from head,
+// which replaying commits would mix into them.
+func rebaseClean(gitRepo *repo.GitRepository, head string) error {
+	idx, err := index.IndexRead(gitRepo)
+	if err != nil {
+		return err
+	}
+	headTree, err := diffTree(gitRepo, head)
+	if err != nil {
+		return err
+	}
+	if err := worktreeStaged(gitRepo, idx, headTree); err != nil {
+		return err
+	}
+	changes, err := worktreeChanges(gitRepo, idx)
+	if err != nil {
+		return err
+	}
+	if len(changes) > 0 {
+		return errors.New("cannot rebase: you have unstaged changes\ncommit your changes or stash them to proceed")
+	}
+	return nil
+}
+
+// rebaseCheckout sets the index and worktree to the tree of commit and
+// detaches HEAD there from old.
+func rebaseCheckout(gitRepo *repo.GitRepository, commit, old, message string) error {
+	tree, err := diffTree(gitRepo, commit)
+	if err != nil {
+		return err
+	}
+	files, err := diff.TreeFiles(gitRepo, tree, nil)
+	if err != nil {
+		return err
+	}
+	idx, err := index.IndexLock(gitRepo)
+	if err != nil {
+		return err
+	}
+	defer idx.Unlock()
+	if err := worktreeUpdate(gitRepo, idx, files, nil, false); err != nil {
+		return err
+	}
+	tx := refs.RefTransactionBegin(gitRepo)
+	tx.Committer, _ = userIdent(gitRepo)
+	tx.NoDeref = true
+	if err := tx.Update("HEAD", commit, old, message); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// rebaseTodoBuild lists a pick for each commit of upstream..head oldest
+// first, leaving out merges, then shaped by autosquash and execCmds.
+func rebaseTodoBuild(gitRepo *repo.GitRepository, upstream, head string, execCmds []string, autosquash bool) ([]rebaseStep, error) {
+	w := revwalk.New(gitRepo, revwalk.Options{Order: revwalk.OrderTopo})
+	if err := w.AddRevisions([]string{upstream + ".." + head}); err != nil {
+		return nil, err
+	}
+	commits, err := w.Walk()
+	if err != nil {
+		return nil, err
+	}
+	var steps []rebaseStep
+	for i := len(commits) - 1; i >= 0; i-- {
+		c := commits[i]
+		if len(c.Parents) > 1 {
+			continue
+		}
+		steps = append(steps, rebaseStep{action: "pick", sha: c.SHA, arg: logSubject(c.Commit.Message)})
+	}
+
+	groups := make([][]rebaseStep, len(steps))
+	for i, s := range steps {
+		groups[i] = []rebaseStep{s}
+	}
+	if autosquash {
+		groups = rebaseAutosquash(steps)
+	}
+	var todo []rebaseStep
+	for _, g := range groups {
+		todo = append(todo, g...)
+		for _, cmd := range execCmds {
+			todo = append(todo, rebaseStep{action: "exec", arg: cmd})
+		}
+	}
+	return todo, nil
+}
+
+// rebaseAutosquash groups picks, oldest first, so that each commit whose
+// subject is "fixup! X" or "squash! X" follows the earlier commit X names
+// as its fixup or squash. X is matched against subjects, then against
+// abbreviated SHAs, then against the start of subjects.
+func rebaseAutosquash(steps []rebaseStep) [][]rebaseStep {
+	var groups [][]rebaseStep
+	groupOf := make([]int, len(steps))
+	for i, s := range steps {
+		action, target := "", s.arg
+		for {
+			if rest, ok := strings.CutPrefix(target, "fixup! "); ok {
+				target = rest
+			} else if rest, ok := strings.CutPrefix(target, "squash! "); ok {
+				target = rest
+			} else {
+				break
+			}
+			if action == "" {
+				action = strings.TrimSuffix(strings.SplitN(s.arg, " ", 2)[0], "!")
+			}
+		}
+		if action != "" {
+			if j := rebaseFindTarget(steps[:i], target); j >= 0 {
+				s.action = action
+				groupOf[i] = groupOf[j]
+				groups[groupOf[j]] = append(groups[groupOf[j]], s)
+				continue
+			}
+		}
+		groupOf[i] = len(groups)
+		groups = append(groups, []rebaseStep{s})
+	}
+	return groups
+}
+
+// rebaseFindTarget returns the index of the commit among steps that target
+// names, or -1.
+func rebaseFindTarget(steps []rebaseStep, target string) int {
+	for i, s := range steps {
+		if s.arg == target {
+			return i
+		}
+	}
+	if len(target) >= 4 {
+		for i, s := range steps {
+			if strings.HasPrefix(s.sha, target) {
+				return i
+			}
+		}
+	}
+	for i, s := range steps {
+		if strings.HasPrefix(s.arg, target) {
+			return i
+		}
+	}
+	return -1
+}
+
+// rebaseTodoRead reads a todo list given by a script, from stdin if name
+// is "-".
+func rebaseTodoRead(gitRepo *repo.GitRepository, name string) ([]rebaseStep, error) {
+	var data []byte
+	var err error
+	if name == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rebaseTodoParse(gitRepo, string(data))
+}
+
+// rebaseTodoParse parses a todo list: one "<action> <commit> [subject]" or
+// "exec <command>" per line, with blank lines and "#" comments ignored.
+// Commits may be abbreviated or named by any revision.
+func rebaseTodoParse(gitRepo *repo.GitRepository, text string) ([]rebaseStep, error) {
+	var steps []rebaseStep
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		word, rest, _ := strings.Cut(line, " ")
+		action, ok := rebaseActions[word]
+		if !ok {
+			return nil, fmt.Errorf("invalid todo line %d: unknown action %q", n, word)
+		}
+		rest = strings.TrimSpace(rest)
+		if action == "exec" {
+			if rest == "" {
+				return nil, fmt.Errorf("invalid todo line %d: missing command", n)
+			}
+			steps = append(steps, rebaseStep{action: action, arg: rest})
+			continue
+		}
+		name, subject, _ := strings.Cut(rest, " ")
+		if name == "" {
+			return nil, fmt.Errorf("invalid todo line %d: missing commit", n)
+		}
+		sha, err := objects.ObjectFind(gitRepo, name, "commit", true)
+		if err != nil || sha == "" {
+			return nil, fmt.Errorf("invalid todo line %d: %s is not a commit", n, name)
+		}
+		steps = append(steps, rebaseStep{action: action, sha: sha, arg: strings.TrimSpace(subject)})
+	}
+	return steps, nil
+}
+
+// rebaseTodoCheck fails if a squash or fixup has no commit before it to
+// fold into.
+func rebaseTodoCheck(todo []rebaseStep) error {
+	for _, s := range todo {
+		switch s.action {
+		case "pick", "reword":
+			return nil
+		case "squash", "fixup":
+			return fmt.Errorf("cannot '%s' without a previous commit", s.action)
+		}
+	}
+	return nil
+}
+
+// rebaseLoad reads the state of the rebase in progress, or returns nil if
+// there is none.
+func rebaseLoad(gitRepo *repo.GitRepository) (*rebase, error) {
+	read := func(name string) (string, error) {
+		data, err := os.ReadFile(repo.RepoPath(gitRepo, rebaseDir, name))
+		return strings.TrimSpace(string(data)), err
+	}
+	headName, err := read("head-name")
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r := &rebase{gitRepo: gitRepo}
+	if headName != "detached HEAD" {
+		r.headName = headName
+	}
+	if r.onto, err = read("onto"); err != nil {
+		return nil, err
+	}
+	if r.origHead, err = read("orig-head"); err != nil {
+		return nil, err
+	}
+	for _, list := range []struct {
+		name  string
+		steps *[]rebaseStep
+	}{{"git-rebase-todo", &r.todo}, {"done", &r.done}} {
+		text, err := read(list.name)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if *list.steps, err = rebaseTodoParse(gitRepo, text); err != nil {
+			return nil, fmt.Errorf("%s: %w", list.name, err)
+		}
+	}
+	return r, nil
+}
+
+// save writes the state of the rebase.
+func (r *rebase) save() error {
+	headName := r.headName
+	if headName == "" {
+		headName = "detached HEAD"
+	}
+	files := map[string]string{
+		"head-name":       headName,
+		"onto":            r.onto,
+		"orig-head":       r.origHead,
+		"git-rebase-todo": rebaseTodoFormat(r.todo),
+		"done":            rebaseTodoFormat(r.done),
+		"msgnum":          strconv.Itoa(len(r.done)),
+		"end":             strconv.Itoa(len(r.done) + len(r.todo)),
+	}
+	for name, content := range files {
+		path, err := repo.RepoFile(r.gitRepo, true, rebaseDir, name)
+		if err != nil {
+			return err
+		}
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebaseTodoFormat writes steps as a todo list.
+func rebaseTodoFormat(steps []rebaseStep) string {
+	var b strings.Builder
+	for _, s := range steps {
+		b.WriteString(s.String() + "\n")
+	}
+	return b.String()
+}
+
+// remove deletes the state of the rebase.
+func (r *rebase) remove() error {
+	if err := r.setStopped(""); err != nil {
+		return err
+	}
+	return os.RemoveAll(repo.RepoPath(r.gitRepo, rebaseDir))
+}
+
+// stopped returns the commit whose pick stopped the rebase with conflicts,
+// or "".
+func (r *rebase) stopped() (string, error) {
+	data, err := os.ReadFile(repo.RepoPath(r.gitRepo, rebaseDir, "stopped-sha"))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(data)), err
+}
+
+// setStopped records the commit whose pick stopped, or forgets it if sha
+// is "".
+func (r *rebase) setStopped(sha string) error {
+	paths := []string{repo.RepoPath(r.gitRepo, rebaseDir, "stopped-sha"), repo.RepoPath(r.gitRepo, rebaseHead)}
+	for _, path := range paths {
+		var err error
+		if sha == "" {
+			err = os.Remove(path)
+		} else {
+			err = os.WriteFile(path, []byte(sha+"\n"), 0644)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// run takes the steps left, stopping at the first that conflicts or fails,
+// and finishes the rebase once all are done. A step that fails before
+// changing anything is put back.
+func (r *rebase) run() error {
+	for len(r.todo) > 0 {
+		step := r.todo[0]
+		r.todo = r.todo[1:]
+		r.done = append(r.done, step)
+		if err := r.save(); err != nil {
+			return err
+		}
+		stopped, err := r.step(step)
+		if err == nil {
+			continue
+		}
+		if !stopped {
+			r.done = r.done[:len(r.done)-1]
+			r.todo = append([]rebaseStep{step}, r.todo...)
+			if serr := r.save(); serr != nil {
+				return serr
+			}
+		}
+		return err
+	}
+	return r.finish()
+}
+
+// step takes a step of the todo list. A step that conflicts or fails is
+// reported as an error with stopped set; other errors leave everything as
+// it was.
+func (r *rebase) step(s rebaseStep) (stopped bool, err error) {
+	switch s.action {
+	case "drop":
+		return false, nil
+	case "exec":
+		fmt.Printf("Executing: %s\n", s.arg)
+		cmd := exec.Command("sh", "-c", s.arg)
+		cmd.Dir = r.gitRepo.Worktree
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return true, fmt.Errorf("execution failed: %s\n%v\nfix it, then run rebase --continue", s.arg, err)
+		}
+		return false, nil
+	}
+
+	commit, err := sequencerCommit(r.gitRepo, s.sha)
+	if err != nil {
+		return false, err
+	}
+	head, err := objects.ObjectFind(r.gitRepo, "HEAD", "commit", true)
+	if err != nil {
+		return false, err
+	}
+	headTree, err := diffTree(r.gitRepo, head)
+	if err != nil {
+		return false, err
+	}
+	subject := logSubject(commit.Message)
+
+	// A commit already on top of HEAD is kept as it is
+	if parents := commit.Kvlm["parent"]; s.action == "pick" && len(parents) == 1 && parents[0] == head {
+		return false, rebaseCheckout(r.gitRepo, s.sha, head, "rebase (pick): "+subject)
+	}
+
+	tree, err := sequencerMerge(r.gitRepo, s.sha, commit, false, headTree)
+	if err != nil {
+		return false, err
+	}
+	if tree == "" {
+		if err := r.setStopped(s.sha); err != nil {
+			return true, err
+		}
+		return true, fmt.Errorf("could not apply %s... %s\n"+
+			"resolve the conflicts, mark them resolved with add, then run rebase --continue; "+
+			"or use rebase --skip to leave this commit out, or rebase --abort to undo the rebase",
+			s.sha[:7], subject)
+	}
+	if tree == headTree && (s.action == "pick" || s.action == "reword") {
+		fmt.Printf("dropping %s %s -- its changes are already upstream\n", s.sha[:7], subject)
+		return false, nil
+	}
+	return true, r.commit(s, tree)
+}
+
+// commit commits tree for the step s and moves HEAD to it: on top of HEAD
+// for a pick or reword, in place of HEAD for a squash or fixup, which
+// folds the commit into it.
+func (r *rebase) commit(s rebaseStep, tree string) error {
+	commit, err := sequencerCommit(r.gitRepo, s.sha)
+	if err != nil {
+		return err
+	}
+	head, err := objects.ObjectFind(r.gitRepo, "HEAD", "commit", true)
+	if err != nil {
+		return err
+	}
+	parents := []string{head}
+	author := showHeader(commit.Kvlm, "author")
+	message := commit.Message
+	edit := s.action == "reword"
+
+	if s.action == "squash" || s.action == "fixup" {
+		headCommit, err := sequencerCommit(r.gitRepo, head)
+		if err != nil {
+			return err
+		}
+		parents = headCommit.Kvlm["parent"]
+		author = showHeader(headCommit.Kvlm, "author")
+		message = headCommit.Message
+		if s.action == "squash" {
+			// The subject of a "squash! " commit only named its target
+			squashed := commit.Message
+			if strings.HasPrefix(squashed, "squash! ") {
+				_, squashed, _ = strings.Cut(squashed, "\n")
+			}
+			if squashed = strings.TrimSpace(squashed); squashed != "" {
+				message = strings.TrimSpace(message) + "\n\n" + squashed + "\n"
+			}
+			// A chain of squashes is edited once, at its end
+			edit = len(r.todo) == 0 || (r.todo[0].action != "squash" && r.todo[0].action != "fixup")
+		}
+	}
+	if edit {
+		if message, err = rebaseEdit(r.gitRepo, message); err != nil {
+			return err
+		}
+	}
+
+	message = strings.TrimSpace(message) + "\n"
+	sha, err := commitWrite(r.gitRepo, tree, parents, author, message)
+	if err != nil {
+		return err
+	}
+	return headUpdate(r.gitRepo, sha, head, fmt.Sprintf("rebase (%s): %s", s.action, logSubject(message)))
+}
+
+// rebaseEdit lets the user edit a commit message in their editor, and
+// returns it without its comment lines.
+func rebaseEdit(gitRepo *repo.GitRepository, message string) (string, error) {
+	path := repo.RepoPath(gitRepo, "COMMIT_EDITMSG")
+	text := strings.TrimSpace(message) + "\n\n" +
+		"# Please enter the commit message for your changes. Lines starting\n" +
+		"# with '#' will be ignored, and an empty message aborts the commit.\n"
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		return "", err
+	}
+
+	editor := rebaseEditor(gitRepo)
+	cmd := exec.Command("sh", "-c", editor+` "$@"`, editor, path)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("there was a problem with the editor '%s': %v", editor, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			lines = append(lines, strings.TrimRight(line, " \t\r"))
+		}
+	}
+	edited := strings.TrimSpace(strings.Join(lines, "\n"))
+	if edited == "" {
+		return "", errors.New("aborting commit due to empty commit message")
+	}
+	return edited + "\n", nil
+}
+
+// rebaseEditor returns the command that edits commit messages, taken from
+// GIT_EDITOR, core.editor, VISUAL and EDITOR in that order.
+func rebaseEditor(gitRepo *repo.GitRepository) string {
+	if editor := os.Getenv("GIT_EDITOR"); editor != "" {
+		return editor
+	}
+	if editor, err := gitRepo.Conf.Get("core", "editor"); err == nil && editor != "" {
+		return editor
+	}
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if editor := os.Getenv(name); editor != "" {
+			return editor
+		}
+	}
+	return "vi"
+}
+
+// finish moves the rebased branch to HEAD and puts HEAD back on it.
+func (r *rebase) finish() error {
+	head, err := objects.ObjectFind(r.gitRepo, "HEAD", "commit", true)
+	if err != nil {
+		return err
+	}
+	committer, _ := userIdent(r.gitRepo)
+	if r.headName == "" {
+		fmt.Println("Successfully rebased and updated detached HEAD.")
+		return r.remove()
+	}
+
+	tx := refs.RefTransactionBegin(r.gitRepo)
+	tx.Committer = committer
+	if err := tx.Update(r.headName, head, r.origHead, fmt.Sprintf("rebase (finish): %s onto %s", r.headName, r.onto)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if err := refs.SymrefWrite(r.gitRepo, "HEAD", r.headName, committer, "rebase (finish): returning to "+r.headName); err != nil {
+		return err
+	}
+	fmt.Printf("Successfully rebased and updated %s.\n", r.headName)
+	return r.remove()
+}
+
+// cont commits the stopped step once its conflicts are resolved, unless
+// the user already did, and goes on with the rest.
+func (r *rebase) cont() error {
+	idx, err := index.IndexRead(r.gitRepo)
+	if err != nil {
+		return err
+	}
+	if unmerged := idx.Unmerged(); len(unmerged) > 0 {
+		return fmt.Errorf("you have unmerged files:\n\t%s\nresolve them and mark them with add first", strings.Join(unmerged, "\n\t"))
+	}
+	head, err := objects.ObjectFind(r.gitRepo, "HEAD", "commit", true)
+	if err != nil {
+		return err
+	}
+	headTree, err := diffTree(r.gitRepo, head)
+	if err != nil {
+		return err
+	}
+	tree, err := treeFromIndex(r.gitRepo, idx)
+	if err != nil {
+		return err
+	}
+
+	stopped, err := r.stopped()
+	if err != nil {
+		return err
+	}
+	if stopped == "" {
+		if tree != headTree {
+			return errors.New("you have staged changes\ncommit them, then run rebase --continue")
+		}
+		return r.run()
+	}
+	step := r.done[len(r.done)-1]
+	if tree != headTree || step.action == "squash" || step.action == "fixup" {
+		if err := r.commit(step, tree); err != nil {
+			return err
+		}
+	}
+	if err := r.setStopped(""); err != nil {
+		return err
+	}
+	return r.run()
+}
+
+// skip drops the changes of the stopped step and goes on with the rest.
+func (r *rebase) skip() error {
+	if err := sequencerReset(r.gitRepo, "HEAD"); err != nil {
+		return err
+	}
+	if err := r.setStopped(""); err != nil {
+		return err
+	}
+	return r.run()
+}
+
+// abort returns HEAD, the index and the worktree to where the rebase
+// started, and forgets it.
+func (r *rebase) abort() error {
+	if err := sequencerReset(r.gitRepo, r.origHead); err != nil {
+		return err
+	}
+	committer, _ := userIdent(r.gitRepo)
+	message := "rebase (abort): returning to " + r.origHead
+	if r.headName != "" {
+		message = "rebase (abort): returning to " + r.headName
+		if err := refs.SymrefWrite(r.gitRepo, "HEAD", r.headName, committer, message); err != nil {
+			return err
+		}
+	} else {
+		tx := refs.RefTransactionBegin(r.gitRepo)
+		tx.Committer = committer
+		tx.NoDeref = true
+		if err := tx.Update("HEAD", r.origHead, "", message); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return r.remove()
+}
+
+// errNoRebase is returned for --continue, --skip or --abort with no rebase
+// in progress.
+var errNoRebase = errors.New("no rebase in progress")
@@ -0,0 +1,188 @@
+package commands
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/refs"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// testRebase runs rebase with the given upstream and no other options.
+func testRebase(t *testing.T, upstream string) error {
+	t.Helper()
+	_, err := testOutput(t, func() error {
+		return CmdRebase(upstream, "", nil, false, "", false, false, false)
+	})
+	return err
+}
+
+// testRebaseAct continues, skips or aborts the rebase in progress.
+func testRebaseAct(t *testing.T, cont, abort, skip bool) error {
+	t.Helper()
+	_, err := testOutput(t, func() error {
+		return CmdRebase("", "", nil, false, "", cont, abort, skip)
+	})
+	return err
+}
+
+// testForked commits base, then upstream on top of it, then moves the
+// branch back to base. It returns both commits.
+func testForked(t *testing.T, gitRepo *repo.GitRepository, upstreamFiles ...string) (base, upstream string) {
+	t.Helper()
+	base = testCommit(t, gitRepo, "base", "a.txt", "a\n")
+	upstream = testCommit(t, gitRepo, "upstream", upstreamFiles...)
+	testReset(t, gitRepo, base)
+	return base, upstream
+}
+
+func TestRebase_Pick(t *testing.T) {
+	gitRepo := testRepo(t)
+	_, upstream := testForked(t, gitRepo, "u.txt", "u\n")
+	testCommit(t, gitRepo, "add b", "b.txt", "b\n")
+	testCommit(t, gitRepo, "add c", "c.txt", "c\n")
+
+	if err := testRebase(t, upstream); err != nil {
+		t.Fatalf("CmdRebase() failed: %v", err)
+	}
+	want := []string{"add c", "add b", "upstream", "base"}
+	if got := testSubjects(t, gitRepo, 5); !equalStrings(got, want) {
+		t.Errorf("Expected history %v, got %v", want, got)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "u.txt"} {
+		if testRead(t, gitRepo, name) == "" {
+			t.Errorf("Expected %s in the worktree", name)
+		}
+	}
+	branch, detached, err := refs.BranchGetActive(gitRepo)
+	if err != nil || detached || branch != "master" {
+		t.Errorf("Expected HEAD back on master, got %q, detached %v, %v", branch, detached, err)
+	}
+	if r, err := rebaseLoad(gitRepo); err != nil || r != nil {
+		t.Errorf("Expected the finished rebase to be forgotten, got %v, %v", r, err)
+	}
+
+	// Nothing left to replay
+	if err := testRebase(t, upstream); err != nil {
+		t.Errorf("CmdRebase() of a rebased branch failed: %v", err)
+	}
+	if got := testSubjects(t, gitRepo, 1); got[0] != "add c" {
+		t.Errorf("Expected an up to date branch to stay, got %v", got)
+	}
+}
+
+func TestRebase_Conflict(t *testing.T) {
+	gitRepo := testRepo(t)
+	_, upstream := testForked(t, gitRepo, "a.txt", "upstream\n")
+	testCommit(t, gitRepo, "change a", "a.txt", "ours\n")
+	orig := testCommit(t, gitRepo, "add b", "b.txt", "b\n")
+
+	// --abort puts everything back
+	if err := testRebase(t, upstream); err == nil {
+		t.Fatalf("Expected the pick of \"change a\" to conflict")
+	}
+	if r, err := rebaseLoad(gitRepo); err != nil || r == nil {
+		t.Fatalf("Expected a rebase in progress, got %v, %v", r, err)
+	}
+	if _, err := os.Stat(repo.RepoPath(gitRepo, rebaseHead)); err != nil {
+		t.Errorf("Expected %s to name the stopped commit: %v", rebaseHead, err)
+	}
+	if err := testRebase(t, upstream); err == nil {
+		t.Errorf("Expected a second rebase to be refused")
+	}
+	if err := testRebaseAct(t, false, true, false); err != nil {
+		t.Fatalf("rebase --abort failed: %v", err)
+	}
+	if got := testResolve(t, gitRepo, "HEAD"); got != orig {
+		t.Errorf("Expected HEAD back at %s, got %s", orig, got)
+	}
+	if got := testRead(t, gitRepo, "a.txt"); got != "ours\n" {
+		t.Errorf("Expected a.txt restored, got %q", got)
+	}
+	if r, err := rebaseLoad(gitRepo); err != nil || r != nil {
+		t.Errorf("Expected the aborted rebase to be forgotten, got %v, %v", r, err)
+	}
+
+	// --skip leaves the conflicting commit out
+	if err := testRebase(t, upstream); err == nil {
+		t.Fatalf("Expected the pick of \"change a\" to conflict")
+	}
+	if err := testRebaseAct(t, false, false, true); err != nil {
+		t.Fatalf("rebase --skip failed: %v", err)
+	}
+	want := []string{"add b", "upstream", "base"}
+	if got := testSubjects(t, gitRepo, 4); !equalStrings(got, want) {
+		t.Errorf("Expected history %v, got %v", want, got)
+	}
+	if got := testRead(t, gitRepo, "a.txt"); got != "upstream\n" {
+		t.Errorf("Expected a.txt from upstream, got %q", got)
+	}
+
+	// --continue commits the resolution
+	testReset(t, gitRepo, orig)
+	if err := testRebase(t, upstream); err == nil {
+		t.Fatalf("Expected the pick of \"change a\" to conflict")
+	}
+	if err := testRebaseAct(t, true, false, false); err == nil {
+		t.Errorf("Expected --continue with unmerged files to fail")
+	}
+	testWrite(t, gitRepo, "a.txt", "resolved\n")
+	if err := CmdAdd([]string{"a.txt"}); err != nil {
+		t.Fatalf("CmdAdd() failed: %v", err)
+	}
+	if err := testRebaseAct(t, true, false, false); err != nil {
+		t.Fatalf("rebase --continue failed: %v", err)
+	}
+	want = []string{"add b", "change a", "upstream", "base"}
+	if got := testSubjects(t, gitRepo, 5); !equalStrings(got, want) {
+		t.Errorf("Expected history %v, got %v", want, got)
+	}
+	if got := testRead(t, gitRepo, "a.txt"); got != "resolved\n" {
+		t.Errorf("Expected the resolution kept, got %q", got)
+	}
+	if err := testRebaseAct(t, true, false, false); err != errNoRebase {
+		t.Errorf("Expected %v, got %v", errNoRebase, err)
+	}
+}
+
+func TestRebase_Autosquash(t *testing.T) {
+	t.Setenv("GIT_EDITOR", "true")
+	gitRepo := testRepo(t)
+	base := testCommit(t, gitRepo, "base", "a.txt", "a\n")
+	testCommit(t, gitRepo, "add b", "b.txt", "b\n")
+	testCommit(t, gitRepo, "add c", "c.txt", "c\n")
+	testCommit(t, gitRepo, "fixup! add b", "b.txt", "b1\n")
+	testCommit(t, gitRepo, "squash! add b\n\nAnd more.", "b.txt", "b2\n")
+
+	if _, err := testOutput(t, func() error {
+		return CmdRebase(base, "", nil, true, "todo", false, false, false)
+	}); err == nil {
+		t.Errorf("Expected --todo-file with --autosquash to be refused")
+	}
+
+	if _, err := testOutput(t, func() error {
+		return CmdRebase(base, "", nil, true, "", false, false, false)
+	}); err != nil {
+		t.Fatalf("CmdRebase() failed: %v", err)
+	}
+	want := []string{"add c", "add b", "base"}
+	if got := testSubjects(t, gitRepo, 4); !equalStrings(got, want) {
+		t.Errorf("Expected history %v, got %v", want, got)
+	}
+	if got := testRead(t, gitRepo, "b.txt"); got != "b2\n" {
+		t.Errorf("Expected b.txt from the squash, got %q", got)
+	}
+
+	obj, err := objects.ObjectRead(gitRepo, testResolve(t, gitRepo, "HEAD"))
+	if err != nil {
+		t.Fatalf("ObjectRead() failed: %v", err)
+	}
+	obj, err = objects.ObjectRead(gitRepo, obj.(*objects.GitCommit).Kvlm["parent"][0])
+	if err != nil {
+		t.Fatalf("ObjectRead() failed: %v", err)
+	}
+	if got, want := obj.(*objects.GitCommit).Message, "add b\n\nAnd more.\n"; got != want {
+		t.Errorf("Expected the squashed message %q, got %q", want, got)
+	}
+}
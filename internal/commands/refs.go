@@ -1,19 +1,69 @@
 package commands
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/Notwinner0/gvcs/internal/refs"
 	"github.com/Notwinner0/gvcs/internal/repo"
 )
 
-func CmdShowRef() error {
+// CmdShowRef is the handler for the show-ref command. Refs are listed in
+// name order; a pattern matches whole trailing path components, so "master"
+// matches refs/heads/master and refs/remotes/origin/master.
+func CmdShowRef(pattern string, heads, tags, verify bool) error {
 	gitRepo, err := repo.RepoFind(".", true)
 	if err != nil {
 		return err
 	}
-	refList, err := refs.RefList(gitRepo, "")
+
+	if verify {
+		return showRefVerify(gitRepo, pattern)
+	}
+
+	entries, err := refs.RefListSorted(gitRepo)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, e := range entries {
+		if heads || tags {
+			if !(heads && strings.HasPrefix(e.Name, "refs/heads/")) && !(tags && strings.HasPrefix(e.Name, "refs/tags/")) {
+				continue
+			}
+		}
+		if pattern != "" && e.Name != pattern && !strings.HasSuffix(e.Name, "/"+pattern) {
+			continue
+		}
+		if e.SHA == "" {
+			// A symref to a ref that does not exist yet
+			continue
+		}
+		found = true
+		if e.Symref != "" {
+			fmt.Printf("%s %s -> %s\n", e.SHA, e.Name, e.Symref)
+		} else {
+			fmt.Printf("%s %s\n", e.SHA, e.Name)
+		}
+	}
+	if pattern != "" && !found {
+		return &ExitError{Code: 1}
+	}
+	return nil
+}
+
+// showRefVerify prints a single ref given by its exact full name.
+func showRefVerify(gitRepo *repo.GitRepository, ref string) error {
+	if ref != "HEAD" && !strings.HasPrefix(ref, "refs/") {
+		return fmt.Errorf("'%s' - not a valid ref", ref)
+	}
+	sha, err := refs.RefResolve(gitRepo, ref)
 	if err != nil {
 		return err
 	}
-	refs.ShowRef(refList, "refs", true)
+	if sha == "" {
+		return fmt.Errorf("'%s' - not a valid ref", ref)
+	}
+	fmt.Printf("%s %s\n", sha, ref)
 	return nil
 }
@@ -0,0 +1,92 @@
+package commands
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/Notwinner0/gvcs/internal/date"
+	"github.com/Notwinner0/gvcs/internal/repo"
+	"github.com/Notwinner0/gvcs/internal/revwalk"
+)
+
+// CmdRevList is the handler for the rev-list command. revisions use the
+// syntax of revwalk.AddRevisions; nots are hidden if given plainly and
+// walked if prefixed with "^", as after git's --not. paths limits the
+// walk to commits that change them.
+func CmdRevList(revisions, nots []string, maxCount int, since, until, author string, firstParent, topoOrder, dateOrder, count, listObjects bool, paths []string) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+	if len(revisions)+len(nots) == 0 {
+		return fmt.Errorf("no revisions given")
+	}
+
+	opts, err := revListOptions(maxCount, since, until, author, firstParent, topoOrder, dateOrder)
+	if err != nil {
+		return err
+	}
+	if opts.Paths, err = pathspecs(gitRepo, paths); err != nil {
+		return err
+	}
+	walker := revwalk.New(gitRepo, opts)
+	args := revisions
+	if len(nots) > 0 {
+		args = append(append(append([]string{}, revisions...), "--not"), nots...)
+	}
+	if err := walker.AddRevisions(args); err != nil {
+		return err
+	}
+	commits, err := walker.Walk()
+	if err != nil {
+		return err
+	}
+
+	if count {
+		fmt.Println(len(commits))
+		return nil
+	}
+	for _, c := range commits {
+		fmt.Println(c.SHA)
+	}
+	if listObjects {
+		objs, err := walker.Objects(commits)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			fmt.Printf("%s %s\n", obj.SHA, obj.Path)
+		}
+	}
+	return nil
+}
+
+// revListOptions builds walk options from command line values.
+func revListOptions(maxCount int, since, until, author string, firstParent, topoOrder, dateOrder bool) (revwalk.Options, error) {
+	opts := revwalk.Options{MaxCount: maxCount, FirstParent: firstParent}
+	now := time.Now()
+	var err error
+	if since != "" {
+		if opts.Since, err = date.Parse(since, now); err != nil {
+			return opts, err
+		}
+	}
+	if until != "" {
+		if opts.Until, err = date.Parse(until, now); err != nil {
+			return opts, err
+		}
+	}
+	if author != "" {
+		if opts.Author, err = regexp.Compile(author); err != nil {
+			return opts, fmt.Errorf("invalid --author pattern: %v", err)
+		}
+	}
+	switch {
+	case topoOrder:
+		opts.Order = revwalk.OrderTopo
+	case dateOrder:
+		opts.Order = revwalk.OrderDate
+	}
+	return opts, nil
+}
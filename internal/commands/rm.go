@@ -17,10 +17,11 @@ func CmdRm(paths []string) error {
 }
 
 func rm(gitRepo *repo.GitRepository, paths []string) error {
-	idx, err := index.IndexRead(gitRepo)
+	idx, err := index.IndexLock(gitRepo)
 	if err != nil {
 		return err
 	}
+	defer idx.Unlock()
 
 	// Create a set of paths to remove for efficient lookup
 	toRemove := make(map[string]bool)
@@ -0,0 +1,395 @@
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/index"
+	"github.com/Notwinner0/gvcs/internal/merge"
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/refs"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// Files in the gitdir naming the commit whose pick stopped, and holding
+// the message prepared for it.
+const (
+	sequencerCherryPickHead = "CHERRY_PICK_HEAD"
+	sequencerRevertHead     = "REVERT_HEAD"
+	sequencerMergeMsg       = "MERGE_MSG"
+)
+
+// sequencerPending is a pick stopped by conflicts or by having nothing to
+// commit, to be committed once resolved.
+type sequencerPending struct {
+	head    string // sequencerCherryPickHead or sequencerRevertHead
+	commit  string
+	author  string // the author line to keep, "" for the user
+	message string
+}
+
+// sequencerPendingRead returns the stopped pick, or nil if there is none.
+func sequencerPendingRead(gitRepo *repo.GitRepository) (*sequencerPending, error) {
+	for _, head := range []string{sequencerCherryPickHead, sequencerRevertHead} {
+		data, err := os.ReadFile(repo.RepoPath(gitRepo, head))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		p := &sequencerPending{head: head, commit: strings.TrimSpace(string(data))}
+		message, err := os.ReadFile(repo.RepoPath(gitRepo, sequencerMergeMsg))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		p.message = string(message)
+		if head == sequencerCherryPickHead {
+			commit, err := sequencerCommit(gitRepo, p.commit)
+			if err != nil {
+				return nil, err
+			}
+			p.author = showHeader(commit.Kvlm, "author")
+		}
+		return p, nil
+	}
+	return nil, nil
+}
+
+// sequencerPendingWrite records a stopped pick.
+func sequencerPendingWrite(gitRepo *repo.GitRepository, p *sequencerPending) error {
+	if err := os.WriteFile(repo.RepoPath(gitRepo, p.head), []byte(p.commit+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(repo.RepoPath(gitRepo, sequencerMergeMsg), []byte(p.message), 0644)
+}
+
+// sequencerPendingRemove forgets the stopped pick, if any.
+func sequencerPendingRemove(gitRepo *repo.GitRepository) error {
+	for _, name := range []string{sequencerCherryPickHead, sequencerRevertHead, sequencerMergeMsg} {
+		if err := os.Remove(repo.RepoPath(gitRepo, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// sequencerItem is a commit to pick, or to revert.
+type sequencerItem struct {
+	action  string // "pick" or "revert"
+	sha     string
+	subject string
+}
+
+// sequencer is a series of commits being cherry-picked or reverted. Its
+// state lives in .git/sequencer while the series is stopped, so it can go
+// on with --continue or --skip, or be undone with --abort.
+type sequencer struct {
+	gitRepo      *repo.GitRepository
+	head         string          // HEAD when the series started
+	todo         []sequencerItem // the picks not started yet
+	recordOrigin bool            // add a "(cherry picked from ...)" line
+}
+
+// sequencerLoad reads the state of the series in progress, or returns nil
+// if there is none.
+func sequencerLoad(gitRepo *repo.GitRepository) (*sequencer, error) {
+	head, err := os.ReadFile(repo.RepoPath(gitRepo, "sequencer", "head"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := &sequencer{gitRepo: gitRepo, head: strings.TrimSpace(string(head))}
+
+	todo, err := os.ReadFile(repo.RepoPath(gitRepo, "sequencer", "todo"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(strings.NewReader(string(todo)))
+	for scanner.Scan() {
+		fields := strings.SplitN(strings.TrimSpace(scanner.Text()), " ", 3)
+		if len(fields) < 2 || (fields[0] != "pick" && fields[0] != "revert") {
+			return nil, fmt.Errorf("invalid line in sequencer todo: %s", scanner.Text())
+		}
+		item := sequencerItem{action: fields[0], sha: fields[1]}
+		if len(fields) == 3 {
+			item.subject = fields[2]
+		}
+		s.todo = append(s.todo, item)
+	}
+
+	opts, err := os.ReadFile(repo.RepoPath(gitRepo, "sequencer", "opts"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(opts), "\n") {
+		key, value, _ := strings.Cut(line, "=")
+		if strings.TrimSpace(key) == "record-origin" {
+			s.recordOrigin = strings.TrimSpace(value) == "true"
+		}
+	}
+	return s, nil
+}
+
+// save writes the state of the series.
+func (s *sequencer) save() error {
+	path, err := repo.RepoFile(s.gitRepo, true, "sequencer", "head")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(s.head+"\n"), 0644); err != nil {
+		return err
+	}
+	var todo strings.Builder
+	for _, item := range s.todo {
+		fmt.Fprintf(&todo, "%s %s %s\n", item.action, item.sha, item.subject)
+	}
+	if err := os.WriteFile(repo.RepoPath(s.gitRepo, "sequencer", "todo"), []byte(todo.String()), 0644); err != nil {
+		return err
+	}
+	opts := ""
+	if s.recordOrigin {
+		opts = "[options]\n\trecord-origin = true\n"
+	}
+	return os.WriteFile(repo.RepoPath(s.gitRepo, "sequencer", "opts"), []byte(opts), 0644)
+}
+
+// remove deletes the state of the series.
+func (s *sequencer) remove() error {
+	return os.RemoveAll(repo.RepoPath(s.gitRepo, "sequencer"))
+}
+
+// run picks the commits left, stopping at the first that cannot be
+// committed as is. The series is done and its state removed once all are.
+// A pick that fails before changing anything is put back, and the series
+// forgotten if nothing was picked yet.
+func (s *sequencer) run() error {
+	for len(s.todo) > 0 {
+		item := s.todo[0]
+		s.todo = s.todo[1:]
+		if err := s.save(); err != nil {
+			return err
+		}
+		stopped, err := sequencerPick(s.gitRepo, item, s.recordOrigin)
+		if err == nil {
+			continue
+		}
+		if !stopped {
+			s.todo = append([]sequencerItem{item}, s.todo...)
+			head, herr := objects.ObjectFind(s.gitRepo, "HEAD", "commit", true)
+			switch {
+			case herr != nil:
+				return herr
+			case head == s.head:
+				herr = s.remove()
+			default:
+				herr = s.save()
+			}
+			if herr != nil {
+				return herr
+			}
+		}
+		return err
+	}
+	return s.remove()
+}
+
+// sequencerCommit reads a commit.
+func sequencerCommit(gitRepo *repo.GitRepository, sha string) (*objects.GitCommit, error) {
+	obj, err := objects.ObjectRead(gitRepo, sha)
+	if err != nil {
+		return nil, err
+	}
+	commit, ok := obj.(*objects.GitCommit)
+	if !ok {
+		return nil, fmt.Errorf("object %s is not a commit", sha)
+	}
+	return commit, nil
+}
+
+// sequencerPick applies the changes of a commit to HEAD, or their reverse,
+// and commits the result. A pick that conflicts or changes nothing is left
+// for the user to resolve, reported as an error with stopped set; other
+// errors leave everything as it was.
+func sequencerPick(gitRepo *repo.GitRepository, item sequencerItem, recordOrigin bool) (stopped bool, err error) {
+	commit, err := sequencerCommit(gitRepo, item.sha)
+	if err != nil {
+		return false, err
+	}
+	head, err := objects.ObjectFind(gitRepo, "HEAD", "commit", true)
+	if err != nil {
+		return false, err
+	}
+	headTree, err := diffTree(gitRepo, head)
+	if err != nil {
+		return false, err
+	}
+
+	subject := logSubject(commit.Message)
+	pending := &sequencerPending{head: sequencerCherryPickHead, commit: item.sha, message: commit.Message}
+	verb := "apply"
+	if item.action == "revert" {
+		pending.head = sequencerRevertHead
+		pending.message = fmt.Sprintf("Revert \"%s\"\n\nThis reverts commit %s.\n", subject, item.sha)
+		verb = "revert"
+	} else {
+		pending.author = showHeader(commit.Kvlm, "author")
+		if recordOrigin {
+			pending.message = sequencerRecordOrigin(pending.message, item.sha)
+		}
+	}
+
+	tree, err := sequencerMerge(gitRepo, item.sha, commit, item.action == "revert", headTree)
+	if err != nil {
+		return false, err
+	}
+	if tree == "" {
+		if err := sequencerPendingWrite(gitRepo, pending); err != nil {
+			return false, err
+		}
+		return true, fmt.Errorf("could not %s %s... %s\n"+
+			"resolve the conflicts, mark them resolved with add, then run --continue; or use --skip or --abort",
+			verb, item.sha[:7], subject)
+	}
+	if tree == headTree {
+		if err := sequencerPendingWrite(gitRepo, pending); err != nil {
+			return false, err
+		}
+		return true, fmt.Errorf("the result of picking %s... %s is empty\nuse --skip to leave it out", item.sha[:7], subject)
+	}
+	return false, sequencerCommitPending(gitRepo, pending, tree, head)
+}
+
+// sequencerMerge merges the changes of commit sha, or their reverse, into
+// the index and worktree, which must hold headTree, the tree of HEAD. It
+// returns the tree of the result, or "" if conflicts were left to resolve;
+// errors leave everything as it was.
+func sequencerMerge(gitRepo *repo.GitRepository, sha string, commit *objects.GitCommit, revert bool, headTree string) (string, error) {
+	parents := commit.Kvlm["parent"]
+	if len(parents) > 1 {
+		return "", fmt.Errorf("commit %s is a merge, which cannot be picked", sha)
+	}
+	parentTree := ""
+	if len(parents) == 1 {
+		var err error
+		if parentTree, err = diffTree(gitRepo, parents[0]); err != nil {
+			return "", err
+		}
+	}
+	commitTree := showHeader(commit.Kvlm, "tree")
+
+	idx, err := index.IndexLock(gitRepo)
+	if err != nil {
+		return "", err
+	}
+	defer idx.Unlock()
+	if err := worktreeStaged(gitRepo, idx, headTree); err != nil {
+		return "", err
+	}
+
+	label := fmt.Sprintf("%s (%s)", sha[:7], logSubject(commit.Message))
+	base, theirs := parentTree, commitTree
+	if revert {
+		base, theirs = commitTree, parentTree
+		label = "parent of " + label
+	}
+	labels := merge.Labels{Ours: "HEAD", Theirs: label}
+	result, err := merge.Trees(gitRepo, base, headTree, theirs, labels)
+	if err != nil {
+		return "", err
+	}
+	if err := worktreeUpdate(gitRepo, idx, result.Files, result.Conflicts, false); err != nil {
+		return "", err
+	}
+	for _, p := range result.Merged {
+		fmt.Printf("Auto-merging %s\n", p)
+	}
+	for _, c := range result.Conflicts {
+		sequencerReportConflict(c, labels)
+	}
+	if len(result.Conflicts) > 0 {
+		return "", nil
+	}
+	return treeFromIndex(gitRepo, idx)
+}
+
+// sequencerCommitPending commits tree on top of head as the pick p, and
+// moves HEAD to it.
+func sequencerCommitPending(gitRepo *repo.GitRepository, p *sequencerPending, tree, head string) error {
+	message := strings.TrimSpace(p.message) + "\n"
+	sha, err := commitWrite(gitRepo, tree, []string{head}, p.author, message)
+	if err != nil {
+		return err
+	}
+	action := "cherry-pick"
+	if p.head == sequencerRevertHead {
+		action = "revert"
+	}
+	if err := headUpdate(gitRepo, sha, head, action+": "+logSubject(message)); err != nil {
+		return err
+	}
+	if err := sequencerPendingRemove(gitRepo); err != nil {
+		return err
+	}
+
+	branch, detached, err := refs.BranchGetActive(gitRepo)
+	if err != nil {
+		return err
+	}
+	if detached {
+		branch = "detached HEAD"
+	}
+	fmt.Printf("[%s %s] %s\n", branch, sha[:7], logSubject(message))
+	return nil
+}
+
+// sequencerReportConflict explains why a path conflicted.
+func sequencerReportConflict(c merge.Conflict, labels merge.Labels) {
+	switch c.Reason {
+	case merge.ConflictModifyDelete:
+		deleted, modified := labels.Theirs, labels.Ours
+		if c.Ours.SHA == "" {
+			deleted, modified = labels.Ours, labels.Theirs
+		}
+		fmt.Printf("CONFLICT (modify/delete): %s deleted in %s and modified in %s. Version %s of %s left in tree.\n",
+			c.Path, deleted, modified, modified, c.Path)
+	case merge.ConflictBinary:
+		fmt.Printf("warning: Cannot merge binary files: %s (%s vs. %s)\n", c.Path, labels.Ours, labels.Theirs)
+		fmt.Printf("CONFLICT (content): Merge conflict in %s\n", c.Path)
+	case merge.ConflictMode:
+		fmt.Printf("CONFLICT (mode): %s changed differently in %s and %s\n", c.Path, labels.Ours, labels.Theirs)
+	default:
+		fmt.Printf("CONFLICT (%s): Merge conflict in %s\n", c.Reason, c.Path)
+	}
+}
+
+// sequencerTrailer matches a "Key: value" trailer line.
+var sequencerTrailer = regexp.MustCompile(`^[A-Za-z0-9-]+: `)
+
+// sequencerRecordOrigin adds the "(cherry picked from commit ...)" line to
+// a message, in its trailer block if it ends with one.
+func sequencerRecordOrigin(message, sha string) string {
+	message = strings.TrimRight(message, "\n")
+	paragraphs := strings.Split(message, "\n\n")
+	separator := "\n\n"
+	if last := paragraphs[len(paragraphs)-1]; len(paragraphs) > 1 {
+		separator = "\n"
+		for _, line := range strings.Split(last, "\n") {
+			if !sequencerTrailer.MatchString(line) && !strings.HasPrefix(line, "(cherry picked from commit ") {
+				separator = "\n\n"
+				break
+			}
+		}
+	}
+	return message + separator + "(cherry picked from commit " + sha + ")\n"
+}
+
+// errNoSequence is returned for --continue, --skip or --abort with nothing
+// in progress.
+var errNoSequence = errors.New("no cherry-pick or revert in progress")
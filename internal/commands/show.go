@@ -0,0 +1,240 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/diff"
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// CmdShow is the handler for the show command. A commit is shown with its
+// headers and message and its changes from its first parent, or for a
+// merge as a combined diff against all parents; an annotated tag with its
+// headers and message followed by the object it tags; a tree as a listing
+// of its entries; and a blob as its content. object defaults to HEAD and
+// may name a path in a commit as "<rev>:<path>". opts selects the diff
+// output as for the diff command.
+func CmdShow(object string, opts DiffOptions) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+	if object == "" {
+		object = "HEAD"
+	}
+	sha, err := objects.ObjectFind(gitRepo, object, "", false)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	return showObject(out, gitRepo, object, sha, opts)
+}
+
+func showObject(out *bufio.Writer, gitRepo *repo.GitRepository, name, sha string, opts DiffOptions) error {
+	// Blobs are streamed so that large files are never held in memory
+	header, r, err := objects.ObjectReader(gitRepo, sha)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if header.Type == "blob" {
+		_, err := io.Copy(out, r)
+		return err
+	}
+
+	obj, err := objects.ObjectRead(gitRepo, sha)
+	if err != nil {
+		return err
+	}
+	switch obj := obj.(type) {
+	case *objects.GitCommit:
+		return showCommit(out, gitRepo, sha, obj, opts)
+	case *objects.GitTag:
+		return showTag(out, gitRepo, obj, opts)
+	case *objects.GitTree:
+		fmt.Fprintf(out, "tree %s\n\n", name)
+		for _, item := range obj.Items {
+			if objType, _ := objects.TreeLeafType(item.Mode); objType == "tree" {
+				fmt.Fprintf(out, "%s/\n", item.Path)
+			} else {
+				fmt.Fprintln(out, item.Path)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("cannot show object %s of type %s", sha, obj.Type())
+}
+
+// showTag prints a tag's name, tagger and message, then the tagged object.
+func showTag(out *bufio.Writer, gitRepo *repo.GitRepository, tag *objects.GitTag, opts DiffOptions) error {
+	fmt.Fprintf(out, "tag %s\n", showHeader(tag.Kvlm, "tag"))
+	if tagger := showHeader(tag.Kvlm, "tagger"); tagger != "" {
+		if err := showSignature(out, "Tagger", tagger); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(out, "\n%s\n", tag.Message)
+
+	target := showHeader(tag.Kvlm, "object")
+	return showObject(out, gitRepo, target, target, opts)
+}
+
+// showCommit prints a commit's headers, its message indented, and its
+// changes.
+func showCommit(out *bufio.Writer, gitRepo *repo.GitRepository, sha string, commit *objects.GitCommit, opts DiffOptions) error {
+	fmt.Fprintf(out, "commit %s\n", sha)
+	parents := commit.Kvlm["parent"]
+	if len(parents) > 1 {
+		short := make([]string, len(parents))
+		for i, p := range parents {
+			short[i] = p[:7]
+		}
+		fmt.Fprintf(out, "Merge: %s\n", strings.Join(short, " "))
+	}
+	if err := showSignature(out, "Author", showHeader(commit.Kvlm, "author")); err != nil {
+		return err
+	}
+	out.WriteString("\n")
+	message := strings.TrimSuffix(commit.Message, "\n")
+	for _, line := range strings.Split(message, "\n") {
+		fmt.Fprintf(out, "    %s\n", line)
+	}
+
+	tree := showHeader(commit.Kvlm, "tree")
+	merge := len(parents) > 1
+	names := opts.NameOnly || opts.NameStatus
+	if merge && (names || !opts.summary()) {
+		out.WriteString("\n")
+		return showCombined(out, gitRepo, tree, parents, opts, "")
+	}
+
+	// Summaries of a merge are against its first parent
+	oldTree := ""
+	if len(parents) > 0 {
+		var err error
+		if oldTree, err = diffTree(gitRepo, parents[0]); err != nil {
+			return err
+		}
+	}
+	changes, err := diff.TreeDiff(gitRepo, oldTree, tree, nil)
+	if err != nil {
+		return err
+	}
+	if changes, err = diffFindRenames(gitRepo, changes, opts); err != nil {
+		return err
+	}
+	if len(changes) > 0 || merge {
+		// A summary with a patch is set off from the message as in an email
+		if opts.summary() && opts.Patch && !merge && !names {
+			out.WriteString("---\n")
+		} else {
+			out.WriteString("\n")
+		}
+	}
+
+	d := &differ{gitRepo: gitRepo}
+	if !merge {
+		return diffWrite(out, d, changes, opts, "\n")
+	}
+	patch := opts.Patch
+	opts.Patch = false
+	if err := diffWrite(out, d, changes, opts, ""); err != nil {
+		return err
+	}
+	if !patch {
+		return nil
+	}
+	return showCombined(out, gitRepo, tree, parents, opts, "\n")
+}
+
+// showCombined writes the combined diff of a merge against its parents,
+// after separator if there is any.
+func showCombined(out *bufio.Writer, gitRepo *repo.GitRepository, tree string, parents []string, opts DiffOptions, separator string) error {
+	merged, err := diff.TreeFiles(gitRepo, tree, nil)
+	if err != nil {
+		return err
+	}
+	parentFiles := make([]map[string]diff.File, len(parents))
+	for i, p := range parents {
+		parentTree, err := diffTree(gitRepo, p)
+		if err != nil {
+			return err
+		}
+		if parentFiles[i], err = diff.TreeFiles(gitRepo, parentTree, nil); err != nil {
+			return err
+		}
+	}
+
+	changes := diff.CombinedChanges(merged, parentFiles)
+	var b strings.Builder
+	if opts.NameOnly || opts.NameStatus {
+		err = diff.WriteNameStatusCombined(&b, changes, opts.NameOnly)
+	} else {
+		err = showCombinedPatches(&b, gitRepo, changes, opts.Context)
+	}
+	if err != nil {
+		return err
+	}
+	if b.Len() > 0 {
+		out.WriteString(separator + b.String())
+	}
+	return nil
+}
+
+// showCombinedPatches writes the combined patch of each change.
+func showCombinedPatches(w io.Writer, gitRepo *repo.GitRepository, changes []diff.CombinedChange, context int) error {
+	for _, c := range changes {
+		var err error
+		parentData := make([][]byte, len(c.Parents))
+		for i, p := range c.Parents {
+			if p.SHA == "" {
+				continue
+			}
+			if parentData[i], err = diff.BlobRead(gitRepo, p.SHA); err != nil {
+				return err
+			}
+		}
+		var data []byte
+		if c.SHA != "" {
+			if data, err = diff.BlobRead(gitRepo, c.SHA); err != nil {
+				return err
+			}
+		}
+		if err := diff.WriteCombined(w, c, parentData, data, context); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// showHeader returns the first value of a commit or tag header.
+func showHeader(kvlm map[string][]string, key string) string {
+	if values := kvlm[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// showSignature prints an identity line and its date.
+func showSignature(out io.Writer, label, line string) error {
+	sig, err := objects.SignatureParse(line)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s: %s <%s>\n", label, sig.Name, sig.Email)
+	if !sig.When.IsZero() {
+		date, err := objects.SignatureFormatDate(sig.When, "default")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Date:   %s\n", date)
+	}
+	return nil
+}
@@ -0,0 +1,623 @@
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/attributes"
+	"github.com/Notwinner0/gvcs/internal/diff"
+	"github.com/Notwinner0/gvcs/internal/index"
+	"github.com/Notwinner0/gvcs/internal/merge"
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/refs"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// stashRef is the ref of the latest stash entry. The entries are the
+// commits in its reflog, the latest being stash@{0}.
+const stashRef = "refs/stash"
+
+// errStashConflict is returned when applying a stash entry left conflicts.
+var errStashConflict = errors.New("conflicts in the stashed changes; the stash entry is kept in case you need it again")
+
+// CmdStashPush is the handler for the stash push command. It saves the
+// staged and unstaged changes of the paths selected by paths, or of all
+// paths, as a stash entry and reverts them to HEAD. The entry is a commit
+// of the worktree whose parents are HEAD and a commit of the index, plus a
+// commit of the untracked files that are not ignored if includeUntracked
+// is set, which are then deleted. message describes the entry instead of
+// HEAD's subject.
+func CmdStashPush(message string, paths []string, includeUntracked bool) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+	specs, err := pathspecs(gitRepo, paths)
+	if err != nil {
+		return err
+	}
+	head, err := objects.ObjectFind(gitRepo, "HEAD", "commit", true)
+	if err != nil {
+		return fmt.Errorf("you do not have the initial commit yet: %w", err)
+	}
+	headCommit, err := sequencerCommit(gitRepo, head)
+	if err != nil {
+		return err
+	}
+	idx, err := index.IndexLock(gitRepo)
+	if err != nil {
+		return err
+	}
+	defer idx.Unlock()
+	if unmerged := idx.Unmerged(); len(unmerged) > 0 {
+		return fmt.Errorf("cannot stash with unmerged files:\n\t%s", strings.Join(unmerged, "\n\t"))
+	}
+	attrs, err := attributes.AttributesRead(gitRepo)
+	if err != nil {
+		return err
+	}
+
+	// The changes to save: staged, not yet staged, and untracked
+	headFiles, err := diff.TreeFiles(gitRepo, showHeader(headCommit.Kvlm, "tree"), specs)
+	if err != nil {
+		return err
+	}
+	reset := make(map[string]bool)
+	for _, c := range diff.FilesDiff(headFiles, diffIndexFiles(idx, specs)) {
+		reset[c.Path()] = true
+	}
+	worktree := make(map[string]*index.GitIndexEntry)
+	for _, e := range idx.Entries {
+		copied := *e
+		worktree[e.Name] = &copied
+	}
+	changes, err := worktreeChanges(gitRepo, idx)
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		p := filepath.ToSlash(c.name)
+		if !diff.PathspecMatch(specs, p) {
+			continue
+		}
+		reset[p] = true
+		if c.deleted {
+			delete(worktree, c.name)
+			continue
+		}
+		if worktree[c.name].SHA, err = hashWorktreeFile(gitRepo, attrs, c.name, true); err != nil {
+			return err
+		}
+	}
+	var untracked []string
+	if includeUntracked {
+		all, err := worktreeUntracked(gitRepo, idx)
+		if err != nil {
+			return err
+		}
+		for _, name := range all {
+			if diff.PathspecMatch(specs, filepath.ToSlash(name)) {
+				untracked = append(untracked, name)
+			}
+		}
+	}
+	if len(reset) == 0 && len(untracked) == 0 {
+		fmt.Println("No local changes to save")
+		return nil
+	}
+
+	branch, detached, err := refs.BranchGetActive(gitRepo)
+	if err != nil {
+		return err
+	}
+	if detached {
+		branch = "(no branch)"
+	}
+	on := fmt.Sprintf("%s: %s %s", branch, head[:7], logSubject(headCommit.Message))
+	if message == "" {
+		message = "WIP on " + on
+	} else {
+		message = fmt.Sprintf("On %s: %s", branch, strings.TrimSpace(message))
+	}
+
+	indexTree, err := treeFromIndex(gitRepo, idx)
+	if err != nil {
+		return err
+	}
+	indexCommit, err := commitWrite(gitRepo, indexTree, []string{head}, "", "index on "+on+"\n")
+	if err != nil {
+		return err
+	}
+	parents := []string{head, indexCommit}
+	if len(untracked) > 0 {
+		entries := make([]*index.GitIndexEntry, len(untracked))
+		for i, name := range untracked {
+			sha, err := hashWorktreeFile(gitRepo, attrs, name, true)
+			if err != nil {
+				return err
+			}
+			entries[i] = &index.GitIndexEntry{Mode: 0100644, SHA: sha, Name: name}
+		}
+		untrackedTree, err := treeFromIndex(gitRepo, &index.GitIndex{Entries: entries})
+		if err != nil {
+			return err
+		}
+		untrackedCommit, err := commitWrite(gitRepo, untrackedTree, nil, "", "untracked files on "+on+"\n")
+		if err != nil {
+			return err
+		}
+		parents = append(parents, untrackedCommit)
+	}
+	worktreeIndex := &index.GitIndex{}
+	for _, e := range idx.Entries {
+		if copied, ok := worktree[e.Name]; ok {
+			worktreeIndex.Entries = append(worktreeIndex.Entries, copied)
+		}
+	}
+	worktreeTree, err := treeFromIndex(gitRepo, worktreeIndex)
+	if err != nil {
+		return err
+	}
+	stash, err := commitWrite(gitRepo, worktreeTree, parents, "", message+"\n")
+	if err != nil {
+		return err
+	}
+
+	tx := refs.RefTransactionBegin(gitRepo)
+	tx.Committer, _ = userIdent(gitRepo)
+	if err := tx.Update(stashRef, stash, "", message); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	resetPaths := make([]string, 0, len(reset))
+	for p := range reset {
+		resetPaths = append(resetPaths, p)
+	}
+	sort.Strings(resetPaths)
+	if err := worktreeRestore(gitRepo, idx, headFiles, resetPaths); err != nil {
+		return err
+	}
+	for _, name := range untracked {
+		if err := worktreeRemove(gitRepo, name); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Saved working directory and index state %s\n", message)
+	return nil
+}
+
+// CmdStashList is the handler for the stash list command.
+func CmdStashList() error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+	entries, err := stashEntries(gitRepo)
+	if err != nil {
+		return err
+	}
+	for n, e := range entries {
+		fmt.Printf("stash@{%d}: %s\n", n, e.Message)
+	}
+	return nil
+}
+
+// CmdStashShow is the handler for the stash show command. It shows the
+// changes of a stash entry from the commit it was made on as a diffstat,
+// or as a patch if patch is set.
+func CmdStashShow(name string, patch bool) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+	_, stash, err := stashFind(gitRepo, name)
+	if err != nil {
+		return err
+	}
+	base, _, _, err := stashParts(gitRepo, stash)
+	if err != nil {
+		return err
+	}
+	var trees [2]string
+	for i, commit := range []string{base, stash} {
+		if trees[i], err = diffTree(gitRepo, commit); err != nil {
+			return err
+		}
+	}
+	changes, err := diff.TreeDiff(gitRepo, trees[0], trees[1], nil)
+	if err != nil {
+		return err
+	}
+	opts := DiffOptions{Context: 3, Stat: !patch, Patch: patch}
+	if changes, err = diffFindRenames(gitRepo, changes, opts); err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	return diffWrite(out, &differ{gitRepo: gitRepo}, changes, opts, "\n")
+}
+
+// CmdStashApply is the handler for the stash apply command. It merges the
+// changes of a stash entry into the worktree, leaving them unstaged apart
+// from new files, and restores its untracked files.
+func CmdStashApply(name string) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+	_, stash, err := stashFind(gitRepo, name)
+	if err != nil {
+		return err
+	}
+	return stashApply(gitRepo, stash)
+}
+
+// CmdStashPop is the handler for the stash pop command: stash apply, then
+// stash drop unless the changes conflicted.
+func CmdStashPop(name string) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+	n, stash, err := stashFind(gitRepo, name)
+	if err != nil {
+		return err
+	}
+	if err := stashApply(gitRepo, stash); err != nil {
+		return err
+	}
+	return stashDrop(gitRepo, n)
+}
+
+// CmdStashDrop is the handler for the stash drop command. It removes a
+// stash entry, the latest by default.
+func CmdStashDrop(name string) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+	n, _, err := stashFind(gitRepo, name)
+	if err != nil {
+		return err
+	}
+	return stashDrop(gitRepo, n)
+}
+
+// CmdStashBranch is the handler for the stash branch command. It creates
+// and switches to a branch at the commit a stash entry was made on,
+// restores the index and worktree it saved there, where they apply
+// without conflicts, and drops it.
+func CmdStashBranch(branch, name string) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+	n, stash, err := stashFind(gitRepo, name)
+	if err != nil {
+		return err
+	}
+	base, indexCommit, untrackedCommit, err := stashParts(gitRepo, stash)
+	if err != nil {
+		return err
+	}
+	ref := "refs/heads/" + branch
+	if err := refs.CheckRefName(ref); err != nil {
+		return err
+	}
+	if sha, err := refs.RefResolve(gitRepo, ref); err != nil {
+		return err
+	} else if sha != "" {
+		return fmt.Errorf("a branch named '%s' already exists", branch)
+	}
+
+	idx, err := index.IndexLock(gitRepo)
+	if err != nil {
+		return err
+	}
+	defer idx.Unlock()
+	head, err := objects.ObjectFind(gitRepo, "HEAD", "commit", true)
+	if err != nil {
+		return err
+	}
+	headTree, err := diffTree(gitRepo, head)
+	if err != nil {
+		return err
+	}
+	if err := worktreeStaged(gitRepo, idx, headTree); err != nil {
+		return err
+	}
+	untracked, err := stashUntracked(gitRepo, untrackedCommit)
+	if err != nil {
+		return err
+	}
+	var files [2]map[string]diff.File
+	for i, commit := range []string{indexCommit, stash} {
+		tree, err := diffTree(gitRepo, commit)
+		if err != nil {
+			return err
+		}
+		if files[i], err = diff.TreeFiles(gitRepo, tree, nil); err != nil {
+			return err
+		}
+	}
+	indexFiles, worktreeFiles := files[0], files[1]
+
+	if err := worktreeUpdate(gitRepo, idx, worktreeFiles, nil, false); err != nil {
+		return err
+	}
+	var unstaged []string
+	for p, f := range indexFiles {
+		if worktreeFiles[p] != f {
+			unstaged = append(unstaged, p)
+		}
+	}
+	sort.Strings(unstaged)
+	if err := stashUnstage(gitRepo, idx, indexFiles, unstaged); err != nil {
+		return err
+	}
+	if err := stashRestoreUntracked(gitRepo, untracked); err != nil {
+		return err
+	}
+
+	committer, _ := userIdent(gitRepo)
+	tx := refs.RefTransactionBegin(gitRepo)
+	tx.Committer = committer
+	if err := tx.Create(ref, base, "branch: Created from "+base); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	from, _, err := refs.BranchGetActive(gitRepo)
+	if err != nil {
+		return err
+	}
+	if err := refs.SymrefWrite(gitRepo, "HEAD", ref, committer, fmt.Sprintf("checkout: moving from %s to %s", from, branch)); err != nil {
+		return err
+	}
+	fmt.Printf("Switched to a new branch '%s'\n", branch)
+	return stashDrop(gitRepo, n)
+}
+
+// stashEntries reads the stash entries, latest first.
+func stashEntries(gitRepo *repo.GitRepository) ([]refs.ReflogEntry, error) {
+	entries, err := refs.ReflogRead(gitRepo, stashRef)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// stashFind resolves name, "stash@{<n>}", "<n>" or "" for the latest, to
+// the number and commit of a stash entry.
+func stashFind(gitRepo *repo.GitRepository, name string) (int, string, error) {
+	entries, err := stashEntries(gitRepo)
+	if err != nil {
+		return 0, "", err
+	}
+	if len(entries) == 0 {
+		return 0, "", errors.New("no stash entries found")
+	}
+	n := 0
+	if name != "" {
+		number := name
+		if inner, ok := strings.CutPrefix(name, "stash@{"); ok && strings.HasSuffix(inner, "}") {
+			number = strings.TrimSuffix(inner, "}")
+		}
+		if n, err = strconv.Atoi(number); err != nil || n < 0 {
+			return 0, "", fmt.Errorf("%s is not a valid stash reference", name)
+		}
+	}
+	if n >= len(entries) {
+		return 0, "", fmt.Errorf("stash@{%d} does not exist", n)
+	}
+	return n, entries[n].New, nil
+}
+
+// stashParts returns the commits of a stash entry: the one it was made
+// on, the index, and the untracked files, "" if they were not saved.
+func stashParts(gitRepo *repo.GitRepository, stash string) (base, indexCommit, untracked string, err error) {
+	commit, err := sequencerCommit(gitRepo, stash)
+	if err != nil {
+		return "", "", "", err
+	}
+	parents := commit.Kvlm["parent"]
+	if len(parents) < 2 {
+		return "", "", "", fmt.Errorf("%s is not a stash commit", stash)
+	}
+	if len(parents) > 2 {
+		untracked = parents[2]
+	}
+	return parents[0], parents[1], untracked, nil
+}
+
+// stashApply merges the changes of stash into the index and worktree, then
+// unstages those to files already in the index.
+func stashApply(gitRepo *repo.GitRepository, stash string) error {
+	base, _, untrackedCommit, err := stashParts(gitRepo, stash)
+	if err != nil {
+		return err
+	}
+	idx, err := index.IndexLock(gitRepo)
+	if err != nil {
+		return err
+	}
+	defer idx.Unlock()
+	if unmerged := idx.Unmerged(); len(unmerged) > 0 {
+		return fmt.Errorf("you have unmerged files:\n\t%s\nresolve them first", strings.Join(unmerged, "\n\t"))
+	}
+	untracked, err := stashUntracked(gitRepo, untrackedCommit)
+	if err != nil {
+		return err
+	}
+	oursTree, err := treeFromIndex(gitRepo, idx)
+	if err != nil {
+		return err
+	}
+	var trees [2]string
+	for i, commit := range []string{base, stash} {
+		if trees[i], err = diffTree(gitRepo, commit); err != nil {
+			return err
+		}
+	}
+
+	labels := merge.Labels{Ours: "Updated upstream", Theirs: "Stashed changes"}
+	result, err := merge.Trees(gitRepo, trees[0], oursTree, trees[1], labels)
+	if err != nil {
+		return err
+	}
+	if err := worktreeUpdate(gitRepo, idx, result.Files, result.Conflicts, false); err != nil {
+		return err
+	}
+	for _, p := range result.Merged {
+		fmt.Printf("Auto-merging %s\n", p)
+	}
+	for _, c := range result.Conflicts {
+		sequencerReportConflict(c, labels)
+	}
+	if err := stashRestoreUntracked(gitRepo, untracked); err != nil {
+		return err
+	}
+	if len(result.Conflicts) > 0 {
+		return errStashConflict
+	}
+
+	// Only new files stay staged
+	oursFiles, err := diff.TreeFiles(gitRepo, oursTree, nil)
+	if err != nil {
+		return err
+	}
+	var unstaged []string
+	for p, f := range oursFiles {
+		if merged, ok := result.Files[p]; !ok || merged != f {
+			unstaged = append(unstaged, p)
+		}
+	}
+	sort.Strings(unstaged)
+	return stashUnstage(gitRepo, idx, oursFiles, unstaged)
+}
+
+// stashUnstage sets the index entries of paths back to their versions in
+// staged, leaving their worktree files as they are. The entries get no
+// stat data, so that the files are compared by content.
+func stashUnstage(gitRepo *repo.GitRepository, idx *index.GitIndex, staged map[string]diff.File, paths []string) error {
+	unstaged := make(map[string]bool)
+	for _, p := range paths {
+		unstaged[p] = true
+	}
+	var kept []*index.GitIndexEntry
+	for _, e := range idx.Entries {
+		if !unstaged[filepath.ToSlash(e.Name)] {
+			kept = append(kept, e)
+		}
+	}
+	for _, p := range paths {
+		f := staged[p]
+		mode, err := strconv.ParseUint(f.Mode, 8, 32)
+		if err != nil {
+			return err
+		}
+		kept = append(kept, &index.GitIndexEntry{Mode: uint32(mode), SHA: f.SHA, Name: filepath.FromSlash(p)})
+	}
+	worktreeSort(kept)
+	idx.Entries = kept
+	return index.IndexWrite(gitRepo, idx)
+}
+
+// stashUntracked returns the files saved in the untracked files commit of
+// a stash entry, if any, failing if one of them is in the way.
+func stashUntracked(gitRepo *repo.GitRepository, commit string) (map[string]diff.File, error) {
+	if commit == "" {
+		return nil, nil
+	}
+	tree, err := diffTree(gitRepo, commit)
+	if err != nil {
+		return nil, err
+	}
+	files, err := diff.TreeFiles(gitRepo, tree, nil)
+	if err != nil {
+		return nil, err
+	}
+	var existing []string
+	for p := range files {
+		if _, err := os.Lstat(filepath.Join(gitRepo.Worktree, filepath.FromSlash(p))); err == nil {
+			existing = append(existing, p)
+		}
+	}
+	if len(existing) > 0 {
+		sort.Strings(existing)
+		return nil, fmt.Errorf("the following untracked files already exist, not restoring them:\n\t%s", strings.Join(existing, "\n\t"))
+	}
+	return files, nil
+}
+
+// stashRestoreUntracked writes untracked files back to the worktree.
+func stashRestoreUntracked(gitRepo *repo.GitRepository, files map[string]diff.File) error {
+	if len(files) == 0 {
+		return nil
+	}
+	attrs, err := attributes.AttributesRead(gitRepo)
+	if err != nil {
+		return err
+	}
+	for p, f := range files {
+		if err := worktreeWrite(gitRepo, attrs, filepath.FromSlash(p), f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stashDrop removes stash@{n}, moving refs/stash to the next entry if it
+// was the latest, or deleting it if it was the last.
+func stashDrop(gitRepo *repo.GitRepository, n int) error {
+	entries, err := refs.ReflogRead(gitRepo, stashRef)
+	if err != nil {
+		return err
+	}
+	i := len(entries) - 1 - n
+	dropped := entries[i]
+	rest := append(entries[:i:i], entries[i+1:]...)
+	// The entry after the dropped one now follows the one before it
+	if i < len(rest) {
+		rest[i].Old = refs.ZeroSHA
+		if i > 0 {
+			rest[i].Old = rest[i-1].New
+		}
+	}
+
+	tx := refs.RefTransactionBegin(gitRepo)
+	tx.Committer, _ = userIdent(gitRepo)
+	switch {
+	case len(rest) == 0:
+		err = tx.Delete(stashRef, dropped.New, "")
+	case n == 0:
+		err = tx.Update(stashRef, rest[len(rest)-1].New, dropped.New, "")
+	default:
+		err = tx.Verify(stashRef, entries[len(entries)-1].New)
+	}
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if err := refs.ReflogWrite(gitRepo, stashRef, rest); err != nil {
+		return err
+	}
+	fmt.Printf("Dropped refs/stash@{%d} (%s)\n", n, dropped.New)
+	return nil
+}
@@ -0,0 +1,189 @@
+package commands
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Notwinner0/gvcs/internal/refs"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// testStashChanges stages a change to a.txt and a new file, then makes
+// further unstaged changes to a.txt and b.txt.
+func testStashChanges(t *testing.T, gitRepo *repo.GitRepository) {
+	t.Helper()
+	testWrite(t, gitRepo, "a.txt", "a staged\n")
+	testWrite(t, gitRepo, "new.txt", "new\n")
+	if err := CmdAdd([]string{"a.txt", "new.txt"}); err != nil {
+		t.Fatalf("CmdAdd() failed: %v", err)
+	}
+	testWrite(t, gitRepo, "a.txt", "a worktree\n")
+	testWrite(t, gitRepo, "b.txt", "b worktree\n")
+}
+
+// testStashCount returns the number of stash entries.
+func testStashCount(t *testing.T, gitRepo *repo.GitRepository) int {
+	t.Helper()
+	entries, err := stashEntries(gitRepo)
+	if err != nil {
+		t.Fatalf("stashEntries() failed: %v", err)
+	}
+	return len(entries)
+}
+
+func TestStash_PushPop(t *testing.T) {
+	gitRepo := testRepo(t)
+	testCommit(t, gitRepo, "base", "a.txt", "a\n", "b.txt", "b\n")
+	testStashChanges(t, gitRepo)
+
+	if _, err := testOutput(t, func() error { return CmdStashPush("", nil, false) }); err != nil {
+		t.Fatalf("CmdStashPush() failed: %v", err)
+	}
+	for name, want := range map[string]string{"a.txt": "a\n", "b.txt": "b\n", "new.txt": ""} {
+		if got := testRead(t, gitRepo, name); got != want {
+			t.Errorf("Expected %s reverted to %q, got %q", name, want, got)
+		}
+		if got := testStaged(t, gitRepo, name); got != want {
+			t.Errorf("Expected %s unstaged to %q, got %q", name, want, got)
+		}
+	}
+	if n := testStashCount(t, gitRepo); n != 1 {
+		t.Fatalf("Expected 1 stash entry, got %d", n)
+	}
+
+	// The entry records the index and the worktree apart
+	_, stash, err := stashFind(gitRepo, "")
+	if err != nil {
+		t.Fatalf("stashFind() failed: %v", err)
+	}
+	_, indexCommit, untracked, err := stashParts(gitRepo, stash)
+	if err != nil {
+		t.Fatalf("stashParts() failed: %v", err)
+	}
+	if untracked != "" {
+		t.Errorf("Expected no untracked files commit, got %s", untracked)
+	}
+	if out := testCatFile(t, "p", indexCommit+":a.txt"); out != "a staged\n" {
+		t.Errorf("Expected the index commit to hold the staged a.txt, got %q", out)
+	}
+	if out := testCatFile(t, "p", stash+":a.txt"); out != "a worktree\n" {
+		t.Errorf("Expected the stash commit to hold the worktree a.txt, got %q", out)
+	}
+
+	if _, err := testOutput(t, func() error { return CmdStashPop("") }); err != nil {
+		t.Fatalf("CmdStashPop() failed: %v", err)
+	}
+	for name, want := range map[string]string{"a.txt": "a worktree\n", "b.txt": "b worktree\n", "new.txt": "new\n"} {
+		if got := testRead(t, gitRepo, name); got != want {
+			t.Errorf("Expected %s restored to %q, got %q", name, want, got)
+		}
+	}
+	// Only the new file stays staged
+	for name, want := range map[string]string{"a.txt": "a\n", "b.txt": "b\n", "new.txt": "new\n"} {
+		if got := testStaged(t, gitRepo, name); got != want {
+			t.Errorf("Expected %q staged for %s, got %q", want, name, got)
+		}
+	}
+	if n := testStashCount(t, gitRepo); n != 0 {
+		t.Errorf("Expected the popped entry dropped, got %d entries", n)
+	}
+
+	if _, err := testOutput(t, func() error { return CmdStashPop("") }); err == nil {
+		t.Errorf("Expected pop without entries to fail")
+	}
+}
+
+func TestStash_Untracked(t *testing.T) {
+	gitRepo := testRepo(t)
+	testCommit(t, gitRepo, "base", "a.txt", "a\n")
+	exclude, err := repo.RepoFile(gitRepo, true, "info", "exclude")
+	if err != nil {
+		t.Fatalf("RepoFile() failed: %v", err)
+	}
+	if err := os.WriteFile(exclude, []byte("*.log\n"), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+	testWrite(t, gitRepo, ".gitignore", "*.tmp\n")
+	testWrite(t, gitRepo, "u.txt", "u\n")
+	testWrite(t, gitRepo, "dir/v.txt", "v\n")
+	testWrite(t, gitRepo, "x.log", "x\n")
+
+	// Without -u there is nothing to save
+	out, err := testOutput(t, func() error { return CmdStashPush("", nil, false) })
+	if err != nil {
+		t.Fatalf("CmdStashPush() failed: %v", err)
+	}
+	if out != "No local changes to save\n" {
+		t.Errorf("Expected nothing saved, got %q", out)
+	}
+
+	if _, err := testOutput(t, func() error { return CmdStashPush("untracked", nil, true) }); err != nil {
+		t.Fatalf("CmdStashPush() failed: %v", err)
+	}
+	for _, name := range []string{".gitignore", "u.txt", "dir/v.txt"} {
+		if got := testRead(t, gitRepo, name); got != "" {
+			t.Errorf("Expected untracked %s removed, got %q", name, got)
+		}
+	}
+	if got := testRead(t, gitRepo, "x.log"); got != "x\n" {
+		t.Errorf("Expected ignored x.log kept, got %q", got)
+	}
+	out, err = testOutput(t, CmdStashList)
+	if err != nil {
+		t.Fatalf("CmdStashList() failed: %v", err)
+	}
+	if want := "stash@{0}: On master: untracked\n"; out != want {
+		t.Errorf("Expected %q, got %q", want, out)
+	}
+
+	if _, err := testOutput(t, func() error { return CmdStashPop("") }); err != nil {
+		t.Fatalf("CmdStashPop() failed: %v", err)
+	}
+	for name, want := range map[string]string{".gitignore": "*.tmp\n", "u.txt": "u\n", "dir/v.txt": "v\n"} {
+		if got := testRead(t, gitRepo, name); got != want {
+			t.Errorf("Expected %s restored to %q, got %q", name, want, got)
+		}
+		if got := testStaged(t, gitRepo, name); got != "" {
+			t.Errorf("Expected %s to stay untracked, got %q staged", name, got)
+		}
+	}
+}
+
+func TestStash_Branch(t *testing.T) {
+	gitRepo := testRepo(t)
+	base := testCommit(t, gitRepo, "base", "a.txt", "a\n", "b.txt", "b\n")
+	testStashChanges(t, gitRepo)
+	if _, err := testOutput(t, func() error { return CmdStashPush("", nil, false) }); err != nil {
+		t.Fatalf("CmdStashPush() failed: %v", err)
+	}
+	// The stashed changes no longer apply cleanly on master
+	testCommit(t, gitRepo, "later", "a.txt", "a later\n")
+
+	if _, err := testOutput(t, func() error { return CmdStashBranch("master", "") }); err == nil {
+		t.Errorf("Expected an existing branch to be refused")
+	}
+	if _, err := testOutput(t, func() error { return CmdStashBranch("topic", "") }); err != nil {
+		t.Fatalf("CmdStashBranch() failed: %v", err)
+	}
+	branch, detached, err := refs.BranchGetActive(gitRepo)
+	if err != nil || detached || branch != "topic" {
+		t.Errorf("Expected HEAD on topic, got %q, detached %v, %v", branch, detached, err)
+	}
+	if got := testResolve(t, gitRepo, "HEAD"); got != base {
+		t.Errorf("Expected topic at %s, got %s", base, got)
+	}
+	// Both the index and the worktree come back as they were
+	for name, want := range map[string]string{"a.txt": "a staged\n", "b.txt": "b\n", "new.txt": "new\n"} {
+		if got := testStaged(t, gitRepo, name); got != want {
+			t.Errorf("Expected %q staged for %s, got %q", want, name, got)
+		}
+	}
+	for name, want := range map[string]string{"a.txt": "a worktree\n", "b.txt": "b worktree\n", "new.txt": "new\n"} {
+		if got := testRead(t, gitRepo, name); got != want {
+			t.Errorf("Expected %s restored to %q, got %q", name, want, got)
+		}
+	}
+	if n := testStashCount(t, gitRepo); n != 0 {
+		t.Errorf("Expected the entry dropped, got %d entries", n)
+	}
+}
@@ -2,18 +2,18 @@ package commands
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
-	"strings"
 
-	"github.com/Notwinner0/gvcs/internal/ignore"
+	"github.com/Notwinner0/gvcs/internal/diff"
 	"github.com/Notwinner0/gvcs/internal/index"
-	"github.com/Notwinner0/gvcs/internal/objects"
 	"github.com/Notwinner0/gvcs/internal/refs"
 	"github.com/Notwinner0/gvcs/internal/repo"
 )
 
-func CmdStatus() error {
+// CmdStatus is the handler for the status command. Staged files that
+// moved are shown as renames unless noRenames is set; findRenames is the
+// similarity threshold, as for diff -M.
+func CmdStatus(findRenames string, noRenames bool) error {
 	gitRepo, err := repo.RepoFind(".", true)
 	if err != nil {
 		return err
@@ -22,14 +22,27 @@ func CmdStatus() error {
 	if err != nil {
 		return err
 	}
+	var renames *diff.RenameOptions
+	if !noRenames {
+		threshold, err := diff.ParseThreshold(findRenames)
+		if err != nil {
+			return err
+		}
+		renames = &diff.RenameOptions{Threshold: threshold}
+	}
 
 	// Part 1: Print current branch
 	if err := statusPrintBranch(gitRepo); err != nil {
 		return err
 	}
 
+	// A stopped cherry-pick or revert, and the paths left unmerged
+	if err := statusSequencer(gitRepo, idx); err != nil {
+		return err
+	}
+
 	// Part 2: Compare HEAD to index
-	if err := statusHeadIndex(gitRepo, idx); err != nil {
+	if err := statusHeadIndex(gitRepo, idx, renames); err != nil {
 		return err
 	}
 
@@ -56,111 +69,126 @@ func statusPrintBranch(gitRepo *repo.GitRepository) error {
 	return nil
 }
 
-func statusHeadIndex(gitRepo *repo.GitRepository, idx *index.GitIndex) error {
-	fmt.Println("Changes to be committed:")
-
-	headMap, err := objects.TreeToMap(gitRepo, "HEAD", "")
+// statusSequencer says which commit a stopped cherry-pick or revert was
+// applying, or which branch is being rebased, and lists the paths left with conflicts by how each side
+// changed them.
+func statusSequencer(gitRepo *repo.GitRepository, idx *index.GitIndex) error {
+	pending, err := sequencerPendingRead(gitRepo)
 	if err != nil {
-		// This can happen in a new repo with no commits
-		if strings.Contains(err.Error(), "no such reference") {
-			headMap = make(map[string]string)
-		} else {
-			return err
+		return err
+	}
+	if pending != nil {
+		action := "cherry-picking"
+		if pending.head == sequencerRevertHead {
+			action = "reverting"
 		}
+		fmt.Printf("You are currently %s commit %s.\n", action, pending.commit[:7])
 	}
-
-	indexMap := make(map[string]string)
-	for _, entry := range idx.Entries {
-		indexMap[entry.Name] = entry.SHA
+	r, err := rebaseLoad(gitRepo)
+	if err != nil {
+		return err
 	}
-
-	// Compare index to head
-	for path, sha := range indexMap {
-		headSHA, ok := headMap[path]
-		if !ok {
-			fmt.Printf("  added:    %s\n", path)
-		} else if headSHA != sha {
-			fmt.Printf("  modified: %s\n", path)
+	if r != nil {
+		branch := "detached HEAD"
+		if r.headName != "" {
+			branch = refs.RefShorten(r.headName)
 		}
+		fmt.Printf("You are currently rebasing %s onto %s.\n", branch, r.onto[:7])
 	}
 
-	// Find deleted files
-	for path := range headMap {
-		if _, ok := indexMap[path]; !ok {
-			fmt.Printf("  deleted:  %s\n", path)
+	unmerged := idx.Unmerged()
+	if len(unmerged) == 0 {
+		return nil
+	}
+	stages := make(map[string]int)
+	for _, e := range idx.Entries {
+		stages[e.Name] |= 1 << e.Stage()
+	}
+	fmt.Println("Unmerged paths:")
+	for _, name := range unmerged {
+		const base, ours, theirs = 1 << index.StageBase, 1 << index.StageOurs, 1 << index.StageTheirs
+		how := "both modified:"
+		switch stages[name] {
+		case ours | theirs:
+			how = "both added:"
+		case base | ours:
+			how = "deleted by them:"
+		case base | theirs:
+			how = "deleted by us:"
 		}
+		fmt.Printf("  %-16s %s\n", how, name)
 	}
+	fmt.Println()
 	return nil
 }
 
-func statusIndexWorktree(gitRepo *repo.GitRepository, idx *index.GitIndex) error {
-	fmt.Println("Changes not staged for commit:")
+func statusHeadIndex(gitRepo *repo.GitRepository, idx *index.GitIndex, renames *diff.RenameOptions) error {
+	fmt.Println("Changes to be committed:")
 
-	worktreeFiles := make(map[string]bool)
-	err := filepath.Walk(gitRepo.Worktree, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		// Ignore .git directory and other directories
-		if strings.HasPrefix(path, gitRepo.Gitdir) || info.IsDir() {
-			return nil
-		}
-		relPath, _ := filepath.Rel(gitRepo.Worktree, path)
-		worktreeFiles[relPath] = true
-		return nil
-	})
+	// An unborn HEAD compares as an empty tree
+	headTree, err := diffTree(gitRepo, "HEAD")
+	if err != nil {
+		return err
+	}
+	headFiles, err := diff.TreeFiles(gitRepo, headTree, nil)
 	if err != nil {
 		return err
 	}
 
-	indexMap := make(map[string]*index.GitIndexEntry)
-	for _, e := range idx.Entries {
-		indexMap[e.Name] = e
+	changes := diff.FilesDiff(headFiles, diffIndexFiles(idx, nil))
+	if renames != nil {
+		if changes, err = diffRenames(gitRepo, changes, *renames); err != nil {
+			return err
+		}
 	}
 
-	// Check for modified and deleted files
-	for _, entry := range idx.Entries {
-		fullPath := filepath.Join(gitRepo.Worktree, entry.Name)
-		stat, err := os.Stat(fullPath)
-		if os.IsNotExist(err) {
-			fmt.Printf("  deleted:  %s\n", entry.Name)
+	unmerged := make(map[string]bool)
+	for _, name := range idx.Unmerged() {
+		unmerged[filepath.ToSlash(name)] = true
+	}
+	for _, c := range changes {
+		if unmerged[c.Path()] {
 			continue
 		}
-
-		// Compare metadata. A simple mtime check is a good start.
-		mtime_s := uint32(stat.ModTime().Unix())
-		if mtime_s != entry.MTime[0] {
-			// Metadata differs, do a full content check
-			f, err := os.Open(fullPath)
-			if err != nil {
-				return err
-			}
-
-			// We pass nil for repo so it doesn't write the object
-			newSHA, err := objects.ObjectHash(f, "blob", nil)
-			f.Close()
-			if err != nil {
-				return err
-			}
-
-			if newSHA != entry.SHA {
-				fmt.Printf("  modified: %s\n", entry.Name)
-			}
+		switch c.Status {
+		case 'A':
+			fmt.Printf("  added:    %s\n", c.NewPath)
+		case 'D':
+			fmt.Printf("  deleted:  %s\n", c.OldPath)
+		case 'R':
+			fmt.Printf("  renamed:  %s -> %s\n", c.OldPath, c.NewPath)
+		case 'C':
+			fmt.Printf("  copied:   %s -> %s\n", c.OldPath, c.NewPath)
+		default:
+			fmt.Printf("  modified: %s\n", c.NewPath)
 		}
 	}
+	return nil
+}
+
+func statusIndexWorktree(gitRepo *repo.GitRepository, idx *index.GitIndex) error {
+	fmt.Println("Changes not staged for commit:")
 
-	rules, err := ignore.GitignoreRead(gitRepo)
+	// Check for modified and deleted files
+	changes, err := worktreeChanges(gitRepo, idx)
 	if err != nil {
 		return err
 	}
+	for _, c := range changes {
+		if c.deleted {
+			fmt.Printf("  deleted:  %s\n", c.name)
+		} else {
+			fmt.Printf("  modified: %s\n", c.name)
+		}
+	}
 
+	untracked, err := worktreeUntracked(gitRepo, idx)
+	if err != nil {
+		return err
+	}
 	fmt.Println("\nUntracked files:")
-	for path := range worktreeFiles {
-		if _, inIndex := indexMap[path]; !inIndex {
-			if !ignore.CheckIgnore(rules, path) {
-				fmt.Printf("  %s\n", path)
-			}
-		}
+	for _, path := range untracked {
+		fmt.Printf("  %s\n", path)
 	}
 
 	return nil
@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/Notwinner0/gvcs/internal/refs"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// ExitError makes the program exit with Code without printing anything,
+// for commands whose exit status is their answer.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// CmdSymbolicRef is the handler for the symbolic-ref command. With only a
+// name it prints the ref that name points to, with a target it repoints it.
+func CmdSymbolicRef(name, target, message string, short, del, quiet bool) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+
+	if del {
+		return refs.SymrefDelete(gitRepo, name)
+	}
+
+	if target != "" {
+		committer, _ := userIdent(gitRepo)
+		return refs.SymrefWrite(gitRepo, name, target, committer, message)
+	}
+
+	pointed, isSymref, err := refs.SymrefRead(gitRepo, name)
+	if err != nil {
+		return err
+	}
+	if !isSymref {
+		if quiet {
+			return &ExitError{Code: 1}
+		}
+		return fmt.Errorf("ref %s is not a symbolic ref", name)
+	}
+	if short {
+		pointed = refs.RefShorten(pointed)
+	}
+	fmt.Println(pointed)
+	return nil
+}
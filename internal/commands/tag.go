@@ -1,6 +1,9 @@
 package commands
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/Notwinner0/gvcs/internal/objects"
 	"github.com/Notwinner0/gvcs/internal/refs"
 	"github.com/Notwinner0/gvcs/internal/repo"
@@ -37,10 +40,18 @@ func tagCreate(gitRepo *repo.GitRepository, name, ref string, createTagObject bo
 			Kvlm: make(map[string][]string),
 		}
 		tag.Kvlm["object"] = []string{sha}
-		tag.Kvlm["type"] = []string{"commit"} // Assuming we're tagging commits
+		header, r, err := objects.ObjectReader(gitRepo, sha)
+		if err != nil {
+			return err
+		}
+		r.Close()
+		tag.Kvlm["type"] = []string{header.Type}
 		tag.Kvlm["tag"] = []string{name}
-		// In a real implementation, you'd get the user's name from config
-		tag.Kvlm["tagger"] = []string{"gvcs <gvcs@example.com>"}
+		tagger, err := userIdent(gitRepo)
+		if err != nil {
+			tagger = "gvcs <gvcs@example.com>"
+		}
+		tag.Kvlm["tagger"] = []string{fmt.Sprintf("%s %d %s", tagger, time.Now().Unix(), time.Now().Format("-0700"))}
 		tag.Message = "A tag generated by gvcs!\n"
 
 		tagSHA, err := objects.ObjectWrite(tag, gitRepo)
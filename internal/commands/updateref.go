@@ -0,0 +1,147 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/refs"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// CmdUpdateRef is the handler for the update-ref command.
+func CmdUpdateRef(ref, newValue, oldValue, message string, del, stdin, noDeref bool) error {
+	gitRepo, err := repo.RepoFind(".", true)
+	if err != nil {
+		return err
+	}
+
+	tx := refs.RefTransactionBegin(gitRepo)
+	tx.Committer, _ = userIdent(gitRepo)
+	tx.NoDeref = noDeref
+
+	switch {
+	case stdin:
+		if err := updateRefStdin(gitRepo, tx, os.Stdin, message); err != nil {
+			tx.Abort()
+			return err
+		}
+	case del:
+		if ref == "" {
+			return fmt.Errorf("usage: update-ref -d <ref> [<old-value>]")
+		}
+		// With -d the second positional is the expected old value
+		old, err := updateRefValue(gitRepo, newValue)
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(ref, old, message); err != nil {
+			return err
+		}
+	default:
+		if ref == "" || newValue == "" {
+			return fmt.Errorf("usage: update-ref <ref> <new-value> [<old-value>]")
+		}
+		newSHA, err := updateRefValue(gitRepo, newValue)
+		if err != nil {
+			return err
+		}
+		old, err := updateRefValue(gitRepo, oldValue)
+		if err != nil {
+			return err
+		}
+		if err := tx.Update(ref, newSHA, old, message); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// updateRefStdin queues the instructions read from r into tx:
+//
+//	update SP <ref> SP <new-value> [SP <old-value>]
+//	create SP <ref> SP <new-value>
+//	delete SP <ref> [SP <old-value>]
+//	verify SP <ref> [SP <old-value>]
+func updateRefStdin(gitRepo *repo.GitRepository, tx *refs.RefTransaction, r io.Reader, message string) error {
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		args := make([]string, 3)
+		copy(args, fields[1:])
+		badLine := func() error {
+			return fmt.Errorf("line %d: malformed %s instruction: %q", lineNo, fields[0], scanner.Text())
+		}
+
+		var err error
+		switch fields[0] {
+		case "update":
+			if len(fields) < 3 || len(fields) > 4 {
+				return badLine()
+			}
+			var newSHA, old string
+			if newSHA, err = updateRefValue(gitRepo, args[1]); err != nil {
+				return err
+			}
+			if old, err = updateRefValue(gitRepo, args[2]); err != nil {
+				return err
+			}
+			err = tx.Update(args[0], newSHA, old, message)
+		case "create":
+			if len(fields) != 3 {
+				return badLine()
+			}
+			var newSHA string
+			if newSHA, err = updateRefValue(gitRepo, args[1]); err != nil {
+				return err
+			}
+			err = tx.Create(args[0], newSHA, message)
+		case "delete":
+			if len(fields) < 2 || len(fields) > 3 {
+				return badLine()
+			}
+			var old string
+			if old, err = updateRefValue(gitRepo, args[1]); err != nil {
+				return err
+			}
+			err = tx.Delete(args[0], old, message)
+		case "verify":
+			if len(fields) < 2 || len(fields) > 3 {
+				return badLine()
+			}
+			// verify without a value checks that the ref does not exist
+			old := refs.ZeroSHA
+			if args[1] != "" {
+				if old, err = updateRefValue(gitRepo, args[1]); err != nil {
+					return err
+				}
+			}
+			err = tx.Verify(args[0], old)
+		default:
+			return fmt.Errorf("line %d: unknown command %q", lineNo, fields[0])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// updateRefValue resolves a value given to update-ref. Empty stays empty
+// (no check) and the all-zero name is kept as is.
+func updateRefValue(gitRepo *repo.GitRepository, value string) (string, error) {
+	if value == "" || value == refs.ZeroSHA {
+		return value, nil
+	}
+	return objects.ObjectFind(gitRepo, value, "", true)
+}
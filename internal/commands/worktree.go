@@ -0,0 +1,412 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/attributes"
+	"github.com/Notwinner0/gvcs/internal/diff"
+	"github.com/Notwinner0/gvcs/internal/ignore"
+	"github.com/Notwinner0/gvcs/internal/index"
+	"github.com/Notwinner0/gvcs/internal/merge"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// worktreeUpdate sets the index and worktree to files, keyed by "/" path,
+// touching only the paths whose index entry differs. A conflicted path gets
+// an index entry for each version it has instead, and its merged version
+// in the worktree. Unless force is set, it fails without changing anything
+// if that would lose changes to those paths not yet staged, or untracked
+// files in the way.
+func worktreeUpdate(gitRepo *repo.GitRepository, idx *index.GitIndex, files map[string]diff.File, conflicts []merge.Conflict, force bool) error {
+	attrs, err := attributes.AttributesRead(gitRepo)
+	if err != nil {
+		return err
+	}
+	entries := make(map[string]*index.GitIndexEntry)
+	unmerged := make(map[string]bool)
+	for _, e := range idx.Entries {
+		name := filepath.ToSlash(e.Name)
+		if e.Stage() != index.StageMerged {
+			unmerged[name] = true
+			continue
+		}
+		entries[name] = e
+	}
+	conflicted := make(map[string]merge.Conflict)
+	for _, c := range conflicts {
+		conflicted[c.Path] = c
+	}
+
+	changed := make(map[string]bool)
+	for p, f := range files {
+		if e, ok := entries[p]; !ok || e.SHA != f.SHA || fmt.Sprintf("%06o", e.Mode) != f.Mode {
+			changed[p] = true
+		}
+	}
+	for p := range entries {
+		if _, ok := files[p]; !ok {
+			changed[p] = true
+		}
+	}
+	for p := range unmerged {
+		changed[p] = true
+	}
+	for p := range conflicted {
+		changed[p] = true
+	}
+	paths := make([]string, 0, len(changed))
+	for p := range changed {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	if !force {
+		if err := worktreeCheck(gitRepo, attrs, entries, files, paths); err != nil {
+			return err
+		}
+	}
+
+	var kept []*index.GitIndexEntry
+	for _, e := range idx.Entries {
+		if !changed[filepath.ToSlash(e.Name)] {
+			kept = append(kept, e)
+		}
+	}
+	for _, p := range paths {
+		name := filepath.FromSlash(p)
+		f, ok := files[p]
+		if !ok {
+			if err := worktreeRemove(gitRepo, name); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := worktreeWrite(gitRepo, attrs, name, f); err != nil {
+			return err
+		}
+		c, isConflict := conflicted[p]
+		if !isConflict {
+			e, err := worktreeEntry(gitRepo, name, f)
+			if err != nil {
+				return err
+			}
+			kept = append(kept, e)
+			continue
+		}
+		for stage, version := range []diff.File{c.Base, c.Ours, c.Theirs} {
+			if version.SHA == "" {
+				continue
+			}
+			mode, err := strconv.ParseUint(version.Mode, 8, 32)
+			if err != nil {
+				return err
+			}
+			e := &index.GitIndexEntry{Mode: uint32(mode), SHA: version.SHA, Name: name}
+			e.SetStage(stage + index.StageBase)
+			kept = append(kept, e)
+		}
+	}
+
+	worktreeSort(kept)
+	idx.Entries = kept
+	return index.IndexWrite(gitRepo, idx)
+}
+
+// worktreeSort puts index entries in the order of the index: by name,
+// then by stage.
+func worktreeSort(entries []*index.GitIndexEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+		return entries[i].Stage() < entries[j].Stage()
+	})
+}
+
+// worktreeRestore sets the index entries and worktree files of paths, "/"
+// separated, to their versions in files, deleting those files lacks,
+// whatever changes they had.
+func worktreeRestore(gitRepo *repo.GitRepository, idx *index.GitIndex, files map[string]diff.File, paths []string) error {
+	attrs, err := attributes.AttributesRead(gitRepo)
+	if err != nil {
+		return err
+	}
+	restored := make(map[string]bool)
+	for _, p := range paths {
+		restored[p] = true
+	}
+	var kept []*index.GitIndexEntry
+	for _, e := range idx.Entries {
+		if !restored[filepath.ToSlash(e.Name)] {
+			kept = append(kept, e)
+		}
+	}
+	for _, p := range paths {
+		name := filepath.FromSlash(p)
+		f, ok := files[p]
+		if !ok {
+			if err := worktreeRemove(gitRepo, name); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := worktreeWrite(gitRepo, attrs, name, f); err != nil {
+			return err
+		}
+		e, err := worktreeEntry(gitRepo, name, f)
+		if err != nil {
+			return err
+		}
+		kept = append(kept, e)
+	}
+	worktreeSort(kept)
+	idx.Entries = kept
+	return index.IndexWrite(gitRepo, idx)
+}
+
+// worktreeCheck fails if updating paths to files would lose worktree
+// changes not yet staged, or overwrite untracked files.
+func worktreeCheck(gitRepo *repo.GitRepository, attrs *attributes.GitAttributes, entries map[string]*index.GitIndexEntry, files map[string]diff.File, paths []string) error {
+	var modified, untracked []string
+	for _, p := range paths {
+		name := filepath.FromSlash(p)
+		stat, err := os.Stat(filepath.Join(gitRepo.Worktree, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		e, ok := entries[p]
+		if !ok {
+			if _, writing := files[p]; writing && !stat.IsDir() {
+				untracked = append(untracked, p)
+			}
+			continue
+		}
+		if worktreeUnchanged(e, stat) {
+			continue
+		}
+		sha, err := hashWorktreeFile(gitRepo, attrs, name, false)
+		if err != nil {
+			return err
+		}
+		if sha != e.SHA {
+			modified = append(modified, p)
+		}
+	}
+
+	var msg []string
+	if len(modified) > 0 {
+		msg = append(msg, "your local changes to the following files would be overwritten:\n\t"+strings.Join(modified, "\n\t"))
+	}
+	if len(untracked) > 0 {
+		msg = append(msg, "the following untracked working tree files would be overwritten:\n\t"+strings.Join(untracked, "\n\t"))
+	}
+	if len(msg) > 0 {
+		return errors.New(strings.Join(msg, "\n") + "\ncommit your changes or stash them to proceed")
+	}
+	return nil
+}
+
+// worktreeWrite writes the blob of f to the worktree file name, creating
+// its directories, with the executable bit of its mode.
+func worktreeWrite(gitRepo *repo.GitRepository, attrs *attributes.GitAttributes, name string, f diff.File) error {
+	dest := filepath.Join(gitRepo.Worktree, name)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	// A file is replaced rather than written through, in case it is a
+	// symlink
+	if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := blobCheckout(gitRepo, f.SHA, dest, name, attrs); err != nil {
+		return err
+	}
+	perm := os.FileMode(0644)
+	if f.Mode == "100755" {
+		perm = 0755
+	}
+	return os.Chmod(dest, perm)
+}
+
+// worktreeRemove deletes the worktree file name and the directories it
+// leaves empty.
+func worktreeRemove(gitRepo *repo.GitRepository, name string) error {
+	if err := os.Remove(filepath.Join(gitRepo.Worktree, name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for dir := filepath.Dir(name); dir != "."; dir = filepath.Dir(dir) {
+		if os.Remove(filepath.Join(gitRepo.Worktree, dir)) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// worktreeEntry makes the index entry of the worktree file name, just
+// written from f.
+func worktreeEntry(gitRepo *repo.GitRepository, name string, f diff.File) (*index.GitIndexEntry, error) {
+	stat, err := os.Stat(filepath.Join(gitRepo.Worktree, name))
+	if err != nil {
+		return nil, err
+	}
+	mode, err := strconv.ParseUint(f.Mode, 8, 32)
+	if err != nil {
+		return nil, err
+	}
+	mtime := [2]uint32{uint32(stat.ModTime().Unix()), uint32(stat.ModTime().Nanosecond())}
+	return &index.GitIndexEntry{
+		CTime: mtime,
+		MTime: mtime,
+		Mode:  uint32(mode),
+		FSize: uint32(stat.Size()),
+		SHA:   f.SHA,
+		Name:  name,
+	}, nil
+}
+
+// worktreeStaged fails if the index has changes from tree, which a command
+// about to replace the index would lose.
+func worktreeStaged(gitRepo *repo.GitRepository, idx *index.GitIndex, tree string) error {
+	if len(idx.Unmerged()) > 0 {
+		return errors.New("you have unmerged files; resolve them and commit, or abort")
+	}
+	treeFiles, err := diff.TreeFiles(gitRepo, tree, nil)
+	if err != nil {
+		return err
+	}
+	if len(diff.FilesDiff(treeFiles, diffIndexFiles(idx, nil))) > 0 {
+		return errors.New("your index contains uncommitted changes\ncommit your changes or stash them to proceed")
+	}
+	return nil
+}
+
+// worktreeReset sets the index and worktree to tree, discarding any
+// changes to the paths where the index differs from it.
+func worktreeReset(gitRepo *repo.GitRepository, idx *index.GitIndex, tree string) error {
+	files, err := diff.TreeFiles(gitRepo, tree, nil)
+	if err != nil {
+		return err
+	}
+	return worktreeUpdate(gitRepo, idx, files, nil, true)
+}
+
+// worktreeChange is a tracked file whose worktree copy no longer matches
+// its index entry.
+type worktreeChange struct {
+	name    string
+	deleted bool
+}
+
+// worktreeChanges lists the tracked files modified or deleted in the
+// worktree since they were staged, in index order. Unmerged paths are left
+// out.
+func worktreeChanges(gitRepo *repo.GitRepository, idx *index.GitIndex) ([]worktreeChange, error) {
+	attrs, err := attributes.AttributesRead(gitRepo)
+	if err != nil {
+		return nil, err
+	}
+	var changes []worktreeChange
+	for _, entry := range idx.Entries {
+		if entry.Stage() != index.StageMerged {
+			continue
+		}
+		stat, err := os.Stat(filepath.Join(gitRepo.Worktree, entry.Name))
+		if os.IsNotExist(err) {
+			changes = append(changes, worktreeChange{name: entry.Name, deleted: true})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if worktreeUnchanged(entry, stat) {
+			continue
+		}
+		sha, err := hashWorktreeFile(gitRepo, attrs, entry.Name, false)
+		if err != nil {
+			return nil, err
+		}
+		if sha != entry.SHA {
+			changes = append(changes, worktreeChange{name: entry.Name})
+		}
+	}
+	return changes, nil
+}
+
+// worktreeUnchanged reports whether a worktree file still has the mtime
+// and size recorded in its index entry, and so is taken as unchanged
+// without hashing it.
+func worktreeUnchanged(e *index.GitIndexEntry, stat os.FileInfo) bool {
+	mtime := stat.ModTime()
+	return uint32(mtime.Unix()) == e.MTime[0] && uint32(mtime.Nanosecond()) == e.MTime[1] && uint32(stat.Size()) == e.FSize
+}
+
+// worktreeUntracked lists the worktree files that are neither in the index
+// nor ignored, sorted.
+func worktreeUntracked(gitRepo *repo.GitRepository, idx *index.GitIndex) ([]string, error) {
+	tracked := make(map[string]bool)
+	for _, e := range idx.Entries {
+		tracked[e.Name] = true
+	}
+	rules, err := ignore.GitignoreRead(gitRepo)
+	if err != nil {
+		return nil, err
+	}
+
+	var untracked []string
+	err = worktreeWalk(gitRepo, func(name string, dir, nested bool) error {
+		relPath := filepath.FromSlash(name)
+		if !dir && !tracked[relPath] && !ignore.CheckIgnore(rules, name) {
+			untracked = append(untracked, relPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(untracked)
+	return untracked, nil
+}
+
+// worktreeWalk calls fn with the "/" path of each file and directory of
+// the worktree, leaving out the git dir. A directory with a .git of its
+// own is another repository: fn sees it with nested set, and it is not
+// entered. fn can return filepath.SkipDir for a directory to leave it out.
+func worktreeWalk(gitRepo *repo.GitRepository, fn func(name string, dir, nested bool) error) error {
+	return filepath.WalkDir(gitRepo.Worktree, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == gitRepo.Worktree {
+			return nil
+		}
+		if path == gitRepo.Gitdir {
+			return filepath.SkipDir
+		}
+		relPath, err := filepath.Rel(gitRepo.Worktree, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(relPath)
+		if !d.IsDir() {
+			return fn(name, false, false)
+		}
+		if _, err := os.Lstat(filepath.Join(path, ".git")); err == nil {
+			if err := fn(name, true, true); err != nil && err != filepath.SkipDir {
+				return err
+			}
+			return filepath.SkipDir
+		}
+		return fn(name, true, false)
+	})
+}
@@ -0,0 +1,78 @@
+package date
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// relativeRE matches "2.weeks.ago", "3 days ago" and "1.hour".
+var relativeRE = regexp.MustCompile(`^(\d+)[. ]+(second|minute|hour|day|week|month|year)s?(?:[. ]+ago)?$`)
+
+// absoluteLayouts are the absolute date formats Parse accepts, tried in order.
+var absoluteLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	time.RFC1123Z,
+	"Mon Jan 2 15:04:05 2006 -0700",
+}
+
+// Parse understands the dates git accepts for options such as --expire and
+// --since: "now", "never", "yesterday", relative dates like "2.weeks.ago",
+// "@<unix seconds>" and common absolute formats. Absolute dates without a
+// zone are local time. "never" is the zero time, before any object.
+func Parse(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	switch strings.ToLower(s) {
+	case "now", "all":
+		return now, nil
+	case "never", "":
+		return time.Time{}, nil
+	case "yesterday":
+		return now.AddDate(0, 0, -1), nil
+	}
+
+	if strings.HasPrefix(s, "@") {
+		secs, err := strconv.ParseInt(s[1:], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date '%s'", s)
+		}
+		return time.Unix(secs, 0), nil
+	}
+
+	if m := relativeRE.FindStringSubmatch(strings.ToLower(s)); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date '%s'", s)
+		}
+		switch m[2] {
+		case "second":
+			return now.Add(-time.Duration(n) * time.Second), nil
+		case "minute":
+			return now.Add(-time.Duration(n) * time.Minute), nil
+		case "hour":
+			return now.Add(-time.Duration(n) * time.Hour), nil
+		case "day":
+			return now.AddDate(0, 0, -n), nil
+		case "week":
+			return now.AddDate(0, 0, -7*n), nil
+		case "month":
+			return now.AddDate(0, -n, 0), nil
+		case "year":
+			return now.AddDate(-n, 0, 0), nil
+		}
+	}
+
+	for _, layout := range absoluteLayouts {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date '%s'", s)
+}
@@ -0,0 +1,46 @@
+package date
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"now", now},
+		{"never", time.Time{}},
+		{"yesterday", now.AddDate(0, 0, -1)},
+		{"2.weeks.ago", now.AddDate(0, 0, -14)},
+		{"3 days ago", now.AddDate(0, 0, -3)},
+		{"1.hour.ago", now.Add(-time.Hour)},
+		{"90.seconds", now.Add(-90 * time.Second)},
+		{"6.Months.Ago", now.AddDate(0, -6, 0)},
+		{"@1700000000", time.Unix(1700000000, 0)},
+		{"2024-01-02", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"2024-01-02 03:04:05", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"2024-01-02T03:04:05+02:00", time.Date(2024, 1, 2, 1, 4, 5, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := Parse(tt.in, now)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	for _, in := range []string{"soon", "2.fortnights.ago", "@abc"} {
+		if _, err := Parse(in, now); err == nil {
+			t.Errorf("Expected an error for %q", in)
+		}
+	}
+}
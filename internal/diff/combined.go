@@ -0,0 +1,547 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// A combined diff shows a merge against all of its parents at once: each
+// line of the merge carries a column per parent, "+" where the parent
+// lacks the line, and lines a parent had but the merge dropped are shown
+// with "-" in that parent's column. Like git's --cc it leaves out files
+// that match one of the parents and hunks where the merge simply took one
+// parent's side.
+
+// CombinedChange is a path of a merge that differs from every parent.
+type CombinedChange struct {
+	Path    string
+	Mode    string // in the merge; "" if the merge deleted the path
+	SHA     string
+	Parents []File // the path in each parent, with an empty SHA if missing
+}
+
+// Status returns the change from each parent as a letter: 'A' where the
+// parent lacked the path, 'D' where the merge deleted it, else 'M'.
+func (c *CombinedChange) Status() string {
+	var b strings.Builder
+	for _, p := range c.Parents {
+		switch {
+		case p.SHA == "":
+			b.WriteByte('A')
+		case c.SHA == "":
+			b.WriteByte('D')
+		default:
+			b.WriteByte('M')
+		}
+	}
+	return b.String()
+}
+
+// CombinedChanges lists the paths of merged that differ from the same path
+// in each of parents, sorted by path.
+func CombinedChanges(merged map[string]File, parents []map[string]File) []CombinedChange {
+	paths := make(map[string]bool)
+	for p := range merged {
+		paths[p] = true
+	}
+	for _, files := range parents {
+		for p := range files {
+			paths[p] = true
+		}
+	}
+
+	var changes []CombinedChange
+	for p := range paths {
+		f := merged[p]
+		c := CombinedChange{Path: p, Mode: f.Mode, SHA: f.SHA}
+		differs := true
+		for _, files := range parents {
+			pf := files[p]
+			if pf == f {
+				differs = false
+				break
+			}
+			c.Parents = append(c.Parents, pf)
+		}
+		if differs {
+			changes = append(changes, c)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// WriteNameStatusCombined writes a line per combined change: its status
+// against each parent and its path, or with nameOnly just the path.
+func WriteNameStatusCombined(w io.Writer, changes []CombinedChange, nameOnly bool) error {
+	var b strings.Builder
+	for _, c := range changes {
+		if !nameOnly {
+			b.WriteString(c.Status() + "\t")
+		}
+		b.WriteString(c.Path + "\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// lostLine is a parent line the merge does not have, with the parents
+// that had it as a bit set.
+type lostLine struct {
+	text    string
+	parents uint64
+}
+
+// mergedLine is a line of the merge: which parents lack it, the lost lines
+// shown before it, and the line it starts at in each parent. One extra
+// mergedLine past the end holds the lines lost at the end of the file.
+type mergedLine struct {
+	text string
+	flag uint64
+	lost []lostLine
+	pLno []int
+}
+
+// WriteCombined writes a combined change as a "diff --cc" patch, given
+// the content of the path in each parent and in the merge. Nothing is
+// written if every hunk turns out to be uninteresting and the modes agree.
+func WriteCombined(w io.Writer, c CombinedChange, parentData [][]byte, data []byte, context int) error {
+	n := len(c.Parents)
+	allMask := uint64(1)<<n - 1
+	mark := uint64(1) << n
+	noPreDelete := uint64(2) << n
+
+	modeDiffers := false
+	for _, p := range c.Parents {
+		if p.Mode != c.Mode {
+			modeDiffers = true
+		}
+	}
+	binary := IsBinary(data)
+	for _, d := range parentData {
+		binary = binary || IsBinary(d)
+	}
+
+	// The merged lines, with a last one to hang deletions at the end on
+	var result []string
+	if c.SHA != "" {
+		result = splitText(data)
+	}
+	cnt := len(result)
+	lines := make([]mergedLine, cnt+2)
+	for i := range lines {
+		if i < cnt {
+			lines[i].text = result[i]
+		}
+		lines[i].pLno = make([]int, n)
+	}
+
+	if !binary {
+		for i := range n {
+			combineParent(lines, cnt, splitText(parentData[i]), result, i)
+		}
+	}
+	showHunks := !binary && c.SHA != "" && combinedHunks(lines, cnt, n, context)
+	if !showHunks && !modeDiffers && !binary {
+		return nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "diff --cc %s\nindex ", c.Path)
+	for i, p := range c.Parents {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(abbrevSHA(p.SHA))
+	}
+	fmt.Fprintf(&b, "..%s\n", abbrevSHA(c.SHA))
+
+	added, deleted := false, c.SHA == ""
+	if modeDiffers {
+		added = !deleted
+		for _, p := range c.Parents {
+			if p.SHA != "" {
+				added = false
+			}
+		}
+		if added {
+			fmt.Fprintf(&b, "new file mode %s\n", c.Mode)
+		} else {
+			if deleted {
+				b.WriteString("deleted file ")
+			}
+			b.WriteString("mode ")
+			for i, p := range c.Parents {
+				if i > 0 {
+					b.WriteString(",")
+				}
+				fmt.Fprintf(&b, "%06s", p.Mode)
+			}
+			if !deleted {
+				fmt.Fprintf(&b, "..%s", c.Mode)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	if binary {
+		b.WriteString("Binary files differ\n")
+	} else if showHunks {
+		from, to := "a/"+c.Path, "b/"+c.Path
+		if added {
+			from = "/dev/null"
+		}
+		if deleted {
+			to = "/dev/null"
+		}
+		fmt.Fprintf(&b, "--- %s\n+++ %s\n", from, to)
+		writeCombinedHunks(&b, lines, cnt, n, context, mark, allMask, noPreDelete)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// abbrevSHA shortens a SHA for an index line, writing a missing one as
+// zeros.
+func abbrevSHA(sha string) string {
+	if sha == "" {
+		sha = nullSHA
+	}
+	return sha[:abbrev]
+}
+
+// combineParent records the diff from parent number n to the merge:
+// merged lines the parent lacks get its bit, and the parent lines the
+// merge lacks are added to the lost lines, shared with other parents that
+// lost the same lines.
+func combineParent(lines []mergedLine, cnt int, parent, result []string, n int) {
+	nmask := uint64(1) << n
+	lost := make([][]string, cnt+1)
+	for _, e := range Lines(parent, result) {
+		switch e.Op {
+		case Insert:
+			lines[e.NewLine].flag |= nmask
+		case Delete:
+			lost[e.NewLine] = append(lost[e.NewLine], parent[e.OldLine])
+		}
+	}
+
+	pLno := 1
+	for lno := 0; lno <= cnt; lno++ {
+		l := &lines[lno]
+		l.pLno[n] = pLno
+		if len(lost[lno]) > 0 {
+			l.lost = coalesceLost(l.lost, lost[lno], nmask)
+		}
+		for _, ll := range l.lost {
+			if ll.parents&nmask != 0 {
+				pLno++
+			}
+		}
+		if lno < cnt && l.flag&nmask == 0 {
+			pLno++
+		}
+	}
+	lines[cnt+1].pLno[n] = pLno
+}
+
+// coalesceLost merges the lines one more parent lost into those earlier
+// parents lost at the same place, so a line several parents lost is
+// shown once. It pairs them by a longest common subsequence, breaking
+// ties as git does so the lines come out in the same order.
+func coalesceLost(have []lostLine, lost []string, nmask uint64) []lostLine {
+	if len(have) == 0 {
+		out := make([]lostLine, len(lost))
+		for i, text := range lost {
+			out[i] = lostLine{text, nmask}
+		}
+		return out
+	}
+
+	const (
+		fromHave = iota
+		fromLost
+		match
+	)
+	lcs := make([][]int, len(have)+1)
+	dir := make([][]int, len(have)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(lost)+1)
+		dir[i] = make([]int, len(lost)+1)
+	}
+	for j := 1; j <= len(lost); j++ {
+		dir[0][j] = fromLost
+	}
+	for i := 1; i <= len(have); i++ {
+		for j := 1; j <= len(lost); j++ {
+			switch {
+			case have[i-1].text == lost[j-1]:
+				lcs[i][j], dir[i][j] = lcs[i-1][j-1]+1, match
+			case lcs[i][j-1] >= lcs[i-1][j]:
+				lcs[i][j], dir[i][j] = lcs[i][j-1], fromLost
+			default:
+				lcs[i][j], dir[i][j] = lcs[i-1][j], fromHave
+			}
+		}
+	}
+
+	// Walk back from the ends, then put the lines in order
+	var out []lostLine
+	for i, j := len(have), len(lost); i > 0 || j > 0; {
+		switch dir[i][j] {
+		case match:
+			ll := have[i-1]
+			ll.parents |= nmask
+			out = append(out, ll)
+			i--
+			j--
+		case fromLost:
+			out = append(out, lostLine{lost[j-1], nmask})
+			j--
+		default:
+			out = append(out, have[i-1])
+			i--
+		}
+	}
+	slices.Reverse(out)
+	return out
+}
+
+// combinedHunks marks the lines to show, as git does: the interesting
+// ones, less the hunks where the merge took one side unchanged, and the
+// context around them. It reports whether any line is shown.
+func combinedHunks(lines []mergedLine, cnt, n, context int) bool {
+	allMask := uint64(1)<<n - 1
+	mark := uint64(1) << n
+	for i := 0; i <= cnt; i++ {
+		if lines[i].flag&allMask != 0 || len(lines[i].lost) > 0 {
+			lines[i].flag |= mark
+		} else {
+			lines[i].flag &^= mark
+		}
+	}
+
+	// A hunk whose changes all come from the same set of parents, short
+	// of all of them, has just two versions and takes one of them
+	for i := 0; i <= cnt; {
+		for i <= cnt && lines[i].flag&mark == 0 {
+			i++
+		}
+		if i > cnt {
+			break
+		}
+		begin := i
+		j := i + 1
+		for ; j <= cnt; j++ {
+			if lines[j].flag&mark != 0 {
+				continue
+			}
+			// Carry on if another interesting line is within context
+			la := min(adjustHunkTail(lines, allMask, begin, j)+context, cnt+1)
+			found := false
+			for la--; la >= j; la-- {
+				if lines[la].flag&mark != 0 {
+					found = true
+					break
+				}
+			}
+			if !found {
+				break
+			}
+			j = la
+		}
+		end := j
+
+		var same uint64
+		interesting := false
+		for k := begin; k < end && !interesting; k++ {
+			if diff := lines[k].flag & allMask; diff != 0 {
+				if same == 0 {
+					same = diff
+				} else if same != diff {
+					interesting = true
+					break
+				}
+			}
+			for _, ll := range lines[k].lost {
+				if same == 0 {
+					same = ll.parents
+				} else if same != ll.parents {
+					interesting = true
+					break
+				}
+			}
+		}
+		if !interesting && same != allMask {
+			for k := begin; k < end; k++ {
+				lines[k].flag &^= mark
+			}
+		}
+		i = end
+	}
+
+	return giveContext(lines, cnt, n, context)
+}
+
+// nextMarked returns the first line from i that is marked, or with
+// unmarked set, that is not; cnt+1 if there is none.
+func nextMarked(lines []mergedLine, mark uint64, i, cnt int, unmarked bool) int {
+	for ; i <= cnt; i++ {
+		if (lines[i].flag&mark == 0) == unmarked {
+			return i
+		}
+	}
+	return i
+}
+
+// adjustHunkTail steps back over a last hunk line that is only there for
+// the lines lost before it, as it already serves as context.
+func adjustHunkTail(lines []mergedLine, allMask uint64, begin, i int) int {
+	if begin+1 <= i && lines[i-1].flag&allMask == 0 {
+		i--
+	}
+	return i
+}
+
+// giveContext marks the context lines around the marked lines, joining
+// hunks that are close together.
+func giveContext(lines []mergedLine, cnt, n, context int) bool {
+	allMask := uint64(1)<<n - 1
+	mark := uint64(1) << n
+	noPreDelete := uint64(2) << n
+
+	i := nextMarked(lines, mark, 0, cnt, false)
+	if i > cnt {
+		return false
+	}
+	for i <= cnt {
+		// Leading context, whose lost lines are not shown
+		for j := max(i-context, 0); j < i; j++ {
+			if lines[j].flag&mark == 0 {
+				lines[j].flag |= noPreDelete
+			}
+			lines[j].flag |= mark
+		}
+
+		for {
+			j := nextMarked(lines, mark, i, cnt, true)
+			if j > cnt {
+				return true
+			}
+			k := nextMarked(lines, mark, j, cnt, false)
+			j = adjustHunkTail(lines, allMask, i, j)
+			if k < j+context {
+				for ; j < k; j++ {
+					lines[j].flag |= mark
+				}
+				i = k
+				continue
+			}
+			i = k
+			for end := min(j+context, cnt+1); j < end; j++ {
+				lines[j].flag |= mark
+			}
+			break
+		}
+	}
+	return true
+}
+
+// writeCombinedHunks writes the marked lines as "@@@" hunks.
+func writeCombinedHunks(b *strings.Builder, lines []mergedLine, cnt, n, context int, mark, allMask, noPreDelete uint64) {
+	marker := strings.Repeat("@", n+1)
+	for lno := 0; ; {
+		// The nearest function line before the hunk that no earlier
+		// hunk showed
+		comment := ""
+		for lno <= cnt && lines[lno].flag&mark == 0 {
+			if lno < cnt && isFuncLine(lines[lno].text) {
+				comment = lines[lno].text
+			}
+			lno++
+		}
+		if lno > cnt {
+			return
+		}
+		end := lno + 1
+		for end <= cnt && lines[end].flag&mark != 0 {
+			end++
+		}
+		rlines := end - lno
+		if end > cnt {
+			rlines--
+		}
+		nullContext := 0
+		if context == 0 {
+			for j := lno; j < end; j++ {
+				if lines[j].flag&allMask == 0 {
+					nullContext++
+				}
+			}
+			rlines -= nullContext
+		}
+
+		b.WriteString(marker)
+		for i := range n {
+			l0, l1 := lines[lno].pLno[i], lines[end].pLno[i]
+			fmt.Fprintf(b, " -%d,%d", l0, max(l1-l0-nullContext, 0))
+		}
+		fmt.Fprintf(b, " +%d,%d %s", lno+1, max(rlines, 0), marker)
+		// git shows the comment up to, but not including, its last
+		// non-blank character among the first 40
+		commentEnd := 0
+		for i := 0; i < 40 && i < len(comment) && comment[i] != '\n'; i++ {
+			if strings.IndexByte(" \t\r\v\f", comment[i]) == -1 {
+				commentEnd = i
+			}
+		}
+		if commentEnd > 0 {
+			b.WriteString(" " + comment[:commentEnd])
+		}
+		b.WriteString("\n")
+
+		for lno < end {
+			l := &lines[lno]
+			lno++
+			if l.flag&noPreDelete == 0 {
+				for _, ll := range l.lost {
+					for i := range n {
+						if ll.parents&(1<<i) != 0 {
+							b.WriteByte('-')
+						} else {
+							b.WriteByte(' ')
+						}
+					}
+					b.WriteString(endLine(ll.text))
+				}
+			}
+			if lno > cnt {
+				break
+			}
+			if l.flag&allMask == 0 && context == 0 {
+				continue
+			}
+			for i := range n {
+				if l.flag&(1<<i) != 0 {
+					b.WriteByte('+')
+				} else {
+					b.WriteByte(' ')
+				}
+			}
+			b.WriteString(endLine(l.text))
+		}
+	}
+}
+
+// isFuncLine reports whether a line could start a function, by git's
+// default rule: it starts with a letter, "_" or "$".
+func isFuncLine(line string) bool {
+	if line == "" {
+		return false
+	}
+	c := line[0]
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
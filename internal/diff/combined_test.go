@@ -0,0 +1,95 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// numbered returns the lines 1 to 20, with some replaced.
+func numbered(replace map[int]string) []byte {
+	var b strings.Builder
+	for i := 1; i <= 20; i++ {
+		if line, ok := replace[i]; ok {
+			b.WriteString(line + "\n")
+		} else {
+			fmt.Fprintf(&b, "%d\n", i)
+		}
+	}
+	return []byte(b.String())
+}
+
+func TestWriteCombined(t *testing.T) {
+	change := CombinedChange{
+		Path: "f",
+		Mode: "100644",
+		SHA:  strings.Repeat("c", 40),
+		Parents: []File{
+			{Mode: "100644", SHA: strings.Repeat("a", 40)},
+			{Mode: "100644", SHA: strings.Repeat("b", 40)},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		parents [][]byte
+		merged  []byte
+		want    string
+	}{
+		{
+			name: "conflict resolved",
+			parents: [][]byte{
+				numbered(map[int]string{5: "FIVE", 18: "eighteen"}),
+				numbered(map[int]string{5: "five", 15: "fifteen"}),
+			},
+			merged: numbered(map[int]string{5: "five-FIVE", 15: "fifteen", 18: "eighteen"}),
+			want: "diff --cc f\n" +
+				"index aaaaaaa,bbbbbbb..ccccccc\n" +
+				"--- a/f\n" +
+				"+++ b/f\n" +
+				"@@@ -2,7 -2,7 +2,7 @@@\n" +
+				"  2\n  3\n  4\n- FIVE\n -five\n++five-FIVE\n  6\n  7\n  8\n" +
+				"@@@ -12,9 -12,9 +12,9 @@@\n" +
+				"  12\n  13\n  14\n- 15\n+ fifteen\n  16\n  17\n -18\n +eighteen\n  19\n  20\n",
+		},
+		{
+			// Each change was taken from one side unchanged
+			name: "clean merge",
+			parents: [][]byte{
+				numbered(map[int]string{2: "two"}),
+				numbered(map[int]string{6: "six"}),
+			},
+			merged: numbered(map[int]string{2: "two", 6: "six"}),
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := WriteCombined(&b, change, tt.parents, tt.merged, 3); err != nil {
+				t.Fatalf("WriteCombined() failed: %v", err)
+			}
+			if b.String() != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, b.String())
+			}
+		})
+	}
+}
+
+func TestCombinedChanges(t *testing.T) {
+	merged := map[string]File{"both": {"100644", "m"}, "ours": {"100644", "o"}, "new": {"100644", "n"}}
+	parents := []map[string]File{
+		{"both": {"100644", "1"}, "ours": {"100644", "o"}, "gone": {"100644", "g"}},
+		{"both": {"100644", "2"}, "ours": {"100644", "x"}, "gone": {"100644", "g"}},
+	}
+
+	var b strings.Builder
+	if err := WriteNameStatusCombined(&b, CombinedChanges(merged, parents), false); err != nil {
+		t.Fatalf("WriteNameStatusCombined() failed: %v", err)
+	}
+	want := "MM\tboth\nDD\tgone\nAA\tnew\n"
+	if b.String() != want {
+		t.Errorf("Expected %q, got %q", want, b.String())
+	}
+}
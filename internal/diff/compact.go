@@ -0,0 +1,290 @@
+package diff
+
+// A run of changed lines can often slide up or down without changing the
+// diff's size, as when one of several identical blank lines is deleted.
+// compact picks the position git would, so patches read the same: runs
+// are lined up with changes on the other side where possible, and
+// otherwise placed by git's indent heuristic, which prefers to split the
+// file where the indentation suggests a block boundary.
+
+// side is one file of a diff: its lines, their ids, and which lines the
+// diff changes.
+type side struct {
+	lines   []string
+	ids     []int
+	changed []bool
+}
+
+func (s *side) isChanged(i int) bool {
+	return i >= 0 && i < len(s.changed) && s.changed[i]
+}
+
+// group is a run of changed lines [start, end); empty between two
+// unchanged lines.
+type group struct{ start, end int }
+
+func (s *side) firstGroup() group {
+	g := group{}
+	for s.isChanged(g.end) {
+		g.end++
+	}
+	return g
+}
+
+func (s *side) nextGroup(g *group) bool {
+	if g.end == len(s.changed) {
+		return false
+	}
+	g.start = g.end + 1
+	g.end = g.start
+	for s.isChanged(g.end) {
+		g.end++
+	}
+	return true
+}
+
+func (s *side) previousGroup(g *group) bool {
+	if g.start == 0 {
+		return false
+	}
+	g.end = g.start - 1
+	g.start = g.end
+	for s.isChanged(g.start - 1) {
+		g.start--
+	}
+	return true
+}
+
+func (s *side) slideDown(g *group) bool {
+	if g.end >= len(s.changed) || s.ids[g.start] != s.ids[g.end] {
+		return false
+	}
+	s.changed[g.start] = false
+	s.changed[g.end] = true
+	g.start++
+	g.end++
+	for s.isChanged(g.end) {
+		g.end++
+	}
+	return true
+}
+
+func (s *side) slideUp(g *group) bool {
+	if g.start == 0 || s.ids[g.start-1] != s.ids[g.end-1] {
+		return false
+	}
+	g.start--
+	g.end--
+	s.changed[g.start] = true
+	s.changed[g.end] = false
+	for s.isChanged(g.start - 1) {
+		g.start--
+	}
+	return true
+}
+
+// maxSliding bounds how far the indent heuristic looks.
+const maxSliding = 100
+
+// compact slides the changed runs of s, keeping o, the other side, in
+// step: the n-th group of s always faces the n-th group of o.
+func compact(s, o *side, indentHeuristic bool) {
+	g, og := s.firstGroup(), o.firstGroup()
+	for {
+		if g.end != g.start {
+			var earliestEnd, size int
+			endMatchingOther := -1
+			// Sliding can merge groups, so repeat until it stops growing
+			for {
+				size = g.end - g.start
+				endMatchingOther = -1
+				for s.slideUp(&g) {
+					o.previousGroup(&og)
+				}
+				earliestEnd = g.end
+				if og.end > og.start {
+					endMatchingOther = g.end
+				}
+				for s.slideDown(&g) {
+					o.nextGroup(&og)
+					if og.end > og.start {
+						endMatchingOther = g.end
+					}
+				}
+				if size == g.end-g.start {
+					break
+				}
+			}
+
+			switch {
+			case g.end == earliestEnd:
+				// It cannot move
+			case endMatchingOther != -1:
+				for og.end == og.start {
+					s.slideUp(&g)
+					o.previousGroup(&og)
+				}
+			case indentHeuristic:
+				shift := max(earliestEnd, g.end-size-1, g.end-maxSliding)
+				bestShift := -1
+				var best splitScore
+				for ; shift <= g.end; shift++ {
+					var score splitScore
+					score.add(s.measureSplit(shift))
+					score.add(s.measureSplit(shift - size))
+					if bestShift == -1 || score.cmp(best) <= 0 {
+						best, bestShift = score, shift
+					}
+				}
+				for g.end > bestShift {
+					s.slideUp(&g)
+					o.previousGroup(&og)
+				}
+			}
+		}
+
+		if !s.nextGroup(&g) {
+			break
+		}
+		o.nextGroup(&og)
+	}
+}
+
+const (
+	maxIndent = 200
+	maxBlanks = 20
+
+	startOfFilePenalty              = 1
+	endOfFilePenalty                = 21
+	totalBlankWeight                = -30
+	postBlankWeight                 = 6
+	relativeIndentPenalty           = -4
+	relativeIndentWithBlankPenalty  = 10
+	relativeOutdentPenalty          = 24
+	relativeOutdentWithBlankPenalty = 17
+	relativeDedentPenalty           = 23
+	relativeDedentWithBlankPenalty  = 17
+	indentWeight                    = 60
+)
+
+// indent returns the width of a line's leading whitespace, with tabs to
+// multiples of 8, or -1 for a blank line.
+func indent(line string) int {
+	n := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ' ':
+			n++
+		case '\t':
+			n += 8 - n%8
+		case '\n', '\r', '\v', '\f':
+		default:
+			return n
+		}
+		if n >= maxIndent {
+			return maxIndent
+		}
+	}
+	return -1
+}
+
+// splitMeasure describes the lines around a split before line split.
+type splitMeasure struct {
+	endOfFile  bool
+	indent     int // of the line after the split; -1 if blank or none
+	preBlank   int // blank lines just before the split
+	preIndent  int // of the nearest non-blank line before them
+	postBlank  int // blank lines after the line after the split
+	postIndent int // of the nearest non-blank line after them
+}
+
+func (s *side) measureSplit(split int) splitMeasure {
+	m := splitMeasure{indent: -1, preIndent: -1, postIndent: -1}
+	if split >= len(s.lines) {
+		m.endOfFile = true
+	} else {
+		m.indent = indent(s.lines[split])
+	}
+	for i := split - 1; i >= 0; i-- {
+		if m.preIndent = indent(s.lines[i]); m.preIndent != -1 {
+			break
+		}
+		m.preBlank++
+		if m.preBlank == maxBlanks {
+			m.preIndent = 0
+			break
+		}
+	}
+	for i := split + 1; i < len(s.lines); i++ {
+		if m.postIndent = indent(s.lines[i]); m.postIndent != -1 {
+			break
+		}
+		m.postBlank++
+		if m.postBlank == maxBlanks {
+			m.postIndent = 0
+			break
+		}
+	}
+	return m
+}
+
+// splitScore rates a position of a group; lower is better.
+type splitScore struct {
+	effectiveIndent int
+	penalty         int
+}
+
+func (sc *splitScore) add(m splitMeasure) {
+	if m.preIndent == -1 && m.preBlank == 0 {
+		sc.penalty += startOfFilePenalty
+	}
+	if m.endOfFile {
+		sc.penalty += endOfFilePenalty
+	}
+	postBlank := 0
+	if m.indent == -1 {
+		postBlank = 1 + m.postBlank
+	}
+	totalBlank := m.preBlank + postBlank
+	sc.penalty += totalBlankWeight * totalBlank
+	sc.penalty += postBlankWeight * postBlank
+
+	ind := m.indent
+	if ind == -1 {
+		ind = m.postIndent
+	}
+	anyBlanks := totalBlank != 0
+	sc.effectiveIndent += ind
+
+	switch {
+	case ind == -1 || m.preIndent == -1 || ind == m.preIndent:
+	case ind > m.preIndent:
+		if anyBlanks {
+			sc.penalty += relativeIndentWithBlankPenalty
+		} else {
+			sc.penalty += relativeIndentPenalty
+		}
+	case m.postIndent != -1 && m.postIndent > ind:
+		if anyBlanks {
+			sc.penalty += relativeOutdentWithBlankPenalty
+		} else {
+			sc.penalty += relativeOutdentPenalty
+		}
+	default:
+		if anyBlanks {
+			sc.penalty += relativeDedentWithBlankPenalty
+		} else {
+			sc.penalty += relativeDedentPenalty
+		}
+	}
+}
+
+func (sc splitScore) cmp(other splitScore) int {
+	c := 0
+	if sc.effectiveIndent > other.effectiveIndent {
+		c = 1
+	} else if sc.effectiveIndent < other.effectiveIndent {
+		c = -1
+	}
+	return indentWeight*c + sc.penalty - other.penalty
+}
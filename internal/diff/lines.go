@@ -0,0 +1,190 @@
+package diff
+
+// Op says what a line diff does with a line.
+type Op byte
+
+const (
+	Equal  Op = ' '
+	Delete Op = '-'
+	Insert Op = '+'
+)
+
+// Edit is one step of a line diff. OldLine and NewLine index the line in
+// the old and new sides; the one a step does not touch is where it
+// happens on that side.
+type Edit struct {
+	Op      Op
+	OldLine int
+	NewLine int
+}
+
+// Lines computes a shortest edit script turning a into b with Myers'
+// algorithm, then slides runs of changes to where git would show them.
+// Within each changed region deletions come before insertions.
+func Lines(a, b []string) []Edit {
+	return diffLines(a, b, true)
+}
+
+// LinesPlain is Lines without the indent heuristic: runs that could go
+// anywhere are left at the bottom, as git places them when merging.
+func LinesPlain(a, b []string) []Edit {
+	return diffLines(a, b, false)
+}
+
+// diffLines is Lines with the choice of whether runs that could go
+// anywhere are placed by the indent heuristic or left at the bottom.
+func diffLines(a, b []string, indentHeuristic bool) []Edit {
+	// Compare small integers rather than strings
+	ids := make(map[string]int)
+	intern := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, line := range lines {
+			id, ok := ids[line]
+			if !ok {
+				id = len(ids)
+				ids[line] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	d := &differ{a: intern(a), b: intern(b)}
+	d.deleted = make([]bool, len(a))
+	d.inserted = make([]bool, len(b))
+	d.compare(0, len(a), 0, len(b))
+	old := &side{lines: a, ids: d.a, changed: d.deleted}
+	new := &side{lines: b, ids: d.b, changed: d.inserted}
+	compact(old, new, indentHeuristic)
+	compact(new, old, indentHeuristic)
+
+	edits := make([]Edit, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && d.deleted[i]:
+			edits = append(edits, Edit{Delete, i, j})
+			i++
+		case j < len(b) && d.inserted[j]:
+			edits = append(edits, Edit{Insert, i, j})
+			j++
+		default:
+			edits = append(edits, Edit{Equal, i, j})
+			i++
+			j++
+		}
+	}
+	return edits
+}
+
+// differ marks the lines a shortest edit script deletes and inserts,
+// finding it in linear space by splitting the problem at the middle
+// snake of each optimal path.
+type differ struct {
+	a, b     []int
+	deleted  []bool
+	inserted []bool
+	vf, vb   []int
+}
+
+// compare diffs a[aLo:aHi] with b[bLo:bHi].
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+	switch {
+	case aLo == aHi:
+		for j := bLo; j < bHi; j++ {
+			d.inserted[j] = true
+		}
+	case bLo == bHi:
+		for i := aLo; i < aHi; i++ {
+			d.deleted[i] = true
+		}
+	default:
+		x, y, u, v := d.middleSnake(aLo, aHi, bLo, bHi)
+		d.compare(aLo, x, bLo, y)
+		d.compare(u, aHi, v, bHi)
+	}
+}
+
+// middleSnake returns the start and end of the snake in the middle of a
+// shortest edit script, searching from both ends at once. The ranges
+// have no common first or last line.
+func (d *differ) middleSnake(aLo, aHi, bLo, bHi int) (x, y, u, v int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	maxD := (n + m + 1) / 2
+	size := 2*maxD + 3
+	if len(d.vf) < size {
+		d.vf = make([]int, size)
+		d.vb = make([]int, size)
+	}
+	// vf[off+k] is the furthest x on diagonal k = x-y from the start; vb
+	// the same counted back from the end
+	off := maxD + 1
+	vf, vb := d.vf[:size], d.vb[:size]
+	for i := range vf {
+		vf[i], vb[i] = -1, -1
+	}
+	vf[off+1], vb[off+1] = 0, 0
+
+	// Paths that run off the end of a side are dropped by narrowing the
+	// range of diagonals searched
+	fStart, fEnd, bStart, bEnd := 0, 0, 0, 0
+	for D := 0; D <= maxD; D++ {
+		for k := -D + fStart; k <= D-fEnd; k += 2 {
+			var x int
+			if k == -D || (k != D && vf[off+k-1] < vf[off+k+1]) {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			vf[off+k] = x
+			switch kb := delta - k; {
+			case x > n:
+				fEnd += 2
+			case y > m:
+				fStart += 2
+			case odd && kb >= -(D-1) && kb <= D-1 && x+vb[off+kb] >= n:
+				return aLo + x0, bLo + y0, aLo + x, bLo + y
+			}
+		}
+		for k := -D + bStart; k <= D-bEnd; k += 2 {
+			var x int
+			if k == -D || (k != D && vb[off+k-1] < vb[off+k+1]) {
+				x = vb[off+k+1]
+			} else {
+				x = vb[off+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && d.a[aHi-1-x] == d.b[bHi-1-y] {
+				x++
+				y++
+			}
+			vb[off+k] = x
+			switch kf := delta - k; {
+			case x > n:
+				bEnd += 2
+			case y > m:
+				bStart += 2
+			case !odd && kf >= -D && kf <= D && x+vf[off+kf] >= n:
+				return aHi - x, bHi - y, aHi - x0, bHi - y0
+			}
+		}
+	}
+	// Unreachable: the searches meet by maxD
+	return aLo, bLo, aHi, bHi
+}
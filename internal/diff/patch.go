@@ -0,0 +1,293 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// nullSHA stands for the missing side of an added or deleted file.
+const nullSHA = "0000000000000000000000000000000000000000"
+
+// abbrev is the length of the SHAs on a patch's index line.
+const abbrev = 7
+
+// PatchOptions configures WritePatch.
+type PatchOptions struct {
+	Context  int      // lines of unchanged context around each change
+	WordDiff WordDiff // how changed lines are shown
+}
+
+// IsBinary guesses whether content is binary the way git does: by looking
+// for a NUL byte near the start.
+func IsBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) != -1
+}
+
+// WritePatch writes a change as a git-style patch: the diff --git header,
+// the lines describing modes, renames and SHAs, and unified hunks between
+// oldData and newData. A type change is written as a deletion followed by
+// an addition.
+func WritePatch(w io.Writer, c Change, oldData, newData []byte, opts PatchOptions) error {
+	if c.Status == 'T' {
+		deleted := Change{Status: 'D', OldPath: c.OldPath, OldMode: c.OldMode, OldSHA: c.OldSHA}
+		if err := WritePatch(w, deleted, oldData, nil, opts); err != nil {
+			return err
+		}
+		added := Change{Status: 'A', NewPath: c.NewPath, NewMode: c.NewMode, NewSHA: c.NewSHA}
+		return WritePatch(w, added, nil, newData, opts)
+	}
+
+	oldPath, newPath := c.OldPath, c.NewPath
+	if oldPath == "" {
+		oldPath = newPath
+	}
+	if newPath == "" {
+		newPath = oldPath
+	}
+	// The header is colored as a whole once written
+	var b strings.Builder
+	fmt.Fprintf(&b, "diff --git a/%s b/%s\n", oldPath, newPath)
+
+	oldSHA, newSHA := c.OldSHA, c.NewSHA
+	switch c.Status {
+	case 'A':
+		fmt.Fprintf(&b, "new file mode %s\n", c.NewMode)
+		oldSHA = nullSHA
+	case 'D':
+		fmt.Fprintf(&b, "deleted file mode %s\n", c.OldMode)
+		newSHA = nullSHA
+	default:
+		if c.OldMode != c.NewMode {
+			fmt.Fprintf(&b, "old mode %s\nnew mode %s\n", c.OldMode, c.NewMode)
+		}
+	}
+	switch c.Status {
+	case 'R':
+		fmt.Fprintf(&b, "similarity index %d%%\nrename from %s\nrename to %s\n", c.Score, oldPath, newPath)
+	case 'C':
+		fmt.Fprintf(&b, "similarity index %d%%\ncopy from %s\ncopy to %s\n", c.Score, oldPath, newPath)
+	}
+	if oldSHA != newSHA {
+		fmt.Fprintf(&b, "index %s..%s", oldSHA[:abbrev], newSHA[:abbrev])
+		if c.OldMode == c.NewMode {
+			fmt.Fprintf(&b, " %s", c.NewMode)
+		}
+		b.WriteString("\n")
+	}
+
+	if oldSHA != newSHA {
+		from, to := "a/"+oldPath, "b/"+newPath
+		if c.Status == 'A' {
+			from = "/dev/null"
+		}
+		if c.Status == 'D' {
+			to = "/dev/null"
+		}
+		if IsBinary(oldData) || IsBinary(newData) {
+			writeMeta(&b, opts)
+			fmt.Fprintf(&b, "Binary files %s and %s differ\n", from, to)
+		} else {
+			fmt.Fprintf(&b, "--- %s\n+++ %s\n", from, to)
+			writeMeta(&b, opts)
+			writeHunks(&b, strings.SplitAfter(string(oldData), "\n"), strings.SplitAfter(string(newData), "\n"), opts)
+		}
+	} else {
+		writeMeta(&b, opts)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeMeta colors the header lines written so far for a colored word
+// diff.
+func writeMeta(b *strings.Builder, opts PatchOptions) {
+	if opts.WordDiff != WordDiffColor {
+		return
+	}
+	lines := strings.SplitAfter(b.String(), "\n")
+	b.Reset()
+	for _, line := range lines {
+		if line != "" {
+			b.WriteString(colorMeta + strings.TrimSuffix(line, "\n") + colorReset + "\n")
+		}
+	}
+}
+
+// Hunk is a run of edits with its context, as shown under one "@@" line.
+type Hunk struct {
+	OldStart, OldCount int // first old line, from 0, and number of lines
+	NewStart, NewCount int
+	Edits              []Edit
+}
+
+// Hunks groups the edits turning old into new into hunks with context
+// lines of unchanged context, merging hunks whose context would touch.
+func Hunks(edits []Edit, context int) []Hunk {
+	var hunks []Hunk
+	for i := 0; i < len(edits); {
+		if edits[i].Op == Equal {
+			i++
+			continue
+		}
+		start := max(i-context, 0)
+		end := i
+		for end < len(edits) {
+			if edits[end].Op != Equal {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].Op == Equal {
+				run++
+			}
+			if run == len(edits) || run-end > 2*context {
+				end = min(end+context, len(edits))
+				break
+			}
+			end = run
+		}
+
+		h := Hunk{OldStart: edits[start].OldLine, NewStart: edits[start].NewLine, Edits: edits[start:end]}
+		for _, e := range h.Edits {
+			if e.Op != Insert {
+				h.OldCount++
+			}
+			if e.Op != Delete {
+				h.NewCount++
+			}
+		}
+		hunks = append(hunks, h)
+		i = end
+	}
+	return hunks
+}
+
+// writeHunks writes the unified hunks between two sets of lines, which
+// keep their newlines; a last line without one is marked. In a word diff
+// each run of changed lines is written as the diff of its words.
+func writeHunks(b *strings.Builder, oldLines, newLines []string, opts PatchOptions) {
+	// SplitAfter leaves an empty string after a final newline
+	if n := len(oldLines); oldLines[n-1] == "" {
+		oldLines = oldLines[:n-1]
+	}
+	if n := len(newLines); newLines[n-1] == "" {
+		newLines = newLines[:n-1]
+	}
+
+	styles, words := wordDiffStyles[opts.WordDiff]
+	for _, h := range Hunks(Lines(oldLines, newLines), opts.Context) {
+		header := fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.OldStart, h.OldCount), hunkRange(h.NewStart, h.NewCount))
+		fn := funcName(oldLines, h.OldStart)
+		if opts.WordDiff == WordDiffColor {
+			header = colorFrag + header + colorReset
+			if fn != "" {
+				fn = colorReset + fn + colorReset
+			}
+		}
+		if fn != "" {
+			header += " " + fn
+		}
+		b.WriteString(header + "\n")
+
+		if words {
+			writeWordHunk(b, h, oldLines, newLines, opts.WordDiff, styles)
+			continue
+		}
+		for _, e := range h.Edits {
+			var line string
+			if e.Op == Delete {
+				line = oldLines[e.OldLine]
+			} else {
+				line = newLines[e.NewLine]
+			}
+			b.WriteByte(byte(e.Op))
+			b.WriteString(line)
+			if !strings.HasSuffix(line, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+}
+
+// writeWordHunk writes the lines of a hunk for a word diff: unchanged
+// lines as they are and each run of changed ones as a diff of its words.
+// Every line is ended, as the words of a last line without a newline are
+// still laid out on a line of their own.
+func writeWordHunk(b *strings.Builder, h Hunk, oldLines, newLines []string, mode WordDiff, styles wordStyles) {
+	var minus, plus strings.Builder
+	flush := func() {
+		if minus.Len() > 0 || plus.Len() > 0 {
+			writeWordDiff(b, minus.String(), plus.String(), styles)
+			minus.Reset()
+			plus.Reset()
+		}
+	}
+	for _, e := range h.Edits {
+		switch e.Op {
+		case Delete:
+			minus.WriteString(endLine(oldLines[e.OldLine]))
+		case Insert:
+			plus.WriteString(endLine(newLines[e.NewLine]))
+		default:
+			flush()
+			line := strings.TrimSuffix(endLine(newLines[e.NewLine]), "\n")
+			switch mode {
+			case WordDiffPorcelain:
+				b.WriteString(" " + line + "\n~\n")
+			case WordDiffColor:
+				cr := ""
+				if strings.HasSuffix(line, "\r") {
+					line, cr = line[:len(line)-1], "\r"
+				}
+				if line != "" {
+					line += colorReset
+				}
+				b.WriteString(line + cr + "\n")
+			default:
+				b.WriteString(line + "\n")
+			}
+		}
+	}
+	flush()
+}
+
+// endLine adds the newline a last line may lack.
+func endLine(line string) string {
+	if strings.HasSuffix(line, "\n") {
+		return line
+	}
+	return line + "\n"
+}
+
+// hunkRange formats the start and length of one side of a hunk. An empty
+// side names the line before it.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// funcName finds the line shown after a hunk header: the nearest line
+// before the hunk that starts with a letter, "_" or "$", as git's default
+// function name pattern does.
+func funcName(lines []string, before int) string {
+	for i := before - 1; i >= 0; i-- {
+		line := lines[i]
+		if isFuncLine(line) {
+			if len(line) > 80 {
+				line = line[:80]
+			}
+			return strings.TrimRight(line, " \t\r\n\v\f")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,151 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", "a b c", "a b c", "  a  b  c"},
+		{"insert", "a c", "a b c", "  a +b  c"},
+		{"delete", "a b c", "a c", "  a -b  c"},
+		{"replace", "a b c", "a x c", "  a -b +x  c"},
+		{"empty", "", "a", " +a"},
+		// The deleted "b" could be either one; it goes with the change
+		// after it
+		{"slide", "a b b c", "a b x", "  a  b -b -c +x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := strings.Fields(tt.a), strings.Fields(tt.b)
+			var got strings.Builder
+			for _, e := range Lines(a, b) {
+				got.WriteString(" " + string(e.Op))
+				if e.Op == Delete {
+					got.WriteString(a[e.OldLine])
+				} else {
+					got.WriteString(b[e.NewLine])
+				}
+			}
+			if got.String() != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got.String())
+			}
+		})
+	}
+}
+
+func TestWritePatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   Change
+		old, new string
+		want     string
+	}{
+		{
+			name:   "modified",
+			change: Change{Status: 'M', OldPath: "f", NewPath: "f", OldMode: "100644", NewMode: "100644", OldSHA: strings.Repeat("a", 40), NewSHA: strings.Repeat("b", 40)},
+			old:    "func main() {\n\t1\n\t2\n\t3\n\t4\n\t5\n}\n",
+			new:    "func main() {\n\t1\n\t2\n\t3\n\t4\n\tfive\n}",
+			want: "diff --git a/f b/f\n" +
+				"index aaaaaaa..bbbbbbb 100644\n" +
+				"--- a/f\n" +
+				"+++ b/f\n" +
+				"@@ -3,5 +3,5 @@ func main() {\n" +
+				" \t2\n \t3\n \t4\n-\t5\n-}\n+\tfive\n+}\n\\ No newline at end of file\n",
+		},
+		{
+			name:   "added",
+			change: Change{Status: 'A', NewPath: "new", NewMode: "100755", NewSHA: strings.Repeat("c", 40)},
+			new:    "x\n",
+			want: "diff --git a/new b/new\n" +
+				"new file mode 100755\n" +
+				"index 0000000..ccccccc\n" +
+				"--- /dev/null\n" +
+				"+++ b/new\n" +
+				"@@ -0,0 +1 @@\n" +
+				"+x\n",
+		},
+		{
+			name:   "pure rename",
+			change: Change{Status: 'R', OldPath: "a", NewPath: "b", OldMode: "100644", NewMode: "100644", OldSHA: strings.Repeat("d", 40), NewSHA: strings.Repeat("d", 40), Score: 100},
+			old:    "same\n",
+			new:    "same\n",
+			want: "diff --git a/a b/b\n" +
+				"similarity index 100%\n" +
+				"rename from a\n" +
+				"rename to b\n",
+		},
+		{
+			name:   "binary",
+			change: Change{Status: 'D', OldPath: "bin", OldMode: "100644", OldSHA: strings.Repeat("e", 40)},
+			old:    "\x00\x01",
+			want: "diff --git a/bin b/bin\n" +
+				"deleted file mode 100644\n" +
+				"index eeeeeee..0000000\n" +
+				"Binary files a/bin and /dev/null differ\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := WritePatch(&b, tt.change, []byte(tt.old), []byte(tt.new), PatchOptions{Context: 3}); err != nil {
+				t.Fatalf("WritePatch() failed: %v", err)
+			}
+			if b.String() != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, b.String())
+			}
+		})
+	}
+}
+
+func TestWritePatch_WordDiff(t *testing.T) {
+	change := Change{Status: 'M', OldPath: "w", NewPath: "w", OldMode: "100644", NewMode: "100644", OldSHA: strings.Repeat("a", 40), NewSHA: strings.Repeat("b", 40)}
+	old := "hello big world\nfoo bar baz\n  same line\nlast one\n"
+	new := "hello small world\nfoo baz qux\n  same line\nlast one changed\nextra line\n"
+	header := "diff --git a/w b/w\nindex aaaaaaa..bbbbbbb 100644\n--- a/w\n+++ b/w\n@@ -1,4 +1,5 @@\n"
+
+	tests := []struct {
+		mode WordDiff
+		want string
+	}{
+		{WordDiffPlain, header +
+			"hello [-big-]{+small+} world\n" +
+			"foo[-bar-] baz {+qux+}\n" +
+			"  same line\n" +
+			"last one {+changed+}\n" +
+			"{+extra line+}\n"},
+		{WordDiffPorcelain, header +
+			" hello \n-big\n+small\n  world\n~\n" +
+			" foo\n-bar\n  baz \n+qux\n~\n" +
+			"   same line\n~\n" +
+			" last one \n+changed\n~\n" +
+			"+extra line\n~\n"},
+		{WordDiffColor, "\033[1mdiff --git a/w b/w\033[m\n" +
+			"\033[1mindex aaaaaaa..bbbbbbb 100644\033[m\n" +
+			"\033[1m--- a/w\033[m\n" +
+			"\033[1m+++ b/w\033[m\n" +
+			"\033[36m@@ -1,4 +1,5 @@\033[m\n" +
+			"hello \033[31mbig\033[m\033[32msmall\033[m world\n" +
+			"foo\033[31mbar\033[m baz \033[32mqux\033[m\n" +
+			"  same line\033[m\n" +
+			"last one \033[32mchanged\033[m\n" +
+			"\033[32mextra line\033[m\n"},
+	}
+
+	for _, tt := range tests {
+		var b strings.Builder
+		if err := WritePatch(&b, change, []byte(old), []byte(new), PatchOptions{Context: 3, WordDiff: tt.mode}); err != nil {
+			t.Fatalf("WritePatch() failed: %v", err)
+		}
+		if b.String() != tt.want {
+			t.Errorf("Expected %q, got %q", tt.want, b.String())
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package diff
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// DefaultThreshold is the similarity, in percent, a pair of files needs
+// to be taken as a rename or copy when no threshold is given.
+const DefaultThreshold = 50
+
+// DefaultRenameLimit caps the number of sources and destinations compared
+// by content when no limit is given.
+const DefaultRenameLimit = 1000
+
+// RenameOptions configures DetectRenames.
+type RenameOptions struct {
+	Threshold int  // minimum similarity in percent; 0 for DefaultThreshold
+	Limit     int  // skip content comparison above this many files; 0 for DefaultRenameLimit
+	Copies    bool // also find copies of modified files
+}
+
+// ParseThreshold parses a similarity threshold as given to -M: a percentage
+// such as "90%", or digits read as a fraction, so "9" and "90" are both 90%.
+// An empty string is DefaultThreshold.
+func ParseThreshold(s string) (int, error) {
+	if s == "" {
+		return DefaultThreshold, nil
+	}
+	if digits, ok := strings.CutSuffix(s, "%"); ok {
+		n, err := strconv.Atoi(digits)
+		if err != nil || n < 0 || n > 100 {
+			return 0, fmt.Errorf("invalid similarity threshold: %s", s)
+		}
+		return n, nil
+	}
+	f, err := strconv.ParseFloat("0."+s, 64)
+	if err != nil || strings.ContainsAny(s, ".+-eE") {
+		return 0, fmt.Errorf("invalid similarity threshold: %s", s)
+	}
+	return int(f*100 + 0.5), nil
+}
+
+// DetectRenames pairs added files with deleted ones, and with copies also
+// with modified ones, that have the same or similar content. Pairs become
+// a single change with status 'R' or 'C' and a similarity Score. A deleted
+// file is renamed at most once; with copies it can be copied after that.
+//
+// Files with identical content are paired first. The rest are compared by
+// content unless there are more files on either side than the limit, in
+// which case skipped is set and only the identical pairs are found.
+func DetectRenames(gitRepo *repo.GitRepository, changes []Change, opts RenameOptions) (result []Change, skipped bool, err error) {
+	threshold := opts.Threshold
+	if threshold == 0 {
+		threshold = DefaultThreshold
+	}
+	limit := opts.Limit
+	if limit == 0 {
+		limit = DefaultRenameLimit
+	}
+
+	var sources, destinations []int
+	for i, c := range changes {
+		switch {
+		case c.Status == 'A':
+			destinations = append(destinations, i)
+		case c.Status == 'D', c.Status == 'M' && opts.Copies:
+			sources = append(sources, i)
+		}
+	}
+	if len(sources) == 0 || len(destinations) == 0 {
+		return changes, false, nil
+	}
+
+	// Candidate pairs, best first
+	type pair struct{ src, dst, score int }
+	var pairs []pair
+	for _, d := range destinations {
+		for _, s := range sources {
+			if changes[s].OldSHA == changes[d].NewSHA && fileKind(changes[s].OldMode) == fileKind(changes[d].NewMode) {
+				pairs = append(pairs, pair{s, d, 100})
+			}
+		}
+	}
+
+	if len(sources) > limit || len(destinations) > limit {
+		skipped = true
+	} else {
+		contents := make(map[string][]byte)
+		read := func(sha string) ([]byte, error) {
+			if data, ok := contents[sha]; ok {
+				return data, nil
+			}
+			data, err := BlobRead(gitRepo, sha)
+			contents[sha] = data
+			return data, err
+		}
+		for _, d := range destinations {
+			if fileKind(changes[d].NewMode) != "file" {
+				continue
+			}
+			newData, err := read(changes[d].NewSHA)
+			if err != nil {
+				return nil, false, err
+			}
+			for _, s := range sources {
+				if changes[s].OldSHA == changes[d].NewSHA || fileKind(changes[s].OldMode) != "file" {
+					continue
+				}
+				oldData, err := read(changes[s].OldSHA)
+				if err != nil {
+					return nil, false, err
+				}
+				// Only identical contents score 100, and those were
+				// paired above; reordered lines count as similar
+				if score := Similarity(oldData, newData, threshold); score >= threshold {
+					pairs = append(pairs, pair{s, d, min(score, 99)})
+				}
+			}
+		}
+	}
+
+	// Higher scores win; among equals, a file that kept its name, then the
+	// earlier path
+	sort.SliceStable(pairs, func(i, j int) bool {
+		if pairs[i].score != pairs[j].score {
+			return pairs[i].score > pairs[j].score
+		}
+		iSame := path.Base(changes[pairs[i].src].OldPath) == path.Base(changes[pairs[i].dst].NewPath)
+		jSame := path.Base(changes[pairs[j].src].OldPath) == path.Base(changes[pairs[j].dst].NewPath)
+		return iSame && !jSame
+	})
+
+	paired := make(map[int]bool)
+	renamed := make(map[int]bool)
+	result = make([]Change, 0, len(changes))
+	var found []Change
+	for _, p := range pairs {
+		if paired[p.dst] {
+			continue
+		}
+		src := changes[p.src]
+		status := byte('C')
+		switch {
+		case src.Status == 'D' && !renamed[p.src]:
+			status = 'R'
+			renamed[p.src] = true
+		case !opts.Copies:
+			continue
+		}
+		paired[p.dst] = true
+		dst := changes[p.dst]
+		found = append(found, Change{
+			Status:  status,
+			OldPath: src.OldPath,
+			NewPath: dst.NewPath,
+			OldMode: src.OldMode,
+			NewMode: dst.NewMode,
+			OldSHA:  src.OldSHA,
+			NewSHA:  dst.NewSHA,
+			Score:   p.score,
+		})
+	}
+
+	for i, c := range changes {
+		if !paired[i] && !renamed[i] {
+			result = append(result, c)
+		}
+	}
+	result = append(result, found...)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Path() < result[j].Path()
+	})
+	return result, skipped, nil
+}
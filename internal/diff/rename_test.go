@@ -0,0 +1,95 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+func TestDetectRenames(t *testing.T) {
+	gitRepo, err := repo.RepoCreate(t.TempDir())
+	if err != nil {
+		t.Fatalf("RepoCreate() failed: %v", err)
+	}
+	body := "1\n2\n3\n4\n5\n6\n7\n8\n9\n"
+	oldTree := writeTree(t, gitRepo, map[string]string{
+		"exact":    "same content\n",
+		"edited":   body,
+		"modified": body + "10\n",
+		"other":    "unrelated\n",
+	})
+	newTree := writeTree(t, gitRepo, map[string]string{
+		"dir/exact": "same content\n",
+		"renamed":   body + "changed\n",
+		"modified":  body + "11\n",
+		"copy":      body + "10\n",
+		"new":       "brand new\n",
+	})
+	changes, err := TreeDiff(gitRepo, oldTree, newTree, nil)
+	if err != nil {
+		t.Fatalf("TreeDiff() failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		opts RenameOptions
+		want string
+	}{
+		{"renames", RenameOptions{}, "R85 edited -> copy, R100 exact -> dir/exact, M modified, A new, D other, A renamed"},
+		{"high threshold", RenameOptions{Threshold: 95}, "A copy, R100 exact -> dir/exact, D edited, M modified, A new, D other, A renamed"},
+		{"copies", RenameOptions{Copies: true}, "C100 modified -> copy, R100 exact -> dir/exact, M modified, A new, D other, R69 edited -> renamed"},
+		{"limit", RenameOptions{Limit: 1}, "A copy, R100 exact -> dir/exact, D edited, M modified, A new, D other, A renamed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, _, err := DetectRenames(gitRepo, changes, tt.opts)
+			if err != nil {
+				t.Fatalf("DetectRenames() failed: %v", err)
+			}
+			var got []string
+			for _, c := range result {
+				switch c.Status {
+				case 'R', 'C':
+					got = append(got, fmt.Sprintf("%c%d %s -> %s", c.Status, c.Score, c.OldPath, c.NewPath))
+				default:
+					got = append(got, fmt.Sprintf("%c %s", c.Status, c.Path()))
+				}
+			}
+			if strings.Join(got, ", ") != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, strings.Join(got, ", "))
+			}
+		})
+	}
+}
+
+func TestParseThreshold(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{"", 50},
+		{"90%", 90},
+		{"5%", 5},
+		{"9", 90},
+		{"75", 75},
+		{"05", 5},
+	}
+	for _, tt := range tests {
+		got, err := ParseThreshold(tt.input)
+		if err != nil {
+			t.Fatalf("ParseThreshold(%q) failed: %v", tt.input, err)
+		}
+		if got != tt.want {
+			t.Errorf("ParseThreshold(%q): expected %d, got %d", tt.input, tt.want, got)
+		}
+	}
+
+	for _, input := range []string{"abc", "101%", "-5", "0.5"} {
+		if _, err := ParseThreshold(input); err == nil {
+			t.Errorf("ParseThreshold(%q): expected an error", input)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// Similarity scores how much of two contents is shared, from 0 to 100:
+// the bytes of the lines they have in common over the size of the larger.
+// Contents whose sizes alone rule out reaching minScore score 0 without
+// being compared.
+func Similarity(a, b []byte, minScore int) int {
+	larger, smaller := len(a), len(b)
+	if smaller > larger {
+		larger, smaller = smaller, larger
+	}
+	if larger == 0 {
+		return 100
+	}
+	if smaller*100 < minScore*larger {
+		return 0
+	}
+
+	counts := make(map[string]int)
+	for _, line := range splitLines(a) {
+		counts[string(line)]++
+	}
+	common := 0
+	for _, line := range splitLines(b) {
+		if counts[string(line)] > 0 {
+			counts[string(line)]--
+			common += len(line)
+		}
+	}
+	return common * 100 / larger
+}
+
+// splitLines splits data after each newline, keeping the newlines so
+// that every byte is counted.
+func splitLines(data []byte) [][]byte {
+	var lines [][]byte
+	for len(data) > 0 {
+		n := bytes.IndexByte(data, '\n') + 1
+		if n == 0 {
+			n = len(data)
+		}
+		lines = append(lines, data[:n])
+		data = data[n:]
+	}
+	return lines
+}
+
+// BlobRead returns the content of a blob.
+func BlobRead(gitRepo *repo.GitRepository, sha string) ([]byte, error) {
+	obj, err := objects.ObjectRead(gitRepo, sha)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Type() != "blob" {
+		return nil, fmt.Errorf("object %s is not a blob", sha)
+	}
+	return obj.Serialize()
+}
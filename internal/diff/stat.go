@@ -0,0 +1,272 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// FileStat counts the lines a change adds and deletes. For binary files
+// the counts are the sizes in bytes of the old and new content.
+type FileStat struct {
+	Change  Change
+	Added   int
+	Deleted int
+	Binary  bool
+}
+
+// Stat counts the changed lines between two contents.
+func Stat(c Change, oldData, newData []byte) FileStat {
+	s := FileStat{Change: c}
+	if IsBinary(oldData) || IsBinary(newData) {
+		s.Binary = true
+		s.Deleted, s.Added = len(oldData), len(newData)
+		if c.OldSHA == c.NewSHA {
+			s.Deleted, s.Added = 0, 0
+		}
+		return s
+	}
+	for _, e := range Lines(splitText(oldData), splitText(newData)) {
+		switch e.Op {
+		case Delete:
+			s.Deleted++
+		case Insert:
+			s.Added++
+		}
+	}
+	return s
+}
+
+// splitText splits content into lines that keep their newlines.
+func splitText(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// DisplayName names a change in a summary: its path, or for a rename or
+// copy both paths with their common leading directories and trailing part
+// factored out, as in "dir/{old => new}/file".
+func DisplayName(c Change) string {
+	if c.Status != 'R' && c.Status != 'C' {
+		return c.Path()
+	}
+	a, b := c.OldPath, c.NewPath
+
+	prefix := 0
+	for i := 0; i < len(a) && i < len(b) && a[i] == b[i]; i++ {
+		if a[i] == '/' {
+			prefix = i + 1
+		}
+	}
+
+	// Compare from the ends, where both strings are taken to end in the
+	// same terminator, back to the slash that ends a common prefix
+	suffix := 0
+	adjust := 0
+	if prefix > 0 {
+		adjust = 1
+	}
+	at := func(s string, i int) byte {
+		if i == len(s) {
+			return 0
+		}
+		return s[i]
+	}
+	for i, j := len(a), len(b); i >= prefix-adjust && j >= prefix-adjust && at(a, i) == at(b, j); i, j = i-1, j-1 {
+		if at(a, i) == '/' {
+			suffix = len(a) - i
+		}
+	}
+
+	aMid := max(len(a)-prefix-suffix, 0)
+	bMid := max(len(b)-prefix-suffix, 0)
+	var name strings.Builder
+	if prefix+suffix > 0 {
+		name.WriteString(a[:prefix] + "{")
+	}
+	name.WriteString(a[prefix:prefix+aMid] + " => " + b[prefix:prefix+bMid])
+	if prefix+suffix > 0 {
+		name.WriteString("}" + a[len(a)-suffix:])
+	}
+	return name.String()
+}
+
+// WriteNumstat writes one "added<TAB>deleted<TAB>path" line per file,
+// with "-" for the counts of binary files.
+func WriteNumstat(w io.Writer, stats []FileStat) error {
+	var b strings.Builder
+	for _, s := range stats {
+		if s.Binary {
+			fmt.Fprintf(&b, "-\t-\t%s\n", DisplayName(s.Change))
+		} else {
+			fmt.Fprintf(&b, "%d\t%d\t%s\n", s.Added, s.Deleted, DisplayName(s.Change))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteStat writes a diffstat: a histogram line per file followed by the
+// summary line, fitted into width columns as git fits them.
+func WriteStat(w io.Writer, stats []FileStat, width int) error {
+	if len(stats) == 0 {
+		return nil
+	}
+
+	maxLen, maxChange, numberWidth, binWidth := 0, 0, 0, 0
+	names := make([]string, len(stats))
+	for i, s := range stats {
+		names[i] = DisplayName(s.Change)
+		maxLen = max(maxLen, utf8.RuneCountInString(names[i]))
+		if s.Binary {
+			binWidth = max(binWidth, 14+decimalWidth(s.Added)+decimalWidth(s.Deleted))
+			numberWidth = 3 // lines up the counts with "Bin"
+			continue
+		}
+		maxChange = max(maxChange, s.Added+s.Deleted)
+	}
+	numberWidth = max(numberWidth, decimalWidth(maxChange))
+	width = max(width, 16+6+numberWidth)
+
+	// Take what the names and graph want, then give each a share of the
+	// width if that is too much: the name 5/8 and the graph 3/8
+	graphWidth := maxChange
+	if maxChange+4 <= binWidth {
+		graphWidth = binWidth - 4
+	}
+	nameWidth := maxLen
+	if nameWidth+numberWidth+6+graphWidth > width {
+		if graphWidth > width*3/8-numberWidth-6 {
+			graphWidth = max(width*3/8-numberWidth-6, 6)
+		}
+		if nameWidth > width-numberWidth-6-graphWidth {
+			nameWidth = width - numberWidth - 6 - graphWidth
+		} else {
+			graphWidth = width - numberWidth - 6 - nameWidth
+		}
+	}
+
+	var b strings.Builder
+	for i, s := range stats {
+		name, prefix := names[i], ""
+		room := nameWidth
+		if n := utf8.RuneCountInString(name); n > nameWidth {
+			// Keep the end of the name, from a directory boundary
+			prefix = "..."
+			room = max(room-3, 0)
+			for utf8.RuneCountInString(name) > room {
+				_, size := utf8.DecodeRuneInString(name)
+				name = name[size:]
+			}
+			if slash := strings.IndexByte(name, '/'); slash != -1 {
+				name = name[slash:]
+			}
+		}
+		padding := strings.Repeat(" ", max(room-utf8.RuneCountInString(name), 0))
+
+		if s.Binary {
+			fmt.Fprintf(&b, " %s%s%s | %*s", prefix, name, padding, numberWidth, "Bin")
+			if s.Added == 0 && s.Deleted == 0 {
+				b.WriteString("\n")
+				continue
+			}
+			fmt.Fprintf(&b, " %d -> %d bytes\n", s.Deleted, s.Added)
+			continue
+		}
+
+		add, del := s.Added, s.Deleted
+		if graphWidth <= maxChange {
+			total := scaleLinear(add+del, graphWidth, maxChange)
+			if total < 2 && add > 0 && del > 0 {
+				total = 2
+			}
+			if add < del {
+				add = scaleLinear(add, graphWidth, maxChange)
+				del = total - add
+			} else {
+				del = scaleLinear(del, graphWidth, maxChange)
+				add = total - del
+			}
+		}
+		fmt.Fprintf(&b, " %s%s%s | %*d", prefix, name, padding, numberWidth, s.Added+s.Deleted)
+		if s.Added+s.Deleted > 0 {
+			b.WriteString(" ")
+		}
+		b.WriteString(strings.Repeat("+", add) + strings.Repeat("-", del) + "\n")
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return err
+	}
+	return WriteShortstat(w, stats)
+}
+
+// scaleLinear scales a count to a width, showing at least one column for
+// any change.
+func scaleLinear(n, width, maxChange int) int {
+	if n == 0 {
+		return 0
+	}
+	return 1 + n*(width-1)/maxChange
+}
+
+func decimalWidth(n int) int {
+	return len(fmt.Sprint(n))
+}
+
+// WriteShortstat writes the summary line of a diffstat, such as
+// " 2 files changed, 3 insertions(+), 1 deletion(-)". Binary files count
+// as changed files without changed lines.
+func WriteShortstat(w io.Writer, stats []FileStat) error {
+	if len(stats) == 0 {
+		return nil
+	}
+	insertions, deletions := 0, 0
+	for _, s := range stats {
+		if !s.Binary {
+			insertions += s.Added
+			deletions += s.Deleted
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, " %d %s changed", len(stats), plural(len(stats), "file", "files"))
+	if insertions > 0 || deletions == 0 {
+		fmt.Fprintf(&b, ", %d %s(+)", insertions, plural(insertions, "insertion", "insertions"))
+	}
+	if deletions > 0 || insertions == 0 {
+		fmt.Fprintf(&b, ", %d %s(-)", deletions, plural(deletions, "deletion", "deletions"))
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// WriteNameStatus writes one line per change with its status letter and
+// paths, such as "M<TAB>file" or "R090<TAB>old<TAB>new". With nameOnly
+// it writes just the paths changed, by their new names.
+func WriteNameStatus(w io.Writer, changes []Change, nameOnly bool) error {
+	var b strings.Builder
+	for _, c := range changes {
+		switch {
+		case nameOnly:
+			b.WriteString(c.Path() + "\n")
+		case c.Status == 'R' || c.Status == 'C':
+			fmt.Fprintf(&b, "%c%03d\t%s\t%s\n", c.Status, c.Score, c.OldPath, c.NewPath)
+		default:
+			fmt.Fprintf(&b, "%c\t%s\n", c.Status, c.Path())
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,57 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDisplayName(t *testing.T) {
+	tests := []struct {
+		old, new string
+		want     string
+	}{
+		{"big", "moved", "big => moved"},
+		{"dir/a.txt", "dir/b.txt", "dir/{a.txt => b.txt}"},
+		{"a/sub/f", "b/sub/f", "{a => b}/sub/f"},
+		{"src/a/f", "src/b/f", "src/{a => b}/f"},
+		{"f", "dir/f", "f => dir/f"},
+	}
+
+	for _, tt := range tests {
+		got := DisplayName(Change{Status: 'R', OldPath: tt.old, NewPath: tt.new})
+		if got != tt.want {
+			t.Errorf("Expected %q, got %q", tt.want, got)
+		}
+	}
+}
+
+func TestWriteStat(t *testing.T) {
+	stats := []FileStat{
+		{Change: Change{Status: 'M', OldPath: "short", NewPath: "short"}, Added: 2, Deleted: 1},
+		{Change: Change{Status: 'A', NewPath: "dir/longer"}, Added: 120},
+		{Change: Change{Status: 'R', OldPath: "old", NewPath: "new", Score: 100}},
+		{Change: Change{Status: 'M', OldPath: "bin", NewPath: "bin"}, Binary: true, Deleted: 10, Added: 12},
+	}
+	want := " short      |   3 +-\n" +
+		" dir/longer | 120 " + strings.Repeat("+", 61) + "\n" +
+		" old => new |   0\n" +
+		" bin        | Bin 10 -> 12 bytes\n" +
+		" 4 files changed, 122 insertions(+), 1 deletion(-)\n"
+
+	var b strings.Builder
+	if err := WriteStat(&b, stats, 80); err != nil {
+		t.Fatalf("WriteStat() failed: %v", err)
+	}
+	if b.String() != want {
+		t.Errorf("Expected %q, got %q", want, b.String())
+	}
+
+	b.Reset()
+	if err := WriteNumstat(&b, stats); err != nil {
+		t.Fatalf("WriteNumstat() failed: %v", err)
+	}
+	want = "2\t1\tshort\n120\t0\tdir/longer\n0\t0\told => new\n-\t-\tbin\n"
+	if b.String() != want {
+		t.Errorf("Expected %q, got %q", want, b.String())
+	}
+}
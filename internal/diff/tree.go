@@ -0,0 +1,257 @@
+package diff
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// Change is one difference between two trees. Paths use "/" on every
+// platform; modes are six digits, as in "100644".
+type Change struct {
+	Status  byte // 'A'dded, 'D'eleted, 'M'odified, 'T'ype changed, 'R'enamed or 'C'opied
+	OldPath string
+	NewPath string
+	OldMode string
+	NewMode string
+	OldSHA  string
+	NewSHA  string
+	Score   int // similarity in percent of a rename or copy
+}
+
+// Path returns the path a change is best known by.
+func (c *Change) Path() string {
+	if c.NewPath != "" {
+		return c.NewPath
+	}
+	return c.OldPath
+}
+
+// treeEntry is a tree leaf with a normalized mode.
+type treeEntry struct {
+	mode string
+	typ  string
+	sha  string
+}
+
+// TreeDiff compares two trees, either of which may be "" for an empty
+// tree, and returns the changed files sorted by path. Only paths matching
+// paths are compared; nil compares everything. Identical subtrees are
+// skipped without being read.
+func TreeDiff(gitRepo *repo.GitRepository, oldTree, newTree string, paths []string) ([]Change, error) {
+	var changes []Change
+	if err := treeDiff(gitRepo, oldTree, newTree, "", paths, &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func treeDiff(gitRepo *repo.GitRepository, oldTree, newTree, prefix string, paths []string, changes *[]Change) error {
+	if oldTree == newTree {
+		return nil
+	}
+	oldEntries, err := treeEntries(gitRepo, oldTree)
+	if err != nil {
+		return err
+	}
+	newEntries, err := treeEntries(gitRepo, newTree)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(oldEntries)+len(newEntries))
+	for name := range oldEntries {
+		names = append(names, name)
+	}
+	for name := range newEntries {
+		if _, ok := oldEntries[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		full := path.Join(prefix, name)
+		o, inOld := oldEntries[name]
+		n, inNew := newEntries[name]
+		if inOld && inNew && o.sha == n.sha && o.mode == n.mode {
+			continue
+		}
+
+		oldIsTree := inOld && o.typ == "tree"
+		newIsTree := inNew && n.typ == "tree"
+		if oldIsTree || newIsTree {
+			if !PathspecDescend(paths, full) {
+				continue
+			}
+		}
+
+		switch {
+		case oldIsTree && newIsTree:
+			if err := treeDiff(gitRepo, o.sha, n.sha, full, paths, changes); err != nil {
+				return err
+			}
+			continue
+		case oldIsTree:
+			// Everything below goes away; a file may take its place
+			if err := treeDiff(gitRepo, o.sha, "", full, paths, changes); err != nil {
+				return err
+			}
+			inOld = false
+		case newIsTree:
+			if err := treeDiff(gitRepo, "", n.sha, full, paths, changes); err != nil {
+				return err
+			}
+			inNew = false
+		}
+
+		// Submodules are listed like files
+		if (!inOld && !inNew) || !PathspecMatch(paths, full) {
+			continue
+		}
+		c := Change{OldPath: full, NewPath: full, OldMode: o.mode, NewMode: n.mode, OldSHA: o.sha, NewSHA: n.sha}
+		switch {
+		case !inOld:
+			c.Status, c.OldPath, c.OldMode, c.OldSHA = 'A', "", "", ""
+		case !inNew:
+			c.Status, c.NewPath, c.NewMode, c.NewSHA = 'D', "", "", ""
+		case fileKind(o.mode) != fileKind(n.mode):
+			c.Status = 'T'
+		default:
+			c.Status = 'M'
+		}
+		*changes = append(*changes, c)
+	}
+
+	// Subtree changes were appended in name order, but a file "a" and
+	// the directory "a/" may interleave with "a.txt"
+	sort.SliceStable(*changes, func(i, j int) bool {
+		return (*changes)[i].Path() < (*changes)[j].Path()
+	})
+	return nil
+}
+
+// treeEntries reads a tree into a map by name.
+func treeEntries(gitRepo *repo.GitRepository, sha string) (map[string]treeEntry, error) {
+	entries := make(map[string]treeEntry)
+	if sha == "" {
+		return entries, nil
+	}
+	obj, err := objects.ObjectRead(gitRepo, sha)
+	if err != nil {
+		return nil, err
+	}
+	tree, ok := obj.(*objects.GitTree)
+	if !ok {
+		return nil, fmt.Errorf("object %s is not a tree", sha)
+	}
+	for _, leaf := range tree.Items {
+		typ, err := objects.TreeLeafType(leaf.Mode)
+		if err != nil {
+			return nil, err
+		}
+		entries[leaf.Path] = treeEntry{mode: fmt.Sprintf("%06s", leaf.Mode), typ: typ, sha: leaf.SHA}
+	}
+	return entries, nil
+}
+
+// fileKind tells regular files, symlinks and submodules apart; a change
+// between kinds is a type change rather than a modification.
+func fileKind(mode string) string {
+	switch mode {
+	case "120000":
+		return "symlink"
+	case "160000":
+		return "gitlink"
+	}
+	return "file"
+}
+
+// File is a file as a tree or the index records it.
+type File struct {
+	Mode string
+	SHA  string
+}
+
+// TreeFiles lists every file of a tree selected by paths, keyed by "/"
+// path.
+func TreeFiles(gitRepo *repo.GitRepository, tree string, paths []string) (map[string]File, error) {
+	changes, err := TreeDiff(gitRepo, "", tree, paths)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]File, len(changes))
+	for _, c := range changes {
+		files[c.NewPath] = File{Mode: c.NewMode, SHA: c.NewSHA}
+	}
+	return files, nil
+}
+
+// FilesDiff compares two sets of files, such as a tree's and the index's,
+// and returns the changes sorted by path.
+func FilesDiff(oldFiles, newFiles map[string]File) []Change {
+	var changes []Change
+	for p, o := range oldFiles {
+		n, ok := newFiles[p]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Status: 'D', OldPath: p, OldMode: o.Mode, OldSHA: o.SHA})
+		case o != n:
+			status := byte('M')
+			if fileKind(o.Mode) != fileKind(n.Mode) {
+				status = 'T'
+			}
+			changes = append(changes, Change{Status: status, OldPath: p, NewPath: p, OldMode: o.Mode, NewMode: n.Mode, OldSHA: o.SHA, NewSHA: n.SHA})
+		}
+	}
+	for p, n := range newFiles {
+		if _, ok := oldFiles[p]; !ok {
+			changes = append(changes, Change{Status: 'A', NewPath: p, NewMode: n.Mode, NewSHA: n.SHA})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path() < changes[j].Path()
+	})
+	return changes
+}
+
+// PathspecMatch reports whether path is selected by paths: a file named
+// by a spec, anything below a directory named by one, or a match of a
+// glob pattern. No specs select everything.
+func PathspecMatch(paths []string, p string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, spec := range paths {
+		spec = strings.TrimSuffix(spec, "/")
+		switch {
+		case spec == "" || spec == ".":
+			return true
+		case p == spec || strings.HasPrefix(p, spec+"/"):
+			return true
+		case strings.ContainsAny(spec, "*?["):
+			if ok, _ := path.Match(spec, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PathspecDescend reports whether anything below the directory dir can
+// be selected by paths.
+func PathspecDescend(paths []string, dir string) bool {
+	if PathspecMatch(paths, dir) {
+		return true
+	}
+	for _, spec := range paths {
+		if strings.HasPrefix(spec, dir+"/") || strings.ContainsAny(spec, "*?[") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package diff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// writeTree writes files, keyed by "/" path, as a tree and returns its SHA.
+// A content starting with "link:" is written as a symlink.
+func writeTree(t *testing.T, gitRepo *repo.GitRepository, files map[string]string) string {
+	t.Helper()
+	dirs := make(map[string]map[string]string)
+	tree := &objects.GitTree{}
+	for p, content := range files {
+		if dir, rest, ok := strings.Cut(p, "/"); ok {
+			if dirs[dir] == nil {
+				dirs[dir] = make(map[string]string)
+			}
+			dirs[dir][rest] = content
+			continue
+		}
+		mode := "100644"
+		if target, ok := strings.CutPrefix(content, "link:"); ok {
+			mode, content = "120000", target
+		}
+		sha, err := objects.ObjectHash(strings.NewReader(content), "blob", gitRepo)
+		if err != nil {
+			t.Fatalf("ObjectHash() failed: %v", err)
+		}
+		tree.Items = append(tree.Items, objects.GitTreeLeaf{Mode: mode, Path: p, SHA: sha})
+	}
+	for dir, sub := range dirs {
+		tree.Items = append(tree.Items, objects.GitTreeLeaf{Mode: "40000", Path: dir, SHA: writeTree(t, gitRepo, sub)})
+	}
+	sort.Slice(tree.Items, func(i, j int) bool { return tree.Items[i].Path < tree.Items[j].Path })
+	sha, err := objects.ObjectWrite(tree, gitRepo)
+	if err != nil {
+		t.Fatalf("ObjectWrite() failed: %v", err)
+	}
+	return sha
+}
+
+func TestTreeDiff(t *testing.T) {
+	gitRepo, err := repo.RepoCreate(t.TempDir())
+	if err != nil {
+		t.Fatalf("RepoCreate() failed: %v", err)
+	}
+	oldTree := writeTree(t, gitRepo, map[string]string{
+		"a":       "a\n",
+		"b":       "b\n",
+		"dir/c":   "c\n",
+		"dir/d":   "d\n",
+		"gone/e":  "e\n",
+		"link":    "a\n",
+		"same/f":  "f\n",
+		"becomes": "file\n",
+	})
+	newTree := writeTree(t, gitRepo, map[string]string{
+		"a":         "a changed\n",
+		"b":         "b\n",
+		"dir/c":     "c\n",
+		"dir/new":   "new\n",
+		"link":      "link:a",
+		"same/f":    "f\n",
+		"becomes/x": "x\n",
+	})
+
+	tests := []struct {
+		name  string
+		paths []string
+		want  string
+	}{
+		{"all", nil, "M a, D becomes, A becomes/x, D dir/d, A dir/new, D gone/e, T link"},
+		{"file", []string{"a"}, "M a"},
+		{"directory", []string{"dir"}, "D dir/d, A dir/new"},
+		{"glob", []string{"dir/*"}, "D dir/d, A dir/new"},
+		{"unchanged", []string{"same", "b"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := TreeDiff(gitRepo, oldTree, newTree, tt.paths)
+			if err != nil {
+				t.Fatalf("TreeDiff() failed: %v", err)
+			}
+			var got []string
+			for _, c := range changes {
+				got = append(got, fmt.Sprintf("%c %s", c.Status, c.Path()))
+			}
+			if strings.Join(got, ", ") != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, strings.Join(got, ", "))
+			}
+		})
+	}
+}
+
+func TestPathspecMatch(t *testing.T) {
+	tests := []struct {
+		paths []string
+		path  string
+		want  bool
+	}{
+		{nil, "a/b", true},
+		{[]string{"."}, "a/b", true},
+		{[]string{"a"}, "a/b", true},
+		{[]string{"a/"}, "a/b", true},
+		{[]string{"a"}, "ab", false},
+		{[]string{"a/b"}, "a", false},
+		{[]string{"*.go"}, "main.go", true},
+		{[]string{"*.go"}, "cmd/main.go", false},
+	}
+
+	for _, tt := range tests {
+		if got := PathspecMatch(tt.paths, tt.path); got != tt.want {
+			t.Errorf("PathspecMatch(%q, %q): expected %v, got %v", tt.paths, tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	base := "one\ntwo\nthree\nfour\n"
+	tests := []struct {
+		name     string
+		a, b     string
+		minScore int
+		want     int
+	}{
+		{"identical", base, base, 50, 100},
+		{"one line appended", base, base + "five\n", 50, 79},
+		{"nothing shared", base, "1\n2\n3\n4\n", 0, 0},
+		{"sizes too different", "a\n", base, 50, 0},
+		{"empty", "", "", 50, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Similarity([]byte(tt.a), []byte(tt.b), tt.minScore); got != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
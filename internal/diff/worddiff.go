@@ -0,0 +1,172 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WordDiff selects how a patch shows changed lines.
+type WordDiff int
+
+const (
+	WordDiffNone      WordDiff = iota // whole lines, prefixed "-" and "+"
+	WordDiffPlain                     // changed words in [-old-] and {+new+}
+	WordDiffColor                     // changed words in red and green
+	WordDiffPorcelain                 // one changed run per line, for scripts
+)
+
+// ParseWordDiff parses the mode named by --word-diff.
+func ParseWordDiff(s string) (WordDiff, error) {
+	switch s {
+	case "none":
+		return WordDiffNone, nil
+	case "plain", "":
+		return WordDiffPlain, nil
+	case "color":
+		return WordDiffColor, nil
+	case "porcelain":
+		return WordDiffPorcelain, nil
+	}
+	return WordDiffNone, fmt.Errorf("bad --word-diff mode %q: expected plain, color, porcelain or none", s)
+}
+
+const (
+	colorReset = "\033[m"
+	colorMeta  = "\033[1m"
+	colorFrag  = "\033[36m"
+	colorOld   = "\033[31m"
+	colorNew   = "\033[32m"
+)
+
+// wordStyle is how one kind of run is marked.
+type wordStyle struct{ prefix, suffix, color string }
+
+// wordStyles marks the removed, added and unchanged runs of a word diff
+// and the line breaks between them.
+type wordStyles struct {
+	old, new, ctx wordStyle
+	newline       string
+}
+
+var wordDiffStyles = map[WordDiff]wordStyles{
+	WordDiffPlain: {
+		old:     wordStyle{prefix: "[-", suffix: "-]"},
+		new:     wordStyle{prefix: "{+", suffix: "+}"},
+		newline: "\n",
+	},
+	WordDiffColor: {
+		old:     wordStyle{color: colorOld},
+		new:     wordStyle{color: colorNew},
+		newline: "\n",
+	},
+	WordDiffPorcelain: {
+		old:     wordStyle{prefix: "-", suffix: "\n"},
+		new:     wordStyle{prefix: "+", suffix: "\n"},
+		ctx:     wordStyle{prefix: " ", suffix: "\n"},
+		newline: "~\n",
+	},
+}
+
+// word is a word's place in the text it was split from.
+type word struct{ begin, end int }
+
+// wordSpace is what separates words: git's whitespace, which leaves out
+// vertical tabs and form feeds.
+const wordSpace = " \t\n\r"
+
+// splitWords splits text into runs of non-whitespace, as git does without
+// a word regex.
+func splitWords(text string) ([]word, []string) {
+	var words []word
+	var keys []string
+	for i := 0; i < len(text); {
+		if strings.IndexByte(wordSpace, text[i]) != -1 {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(text) && strings.IndexByte(wordSpace, text[j]) == -1 {
+			j++
+		}
+		words = append(words, word{i, j})
+		keys = append(keys, text[i:j])
+		i = j
+	}
+	return words, keys
+}
+
+// writeWordDiff writes the lines of a changed region, the removed lines
+// joined in minus and the added ones in plus, as a diff of their words,
+// laid out on the lines of plus.
+func writeWordDiff(b *strings.Builder, minus, plus string, st wordStyles) {
+	if plus == "" {
+		writeWords(b, st.old, st.newline, minus)
+		return
+	}
+
+	minusWords, minusKeys := splitWords(minus)
+	plusWords, plusKeys := splitWords(plus)
+	// end returns where the text of words ends before word i
+	end := func(words []word, i int) int {
+		if i == 0 {
+			return 0
+		}
+		return words[i-1].end
+	}
+
+	edits := diffLines(minusKeys, plusKeys, false)
+	current := 0
+	for i := 0; i < len(edits); {
+		if edits[i].Op == Equal {
+			i++
+			continue
+		}
+		first := edits[i]
+		minusLen, plusLen := 0, 0
+		for ; i < len(edits) && edits[i].Op != Equal; i++ {
+			if edits[i].Op == Delete {
+				minusLen++
+			} else {
+				plusLen++
+			}
+		}
+
+		minusBegin := end(minusWords, first.OldLine)
+		minusEnd := minusBegin
+		if minusLen > 0 {
+			minusBegin = minusWords[first.OldLine].begin
+			minusEnd = minusWords[first.OldLine+minusLen-1].end
+		}
+		plusBegin := end(plusWords, first.NewLine)
+		plusEnd := plusBegin
+		if plusLen > 0 {
+			plusBegin = plusWords[first.NewLine].begin
+			plusEnd = plusWords[first.NewLine+plusLen-1].end
+		}
+
+		writeWords(b, st.ctx, st.newline, plus[current:plusBegin])
+		writeWords(b, st.old, st.newline, minus[minusBegin:minusEnd])
+		writeWords(b, st.new, st.newline, plus[plusBegin:plusEnd])
+		current = plusEnd
+	}
+	writeWords(b, st.ctx, st.newline, plus[current:])
+}
+
+// writeWords writes a run of text in a style, marking each of its lines
+// separately.
+func writeWords(b *strings.Builder, st wordStyle, newline, text string) {
+	for text != "" {
+		line, rest, found := strings.Cut(text, "\n")
+		if line != "" {
+			b.WriteString(st.color + st.prefix + line + st.suffix)
+			if st.color != "" {
+				b.WriteString(colorReset)
+			}
+		}
+		if !found {
+			return
+		}
+		b.WriteString(newline)
+		text = rest
+	}
+}
@@ -0,0 +1,101 @@
+// Package grep finds the lines of files matching a pattern and prints them
+// the way git grep does.
+package grep
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// Compile turns pattern into an RE2 regexp matching a line. fixed takes
+// the pattern as a literal string, ignoreCase matches regardless of case,
+// and word only matches it at word boundaries: at the start of the line or
+// after a non-word character, and at the end or before one.
+func Compile(pattern string, fixed, ignoreCase, word bool) (*regexp.Regexp, error) {
+	if fixed {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if word {
+		pattern = `(?:^|\W)(?:` + pattern + `)(?:\W|$)`
+	}
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// Options configures what Grep prints.
+type Options struct {
+	LineNumbers   bool // prefix lines with their numbers
+	Before, After int  // lines of context around each match
+	FilesOnly     bool // only print the names of files that match
+	Count         bool // only print how many lines of each file match
+}
+
+// Grep writes the lines of data matching re to w, each prefixed with name,
+// and reports whether any matched. Matching lines are separated from their
+// name by ":", context lines by "-", and runs of lines that aren't
+// adjacent by a "--" line.
+func Grep(w io.Writer, name string, data []byte, re *regexp.Regexp, opts Options) (bool, error) {
+	lines := splitLines(data)
+	var matches []int
+	for i, line := range lines {
+		if re.Match(line) {
+			matches = append(matches, i)
+		}
+	}
+	if len(matches) == 0 {
+		return false, nil
+	}
+
+	switch {
+	case opts.FilesOnly:
+		_, err := fmt.Fprintf(w, "%s\n", name)
+		return true, err
+	case opts.Count:
+		_, err := fmt.Fprintf(w, "%s:%d\n", name, len(matches))
+		return true, err
+	}
+
+	// last is the line after the last one printed.
+	last := 0
+	for j, m := range matches {
+		start := max(m-opts.Before, last)
+		if j > 0 && start > last && (opts.Before > 0 || opts.After > 0) {
+			if _, err := io.WriteString(w, "--\n"); err != nil {
+				return true, err
+			}
+		}
+		end := min(m+opts.After+1, len(lines))
+		if j+1 < len(matches) {
+			end = min(end, matches[j+1])
+		}
+		for i := start; i < end; i++ {
+			sep := "-"
+			if i == m {
+				sep = ":"
+			}
+			prefix := name + sep
+			if opts.LineNumbers {
+				prefix += fmt.Sprintf("%d%s", i+1, sep)
+			}
+			if _, err := fmt.Fprintf(w, "%s%s\n", prefix, lines[i]); err != nil {
+				return true, err
+			}
+		}
+		last = end
+	}
+	return true, nil
+}
+
+// splitLines splits data into lines without their newlines. A final line
+// without one is a line too.
+func splitLines(data []byte) [][]byte {
+	lines := bytes.Split(data, []byte("\n"))
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
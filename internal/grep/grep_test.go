@@ -0,0 +1,76 @@
+package grep
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		pattern                 string
+		fixed, ignoreCase, word bool
+		line                    string
+		want                    bool
+	}{
+		{"fo+", false, false, false, "a foo", true},
+		{"fo+", true, false, false, "a foo", false},
+		{"fo+", true, false, false, "a fo+", true},
+		{"FOO", false, true, false, "a foo", true},
+		{"foo", false, false, true, "food", false},
+		{"foo", false, false, true, "(foo)", true},
+		{"foo", false, false, true, "foo", true},
+		{"(foo)", true, false, true, "x (foo) y", true},
+		{"x.foo", true, false, true, "xyfoo", false},
+	}
+
+	for _, tt := range tests {
+		re, err := Compile(tt.pattern, tt.fixed, tt.ignoreCase, tt.word)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.pattern, err)
+		}
+		if got := re.MatchString(tt.line); got != tt.want {
+			t.Errorf("Compile(%q, fixed=%v, ignoreCase=%v, word=%v) on %q: expected %v, got %v",
+				tt.pattern, tt.fixed, tt.ignoreCase, tt.word, tt.line, tt.want, got)
+		}
+	}
+}
+
+func TestGrep(t *testing.T) {
+	data := []byte("one\nfoo two\nthree\nfour\nfive\nsix foo\nseven\nfoo eight")
+	re, err := Compile("foo", false, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{"plain", Options{}, "f:foo two\nf:six foo\nf:foo eight\n"},
+		{"line numbers", Options{LineNumbers: true}, "f:2:foo two\nf:6:six foo\nf:8:foo eight\n"},
+		{"files only", Options{FilesOnly: true}, "f\n"},
+		{"count", Options{Count: true}, "f:3\n"},
+		{"context", Options{Before: 1, After: 1}, "f-one\nf:foo two\nf-three\n--\nf-five\nf:six foo\nf-seven\nf:foo eight\n"},
+		{"after", Options{After: 2, LineNumbers: true}, "f:2:foo two\nf-3-three\nf-4-four\n--\nf:6:six foo\nf-7-seven\nf:8:foo eight\n"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		matched, err := Grep(&buf, "f", data, re, tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !matched {
+			t.Errorf("%s: expected a match", tt.name)
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+
+	var buf bytes.Buffer
+	if matched, _ := Grep(&buf, "f", []byte("nothing\n"), re, Options{}); matched || buf.Len() != 0 {
+		t.Errorf("Expected no match, got %q", buf.String())
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"os/user"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -47,6 +48,13 @@ func gitignoreParse(reader io.Reader) []gitignoreRule {
 type GitIgnore struct {
 	Absolute []gitignoreRule
 	Scoped   map[string][]gitignoreRule // Key is the directory path
+	Command  []gitignoreRule            // Patterns given on the command line
+}
+
+// AddExcludes adds command line exclude patterns, which take precedence
+// over every ignore file.
+func (rules *GitIgnore) AddExcludes(patterns []string) {
+	rules.Command = append(rules.Command, gitignoreParse(strings.NewReader(strings.Join(patterns, "\n")))...)
 }
 
 func GitignoreRead(gitRepo *repo.GitRepository) (*GitIgnore, error) {
@@ -87,7 +95,7 @@ func GitignoreRead(gitRepo *repo.GitRepository) (*GitIgnore, error) {
 			data, _ := blob.Serialize()
 			reader := bytes.NewReader(data)
 			rules := gitignoreParse(reader)
-			dirName := filepath.Dir(entry.Name)
+			dirName := filepath.ToSlash(filepath.Dir(entry.Name))
 			// For root .gitignore, dirname is "."
 			if dirName == "." {
 				dirName = ""
@@ -99,39 +107,107 @@ func GitignoreRead(gitRepo *repo.GitRepository) (*GitIgnore, error) {
 	return ignore, nil
 }
 
-// CheckIgnore checks if a path should be ignored.
+// CheckIgnore checks if a path should be ignored. A path below an
+// ignored directory is ignored too.
 func CheckIgnore(rules *GitIgnore, path string) bool {
+	return checkIgnore(rules, path, false)
+}
+
+// CheckIgnoreDir is CheckIgnore for a directory, which patterns with a
+// trailing slash match too.
+func CheckIgnoreDir(rules *GitIgnore, path string) bool {
+	return checkIgnore(rules, path, true)
+}
+
+func checkIgnore(rules *GitIgnore, path string, isDir bool) bool {
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	for i := 1; i < len(parts); i++ {
+		if rules.ignored(parts[:i], true) {
+			return true
+		}
+	}
+	return rules.ignored(parts, isDir)
+}
+
+// ignored reports whether the rules ignore the path made of parts, without
+// looking at the directories holding it.
+func (rules *GitIgnore) ignored(parts []string, isDir bool) bool {
 	// A path is ignored if it matches a pattern, unless it also matches
 	// a later negation pattern.
+	p := strings.Join(parts, "/")
 	ignored := false
 
 	// Absolute rules (global, info/exclude) have the lowest precedence.
 	for _, rule := range rules.Absolute {
-		// filepath.Match handles glob patterns like *.c
-		if matched, _ := filepath.Match(rule.Pattern, path); matched {
+		if rule.match("", p, isDir) {
 			ignored = !rule.Negate
 		}
 	}
 
 	// Scoped rules (.gitignore files) have higher precedence.
-	// We check from the root down to the file's directory.
-	dir := ""
-	parts := strings.Split(path, string(os.PathSeparator))
-	for i := 0; i < len(parts)-1; i++ {
-		if scopedRules, ok := rules.Scoped[dir]; ok {
-			for _, rule := range scopedRules {
-				// We need to match the pattern against the full path.
-				// Git's behavior here is complex. For simplicity, we'll
-				// assume patterns in subdirectories are relative to that dir.
-				// A proper implementation is much more involved.
-				fullPattern := filepath.Join(dir, rule.Pattern)
-				if matched, _ := filepath.Match(fullPattern, path); matched {
-					ignored = !rule.Negate
-				}
+	// We check from the root down to the path's directory.
+	for i := 0; i < len(parts); i++ {
+		dir := strings.Join(parts[:i], "/")
+		for _, rule := range rules.Scoped[dir] {
+			if rule.match(dir, p, isDir) {
+				ignored = !rule.Negate
 			}
 		}
-		dir = filepath.Join(dir, parts[i])
+	}
+
+	// Command line patterns beat them all.
+	for _, rule := range rules.Command {
+		if rule.match("", p, isDir) {
+			ignored = !rule.Negate
+		}
 	}
 
 	return ignored
 }
+
+// match reports whether the rule, read from the .gitignore of dir, matches
+// the path p. A pattern without a slash matches the name of a file or
+// directory at any depth; one with a slash matches the path relative to
+// dir, where "**" matches any number of directories. A trailing slash
+// only matches directories.
+func (rule gitignoreRule) match(dir, p string, isDir bool) bool {
+	pattern := rule.Pattern
+	if strings.HasSuffix(pattern, "/") {
+		if !isDir {
+			return false
+		}
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	rel := p
+	if dir != "" {
+		rel = strings.TrimPrefix(p, dir+"/")
+	}
+	if !strings.Contains(pattern, "/") {
+		matched, _ := path.Match(pattern, path.Base(rel))
+		return matched
+	}
+	return globMatch(strings.Split(strings.TrimPrefix(pattern, "/"), "/"), strings.Split(rel, "/"))
+}
+
+// globMatch matches path components against pattern components, where a
+// "**" component matches any number of path components.
+func globMatch(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if globMatch(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(pattern[0], parts[0]); !matched {
+		return false
+	}
+	return globMatch(pattern[1:], parts[1:])
+}
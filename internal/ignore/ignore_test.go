@@ -0,0 +1,75 @@
+package ignore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckIgnore(t *testing.T) {
+	rules := &GitIgnore{
+		Absolute: gitignoreParse(strings.NewReader("*.swp\n")),
+		Scoped: map[string][]gitignoreRule{
+			"":    gitignoreParse(strings.NewReader("*.log\n!keep.log\nbuild/\n/top\ndocs/**/*.tmp\n")),
+			"sub": gitignoreParse(strings.NewReader("local\n!*.swp\n")),
+		},
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"x.log", true},
+		{"deep/down/x.log", true},
+		{"keep.log", false},
+		{"build/out.o", true},
+		{"build", false}, // a file, not the directory
+		{"top", true},
+		{"sub/top", false},
+		{"docs/a/b/x.tmp", true},
+		{"docs/x.tmp", true},
+		{"x.tmp", false},
+		{"a.swp", true},
+		{"sub/a.swp", false},
+		{"sub/local", true},
+		{"local", false},
+		{"main.go", false},
+	}
+
+	for _, tt := range tests {
+		if got := CheckIgnore(rules, tt.path); got != tt.want {
+			t.Errorf("CheckIgnore(%q): expected %v, got %v", tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestCheckIgnore_Command(t *testing.T) {
+	rules := &GitIgnore{
+		Scoped: map[string][]gitignoreRule{
+			"": gitignoreParse(strings.NewReader("*.log\nbuild/\n")),
+		},
+	}
+	rules.AddExcludes([]string{"!keep.log", "*.tmp"})
+
+	tests := []struct {
+		path string
+		dir  bool
+		want bool
+	}{
+		{"x.log", false, true},
+		{"keep.log", false, false},
+		{"x.tmp", false, true},
+		{"build", false, false},
+		{"build", true, true},
+		{"src", true, false},
+	}
+
+	for _, tt := range tests {
+		got := CheckIgnore(rules, tt.path)
+		if tt.dir {
+			got = CheckIgnoreDir(rules, tt.path)
+		}
+		if got != tt.want {
+			t.Errorf("CheckIgnore(%q, dir=%v): expected %v, got %v", tt.path, tt.dir, tt.want, got)
+		}
+	}
+}
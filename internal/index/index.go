@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/Notwinner0/gvcs/internal/lockfile"
 	"github.com/Notwinner0/gvcs/internal/repo"
 )
 
@@ -31,6 +32,64 @@ type GitIndexEntry struct {
 type GitIndex struct {
 	Version uint32
 	Entries []*GitIndexEntry
+	lock    *lockfile.Lockfile // held from IndexLock until IndexWrite or Unlock
+}
+
+// IndexLock takes index.lock and then reads the index, so that no other
+// process can change it between the read and the IndexWrite that commits
+// the update. Callers that may return without writing should defer Unlock.
+func IndexLock(gitRepo *repo.GitRepository) (*GitIndex, error) {
+	lock, err := lockfile.Acquire(repo.RepoPath(gitRepo, "index"), repo.RepoFsync(gitRepo, "index"))
+	if err != nil {
+		return nil, err
+	}
+	index, err := IndexRead(gitRepo)
+	if err != nil {
+		lock.Rollback()
+		return nil, err
+	}
+	index.lock = lock
+	return index, nil
+}
+
+// Unlock releases the lock taken by IndexLock without writing the index.
+// It does nothing once the index has been written.
+func (index *GitIndex) Unlock() {
+	if index.lock != nil {
+		index.lock.Rollback()
+		index.lock = nil
+	}
+}
+
+// Merge stages of an entry. A path left conflicted by a merge has an entry
+// for each side that has it instead of one at stage 0.
+const (
+	StageMerged = 0
+	StageBase   = 1
+	StageOurs   = 2
+	StageTheirs = 3
+)
+
+// Stage returns the merge stage of the entry, from bits 12-13 of its flags.
+func (e *GitIndexEntry) Stage() int {
+	return int(e.Flags>>12) & 3
+}
+
+// SetStage sets the merge stage of the entry.
+func (e *GitIndexEntry) SetStage(stage int) {
+	e.Flags = e.Flags&^0x3000 | uint16(stage&3)<<12
+}
+
+// Unmerged returns the names of the paths with entries in a merge stage,
+// in index order.
+func (index *GitIndex) Unmerged() []string {
+	var names []string
+	for _, e := range index.Entries {
+		if e.Stage() != StageMerged && (len(names) == 0 || names[len(names)-1] != e.Name) {
+			names = append(names, e.Name)
+		}
+	}
+	return names
 }
 
 // IndexRead reads and parses the index file from the repository.
@@ -103,6 +162,9 @@ func IndexRead(gitRepo *repo.GitRepository) (*GitIndex, error) {
 	return index, nil
 }
 
+// IndexWrite writes the index. An index returned by IndexLock is committed
+// through the lock it holds; otherwise index.lock is taken just for the
+// write.
 func IndexWrite(gitRepo *repo.GitRepository, index *GitIndex) error {
 	// Build index in-memory first so we can compute checksum.
 	var buf bytes.Buffer
@@ -195,10 +257,15 @@ func IndexWrite(gitRepo *repo.GitRepository, index *GitIndex) error {
 	sum := sha1.Sum(content)
 	final := append(content, sum[:]...)
 
-	// Atomically write the final index file.
-	if err := os.WriteFile(repo.RepoPath(gitRepo, "index"), final, 0644); err != nil {
-		return err
+	// Atomically write the final index file through index.lock, so a
+	// concurrent writer fails instead of corrupting it.
+	if lock := index.lock; lock != nil {
+		index.lock = nil
+		if _, err := lock.Write(final); err != nil {
+			lock.Rollback()
+			return err
+		}
+		return lock.Commit()
 	}
-
-	return nil
+	return lockfile.WriteFile(repo.RepoPath(gitRepo, "index"), final, repo.RepoFsync(gitRepo, "index"))
 }
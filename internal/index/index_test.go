@@ -0,0 +1,56 @@
+package index
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/Notwinner0/gvcs/internal/lockfile"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+const testSHA = "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"
+
+func TestIndexLock(t *testing.T) {
+	gitRepo, err := repo.RepoCreate(t.TempDir())
+	if err != nil {
+		t.Fatalf("RepoCreate() failed: %v", err)
+	}
+	lockPath := repo.RepoPath(gitRepo, "index") + ".lock"
+
+	idx, err := IndexLock(gitRepo)
+	if err != nil {
+		t.Fatalf("IndexLock() failed: %v", err)
+	}
+	// A second read-modify-write must wait for the first one
+	if _, err := IndexLock(gitRepo); !errors.Is(err, lockfile.ErrLocked) {
+		t.Errorf("Expected a second IndexLock() to fail with ErrLocked, got %v", err)
+	}
+	if err := IndexWrite(gitRepo, &GitIndex{Version: 2}); !errors.Is(err, lockfile.ErrLocked) {
+		t.Errorf("Expected an unlocked IndexWrite() to fail with ErrLocked, got %v", err)
+	}
+
+	idx.Entries = append(idx.Entries, &GitIndexEntry{Mode: 0100644, SHA: testSHA, Name: "a.txt"})
+	if err := IndexWrite(gitRepo, idx); err != nil {
+		t.Fatalf("IndexWrite() failed: %v", err)
+	}
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("Expected IndexWrite() to release the lock")
+	}
+	// Unlock after the write must not remove a lock taken since
+	other, err := IndexLock(gitRepo)
+	if err != nil {
+		t.Fatalf("IndexLock() after the write failed: %v", err)
+	}
+	idx.Unlock()
+	if _, err := os.Stat(lockPath); err != nil {
+		t.Errorf("Expected the new lock to survive a stale Unlock(): %v", err)
+	}
+	if len(other.Entries) != 1 || other.Entries[0].Name != "a.txt" {
+		t.Errorf("Expected the locked read to see the written entry, got %+v", other.Entries)
+	}
+	other.Unlock()
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("Expected Unlock() to release the lock")
+	}
+}
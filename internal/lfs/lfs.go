@@ -0,0 +1,214 @@
+package lfs
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+const (
+	pointerVersion = "https://git-lfs.github.com/spec/v1"
+	// PointerMaxSize bounds how much of a blob is inspected when looking
+	// for a pointer; real pointers are well under 200 bytes.
+	PointerMaxSize = 1024
+)
+
+var oidRE = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Pointer is the small text blob stored in place of a large file.
+type Pointer struct {
+	Oid  string // hex SHA-256 of the content
+	Size int64
+}
+
+// Encode returns the canonical pointer file contents.
+func (p *Pointer) Encode() []byte {
+	return []byte(fmt.Sprintf("version %s\noid sha256:%s\nsize %d\n", pointerVersion, p.Oid, p.Size))
+}
+
+// PointerParse parses the contents of a pointer blob.
+func PointerParse(data []byte) (*Pointer, error) {
+	if len(data) > PointerMaxSize {
+		return nil, errors.New("not an lfs pointer: too large")
+	}
+
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		space := strings.IndexByte(line, ' ')
+		if space == -1 {
+			return nil, errors.New("not an lfs pointer: missing space")
+		}
+		fields[line[:space]] = line[space+1:]
+	}
+
+	if fields["version"] != pointerVersion {
+		return nil, errors.New("not an lfs pointer: bad version")
+	}
+	oid := strings.TrimPrefix(fields["oid"], "sha256:")
+	if !oidRE.MatchString(oid) {
+		return nil, fmt.Errorf("invalid lfs pointer oid %q", fields["oid"])
+	}
+	size, err := strconv.ParseInt(fields["size"], 10, 64)
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("invalid lfs pointer size %q", fields["size"])
+	}
+	return &Pointer{Oid: oid, Size: size}, nil
+}
+
+// ObjectPath returns where the content for oid lives in the local store.
+func ObjectPath(gitRepo *repo.GitRepository, oid string) string {
+	return repo.RepoPath(gitRepo, "lfs", "objects", oid[0:2], oid[2:4], oid)
+}
+
+// ObjectExists reports whether the content for oid is in the local store.
+func ObjectExists(gitRepo *repo.GitRepository, oid string) bool {
+	_, err := os.Stat(ObjectPath(gitRepo, oid))
+	return err == nil
+}
+
+// Clean streams r into the local store and returns the pointer that should
+// be committed in its place. With a nil repository, only the pointer is
+// computed.
+func Clean(gitRepo *repo.GitRepository, r io.Reader) (*Pointer, error) {
+	h := sha256.New()
+	if gitRepo == nil {
+		size, err := io.Copy(h, r)
+		if err != nil {
+			return nil, err
+		}
+		return &Pointer{Oid: hex.EncodeToString(h.Sum(nil)), Size: size}, nil
+	}
+
+	tmp, err := tempFile(gitRepo, "clean_*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Pointer{Oid: hex.EncodeToString(h.Sum(nil)), Size: size}
+	if ObjectExists(gitRepo, p.Oid) {
+		return p, nil
+	}
+	dest, err := repo.RepoFile(gitRepo, true, "lfs", "objects", p.Oid[0:2], p.Oid[2:4], p.Oid)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Smudge writes the content described by p to w, downloading it through the
+// configured transfer backend if it is not in the local store.
+func Smudge(gitRepo *repo.GitRepository, p *Pointer, w io.Writer) error {
+	if !ObjectExists(gitRepo, p.Oid) {
+		if err := Fetch(gitRepo, p); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Open(ObjectPath(gitRepo, p.Oid))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := io.Copy(w, f)
+	if err != nil {
+		return err
+	}
+	if n != p.Size {
+		return fmt.Errorf("lfs object %s: expected %d bytes, got %d", p.Oid, p.Size, n)
+	}
+	return nil
+}
+
+// Fetch downloads the content for p into the local store, verifying its
+// hash before it becomes visible.
+func Fetch(gitRepo *repo.GitRepository, p *Pointer) error {
+	transfer, err := TransferFor(gitRepo)
+	if err != nil {
+		return err
+	}
+	if transfer == nil {
+		return fmt.Errorf("lfs object %s is missing and no lfs.url is configured", p.Oid)
+	}
+
+	tmp, err := tempFile(gitRepo, "fetch_*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	err = transfer.Download(p.Oid, p.Size, io.MultiWriter(tmp, h))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != p.Oid {
+		return fmt.Errorf("lfs object %s: downloaded content hashes to %s", p.Oid, got)
+	}
+
+	dest, err := repo.RepoFile(gitRepo, true, "lfs", "objects", p.Oid[0:2], p.Oid[2:4], p.Oid)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+// tempFile creates a scratch file next to the store so that finished
+// objects can be renamed into place.
+func tempFile(gitRepo *repo.GitRepository, pattern string) (*os.File, error) {
+	dir := repo.RepoPath(gitRepo, "lfs", "tmp")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(dir, pattern)
+}
+
+// ObjectList returns the oids of every object in the local store.
+func ObjectList(gitRepo *repo.GitRepository) ([]string, error) {
+	var oids []string
+	root := repo.RepoPath(gitRepo, "lfs", "objects")
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() && oidRE.MatchString(info.Name()) {
+			oids = append(oids, info.Name())
+		}
+		return nil
+	})
+	return oids, err
+}
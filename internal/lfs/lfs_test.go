@@ -0,0 +1,109 @@
+package lfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestPointer_RoundTrip(t *testing.T) {
+	original := &Pointer{
+		Oid:  "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393",
+		Size: 12345,
+	}
+
+	encoded := original.Encode()
+	want := "version https://git-lfs.github.com/spec/v1\noid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\nsize 12345\n"
+	if string(encoded) != want {
+		t.Errorf("Expected %q, got %q", want, string(encoded))
+	}
+
+	parsed, err := PointerParse(encoded)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if *parsed != *original {
+		t.Errorf("Round trip failed: expected %+v, got %+v", original, parsed)
+	}
+}
+
+func TestPointerParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "plain content", data: "Hello, World!\n"},
+		{name: "wrong version", data: "version https://example.com/v2\noid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\nsize 1\n"},
+		{name: "short oid", data: "version https://git-lfs.github.com/spec/v1\noid sha256:4d7a\nsize 1\n"},
+		{name: "negative size", data: "version https://git-lfs.github.com/spec/v1\noid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\nsize -1\n"},
+		{name: "too large", data: string(make([]byte, PointerMaxSize+1))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := PointerParse([]byte(tt.data)); err == nil {
+				t.Errorf("Expected an error for %q", tt.name)
+			}
+		})
+	}
+}
+
+func TestClean_NoRepository(t *testing.T) {
+	content := []byte("large binary asset")
+	sum := sha256.Sum256(content)
+
+	p, err := Clean(nil, bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if p.Oid != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected oid %s, got %s", hex.EncodeToString(sum[:]), p.Oid)
+	}
+	if p.Size != int64(len(content)) {
+		t.Errorf("Expected size %d, got %d", len(content), p.Size)
+	}
+}
+
+func TestLocalTransfer(t *testing.T) {
+	transfer := &LocalTransfer{Dir: t.TempDir()}
+	content := []byte("content stored on the fake remote")
+	sum := sha256.Sum256(content)
+	oid := hex.EncodeToString(sum[:])
+
+	exists, err := transfer.Exists(oid)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if exists {
+		t.Errorf("Expected %s to be missing before upload", oid)
+	}
+
+	if err := transfer.Upload(oid, int64(len(content)), bytes.NewReader(content)); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+
+	exists, err = transfer.Exists(oid)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !exists {
+		t.Errorf("Expected %s to exist after upload", oid)
+	}
+
+	var buf bytes.Buffer
+	if err := transfer.Download(oid, int64(len(content)), &buf); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), content) {
+		t.Errorf("Expected %q, got %q", content, buf.Bytes())
+	}
+
+	// A size mismatch must be reported rather than silently accepted
+	if err := transfer.Download(oid, int64(len(content))+1, &bytes.Buffer{}); err == nil {
+		t.Errorf("Expected an error for a short download")
+	}
+	if err := transfer.Upload(oid, 1, bytes.NewReader(content)); err == nil {
+		t.Errorf("Expected an error for an upload of the wrong size")
+	}
+}
@@ -0,0 +1,133 @@
+package lfs
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// Transfer moves LFS content between the local store and a remote.
+type Transfer interface {
+	Download(oid string, size int64, w io.Writer) error
+	Upload(oid string, size int64, r io.Reader) error
+	Exists(oid string) (bool, error)
+}
+
+// TransferFactory builds a Transfer for a configured lfs.url.
+type TransferFactory func(rawURL string) (Transfer, error)
+
+var transfers = map[string]TransferFactory{
+	"file": func(rawURL string) (Transfer, error) {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		return &LocalTransfer{Dir: filepath.FromSlash(u.Path)}, nil
+	},
+}
+
+// RegisterTransfer makes a backend available for lfs.url values using the
+// given URL scheme.
+func RegisterTransfer(scheme string, factory TransferFactory) {
+	transfers[scheme] = factory
+}
+
+// TransferFor returns the backend configured by lfs.url, or nil if none is.
+// A bare filesystem path selects the local directory backend.
+func TransferFor(gitRepo *repo.GitRepository) (Transfer, error) {
+	rawURL, err := gitRepo.Conf.Get("lfs", "url")
+	if err != nil || rawURL == "" {
+		return nil, nil
+	}
+
+	i := strings.Index(rawURL, "://")
+	if i == -1 {
+		return &LocalTransfer{Dir: rawURL}, nil
+	}
+	scheme := rawURL[:i]
+
+	factory, ok := transfers[scheme]
+	if !ok {
+		return nil, fmt.Errorf("unsupported lfs transfer scheme %s", scheme)
+	}
+	return factory(rawURL)
+}
+
+// LocalTransfer is a Transfer backed by a plain directory using the same
+// layout as the local store. It stands in for a server in tests and can be
+// pointed at a shared network drive.
+type LocalTransfer struct {
+	Dir string
+}
+
+func (t *LocalTransfer) path(oid string) string {
+	return filepath.Join(t.Dir, oid[0:2], oid[2:4], oid)
+}
+
+func (t *LocalTransfer) Download(oid string, size int64, w io.Writer) error {
+	f, err := os.Open(t.path(oid))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := io.Copy(w, f)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("lfs object %s: expected %d bytes, got %d", oid, size, n)
+	}
+	return nil
+}
+
+func (t *LocalTransfer) Upload(oid string, size int64, r io.Reader) error {
+	dest := t.path(oid)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "upload_*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("lfs object %s: expected %d bytes, got %d", oid, size, n)
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+func (t *LocalTransfer) Exists(oid string) (bool, error) {
+	_, err := os.Stat(t.path(oid))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Push uploads the content for p unless the remote already has it.
+func Push(gitRepo *repo.GitRepository, transfer Transfer, p *Pointer) error {
+	exists, err := transfer.Exists(p.Oid)
+	if err != nil || exists {
+		return err
+	}
+	f, err := os.Open(ObjectPath(gitRepo, p.Oid))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return transfer.Upload(p.Oid, p.Size, f)
+}
@@ -0,0 +1,107 @@
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrLocked is matched by the error returned when a lock is already held.
+var ErrLocked = errors.New("lock is held by another process")
+
+// LockError reports that a lock file could not be created because it
+// already exists.
+type LockError struct {
+	Path string // the .lock file
+}
+
+func (e *LockError) Error() string {
+	return fmt.Sprintf("unable to create '%s': File exists.\n\n"+
+		"Another gvcs process seems to be running in this repository.\n"+
+		"If it crashed, remove the file manually to continue.", e.Path)
+}
+
+func (e *LockError) Unwrap() error {
+	return ErrLocked
+}
+
+// Lockfile guards an update of a file the way git does: the new content is
+// written to "<path>.lock", which is exclusively created, and renamed over
+// the original on Commit.
+type Lockfile struct {
+	Path  string // the file being updated
+	Fsync bool   // flush the new content to disk before renaming it
+	f     *os.File
+}
+
+// Acquire creates the lock file for path, failing with a *LockError if
+// another process holds it.
+func Acquire(path string, fsync bool) (*Lockfile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, &LockError{Path: path + ".lock"}
+		}
+		return nil, err
+	}
+	return &Lockfile{Path: path, Fsync: fsync, f: f}, nil
+}
+
+func (l *Lockfile) Write(p []byte) (int, error) {
+	return l.f.Write(p)
+}
+
+// Commit makes the written content visible by renaming the lock file over
+// the original.
+func (l *Lockfile) Commit() error {
+	if l.Fsync {
+		if err := l.f.Sync(); err != nil {
+			l.Rollback()
+			return err
+		}
+	}
+	if err := l.f.Close(); err != nil {
+		os.Remove(l.f.Name())
+		return err
+	}
+	if err := os.Rename(l.f.Name(), l.Path); err != nil {
+		os.Remove(l.f.Name())
+		return err
+	}
+	if l.Fsync {
+		syncDir(filepath.Dir(l.Path))
+	}
+	return nil
+}
+
+// Rollback releases the lock and leaves the original file untouched.
+func (l *Lockfile) Rollback() error {
+	l.f.Close()
+	return os.Remove(l.f.Name())
+}
+
+// syncDir flushes a directory entry after a rename. Not every platform
+// supports this, so failures are ignored.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// WriteFile atomically replaces path with data under its lock.
+func WriteFile(path string, data []byte, fsync bool) error {
+	lock, err := Acquire(path, fsync)
+	if err != nil {
+		return err
+	}
+	if _, err := lock.Write(data); err != nil {
+		lock.Rollback()
+		return err
+	}
+	return lock.Commit()
+}
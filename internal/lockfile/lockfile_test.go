@@ -0,0 +1,90 @@
+package lockfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLockfile_Commit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+
+	lock, err := Acquire(path, true)
+	if err != nil {
+		t.Fatalf("Acquire() failed: %v", err)
+	}
+	if _, err := lock.Write([]byte("new")); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+
+	// The original stays intact until the lock is committed
+	data, _ := os.ReadFile(path)
+	if string(data) != "old" {
+		t.Errorf("Expected %q before commit, got %q", "old", string(data))
+	}
+
+	if err := lock.Commit(); err != nil {
+		t.Fatalf("Commit() failed: %v", err)
+	}
+	data, _ = os.ReadFile(path)
+	if string(data) != "new" {
+		t.Errorf("Expected %q after commit, got %q", "new", string(data))
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("Expected the lock file to be gone after commit")
+	}
+}
+
+func TestLockfile_Rollback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "HEAD")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+
+	lock, err := Acquire(path, false)
+	if err != nil {
+		t.Fatalf("Acquire() failed: %v", err)
+	}
+	lock.Write([]byte("new"))
+	if err := lock.Rollback(); err != nil {
+		t.Fatalf("Rollback() failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "old" {
+		t.Errorf("Expected %q after rollback, got %q", "old", string(data))
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("Expected the lock file to be gone after rollback")
+	}
+}
+
+func TestLockfile_Contention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "refs", "heads", "master")
+
+	first, err := Acquire(path, false)
+	if err != nil {
+		t.Fatalf("Acquire() failed: %v", err)
+	}
+	defer first.Rollback()
+
+	_, err = Acquire(path, false)
+	if err == nil {
+		t.Fatalf("Expected the second Acquire() to fail")
+	}
+	if !errors.Is(err, ErrLocked) {
+		t.Errorf("Expected ErrLocked, got %v", err)
+	}
+	var lockErr *LockError
+	if !errors.As(err, &lockErr) || lockErr.Path != path+".lock" {
+		t.Errorf("Expected a *LockError for %s, got %v", path+".lock", err)
+	}
+
+	if err := WriteFile(path, []byte("sha\n"), false); !errors.Is(err, ErrLocked) {
+		t.Errorf("Expected WriteFile() to respect the held lock, got %v", err)
+	}
+}
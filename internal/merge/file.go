@@ -0,0 +1,284 @@
+// Package merge combines the changes two sides made to a common ancestor,
+// for files and whole trees.
+package merge
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/diff"
+)
+
+// MarkerSize is the length of the runs of "<", "=" and ">" that mark a
+// conflict.
+const MarkerSize = 7
+
+// Labels name the sides of a merge in conflict markers.
+type Labels struct {
+	Ours, Theirs string
+}
+
+// Modes of a region of the merge result.
+const (
+	regionConflict = iota
+	regionOurs     // changed by ours only
+	regionTheirs   // changed by theirs only
+	regionSame     // a conflict that turned out to be the same change
+)
+
+// region is a part of the merge: the lines [b, bEnd) of the base and what
+// each side has in their place.
+type region struct {
+	mode    int
+	b, bEnd int
+	o, oEnd int
+	t, tEnd int
+}
+
+// File merges the changes ours and theirs made to base, line by line, as
+// git does. Changes to the same or adjacent lines conflict unless they are
+// identical; a conflict is narrowed to the lines that really differ, and
+// conflicts no more than three lines apart are joined. Each conflict is
+// written between "<<<<<<<", "=======" and ">>>>>>>" markers; File reports
+// whether there were any.
+func File(base, ours, theirs []byte, labels Labels) ([]byte, bool) {
+	b, o, t := splitLines(base), splitLines(ours), splitLines(theirs)
+	regions := mergeRegions(hunks(b, o), hunks(b, t), o, t, len(b))
+	regions = refineConflicts(regions, o, t)
+	regions = joinConflicts(regions)
+
+	var out strings.Builder
+	conflict := false
+	i := 0
+	for _, r := range regions {
+		switch r.mode {
+		case regionSame:
+			continue
+		case regionOurs:
+			writeLines(&out, o[i:r.oEnd], false, false)
+		case regionTheirs:
+			writeLines(&out, o[i:r.o], false, false)
+			writeLines(&out, t[r.t:r.tEnd], false, false)
+		case regionConflict:
+			conflict = true
+			cr := needsCR(b, o, t, r)
+			eol := "\n"
+			if cr {
+				eol = "\r\n"
+			}
+			writeLines(&out, o[i:r.o], false, false)
+			out.WriteString(marker('<', labels.Ours) + eol)
+			writeLines(&out, o[r.o:r.oEnd], true, cr)
+			out.WriteString(strings.Repeat("=", MarkerSize) + eol)
+			writeLines(&out, t[r.t:r.tEnd], true, cr)
+			out.WriteString(marker('>', labels.Theirs) + eol)
+		}
+		i = r.oEnd
+	}
+	writeLines(&out, o[i:], false, false)
+	return []byte(out.String()), conflict
+}
+
+// hunk is a change from the base to one side: base lines [b, bEnd) became
+// the side's lines [s, sEnd).
+type hunk struct {
+	b, bEnd, s, sEnd int
+}
+
+// hunks returns the changes turning base into side.
+func hunks(base, side []string) []hunk {
+	var result []hunk
+	for _, h := range diff.Hunks(diff.LinesPlain(base, side), 0) {
+		result = append(result, hunk{h.OldStart, h.OldStart + h.OldCount, h.NewStart, h.NewStart + h.NewCount})
+	}
+	return result
+}
+
+// mergeRegions walks the changes of both sides in order of the base,
+// finding where each lands in the other side through the unchanged lines
+// around it. Changes that overlap or touch in the base conflict, unless
+// they replace the same lines with the same text. baseLen is the number of
+// base lines.
+func mergeRegions(ours, theirs []hunk, o, t []string, baseLen int) []region {
+	var regions []region
+	add := func(r region) {
+		// A region overlapping the last one joins it, as a conflict if
+		// they came from different sides
+		if n := len(regions); n > 0 {
+			last := &regions[n-1]
+			if r.o <= last.oEnd || r.t <= last.tEnd {
+				if r.mode != last.mode {
+					last.mode = regionConflict
+				}
+				last.bEnd, last.oEnd, last.tEnd = r.bEnd, r.oEnd, r.tEnd
+				return
+			}
+		}
+		regions = append(regions, r)
+	}
+
+	i, j := 0, 0
+	for i < len(ours) && j < len(theirs) {
+		x, y := ours[i], theirs[j]
+		if x.bEnd < y.b {
+			at := y.s - y.b + x.b
+			add(region{regionOurs, x.b, x.bEnd, x.s, x.sEnd, at, at + x.bEnd - x.b})
+			i++
+			continue
+		}
+		if y.bEnd < x.b {
+			at := x.s - x.b + y.b
+			add(region{regionTheirs, y.b, y.bEnd, at, at + y.bEnd - y.b, y.s, y.sEnd})
+			j++
+			continue
+		}
+
+		if x.b != y.b || x.bEnd != y.bEnd || !slices.Equal(o[x.s:x.sEnd], t[y.s:y.sEnd]) {
+			// Widen both sides to the base lines either one changed
+			r := region{mode: regionConflict, b: x.b, o: x.s, t: y.s}
+			if off := x.b - y.b; off > 0 {
+				r.b -= off
+				r.o -= off
+			} else {
+				r.t += off
+			}
+			r.bEnd, r.oEnd, r.tEnd = x.bEnd, x.sEnd, y.sEnd
+			if ffo := x.bEnd - y.bEnd; ffo < 0 {
+				r.bEnd -= ffo
+				r.oEnd -= ffo
+			} else {
+				r.tEnd += ffo
+			}
+			add(r)
+		}
+
+		if x.bEnd >= y.bEnd {
+			j++
+		}
+		if y.bEnd >= x.bEnd {
+			i++
+		}
+	}
+
+	// Past the last change of one side, lines line up by the difference in
+	// its length from the base
+	for ; i < len(ours); i++ {
+		x := ours[i]
+		at := x.b + len(t) - baseLen
+		add(region{regionOurs, x.b, x.bEnd, x.s, x.sEnd, at, at + x.bEnd - x.b})
+	}
+	for ; j < len(theirs); j++ {
+		y := theirs[j]
+		at := y.b + len(o) - baseLen
+		add(region{regionTheirs, y.b, y.bEnd, at, at + y.bEnd - y.b, y.s, y.sEnd})
+	}
+	return regions
+}
+
+// refineConflicts narrows each conflict to the runs of lines where ours
+// and theirs differ, splitting it where they agree. A conflict where they
+// agree everywhere is no conflict.
+func refineConflicts(regions []region, o, t []string) []region {
+	var result []region
+	for _, r := range regions {
+		if r.mode != regionConflict || r.oEnd == r.o || r.tEnd == r.t {
+			result = append(result, r)
+			continue
+		}
+		pieces := hunks(o[r.o:r.oEnd], t[r.t:r.tEnd])
+		if len(pieces) == 0 {
+			r.mode = regionSame
+			result = append(result, r)
+			continue
+		}
+		for _, p := range pieces {
+			// The base lines stay those of the whole conflict
+			result = append(result, region{regionConflict, r.b, r.bEnd, r.o + p.b, r.o + p.bEnd, r.t + p.s, r.t + p.sEnd})
+		}
+	}
+	return result
+}
+
+// joinConflicts joins conflicts separated by three lines or fewer, which
+// are easier to resolve as one.
+func joinConflicts(regions []region) []region {
+	var result []region
+	for _, r := range regions {
+		if n := len(result); n > 0 {
+			last := &result[n-1]
+			if last.mode == regionConflict && r.mode == regionConflict && r.o-last.oEnd <= 3 {
+				last.bEnd, last.oEnd, last.tEnd = r.bEnd, r.oEnd, r.tEnd
+				continue
+			}
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+// needsCR decides whether the markers of a conflict end in CRLF: when the
+// lines before it on both sides, and the first line of the base, do.
+func needsCR(b, o, t []string, r region) bool {
+	cr := isCRLF(o, max(r.o-1, 0))
+	if cr != 0 {
+		cr = isCRLF(t, max(r.t-1, 0))
+	}
+	if cr != 0 {
+		cr = isCRLF(b, 0)
+	}
+	return cr > 0
+}
+
+// isCRLF reports whether line i ends in CRLF: 1 if it does, 0 if not and
+// -1 if it cannot tell. A last line without a newline goes by the one
+// before it.
+func isCRLF(lines []string, i int) int {
+	crlf := func(line string) int {
+		if strings.HasSuffix(line, "\r\n") {
+			return 1
+		}
+		return 0
+	}
+	switch {
+	case len(lines) == 0:
+		return -1
+	case i < len(lines)-1 || strings.HasSuffix(lines[i], "\n"):
+		return crlf(lines[i])
+	case i == 0:
+		return -1
+	}
+	return crlf(lines[i-1])
+}
+
+// writeLines writes lines, and with addNewline a newline after a last line
+// that has none, so a marker can follow.
+func writeLines(out *strings.Builder, lines []string, addNewline, cr bool) {
+	for _, line := range lines {
+		out.WriteString(line)
+	}
+	if n := len(lines); addNewline && n > 0 && !strings.HasSuffix(lines[n-1], "\n") {
+		if cr {
+			out.WriteString("\r")
+		}
+		out.WriteString("\n")
+	}
+}
+
+// marker returns a conflict marker line with its label, without the
+// newline.
+func marker(ch byte, label string) string {
+	m := strings.Repeat(string(ch), MarkerSize)
+	if label != "" {
+		m += " " + label
+	}
+	return m
+}
+
+// splitLines splits content into lines that keep their newlines.
+func splitLines(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
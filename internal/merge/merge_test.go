@@ -0,0 +1,136 @@
+package merge
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Notwinner0/gvcs/internal/diff"
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+func TestFile(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		want               string
+		wantConflict       bool
+	}{
+		{"apart", "a\nb\nc\nd\ne\n", "A\nb\nc\nd\ne\n", "a\nb\nc\nd\nE\n", "A\nb\nc\nd\nE\n", false},
+		{"same change", "a\nb\nc\n", "a\nB\nc\n", "a\nB\nc\n", "a\nB\nc\n", false},
+		{"conflict", "a\nb\nc\n", "a\nB\nc\n", "a\nX\nc\n",
+			"a\n<<<<<<< ours\nB\n=======\nX\n>>>>>>> theirs\nc\n", true},
+		{"adjacent", "a\nb\n", "A\nb\n", "a\nB\n",
+			"<<<<<<< ours\nA\nb\n=======\na\nB\n>>>>>>> theirs\n", true},
+		{"narrowed", "1\n2\n3\n", "1\nA\ns1\ns2\ns3\ns4\nB\n3\n", "1\nC\ns1\ns2\ns3\ns4\nD\n3\n",
+			"1\n<<<<<<< ours\nA\n=======\nC\n>>>>>>> theirs\ns1\ns2\ns3\ns4\n<<<<<<< ours\nB\n=======\nD\n>>>>>>> theirs\n3\n", true},
+		{"joined", "1\n2\n3\n", "1\nA\ns1\ns2\nB\n3\n", "1\nC\ns1\ns2\nD\n3\n",
+			"1\n<<<<<<< ours\nA\ns1\ns2\nB\n=======\nC\ns1\ns2\nD\n>>>>>>> theirs\n3\n", true},
+		{"no newline", "a", "a\nb", "a\nc",
+			"a\n<<<<<<< ours\nb\n=======\nc\n>>>>>>> theirs\n", true},
+		{"crlf", "a\r\nb\r\n", "a\r\nB\r\n", "a\r\nC\r\n",
+			"a\r\n<<<<<<< ours\r\nB\r\n=======\r\nC\r\n>>>>>>> theirs\r\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflict := File([]byte(tt.base), []byte(tt.ours), []byte(tt.theirs), Labels{Ours: "ours", Theirs: "theirs"})
+			if string(got) != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+			if conflict != tt.wantConflict {
+				t.Errorf("Expected conflict %v, got %v", tt.wantConflict, conflict)
+			}
+		})
+	}
+}
+
+// writeTree writes a flat tree of files and returns its SHA.
+func writeTree(t *testing.T, gitRepo *repo.GitRepository, files map[string]string) string {
+	t.Helper()
+	tree := &objects.GitTree{}
+	for path, content := range files {
+		sha, err := objects.ObjectHash(strings.NewReader(content), "blob", gitRepo)
+		if err != nil {
+			t.Fatalf("ObjectHash() failed: %v", err)
+		}
+		tree.Items = append(tree.Items, objects.GitTreeLeaf{Mode: "100644", Path: path, SHA: sha})
+	}
+	sort.Slice(tree.Items, func(i, j int) bool { return tree.Items[i].Path < tree.Items[j].Path })
+	sha, err := objects.ObjectWrite(tree, gitRepo)
+	if err != nil {
+		t.Fatalf("ObjectWrite() failed: %v", err)
+	}
+	return sha
+}
+
+func TestTrees(t *testing.T) {
+	gitRepo, err := repo.RepoCreate(t.TempDir())
+	if err != nil {
+		t.Fatalf("RepoCreate() failed: %v", err)
+	}
+	base := writeTree(t, gitRepo, map[string]string{
+		"both":     "a\nb\nc\nd\ne\n",
+		"conflict": "a\n",
+		"deleted":  "d\n",
+		"modified": "m\n",
+		"ours":     "o\n",
+	})
+	ours := writeTree(t, gitRepo, map[string]string{
+		"added":    "x\n",
+		"both":     "A\nb\nc\nd\ne\n",
+		"conflict": "b\n",
+		"deleted":  "d\n",
+		"ours":     "O\n",
+	})
+	theirs := writeTree(t, gitRepo, map[string]string{
+		"added":    "y\n",
+		"both":     "a\nb\nc\nd\nE\n",
+		"conflict": "c\n",
+		"modified": "M\n",
+		"ours":     "o\n",
+	})
+
+	result, err := Trees(gitRepo, base, ours, theirs, Labels{Ours: "ours", Theirs: "theirs"})
+	if err != nil {
+		t.Fatalf("Trees() failed: %v", err)
+	}
+
+	wantFiles := map[string]string{
+		"added":    "<<<<<<< ours\nx\n=======\ny\n>>>>>>> theirs\n",
+		"both":     "A\nb\nc\nd\nE\n",
+		"conflict": "<<<<<<< ours\nb\n=======\nc\n>>>>>>> theirs\n",
+		"modified": "M\n",
+		"ours":     "O\n",
+	}
+	if len(result.Files) != len(wantFiles) {
+		t.Errorf("Expected %d files, got %v", len(wantFiles), result.Files)
+	}
+	for path, want := range wantFiles {
+		f, ok := result.Files[path]
+		if !ok {
+			t.Errorf("Expected %s in the result", path)
+			continue
+		}
+		data, err := diff.BlobRead(gitRepo, f.SHA)
+		if err != nil {
+			t.Fatalf("BlobRead() failed: %v", err)
+		}
+		if string(data) != want {
+			t.Errorf("Expected %s to be %q, got %q", path, want, data)
+		}
+	}
+
+	var conflicts []string
+	for _, c := range result.Conflicts {
+		conflicts = append(conflicts, c.Path+":"+c.Reason)
+	}
+	if got, want := fmt.Sprint(conflicts), "[added:add/add conflict:content modified:modify/delete]"; got != want {
+		t.Errorf("Expected conflicts %s, got %s", want, got)
+	}
+	if got, want := fmt.Sprint(result.Merged), "[added both conflict]"; got != want {
+		t.Errorf("Expected merged %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,168 @@
+package merge
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/Notwinner0/gvcs/internal/diff"
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// Reasons a path could not be merged.
+const (
+	ConflictContent      = "content"       // both sides changed the same lines
+	ConflictAddAdd       = "add/add"       // both sides added different files
+	ConflictModifyDelete = "modify/delete" // one side changed what the other deleted
+	ConflictBinary       = "binary"        // both sides changed a file that is not text
+	ConflictMode         = "mode"          // both sides changed the mode or kind differently
+)
+
+// Conflict is a path the merge could not resolve, with its versions in the
+// base and on each side; a missing version is the zero File.
+type Conflict struct {
+	Path               string
+	Reason             string
+	Base, Ours, Theirs diff.File
+}
+
+// Result is the outcome of a tree merge.
+type Result struct {
+	// Files is the merged tree, keyed by "/" path. A conflicted path has
+	// its merge with conflict markers, or whichever side's version is
+	// left when there is nothing to merge.
+	Files     map[string]diff.File
+	Conflicts []Conflict // sorted by path
+	Merged    []string   // the paths whose contents were merged, sorted
+}
+
+// Trees merges the changes that ours and theirs made to base, any of which
+// may be "" for an empty tree. Paths changed by one side take that side's
+// version; paths both changed have their contents merged with File, the
+// blobs it produces written to the repository.
+func Trees(gitRepo *repo.GitRepository, base, ours, theirs string, labels Labels) (*Result, error) {
+	var files [3]map[string]diff.File
+	for i, tree := range []string{base, ours, theirs} {
+		var err error
+		if files[i], err = diff.TreeFiles(gitRepo, tree, nil); err != nil {
+			return nil, err
+		}
+	}
+	baseFiles, ourFiles, theirFiles := files[0], files[1], files[2]
+
+	paths := make(map[string]bool)
+	for _, f := range files {
+		for p := range f {
+			paths[p] = true
+		}
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	result := &Result{Files: make(map[string]diff.File)}
+	for _, p := range sorted {
+		b, bok := baseFiles[p]
+		o, ook := ourFiles[p]
+		t, tok := theirFiles[p]
+		conflict := Conflict{Path: p, Base: b, Ours: o, Theirs: t}
+
+		switch {
+		case o == t || b == t:
+			if ook {
+				result.Files[p] = o
+			}
+			continue
+		case b == o:
+			if tok {
+				result.Files[p] = t
+			}
+			continue
+		case !ook || !tok:
+			// Keep the version that was changed
+			conflict.Reason = ConflictModifyDelete
+			if ook {
+				result.Files[p] = o
+			} else {
+				result.Files[p] = t
+			}
+			result.Conflicts = append(result.Conflicts, conflict)
+			continue
+		}
+
+		merged, reason, err := mergeFile(gitRepo, b, o, t, bok, labels)
+		if err != nil {
+			return nil, err
+		}
+		result.Files[p] = merged
+		if o.SHA != t.SHA {
+			result.Merged = append(result.Merged, p)
+		}
+		if reason != "" {
+			conflict.Reason = reason
+			result.Conflicts = append(result.Conflicts, conflict)
+		}
+	}
+	return result, nil
+}
+
+// mergeFile merges a file both sides changed, returning the merged version
+// and the reason it conflicts, if it does. A file that cannot be merged
+// line by line keeps our version.
+func mergeFile(gitRepo *repo.GitRepository, b, o, t diff.File, inBase bool, labels Labels) (diff.File, string, error) {
+	mode, modeOK := o.Mode, true
+	switch {
+	case o.Mode == t.Mode:
+	case b.Mode == o.Mode:
+		mode = t.Mode
+	case b.Mode != t.Mode:
+		modeOK = false
+	}
+	if o.SHA == t.SHA {
+		if !modeOK {
+			return o, ConflictMode, nil
+		}
+		return diff.File{Mode: mode, SHA: o.SHA}, "", nil
+	}
+	if !regularFile(o.Mode) || !regularFile(t.Mode) || (inBase && !regularFile(b.Mode)) {
+		return o, ConflictMode, nil
+	}
+
+	var data [3][]byte
+	for i, f := range []diff.File{b, o, t} {
+		if i == 0 && !inBase {
+			continue
+		}
+		var err error
+		if data[i], err = diff.BlobRead(gitRepo, f.SHA); err != nil {
+			return diff.File{}, "", err
+		}
+		if diff.IsBinary(data[i]) {
+			return o, ConflictBinary, nil
+		}
+	}
+
+	merged, conflict := File(data[0], data[1], data[2], labels)
+	sha, err := objects.ObjectHash(bytes.NewReader(merged), "blob", gitRepo)
+	if err != nil {
+		return diff.File{}, "", err
+	}
+	reason := ""
+	switch {
+	case conflict && !inBase:
+		reason = ConflictAddAdd
+	case conflict:
+		reason = ConflictContent
+	case !modeOK:
+		reason = ConflictMode
+	}
+	return diff.File{Mode: mode, SHA: sha}, reason, nil
+}
+
+// regularFile reports whether mode is that of a regular file, which can
+// be merged line by line unlike symlinks and submodules.
+func regularFile(mode string) bool {
+	return mode == "100644" || mode == "100755"
+}
@@ -0,0 +1,227 @@
+package objects
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ObjectProblem is one finding of ObjectCheck. IDs follow the message ids
+// of `git fsck` so that findings can be matched by scripts.
+type ObjectProblem struct {
+	ID      string // e.g. "treeNotSorted"
+	Message string
+	Warning bool // a problem git tolerates by default
+}
+
+func (p ObjectProblem) String() string {
+	return fmt.Sprintf("%s: %s", p.ID, p.Message)
+}
+
+var (
+	checkHexRE   = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	checkIdentRE = regexp.MustCompile(`^[^<>\n]*<[^<>\n]*> (\d+) ([+-]\d{4})$`)
+)
+
+// ObjectCheck validates the structure of an object's content: tree entry
+// modes, names and order, and the headers of commits and tags. Blobs are
+// always valid.
+func ObjectCheck(objType string, data []byte) []ObjectProblem {
+	switch objType {
+	case "commit":
+		return commitCheck(data)
+	case "tree":
+		return treeCheck(data)
+	case "tag":
+		return tagCheck(data)
+	case "blob":
+		return nil
+	}
+	return []ObjectProblem{{ID: "badType", Message: fmt.Sprintf("invalid object type %q", objType)}}
+}
+
+// checkHeaders splits the header block of a commit or tag into lines. It
+// reports a NUL in the headers or a missing blank line before the message.
+func checkHeaders(data []byte) ([]string, []ObjectProblem) {
+	end := bytes.Index(data, []byte("\n\n"))
+	if end == -1 {
+		end = len(data)
+	}
+	if bytes.IndexByte(data[:end], 0) != -1 {
+		return nil, []ObjectProblem{{ID: "nulInHeader", Message: "NUL byte in the object header"}}
+	}
+	if end == len(data) {
+		return nil, []ObjectProblem{{ID: "unterminatedHeader", Message: "missing blank line before the message"}}
+	}
+	return strings.Split(string(data[:end]), "\n"), nil
+}
+
+// checkHeader consumes the next header line if it has the given key.
+func checkHeader(lines []string, key string) (string, []string, bool) {
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], key+" ") {
+		return "", lines, false
+	}
+	return lines[0][len(key)+1:], lines[1:], true
+}
+
+// checkIdent validates a "Name <email> <time> <tz>" line.
+func checkIdent(who, ident string) []ObjectProblem {
+	if !strings.Contains(ident, "<") || !strings.Contains(ident, ">") {
+		return []ObjectProblem{{ID: "missingEmail", Message: fmt.Sprintf("invalid %s line - missing email", who)}}
+	}
+	if !strings.Contains(ident, " <") && !strings.HasPrefix(ident, "<") {
+		return []ObjectProblem{{ID: "missingSpaceBeforeEmail", Message: fmt.Sprintf("invalid %s line - missing space before email", who)}}
+	}
+	m := checkIdentRE.FindStringSubmatch(ident)
+	if m == nil {
+		return []ObjectProblem{{ID: "badDate", Message: fmt.Sprintf("invalid %s line - bad date", who)}}
+	}
+	if len(m[1]) > 1 && m[1][0] == '0' {
+		return []ObjectProblem{{ID: "zeroPaddedDate", Message: fmt.Sprintf("invalid %s line - zero-padded date", who)}}
+	}
+	return nil
+}
+
+func commitCheck(data []byte) []ObjectProblem {
+	lines, problems := checkHeaders(data)
+	if problems != nil {
+		return problems
+	}
+
+	tree, lines, ok := checkHeader(lines, "tree")
+	if !ok {
+		return []ObjectProblem{{ID: "missingTree", Message: "invalid format - expected 'tree' line"}}
+	}
+	if !checkHexRE.MatchString(tree) {
+		problems = append(problems, ObjectProblem{ID: "badTreeSha1", Message: "invalid 'tree' line format - bad sha1"})
+	}
+	for {
+		parent, rest, ok := checkHeader(lines, "parent")
+		if !ok {
+			break
+		}
+		if !checkHexRE.MatchString(parent) {
+			problems = append(problems, ObjectProblem{ID: "badParentSha1", Message: "invalid 'parent' line format - bad sha1"})
+		}
+		lines = rest
+	}
+
+	author, lines, ok := checkHeader(lines, "author")
+	if !ok {
+		return append(problems, ObjectProblem{ID: "missingAuthor", Message: "invalid format - expected 'author' line"})
+	}
+	problems = append(problems, checkIdent("author", author)...)
+
+	committer, _, ok := checkHeader(lines, "committer")
+	if !ok {
+		return append(problems, ObjectProblem{ID: "missingCommitter", Message: "invalid format - expected 'committer' line"})
+	}
+	return append(problems, checkIdent("committer", committer)...)
+}
+
+func tagCheck(data []byte) []ObjectProblem {
+	lines, problems := checkHeaders(data)
+	if problems != nil {
+		return problems
+	}
+
+	object, lines, ok := checkHeader(lines, "object")
+	if !ok {
+		return []ObjectProblem{{ID: "missingObject", Message: "invalid format - expected 'object' line"}}
+	}
+	if !checkHexRE.MatchString(object) {
+		problems = append(problems, ObjectProblem{ID: "badObjectSha1", Message: "invalid 'object' line format - bad sha1"})
+	}
+
+	typ, lines, ok := checkHeader(lines, "type")
+	if !ok {
+		return append(problems, ObjectProblem{ID: "missingTypeEntry", Message: "invalid format - expected 'type' line"})
+	}
+	switch typ {
+	case "commit", "tree", "blob", "tag":
+	default:
+		problems = append(problems, ObjectProblem{ID: "badType", Message: fmt.Sprintf("invalid 'type' value %q", typ)})
+	}
+
+	name, lines, ok := checkHeader(lines, "tag")
+	if !ok {
+		return append(problems, ObjectProblem{ID: "missingTagEntry", Message: "invalid format - expected 'tag' line"})
+	}
+	if name == "" || strings.ContainsAny(name, " ~^:?*[\\") || strings.Contains(name, "..") {
+		problems = append(problems, ObjectProblem{ID: "badTagName", Message: fmt.Sprintf("invalid 'tag' name: %s", name), Warning: true})
+	}
+
+	tagger, _, ok := checkHeader(lines, "tagger")
+	if !ok {
+		// Very old tags have no tagger; git only warns
+		return append(problems, ObjectProblem{ID: "missingTaggerEntry", Message: "invalid format - expected 'tagger' line", Warning: true})
+	}
+	return append(problems, checkIdent("tagger", tagger)...)
+}
+
+func treeCheck(data []byte) []ObjectProblem {
+	var problems []ObjectProblem
+	seen := map[string]bool{}
+	add := func(p ObjectProblem) {
+		// Report each kind of problem once per tree, like git
+		if !seen[p.ID] {
+			seen[p.ID] = true
+			problems = append(problems, p)
+		}
+	}
+
+	names := map[string]bool{}
+	var lastName string
+	pos := 0
+	for pos < len(data) {
+		space := bytes.IndexByte(data[pos:], ' ')
+		null := bytes.IndexByte(data[pos:], 0)
+		if space == -1 || null == -1 || space > null || pos+null+21 > len(data) {
+			add(ObjectProblem{ID: "badTree", Message: "cannot be parsed as a tree"})
+			return problems
+		}
+		mode := string(data[pos : pos+space])
+		name := string(data[pos+space+1 : pos+null])
+		pos += null + 21
+
+		switch mode {
+		case "100644", "100755", "120000", "40000", "160000":
+		case "040000":
+			add(ObjectProblem{ID: "zeroPaddedFilemode", Message: "contains zero-padded file modes", Warning: true})
+		case "100664":
+			add(ObjectProblem{ID: "badFilemode", Message: "contains bad file modes", Warning: true})
+		default:
+			add(ObjectProblem{ID: "badFilemode", Message: "contains bad file modes"})
+		}
+
+		switch {
+		case name == "":
+			add(ObjectProblem{ID: "emptyName", Message: "contains empty pathname"})
+		case name == ".":
+			add(ObjectProblem{ID: "hasDot", Message: "contains '.'", Warning: true})
+		case name == "..":
+			add(ObjectProblem{ID: "hasDotdot", Message: "contains '..'", Warning: true})
+		case strings.EqualFold(name, ".git"):
+			add(ObjectProblem{ID: "hasDotgit", Message: "contains '.git'", Warning: true})
+		case strings.Contains(name, "/"):
+			add(ObjectProblem{ID: "fullPathname", Message: "contains full pathnames", Warning: true})
+		}
+
+		if names[name] {
+			add(ObjectProblem{ID: "duplicateEntries", Message: "contains duplicate file entries"})
+		}
+		names[name] = true
+
+		// Entries sort by name, with directories compared as "name/"
+		sortName := name
+		if mode == "40000" || mode == "040000" {
+			sortName += "/"
+		}
+		if lastName != "" && sortName < lastName {
+			add(ObjectProblem{ID: "treeNotSorted", Message: "not properly sorted"})
+		}
+		lastName = sortName
+	}
+	return problems
+}
@@ -0,0 +1,143 @@
+package objects
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestObjectCheck(t *testing.T) {
+	sha := strings.Repeat("a", 40)
+	raw := strings.Repeat("A", 20)
+	ident := "John Doe <john@example.com> 1234567890 +0000"
+
+	tests := []struct {
+		name    string
+		objType string
+		data    string
+		wantIDs []string
+	}{
+		{
+			name:    "valid commit",
+			objType: "commit",
+			data:    "tree " + sha + "\nparent " + sha + "\nauthor " + ident + "\ncommitter " + ident + "\n\nmsg\n",
+		},
+		{
+			name:    "commit without tree",
+			objType: "commit",
+			data:    "author " + ident + "\ncommitter " + ident + "\n\nmsg\n",
+			wantIDs: []string{"missingTree"},
+		},
+		{
+			name:    "commit with bad parent and date",
+			objType: "commit",
+			data:    "tree " + sha + "\nparent xyz\nauthor John <j@x> yesterday\ncommitter " + ident + "\n\nmsg\n",
+			wantIDs: []string{"badParentSha1", "badDate"},
+		},
+		{
+			name:    "commit without committer",
+			objType: "commit",
+			data:    "tree " + sha + "\nauthor " + ident + "\n\nmsg\n",
+			wantIDs: []string{"missingCommitter"},
+		},
+		{
+			name:    "commit without blank line",
+			objType: "commit",
+			data:    "tree " + sha + "\nauthor " + ident + "\ncommitter " + ident + "\nmsg\n",
+			wantIDs: []string{"unterminatedHeader"},
+		},
+		{
+			name:    "valid tag",
+			objType: "tag",
+			data:    "object " + sha + "\ntype commit\ntag v1.0\ntagger " + ident + "\n\nrelease\n",
+		},
+		{
+			name:    "tag with bad type",
+			objType: "tag",
+			data:    "object " + sha + "\ntype bogus\ntag v1.0\ntagger " + ident + "\n\nrelease\n",
+			wantIDs: []string{"badType"},
+		},
+		{
+			name:    "tag without tagger",
+			objType: "tag",
+			data:    "object " + sha + "\ntype commit\ntag v1.0\n\nrelease\n",
+			wantIDs: []string{"missingTaggerEntry"},
+		},
+		{
+			name:    "tag without blank line",
+			objType: "tag",
+			data:    "object " + sha + "\ntype commit\ntag v1.0\ntagger " + ident,
+			wantIDs: []string{"unterminatedHeader"},
+		},
+		{
+			name:    "valid tree",
+			objType: "tree",
+			data:    "100644 a\x00" + raw + "100644 b.txt\x00" + raw + "40000 b\x00" + raw,
+		},
+		{
+			name:    "tree sorted with directory suffix",
+			objType: "tree",
+			data:    "40000 a\x00" + raw + "100644 a-b\x00" + raw,
+			wantIDs: []string{"treeNotSorted"},
+		},
+		{
+			name:    "tree with duplicates and bad mode",
+			objType: "tree",
+			data:    "100644 a\x00" + raw + "100600 a\x00" + raw,
+			wantIDs: []string{"badFilemode", "duplicateEntries"},
+		},
+		{
+			name:    "tree with zero-padded mode",
+			objType: "tree",
+			data:    "040000 d\x00" + raw,
+			wantIDs: []string{"zeroPaddedFilemode"},
+		},
+		{
+			name:    "truncated tree",
+			objType: "tree",
+			data:    "100644 a\x00AAAA",
+			wantIDs: []string{"badTree"},
+		},
+		{
+			name:    "blob",
+			objType: "blob",
+			data:    "anything\x00at all",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := ObjectCheck(tt.objType, []byte(tt.data))
+			var got []string
+			for _, p := range problems {
+				got = append(got, p.ID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Errorf("Expected %v, got %v", tt.wantIDs, got)
+			}
+		})
+	}
+}
+
+func TestObjectHash_Validation(t *testing.T) {
+	// Headers the parser does not model must survive hashing
+	commit := "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\nauthor A <a@b> 1 +0000\ncommitter A <a@b> 1 +0000\nencoding latin1\n\nmsg\n"
+	sha, err := ObjectHash(strings.NewReader(commit), "commit", nil)
+	if err != nil {
+		t.Fatalf("ObjectHash() failed: %v", err)
+	}
+	if want := objectHash("commit", []byte(commit)); sha != want {
+		t.Errorf("Expected %q, got %q", want, sha)
+	}
+
+	for _, tt := range []struct{ objType, data string }{
+		{"commit", "author A <a@b> 1 +0000\n\nmsg\n"},
+		{"commit", "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\nauthor A <a@b> 1 +0000\ncommitter A <a@b> 1 +0000\n"},
+		{"tree", "100644 a\x00short"},
+		{"tag", "object xyz\ntype commit\ntag v1\n\nmsg\n"},
+		{"bogus", "data"},
+	} {
+		if _, err := ObjectHash(strings.NewReader(tt.data), tt.objType, nil); err == nil {
+			t.Errorf("Expected ObjectHash() to reject %s %q", tt.objType, tt.data)
+		}
+	}
+}
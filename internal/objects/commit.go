@@ -17,5 +17,5 @@ func (c *GitCommit) Deserialize(data []byte) error {
 }
 
 func (c *GitCommit) Serialize() ([]byte, error) {
-	return kvlmSerialize(c.Kvlm, c.Message), nil
+	return kvlmSerialize(c.Kvlm, c.Message, commitKeyOrder), nil
 }
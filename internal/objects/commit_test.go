@@ -101,6 +101,12 @@ func TestGitCommit_Deserialize(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name:    "invalid kvlm - missing blank line",
+			data:    "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\nauthor John Doe <john@example.com> 1234567890 +0000",
+			want:    nil,
+			wantErr: true,
+		},
 		{
 			name:    "invalid kvlm - missing space",
 			data:    "tree4b825dc642cb6eb9a060e54bf8d69288fbee4904\nauthor John Doe <john@example.com> 1234567890 +0000\n\nInitial commit",
@@ -14,8 +14,7 @@ func kvlmParse(raw []byte) (map[string][]string, string, error) {
 	// Find the end of the key-value pairs (first blank line)
 	endOfPairs := bytes.Index(raw, []byte("\n\n"))
 	if endOfPairs == -1 {
-		// Maybe there's no message
-		endOfPairs = len(raw)
+		return nil, "", errors.New("invalid kvlm: missing blank line before message")
 	}
 
 	// The rest is the message
@@ -51,12 +50,16 @@ func kvlmParse(raw []byte) (map[string][]string, string, error) {
 	return kvlm, message, nil
 }
 
-// kvlmSerialize serializes a key-value map and a message back into bytes.
-func kvlmSerialize(kvlm map[string][]string, message string) []byte {
-	var b bytes.Buffer
+// Canonical header orders; keys not listed are not serialized.
+var (
+	commitKeyOrder = []string{"tree", "parent", "author", "committer", "gpgsig"}
+	tagKeyOrder    = []string{"object", "type", "tag", "tagger"}
+)
 
-	// Canonical order
-	order := []string{"tree", "parent", "author", "committer", "gpgsig"}
+// kvlmSerialize serializes a key-value map and a message back into bytes,
+// writing the keys in the given order.
+func kvlmSerialize(kvlm map[string][]string, message string, order []string) []byte {
+	var b bytes.Buffer
 
 	for _, key := range order {
 		if values, ok := kvlm[key]; ok {
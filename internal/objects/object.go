@@ -2,15 +2,11 @@ package objects
 
 import (
 	"bytes"
-	"compress/zlib"
-	"crypto/sha1"
-	"encoding/hex"
-	"errors"
 	"fmt"
 	"io"
 	"os"
 	"regexp"
-	"strconv"
+	"sort"
 	"strings"
 
 	"github.com/Notwinner0/gvcs/internal/refs"
@@ -26,50 +22,14 @@ type GitObject interface {
 
 // ObjectRead reads an object from the repository.
 func ObjectRead(gitRepo *repo.GitRepository, sha string) (GitObject, error) {
-	path, err := repo.RepoFile(gitRepo, false, "objects", sha[0:2], sha[2:])
+	header, r, err := ObjectReader(gitRepo, sha)
 	if err != nil {
 		return nil, err
 	}
-
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	z, err := zlib.NewReader(f)
-	if err != nil {
-		return nil, err
-	}
-	defer z.Close()
-
-	raw, err := io.ReadAll(z)
-	if err != nil {
-		return nil, err
-	}
-
-	// Read object type
-	spaceIndex := bytes.IndexByte(raw, ' ')
-	if spaceIndex == -1 {
-		return nil, errors.New("invalid object format: missing space")
-	}
-	fmtStr := string(raw[0:spaceIndex])
-
-	// Read and validate object size
-	nullIndex := bytes.IndexByte(raw, '\x00')
-	if nullIndex == -1 {
-		return nil, errors.New("invalid object format: missing null terminator")
-	}
-	size, err := strconv.Atoi(string(raw[spaceIndex+1 : nullIndex]))
-	if err != nil {
-		return nil, err
-	}
-	if size != len(raw)-nullIndex-1 {
-		return nil, fmt.Errorf("malformed object %s: bad length", sha)
-	}
+	defer r.Close()
 
 	var obj GitObject
-	switch fmtStr {
+	switch header.Type {
 	case "commit":
 		obj = new(GitCommit)
 	case "tree":
@@ -79,10 +39,15 @@ func ObjectRead(gitRepo *repo.GitRepository, sha string) (GitObject, error) {
 	case "blob":
 		obj = new(GitBlob)
 	default:
-		return nil, fmt.Errorf("unknown type %s for object %s", fmtStr, sha)
+		return nil, fmt.Errorf("unknown type %s for object %s", header.Type, sha)
 	}
 
-	err = obj.Deserialize(raw[nullIndex+1:])
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	err = obj.Deserialize(raw)
 	if err != nil {
 		return nil, err
 	}
@@ -97,36 +62,42 @@ func ObjectWrite(obj GitObject, gitRepo *repo.GitRepository) (string, error) {
 		return "", err
 	}
 
-	// Add header
-	header := []byte(fmt.Sprintf("%s %d\x00", obj.Type(), len(data)))
-	result := append(header, data...)
-
-	// Compute hash
-	h := sha1.New()
-	h.Write(result)
-	sha := hex.EncodeToString(h.Sum(nil))
-
+	// Hash first so that objects already in the store are not rewritten
 	if gitRepo != nil {
-		path, err := repo.RepoFile(gitRepo, true, "objects", sha[0:2], sha[2:])
-		if err != nil {
-			return "", err
-		}
-
-		f, err := os.Create(path)
-		if err != nil {
-			return "", err
+		if sha := objectHash(obj.Type(), data); objectFreshen(gitRepo, sha) {
+			return sha, nil
 		}
-		defer f.Close()
+	}
 
-		w := zlib.NewWriter(f)
-		_, err = w.Write(result)
-		if err != nil {
-			return "", err
-		}
-		w.Close()
+	w, err := NewObjectWriter(gitRepo, obj.Type(), int64(len(data)))
+	if err != nil {
+		return "", err
 	}
+	if _, err := w.Write(data); err != nil {
+		w.Abort()
+		return "", err
+	}
+	return w.Commit()
+}
+
+// ObjectNotFoundError reports a name that matches no object.
+type ObjectNotFoundError struct {
+	Name string
+}
+
+func (e *ObjectNotFoundError) Error() string {
+	return fmt.Sprintf("no such reference %s", e.Name)
+}
+
+// ObjectAmbiguousError reports a name, usually a short hash, that matches
+// more than one object.
+type ObjectAmbiguousError struct {
+	Name       string
+	Candidates []string
+}
 
-	return sha, nil
+func (e *ObjectAmbiguousError) Error() string {
+	return fmt.Sprintf("ambiguous reference %s: candidates are %v", e.Name, e.Candidates)
 }
 
 // ObjectFind resolves a name and optionally follows it to the desired object type.
@@ -137,10 +108,10 @@ func ObjectFind(gitRepo *repo.GitRepository, name, objType string, follow bool)
 	}
 
 	if len(shas) == 0 {
-		return "", fmt.Errorf("no such reference %s", name)
+		return "", &ObjectNotFoundError{Name: name}
 	}
 	if len(shas) > 1 {
-		return "", fmt.Errorf("ambiguous reference %s: candidates are %v", name, shas)
+		return "", &ObjectAmbiguousError{Name: name, Candidates: shas}
 	}
 	sha := shas[0]
 
@@ -150,19 +121,26 @@ func ObjectFind(gitRepo *repo.GitRepository, name, objType string, follow bool)
 
 	// Follow tags and commits if needed
 	for {
-		obj, err := ObjectRead(gitRepo, sha)
+		// Peek at the header first so that large blobs are never loaded
+		header, r, err := ObjectReader(gitRepo, sha)
 		if err != nil {
 			return "", err
 		}
+		r.Close()
 
-		if obj.Type() == objType {
+		if header.Type == objType {
 			return sha, nil
 		}
 
-		if !follow {
+		if !follow || (header.Type != "tag" && header.Type != "commit") {
 			return "", nil
 		}
 
+		obj, err := ObjectRead(gitRepo, sha)
+		if err != nil {
+			return "", err
+		}
+
 		switch o := obj.(type) {
 		case *GitTag:
 			sha = o.Kvlm["object"][0]
@@ -178,7 +156,10 @@ func ObjectFind(gitRepo *repo.GitRepository, name, objType string, follow bool)
 	}
 }
 
-// ObjectHash hashes an object from a reader.
+// ObjectHash hashes an object from a reader and writes it if gitRepo is
+// not nil. Commits, trees and tags must parse and pass the structural
+// checks of ObjectCheck; warnings are tolerated. The content is stored
+// exactly as read.
 func ObjectHash(fd io.Reader, objType string, gitRepo *repo.GitRepository) (string, error) {
 	data, err := io.ReadAll(fd)
 	if err != nil {
@@ -189,24 +170,30 @@ func ObjectHash(fd io.Reader, objType string, gitRepo *repo.GitRepository) (stri
 	switch objType {
 	case "commit":
 		obj = new(GitCommit)
-		obj.Deserialize(data)
 	case "tree":
 		obj = new(GitTree)
-		obj.Deserialize(data)
 	case "tag":
 		obj = new(GitTag)
-		obj.Deserialize(data)
 	case "blob":
 		obj = new(GitBlob)
-		err = obj.Deserialize(data)
-		if err != nil {
-			return "", err
-		}
 	default:
 		return "", fmt.Errorf("unknown type %s", objType) // objtype instead of fmt as fmt is format, but it is a package
 	}
+	for _, p := range ObjectCheck(objType, data) {
+		if !p.Warning {
+			return "", fmt.Errorf("corrupt %s: %s", objType, p)
+		}
+	}
+	if err := obj.Deserialize(data); err != nil {
+		return "", fmt.Errorf("corrupt %s: %v", objType, err)
+	}
 
-	return ObjectWrite(obj, gitRepo)
+	if gitRepo != nil {
+		if sha := objectHash(objType, data); objectFreshen(gitRepo, sha) {
+			return sha, nil
+		}
+	}
+	return ObjectHashStream(bytes.NewReader(data), int64(len(data)), objType, gitRepo)
 }
 
 // objectResolve resolves a name to a list of candidate object hashes.
@@ -214,6 +201,21 @@ func objectResolve(gitRepo *repo.GitRepository, name string) ([]string, error) {
 	if name == "" {
 		return nil, nil
 	}
+	// "<rev>:<path>" names the entry at path in the tree of rev
+	if rev, path, ok := strings.Cut(name, ":"); ok && rev != "" {
+		tree, err := ObjectFind(gitRepo, rev, "tree", true)
+		if err != nil {
+			return nil, err
+		}
+		if tree == "" {
+			return nil, fmt.Errorf("%s is not a tree-ish", rev)
+		}
+		sha, err := TreeLookup(gitRepo, tree, path)
+		if err != nil || sha == "" {
+			return nil, err
+		}
+		return []string{sha}, nil
+	}
 	if name == "HEAD" {
 		sha, err := refs.RefResolve(gitRepo, "HEAD")
 		if err != nil {
@@ -226,7 +228,7 @@ func objectResolve(gitRepo *repo.GitRepository, name string) ([]string, error) {
 	}
 
 	var candidates []string
-	hashRE := regexp.MustCompile(`^[0-9a-fA-F]{4,40}$/`)
+	hashRE := regexp.MustCompile(`^[0-9a-fA-F]{4,40}$`)
 
 	// Is it a hash?
 	if hashRE.MatchString(name) {
@@ -245,11 +247,28 @@ func objectResolve(gitRepo *repo.GitRepository, name string) ([]string, error) {
 				}
 			}
 		}
+
+		packs, err := PackList(gitRepo)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range packs {
+			shas := p.Objects()
+			for i := sort.SearchStrings(shas, name); i < len(shas) && strings.HasPrefix(shas[i], name); i++ {
+				candidates = append(candidates, shas[i])
+			}
+		}
 	}
 
-	// Try for references
-	for _, refPath := range []string{"refs/tags/", "refs/heads/"} {
-		if sha, err := refs.RefResolve(gitRepo, refPath+name); err == nil && sha != "" {
+	// Try for references, including full names and remote-tracking
+	// branches, with the same expansions as git
+	refNames := []string{"refs/" + name, "refs/tags/" + name, "refs/heads/" + name,
+		"refs/remotes/" + name, "refs/remotes/" + name + "/HEAD"}
+	if strings.HasPrefix(name, "refs/") {
+		refNames = append([]string{name}, refNames...)
+	}
+	for _, refName := range refNames {
+		if sha, err := refs.RefResolve(gitRepo, refName); err == nil && sha != "" {
 			candidates = append(candidates, sha)
 		}
 	}
@@ -0,0 +1,34 @@
+package objects
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+func TestObjectFind_Hash(t *testing.T) {
+	gitRepo, err := repo.RepoCreate(t.TempDir())
+	if err != nil {
+		t.Fatalf("RepoCreate() failed: %v", err)
+	}
+	sha, err := ObjectWrite(&GitBlob{data: []byte("hello\n")}, gitRepo)
+	if err != nil {
+		t.Fatalf("ObjectWrite() failed: %v", err)
+	}
+
+	for _, name := range []string{sha, sha[:7], sha[:4], strings.ToUpper(sha[:10])} {
+		got, err := ObjectFind(gitRepo, name, "", false)
+		if err != nil {
+			t.Errorf("ObjectFind(%q) failed: %v", name, err)
+		} else if got != sha {
+			t.Errorf("ObjectFind(%q): expected %s, got %s", name, sha, got)
+		}
+	}
+
+	var notFound *ObjectNotFoundError
+	if _, err := ObjectFind(gitRepo, "abc", "", false); !errors.As(err, &notFound) {
+		t.Errorf("Expected a prefix shorter than 4 to match nothing, got %v", err)
+	}
+}
@@ -0,0 +1,426 @@
+package objects
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// Object types as numbered in pack entry headers.
+const (
+	packTypeCommit   = 1
+	packTypeTree     = 2
+	packTypeBlob     = 3
+	packTypeTag      = 4
+	packTypeOfsDelta = 6
+	packTypeRefDelta = 7
+)
+
+// packMaxDeltaDepth bounds delta chains so a corrupt pack cannot loop.
+const packMaxDeltaDepth = 10000
+
+var packTypeNames = map[int]string{
+	packTypeCommit: "commit",
+	packTypeTree:   "tree",
+	packTypeBlob:   "blob",
+	packTypeTag:    "tag",
+}
+
+// Pack is a packfile described by its version 2 index.
+type Pack struct {
+	Path     string   // the .pack file
+	shas     []string // sorted object names
+	offsets  []int64  // offsets of the entries, in shas order
+	crcs     []uint32 // CRC32 of each packed entry, in shas order
+	checksum []byte   // SHA-1 of the .pack, as recorded in the index
+	idxSum   []byte   // SHA-1 of the index itself
+}
+
+// packCache keeps parsed indexes so ObjectReader does not re-read them on
+// every lookup. Packs are immutable once written, so the path is the key.
+var packCache sync.Map
+
+// PackList returns the packs of the repository.
+func PackList(gitRepo *repo.GitRepository) ([]*Pack, error) {
+	idxPaths, err := filepath.Glob(filepath.Join(repo.RepoPath(gitRepo, "objects", "pack"), "pack-*.idx"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(idxPaths)
+
+	var packs []*Pack
+	for _, idxPath := range idxPaths {
+		if cached, ok := packCache.Load(idxPath); ok {
+			packs = append(packs, cached.(*Pack))
+			continue
+		}
+		p, err := packIndexRead(idxPath)
+		if err != nil {
+			return nil, err
+		}
+		packCache.Store(idxPath, p)
+		packs = append(packs, p)
+	}
+	return packs, nil
+}
+
+// packIndexRead parses a version 2 pack index.
+func packIndexRead(idxPath string) (*Pack, error) {
+	data, err := os.ReadFile(idxPath)
+	if err != nil {
+		return nil, err
+	}
+	bad := func(reason string) error {
+		return fmt.Errorf("malformed pack index %s: %s", idxPath, reason)
+	}
+
+	const headerLen = 8 + 256*4
+	if len(data) < headerLen+40 {
+		return nil, bad("too short")
+	}
+	if !bytes.Equal(data[:4], []byte{0xff, 't', 'O', 'c'}) || binary.BigEndian.Uint32(data[4:8]) != 2 {
+		return nil, bad("only version 2 indexes are supported")
+	}
+	n := int(binary.BigEndian.Uint32(data[headerLen-4 : headerLen]))
+	if len(data) < headerLen+n*28+40 {
+		return nil, bad("truncated")
+	}
+
+	p := &Pack{
+		Path:     strings.TrimSuffix(idxPath, ".idx") + ".pack",
+		shas:     make([]string, n),
+		offsets:  make([]int64, n),
+		crcs:     make([]uint32, n),
+		checksum: data[len(data)-40 : len(data)-20],
+		idxSum:   data[len(data)-20:],
+	}
+	shaTable := data[headerLen : headerLen+n*20]
+	crcTable := data[headerLen+n*20 : headerLen+n*24]
+	offTable := data[headerLen+n*24 : headerLen+n*28]
+	largeTable := data[headerLen+n*28 : len(data)-40]
+	for i := 0; i < n; i++ {
+		p.shas[i] = hex.EncodeToString(shaTable[i*20 : i*20+20])
+		p.crcs[i] = binary.BigEndian.Uint32(crcTable[i*4:])
+		off := binary.BigEndian.Uint32(offTable[i*4:])
+		if off&0x80000000 == 0 {
+			p.offsets[i] = int64(off)
+			continue
+		}
+		// Offsets beyond 2GiB live in a separate table of 64-bit values
+		j := int(off & 0x7fffffff)
+		if (j+1)*8 > len(largeTable) {
+			return nil, bad("bad large offset")
+		}
+		p.offsets[i] = int64(binary.BigEndian.Uint64(largeTable[j*8:]))
+	}
+	return p, nil
+}
+
+// Objects returns the names of all objects in the pack, sorted.
+func (p *Pack) Objects() []string {
+	return p.shas
+}
+
+// Contains reports whether the pack holds sha.
+func (p *Pack) Contains(sha string) bool {
+	_, ok := p.find(sha)
+	return ok
+}
+
+func (p *Pack) find(sha string) (int, bool) {
+	i := sort.SearchStrings(p.shas, sha)
+	return i, i < len(p.shas) && p.shas[i] == sha
+}
+
+// ReadObject returns the type and content of a packed object, applying any
+// deltas. Bases outside the pack are read through gitRepo.
+func (p *Pack) ReadObject(gitRepo *repo.GitRepository, sha string) (string, []byte, error) {
+	i, ok := p.find(sha)
+	if !ok {
+		return "", nil, fmt.Errorf("object %s not in %s", sha, p.Path)
+	}
+	f, err := os.Open(p.Path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	return p.readAt(gitRepo, f, p.offsets[i], 0)
+}
+
+func (p *Pack) readAt(gitRepo *repo.GitRepository, f *os.File, offset int64, depth int) (string, []byte, error) {
+	if depth > packMaxDeltaDepth {
+		return "", nil, fmt.Errorf("%s: delta chain too deep at offset %d", p.Path, offset)
+	}
+	br := bufio.NewReader(io.NewSectionReader(f, offset, 1<<62))
+	typ, size, err := packEntryHeader(br)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: bad entry at offset %d: %v", p.Path, offset, err)
+	}
+
+	var baseType string
+	var base []byte
+	switch typ {
+	case packTypeOfsDelta:
+		rel, err := packOfsDeltaOffset(br)
+		if err != nil || rel <= 0 || rel > offset {
+			return "", nil, fmt.Errorf("%s: bad delta base offset at %d", p.Path, offset)
+		}
+		if baseType, base, err = p.readAt(gitRepo, f, offset-rel, depth+1); err != nil {
+			return "", nil, err
+		}
+	case packTypeRefDelta:
+		raw := make([]byte, 20)
+		if _, err := io.ReadFull(br, raw); err != nil {
+			return "", nil, err
+		}
+		baseSHA := hex.EncodeToString(raw)
+		if i, ok := p.find(baseSHA); ok {
+			baseType, base, err = p.readAt(gitRepo, f, p.offsets[i], depth+1)
+		} else {
+			baseType, base, err = objectReadRaw(gitRepo, baseSHA)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+	default:
+		if packTypeNames[typ] == "" {
+			return "", nil, fmt.Errorf("%s: unknown entry type %d at offset %d", p.Path, typ, offset)
+		}
+	}
+
+	z, err := zlib.NewReader(br)
+	if err != nil {
+		return "", nil, err
+	}
+	defer z.Close()
+	data, err := io.ReadAll(io.LimitReader(z, size+1))
+	if err != nil {
+		return "", nil, err
+	}
+	if int64(len(data)) != size {
+		return "", nil, fmt.Errorf("%s: entry at offset %d has bad length", p.Path, offset)
+	}
+
+	if typ != packTypeOfsDelta && typ != packTypeRefDelta {
+		return packTypeNames[typ], data, nil
+	}
+	data, err = packDeltaApply(base, data)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: bad delta at offset %d: %v", p.Path, offset, err)
+	}
+	return baseType, data, nil
+}
+
+// packEntryHeader reads the type and inflated size of a pack entry.
+func packEntryHeader(br *bufio.Reader) (int, int64, error) {
+	c, err := br.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	typ := int(c>>4) & 7
+	size := int64(c & 0x0f)
+	for shift := 4; c&0x80 != 0; shift += 7 {
+		if c, err = br.ReadByte(); err != nil {
+			return 0, 0, err
+		}
+		if shift > 56 {
+			return 0, 0, errors.New("size too large")
+		}
+		size |= int64(c&0x7f) << shift
+	}
+	return typ, size, nil
+}
+
+// packOfsDeltaOffset reads the distance back to an ofs-delta base, which
+// uses its own big-endian varint encoding.
+func packOfsDeltaOffset(br *bufio.Reader) (int64, error) {
+	c, err := br.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	off := int64(c & 0x7f)
+	for c&0x80 != 0 {
+		if c, err = br.ReadByte(); err != nil {
+			return 0, err
+		}
+		if off > 1<<55 {
+			return 0, errors.New("offset too large")
+		}
+		off = ((off + 1) << 7) | int64(c&0x7f)
+	}
+	return off, nil
+}
+
+// packDeltaApply rebuilds an object from its base and a delta.
+func packDeltaApply(base, delta []byte) ([]byte, error) {
+	pos := 0
+	varint := func() (int, error) {
+		v, shift := 0, 0
+		for {
+			if pos >= len(delta) || shift > 56 {
+				return 0, errors.New("truncated size")
+			}
+			c := delta[pos]
+			pos++
+			v |= int(c&0x7f) << shift
+			shift += 7
+			if c&0x80 == 0 {
+				return v, nil
+			}
+		}
+	}
+
+	srcSize, err := varint()
+	if err != nil {
+		return nil, err
+	}
+	if srcSize != len(base) {
+		return nil, errors.New("base size mismatch")
+	}
+	dstSize, err := varint()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, dstSize)
+	for pos < len(delta) {
+		op := delta[pos]
+		pos++
+		switch {
+		case op&0x80 != 0:
+			// Copy from the base; the low bits say which offset and size
+			// bytes follow
+			var offset, size int
+			for i := 0; i < 4; i++ {
+				if op&(1<<i) != 0 {
+					if pos >= len(delta) {
+						return nil, errors.New("truncated copy")
+					}
+					offset |= int(delta[pos]) << (8 * i)
+					pos++
+				}
+			}
+			for i := 0; i < 3; i++ {
+				if op&(0x10<<i) != 0 {
+					if pos >= len(delta) {
+						return nil, errors.New("truncated copy")
+					}
+					size |= int(delta[pos]) << (8 * i)
+					pos++
+				}
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > len(base) {
+				return nil, errors.New("copy out of bounds")
+			}
+			out = append(out, base[offset:offset+size]...)
+		case op != 0:
+			if pos+int(op) > len(delta) {
+				return nil, errors.New("truncated insert")
+			}
+			out = append(out, delta[pos:pos+int(op)]...)
+			pos += int(op)
+		default:
+			return nil, errors.New("reserved opcode 0")
+		}
+	}
+	if len(out) != dstSize {
+		return nil, errors.New("result size mismatch")
+	}
+	return out, nil
+}
+
+// Verify checks the pack and index checksums and the CRC32 of every entry.
+// It does not inflate objects; use ReadObject and hash them for that.
+func (p *Pack) Verify() error {
+	idxData, err := os.ReadFile(strings.TrimSuffix(p.Path, ".pack") + ".idx")
+	if err != nil {
+		return err
+	}
+	if sum := sha1.Sum(idxData[:len(idxData)-20]); !bytes.Equal(sum[:], p.idxSum) {
+		return fmt.Errorf("%s: index checksum mismatch", p.Path)
+	}
+
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return err
+	}
+	if len(data) < 32 || !bytes.Equal(data[:4], []byte("PACK")) {
+		return fmt.Errorf("%s: not a pack file", p.Path)
+	}
+	sum := sha1.Sum(data[:len(data)-20])
+	if !bytes.Equal(sum[:], data[len(data)-20:]) {
+		return fmt.Errorf("%s: pack checksum mismatch", p.Path)
+	}
+	if !bytes.Equal(sum[:], p.checksum) {
+		return fmt.Errorf("%s: pack does not match its index", p.Path)
+	}
+	if count := int(binary.BigEndian.Uint32(data[8:12])); count != len(p.shas) {
+		return fmt.Errorf("%s: pack has %d objects but index has %d", p.Path, count, len(p.shas))
+	}
+
+	// Each entry runs up to the next one; the last ends at the trailer
+	order := make([]int, len(p.offsets))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return p.offsets[order[a]] < p.offsets[order[b]] })
+	for k, i := range order {
+		end := int64(len(data) - 20)
+		if k+1 < len(order) {
+			end = p.offsets[order[k+1]]
+		}
+		start := p.offsets[i]
+		if start < 12 || start >= end || end > int64(len(data)-20) {
+			return fmt.Errorf("%s: bad offset for %s", p.Path, p.shas[i])
+		}
+		if crc32.ChecksumIEEE(data[start:end]) != p.crcs[i] {
+			return fmt.Errorf("%s: CRC mismatch for %s", p.Path, p.shas[i])
+		}
+	}
+	return nil
+}
+
+// packFind looks sha up in every pack of the repository.
+func packFind(gitRepo *repo.GitRepository, sha string) (*Pack, error) {
+	packs, err := PackList(gitRepo)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range packs {
+		if p.Contains(sha) {
+			return p, nil
+		}
+	}
+	return nil, nil
+}
+
+// objectReadRaw returns the type and content of a loose or packed object.
+func objectReadRaw(gitRepo *repo.GitRepository, sha string) (string, []byte, error) {
+	header, r, err := ObjectReader(gitRepo, sha)
+	if err != nil {
+		return "", nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", nil, err
+	}
+	return header.Type, data, nil
+}
@@ -0,0 +1,176 @@
+package objects
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// testPackEntry is one entry of a pack built by writeTestPack.
+type testPackEntry struct {
+	typ     int
+	data    []byte // content, or the delta for delta entries
+	baseRef string // ref-delta base
+	baseIdx int    // ofs-delta base, as an index into the entries
+	sha     string // name of the resulting object
+}
+
+// writeTestPack writes a pack and its version 2 index into the repository.
+func writeTestPack(t *testing.T, gitRepo *repo.GitRepository, entries []testPackEntry) string {
+	t.Helper()
+	var pack bytes.Buffer
+	pack.WriteString("PACK")
+	binary.Write(&pack, binary.BigEndian, uint32(2))
+	binary.Write(&pack, binary.BigEndian, uint32(len(entries)))
+
+	offsets := make([]int64, len(entries))
+	crcs := make([]uint32, len(entries))
+	for i, e := range entries {
+		offsets[i] = int64(pack.Len())
+		var entry bytes.Buffer
+
+		// Type and size header
+		size := len(e.data)
+		c := byte(e.typ<<4) | byte(size&0x0f)
+		size >>= 4
+		for size > 0 {
+			entry.WriteByte(c | 0x80)
+			c = byte(size & 0x7f)
+			size >>= 7
+		}
+		entry.WriteByte(c)
+
+		switch e.typ {
+		case packTypeOfsDelta:
+			rel := offsets[i] - offsets[e.baseIdx]
+			buf := []byte{byte(rel & 0x7f)}
+			for rel >>= 7; rel > 0; rel >>= 7 {
+				rel--
+				buf = append([]byte{byte(0x80 | rel&0x7f)}, buf...)
+			}
+			entry.Write(buf)
+		case packTypeRefDelta:
+			raw, _ := hex.DecodeString(e.baseRef)
+			entry.Write(raw)
+		}
+
+		z := zlib.NewWriter(&entry)
+		z.Write(e.data)
+		z.Close()
+		crcs[i] = crc32.ChecksumIEEE(entry.Bytes())
+		pack.Write(entry.Bytes())
+	}
+	packSum := sha1.Sum(pack.Bytes())
+	pack.Write(packSum[:])
+
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return entries[order[a]].sha < entries[order[b]].sha })
+
+	var idx bytes.Buffer
+	idx.Write([]byte{0xff, 't', 'O', 'c', 0, 0, 0, 2})
+	var fanout [256]uint32
+	for _, e := range entries {
+		raw, _ := hex.DecodeString(e.sha)
+		for b := int(raw[0]); b < 256; b++ {
+			fanout[b]++
+		}
+	}
+	binary.Write(&idx, binary.BigEndian, fanout)
+	for _, i := range order {
+		raw, _ := hex.DecodeString(entries[i].sha)
+		idx.Write(raw)
+	}
+	for _, i := range order {
+		binary.Write(&idx, binary.BigEndian, crcs[i])
+	}
+	for _, i := range order {
+		binary.Write(&idx, binary.BigEndian, uint32(offsets[i]))
+	}
+	idx.Write(packSum[:])
+	idxSum := sha1.Sum(idx.Bytes())
+	idx.Write(idxSum[:])
+
+	dir := repo.RepoPath(gitRepo, "objects", "pack")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("MkdirAll() failed: %v", err)
+	}
+	base := filepath.Join(dir, "pack-"+hex.EncodeToString(packSum[:]))
+	if err := os.WriteFile(base+".pack", pack.Bytes(), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+	if err := os.WriteFile(base+".idx", idx.Bytes(), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+	return base + ".pack"
+}
+
+func TestPack_ReadObject(t *testing.T) {
+	gitRepo, err := repo.RepoCreate(t.TempDir())
+	if err != nil {
+		t.Fatalf("RepoCreate() failed: %v", err)
+	}
+
+	base := []byte("line one\nline two\nline three\n")
+	// Copy the first 18 bytes of the base, then insert new text
+	delta1 := []byte{byte(len(base)), 24, 0x90, 18, 6, 'f', 'o', 'u', 'r', '!', '\n'}
+	want1 := []byte("line one\nline two\nfour!\n")
+	// Copy the whole base, then append a line
+	delta2 := []byte{byte(len(base)), byte(len(base) + 4), 0x90, byte(len(base)), 4, 'e', 'n', 'd', '\n'}
+	want2 := append(append([]byte{}, base...), "end\n"...)
+
+	baseSHA := objectHash("blob", base)
+	entries := []testPackEntry{
+		{typ: packTypeBlob, data: base, sha: baseSHA},
+		{typ: packTypeOfsDelta, data: delta1, baseIdx: 0, sha: objectHash("blob", want1)},
+		{typ: packTypeRefDelta, data: delta2, baseRef: baseSHA, sha: objectHash("blob", want2)},
+	}
+	packPath := writeTestPack(t, gitRepo, entries)
+
+	for _, tt := range []struct {
+		sha  string
+		want []byte
+	}{{baseSHA, base}, {entries[1].sha, want1}, {entries[2].sha, want2}} {
+		header, r, err := ObjectReader(gitRepo, tt.sha)
+		if err != nil {
+			t.Fatalf("ObjectReader(%s) failed: %v", tt.sha, err)
+		}
+		got, _ := io.ReadAll(r)
+		r.Close()
+		if header.Type != "blob" || !bytes.Equal(got, tt.want) {
+			t.Errorf("Expected blob %q, got %s %q", tt.want, header.Type, got)
+		}
+	}
+
+	// Packed objects resolve by abbreviated name too
+	if sha, err := ObjectFind(gitRepo, entries[2].sha[:8], "", true); err != nil || sha != entries[2].sha {
+		t.Errorf("Expected %s, got %s (%v)", entries[2].sha, sha, err)
+	}
+
+	packs, err := PackList(gitRepo)
+	if err != nil || len(packs) != 1 {
+		t.Fatalf("Expected one pack, got %d (%v)", len(packs), err)
+	}
+	if err := packs[0].Verify(); err != nil {
+		t.Errorf("Verify() failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(packPath)
+	data[20] ^= 0xff
+	os.WriteFile(packPath, data, 0644)
+	if err := packs[0].Verify(); err == nil {
+		t.Errorf("Expected Verify() to detect the corrupted pack")
+	}
+}
@@ -0,0 +1,117 @@
+package objects
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signature is a parsed author, committer or tagger line:
+// "Name <email> <unix time> <tz>".
+type Signature struct {
+	Name  string
+	Email string
+	When  time.Time // zero if the line carries no date
+}
+
+// SignatureParse parses an identity line as found in commit and tag headers.
+func SignatureParse(line string) (*Signature, error) {
+	lt := strings.Index(line, "<")
+	gt := strings.LastIndex(line, ">")
+	if lt == -1 || gt < lt {
+		return nil, fmt.Errorf("invalid signature %q: missing <email>", line)
+	}
+	sig := &Signature{
+		Name:  strings.TrimSpace(line[:lt]),
+		Email: line[lt+1 : gt],
+	}
+
+	fields := strings.Fields(line[gt+1:])
+	if len(fields) == 0 {
+		return sig, nil
+	}
+	unix, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature %q: bad timestamp", line)
+	}
+	loc := time.UTC
+	if len(fields) > 1 {
+		if loc, err = signatureZone(fields[1]); err != nil {
+			return nil, fmt.Errorf("invalid signature %q: %v", line, err)
+		}
+	}
+	sig.When = time.Unix(unix, 0).In(loc)
+	return sig, nil
+}
+
+// signatureZone turns a "+hhmm" offset into a fixed time zone.
+func signatureZone(tz string) (*time.Location, error) {
+	if len(tz) != 5 || (tz[0] != '+' && tz[0] != '-') {
+		return nil, fmt.Errorf("bad time zone %q", tz)
+	}
+	hours, err := strconv.Atoi(tz[1:3])
+	if err != nil {
+		return nil, fmt.Errorf("bad time zone %q", tz)
+	}
+	minutes, err := strconv.Atoi(tz[3:5])
+	if err != nil {
+		return nil, fmt.Errorf("bad time zone %q", tz)
+	}
+	offset := hours*3600 + minutes*60
+	if tz[0] == '-' {
+		offset = -offset
+	}
+	return time.FixedZone(tz, offset), nil
+}
+
+// SignatureFormatDate renders a date in one of git's date formats: "default",
+// "unix", "raw", "short", "iso", "iso-strict", "rfc" or "relative".
+func SignatureFormatDate(when time.Time, format string) (string, error) {
+	switch format {
+	case "", "default":
+		return when.Format("Mon Jan 2 15:04:05 2006 -0700"), nil
+	case "unix":
+		return strconv.FormatInt(when.Unix(), 10), nil
+	case "raw":
+		return fmt.Sprintf("%d %s", when.Unix(), when.Format("-0700")), nil
+	case "short":
+		return when.Format("2006-01-02"), nil
+	case "iso":
+		return when.Format("2006-01-02 15:04:05 -0700"), nil
+	case "iso-strict":
+		return when.Format(time.RFC3339), nil
+	case "rfc":
+		return when.Format("Mon, 2 Jan 2006 15:04:05 -0700"), nil
+	case "relative":
+		return signatureRelative(time.Since(when)), nil
+	}
+	return "", fmt.Errorf("unknown date format %q", format)
+}
+
+// signatureRelative describes an age the way git does, e.g. "3 days ago".
+func signatureRelative(age time.Duration) string {
+	if age < 0 {
+		return "in the future"
+	}
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"year", 365 * 24 * time.Hour},
+		{"month", 30 * 24 * time.Hour},
+		{"week", 7 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	}
+	for _, u := range units {
+		if n := int64(age / u.size); n > 0 {
+			if n == 1 {
+				return fmt.Sprintf("1 %s ago", u.name)
+			}
+			return fmt.Sprintf("%d %ss ago", n, u.name)
+		}
+	}
+	return fmt.Sprintf("%d seconds ago", int64(age/time.Second))
+}
@@ -0,0 +1,123 @@
+package objects
+
+import (
+	"testing"
+)
+
+func TestSignatureParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      string
+		wantName  string
+		wantEmail string
+		wantUnix  int64
+		wantTZ    string
+		wantErr   bool
+	}{
+		{
+			name:      "full signature",
+			line:      "John Doe <john@example.com> 1234567890 +0100",
+			wantName:  "John Doe",
+			wantEmail: "john@example.com",
+			wantUnix:  1234567890,
+			wantTZ:    "+0100",
+		},
+		{
+			name:      "negative offset",
+			line:      "Jane <jane@example.com> 1700000000 -0530",
+			wantName:  "Jane",
+			wantEmail: "jane@example.com",
+			wantUnix:  1700000000,
+			wantTZ:    "-0530",
+		},
+		{
+			name:      "no date",
+			line:      "gvcs <gvcs@example.com>",
+			wantName:  "gvcs",
+			wantEmail: "gvcs@example.com",
+		},
+		{name: "missing email", line: "John Doe 1234567890 +0000", wantErr: true},
+		{name: "bad timestamp", line: "John <j@x> yesterday +0000", wantErr: true},
+		{name: "bad zone", line: "John <j@x> 1234567890 CET", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig, err := SignatureParse(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SignatureParse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if sig.Name != tt.wantName || sig.Email != tt.wantEmail {
+				t.Errorf("Expected %q <%s>, got %q <%s>", tt.wantName, tt.wantEmail, sig.Name, sig.Email)
+			}
+			if tt.wantUnix == 0 {
+				if !sig.When.IsZero() {
+					t.Errorf("Expected no date, got %v", sig.When)
+				}
+				return
+			}
+			if sig.When.Unix() != tt.wantUnix {
+				t.Errorf("Expected %d, got %d", tt.wantUnix, sig.When.Unix())
+			}
+			if got := sig.When.Format("-0700"); got != tt.wantTZ {
+				t.Errorf("Expected zone %q, got %q", tt.wantTZ, got)
+			}
+		})
+	}
+}
+
+func TestSignatureFormatDate(t *testing.T) {
+	sig, err := SignatureParse("John Doe <john@example.com> 1234567890 +0100")
+	if err != nil {
+		t.Fatalf("SignatureParse() failed: %v", err)
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{format: "default", want: "Sat Feb 14 00:31:30 2009 +0100"},
+		{format: "unix", want: "1234567890"},
+		{format: "raw", want: "1234567890 +0100"},
+		{format: "short", want: "2009-02-14"},
+		{format: "iso", want: "2009-02-14 00:31:30 +0100"},
+		{format: "iso-strict", want: "2009-02-14T00:31:30+01:00"},
+	}
+	for _, tt := range tests {
+		got, err := SignatureFormatDate(sig.When, tt.format)
+		if err != nil {
+			t.Fatalf("SignatureFormatDate(%q) failed: %v", tt.format, err)
+		}
+		if got != tt.want {
+			t.Errorf("SignatureFormatDate(%q): expected %q, got %q", tt.format, tt.want, got)
+		}
+	}
+
+	if _, err := SignatureFormatDate(sig.When, "bogus"); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
+
+func TestGitTag_SerializeOrder(t *testing.T) {
+	tag := &GitTag{
+		Kvlm: map[string][]string{
+			"tagger": {"John Doe <john@example.com> 1234567890 +0000"},
+			"tag":    {"v1.0"},
+			"object": {"4b825dc642cb6eb9a060e54bf8d69288fbee4904"},
+			"type":   {"commit"},
+		},
+		Message: "Release\n",
+	}
+
+	got, err := tag.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize() failed: %v", err)
+	}
+	want := "object 4b825dc642cb6eb9a060e54bf8d69288fbee4904\ntype commit\ntag v1.0\ntagger John Doe <john@example.com> 1234567890 +0000\n\nRelease\n"
+	if string(got) != want {
+		t.Errorf("Serialize() got:\n%s\n\nwant:\n%s", string(got), want)
+	}
+}
@@ -0,0 +1,290 @@
+package objects
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// maxHeaderLen bounds the "<type> <size>\x00" prefix of a loose object.
+const maxHeaderLen = 64
+
+// ObjectHeader describes a stored object without its content.
+type ObjectHeader struct {
+	Type string
+	Size int64
+}
+
+// objectStream yields the content of a loose object and checks that it
+// matches the size announced in its header.
+type objectStream struct {
+	sha       string
+	f         *os.File
+	z         io.ReadCloser
+	br        *bufio.Reader
+	remaining int64
+}
+
+func (s *objectStream) Read(p []byte) (int, error) {
+	if s.remaining <= 0 {
+		// Anything after the announced size means the header lied
+		if _, err := s.br.ReadByte(); err == nil {
+			return 0, fmt.Errorf("malformed object %s: bad length", s.sha)
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > s.remaining {
+		p = p[:s.remaining]
+	}
+	n, err := s.br.Read(p)
+	s.remaining -= int64(n)
+	if err == io.EOF {
+		if s.remaining > 0 {
+			return n, fmt.Errorf("malformed object %s: bad length", s.sha)
+		}
+		err = nil
+	}
+	return n, err
+}
+
+func (s *objectStream) Close() error {
+	s.z.Close()
+	return s.f.Close()
+}
+
+// ObjectReader opens an object for streaming. The returned reader yields
+// exactly Size bytes of content and must be closed by the caller.
+func ObjectReader(gitRepo *repo.GitRepository, sha string) (*ObjectHeader, io.ReadCloser, error) {
+	path, err := repo.RepoFile(gitRepo, false, "objects", sha[0:2], sha[2:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		// Not loose; it may be packed
+		p, perr := packFind(gitRepo, sha)
+		if perr != nil {
+			return nil, nil, perr
+		}
+		if p == nil {
+			return nil, nil, err
+		}
+		objType, data, err := p.ReadObject(gitRepo, sha)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &ObjectHeader{Type: objType, Size: int64(len(data))}, io.NopCloser(bytes.NewReader(data)), nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	z, err := zlib.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	br := bufio.NewReader(z)
+	header, err := readObjectHeader(br)
+	if err != nil {
+		z.Close()
+		f.Close()
+		return nil, nil, fmt.Errorf("malformed object %s: %v", sha, err)
+	}
+
+	return header, &objectStream{sha: sha, f: f, z: z, br: br, remaining: header.Size}, nil
+}
+
+// readObjectHeader parses the "<type> <size>\x00" prefix of an object.
+func readObjectHeader(br *bufio.Reader) (*ObjectHeader, error) {
+	var raw []byte
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return nil, errors.New("invalid object format: missing null terminator")
+		}
+		if c == '\x00' {
+			break
+		}
+		raw = append(raw, c)
+		if len(raw) > maxHeaderLen {
+			return nil, errors.New("invalid object format: header too long")
+		}
+	}
+
+	fmtStr, sizeStr, ok := strings.Cut(string(raw), " ")
+	if !ok {
+		return nil, errors.New("invalid object format: missing space")
+	}
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("invalid object format: bad size %q", sizeStr)
+	}
+	return &ObjectHeader{Type: fmtStr, Size: size}, nil
+}
+
+// ObjectWriter hashes an object as it is written, compressing it on the fly
+// into a temporary file that Commit moves into the object store. Without a
+// repository it only computes the hash.
+type ObjectWriter struct {
+	gitRepo *repo.GitRepository
+	size    int64
+	written int64
+	hash    hash.Hash
+	tmp     *os.File
+	zw      *zlib.Writer
+}
+
+// NewObjectWriter starts writing an object of the given type whose content
+// will be exactly size bytes long.
+func NewObjectWriter(gitRepo *repo.GitRepository, objType string, size int64) (*ObjectWriter, error) {
+	w := &ObjectWriter{gitRepo: gitRepo, size: size, hash: sha1.New()}
+
+	if gitRepo != nil {
+		tmp, err := os.CreateTemp(repo.RepoPath(gitRepo, "objects"), "tmp_obj_*")
+		if err != nil {
+			return nil, err
+		}
+		w.tmp = tmp
+		w.zw = zlib.NewWriter(tmp)
+	}
+
+	if err := w.write([]byte(fmt.Sprintf("%s %d\x00", objType, size))); err != nil {
+		w.Abort()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *ObjectWriter) write(p []byte) error {
+	w.hash.Write(p)
+	if w.zw != nil {
+		if _, err := w.zw.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *ObjectWriter) Write(p []byte) (int, error) {
+	if w.written+int64(len(p)) > w.size {
+		return 0, fmt.Errorf("object content exceeds declared size %d", w.size)
+	}
+	if err := w.write(p); err != nil {
+		return 0, err
+	}
+	w.written += int64(len(p))
+	return len(p), nil
+}
+
+// Commit finishes the object and returns its SHA. The temporary file is
+// renamed into place, so readers never observe a partial object.
+func (w *ObjectWriter) Commit() (string, error) {
+	if w.written != w.size {
+		w.Abort()
+		return "", fmt.Errorf("object size mismatch: declared %d, wrote %d", w.size, w.written)
+	}
+	sha := hex.EncodeToString(w.hash.Sum(nil))
+	if w.tmp == nil {
+		return sha, nil
+	}
+
+	path, err := repo.RepoFile(w.gitRepo, true, "objects", sha[0:2], sha[2:])
+	if err != nil {
+		w.Abort()
+		return "", err
+	}
+	// Objects are immutable, so an existing copy is never rewritten
+	if objectFreshen(w.gitRepo, sha) {
+		w.Abort()
+		return sha, nil
+	}
+
+	if err := w.zw.Close(); err != nil {
+		w.Abort()
+		return "", err
+	}
+	if repo.RepoFsync(w.gitRepo, "loose-object") {
+		if err := w.tmp.Sync(); err != nil {
+			w.Abort()
+			return "", err
+		}
+	}
+	if err := w.tmp.Close(); err != nil {
+		os.Remove(w.tmp.Name())
+		return "", err
+	}
+	if err := os.Chmod(w.tmp.Name(), 0644); err != nil {
+		os.Remove(w.tmp.Name())
+		return "", err
+	}
+	if err := os.Rename(w.tmp.Name(), path); err != nil {
+		os.Remove(w.tmp.Name())
+		return "", err
+	}
+	return sha, nil
+}
+
+// objectHash computes the SHA of an in-memory object without storing it.
+func objectHash(objType string, data []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s %d\x00", objType, len(data))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// objectFreshen reports whether a loose object is already stored. A found
+// object is touched, so that prune treats it as new: whoever is writing it
+// is about to make it reachable.
+func objectFreshen(gitRepo *repo.GitRepository, sha string) bool {
+	path := repo.RepoPath(gitRepo, "objects", sha[0:2], sha[2:])
+	if _, err := os.Stat(path); err != nil {
+		return false
+	}
+	now := time.Now()
+	return os.Chtimes(path, now, now) == nil
+}
+
+// Abort discards a partially written object.
+func (w *ObjectWriter) Abort() {
+	if w.tmp == nil {
+		return
+	}
+	w.zw.Close()
+	w.tmp.Close()
+	os.Remove(w.tmp.Name())
+}
+
+// ObjectHashStream hashes size bytes read from fd as an object of the given
+// type without holding the content in memory, and writes it if gitRepo is
+// not nil. Unlike ObjectHash, the content is not parsed.
+func ObjectHashStream(fd io.Reader, size int64, objType string, gitRepo *repo.GitRepository) (string, error) {
+	w, err := NewObjectWriter(gitRepo, objType, size)
+	if err != nil {
+		return "", err
+	}
+	n, err := io.Copy(w, fd)
+	if err != nil {
+		w.Abort()
+		return "", err
+	}
+	if n != size {
+		w.Abort()
+		return "", fmt.Errorf("expected %d bytes of content, got %d", size, n)
+	}
+	return w.Commit()
+}
@@ -0,0 +1,121 @@
+package objects
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+func TestObjectHashStream_KnownHash(t *testing.T) {
+	// Same value as `git hash-object` for a file containing "hello\n"
+	expected := "ce013625030ba8dba906f756967f9e9ca394464a"
+
+	sha, err := ObjectHashStream(strings.NewReader("hello\n"), 6, "blob", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if sha != expected {
+		t.Errorf("Expected %q, got %q", expected, sha)
+	}
+
+	// The in-memory path must agree with the streaming one
+	sha, err = ObjectWrite(&GitBlob{data: []byte("hello\n")}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if sha != expected {
+		t.Errorf("Expected %q, got %q", expected, sha)
+	}
+}
+
+func TestObjectHashStream_SizeMismatch(t *testing.T) {
+	if _, err := ObjectHashStream(strings.NewReader("hello\n"), 3, "blob", nil); err == nil {
+		t.Errorf("Expected an error when content exceeds the declared size")
+	}
+	if _, err := ObjectHashStream(strings.NewReader("hello\n"), 10, "blob", nil); err == nil {
+		t.Errorf("Expected an error when content is shorter than the declared size")
+	}
+}
+
+func TestObjectReader_RoundTrip(t *testing.T) {
+	gitRepo, err := repo.RepoCreate(t.TempDir())
+	if err != nil {
+		t.Fatalf("RepoCreate() failed: %v", err)
+	}
+
+	content := bytes.Repeat([]byte("streamed content\n"), 10000)
+	sha, err := ObjectHashStream(bytes.NewReader(content), int64(len(content)), "blob", gitRepo)
+	if err != nil {
+		t.Fatalf("ObjectHashStream() failed: %v", err)
+	}
+
+	header, r, err := ObjectReader(gitRepo, sha)
+	if err != nil {
+		t.Fatalf("ObjectReader() failed: %v", err)
+	}
+	defer r.Close()
+
+	if header.Type != "blob" {
+		t.Errorf("Expected type %q, got %q", "blob", header.Type)
+	}
+	if header.Size != int64(len(content)) {
+		t.Errorf("Expected size %d, got %d", len(content), header.Size)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Reading content failed: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("Round trip failed: content differs")
+	}
+
+	// No temporary files may be left behind in the object store
+	entries, err := os.ReadDir(repo.RepoPath(gitRepo, "objects"))
+	if err != nil {
+		t.Fatalf("ReadDir() failed: %v", err)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "tmp_obj_") {
+			t.Errorf("Leftover temporary file %s", e.Name())
+		}
+	}
+}
+
+func TestObjectReader_BadLength(t *testing.T) {
+	gitRepo, err := repo.RepoCreate(t.TempDir())
+	if err != nil {
+		t.Fatalf("RepoCreate() failed: %v", err)
+	}
+
+	// Hand-craft an object whose header claims more bytes than it holds
+	sha := "0123456789abcdef0123456789abcdef01234567"
+	path, err := repo.RepoFile(gitRepo, true, "objects", sha[0:2], sha[2:])
+	if err != nil {
+		t.Fatalf("RepoFile() failed: %v", err)
+	}
+	var buf bytes.Buffer
+	z := zlib.NewWriter(&buf)
+	z.Write([]byte("blob 10\x00short"))
+	z.Close()
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+
+	_, r, err := ObjectReader(gitRepo, sha)
+	if err != nil {
+		t.Fatalf("ObjectReader() failed: %v", err)
+	}
+	defer r.Close()
+	if _, err := io.ReadAll(r); err == nil {
+		t.Errorf("Expected a bad length error")
+	}
+
+	if _, err := ObjectRead(gitRepo, sha); err == nil {
+		t.Errorf("Expected ObjectRead() to reject the object")
+	}
+}
@@ -17,9 +17,6 @@ func (t *GitTag) Deserialize(data []byte) error {
 }
 
 func (t *GitTag) Serialize() ([]byte, error) {
-	// The canonical order for tags is different
-	// order := []string{"object", "type", "tag", "tagger", "gpgsig"}
-	// We need a slightly modified serializer for tags if the order matters strictly.
-	// For simplicity here, we'll reuse the commit serializer's logic.
-	return kvlmSerialize(t.Kvlm, t.Message), nil
+	// Tags have their own header order; a signature lives in the message
+	return kvlmSerialize(t.Kvlm, t.Message, tagKeyOrder), nil
 }
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/Notwinner0/gvcs/internal/repo"
 )
@@ -36,6 +38,23 @@ type GitTreeLeaf struct {
 	SHA  string // Stored as a hex string
 }
 
+// TreeLeafType returns the type of object a tree entry with the given mode
+// points to. Directories are accepted both as git writes them, "40000",
+// and zero-padded.
+func TreeLeafType(mode string) (string, error) {
+	switch mode {
+	case "40000", "040000":
+		return "tree", nil
+	case "100644", "100755", "100664":
+		return "blob", nil
+	case "120000":
+		return "blob", nil // Symlink
+	case "160000":
+		return "commit", nil // Submodule
+	}
+	return "", fmt.Errorf("weird tree leaf mode %s", mode)
+}
+
 // treeParse parses the raw data of a tree object.
 func treeParse(raw []byte) ([]GitTreeLeaf, error) {
 	var leaves []GitTreeLeaf
@@ -73,8 +92,8 @@ func treeSerialize(tree *GitTree) ([]byte, error) {
 		pathB := tree.Items[j].Path
 
 		// Directories are sorted with a trailing slash
-		isDirA := tree.Items[i].Mode == "040000"
-		isDirB := tree.Items[j].Mode == "040000"
+		isDirA := tree.Items[i].Mode == "40000" || tree.Items[i].Mode == "040000"
+		isDirB := tree.Items[j].Mode == "40000" || tree.Items[j].Mode == "040000"
 
 		if isDirA {
 			pathA += "/"
@@ -104,6 +123,36 @@ func treeSerialize(tree *GitTree) ([]byte, error) {
 	return b.Bytes(), nil
 }
 
+// TreeLookup returns the SHA of the entry at a slash-separated path below
+// a tree, the tree itself for an empty path, or "" if there is none.
+func TreeLookup(gitRepo *repo.GitRepository, tree, path string) (string, error) {
+	sha := tree
+	for _, name := range strings.Split(path, "/") {
+		if name == "" {
+			continue
+		}
+		obj, err := ObjectRead(gitRepo, sha)
+		if err != nil {
+			return "", err
+		}
+		t, ok := obj.(*GitTree)
+		if !ok {
+			return "", nil
+		}
+		sha = ""
+		for _, item := range t.Items {
+			if item.Path == name {
+				sha = item.SHA
+				break
+			}
+		}
+		if sha == "" {
+			return "", nil
+		}
+	}
+	return sha, nil
+}
+
 // TreeToMap recursively reads a tree and flattens it into a map.
 func TreeToMap(gitRepo *repo.GitRepository, ref, prefix string) (map[string]string, error) {
 	ret := make(map[string]string)
@@ -119,7 +168,7 @@ func TreeToMap(gitRepo *repo.GitRepository, ref, prefix string) (map[string]stri
 
 	for _, leaf := range tree.Items {
 		fullPath := filepath.Join(prefix, leaf.Path)
-		if leaf.Mode == "040000" { // is a subtree
+		if leaf.Mode == "40000" || leaf.Mode == "040000" { // is a subtree
 			subMap, err := TreeToMap(gitRepo, leaf.SHA, fullPath)
 			if err != nil {
 				return nil, err
@@ -0,0 +1,164 @@
+package reachable
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/Notwinner0/gvcs/internal/index"
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/refs"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// gitlinkMode marks submodule entries, whose commits live elsewhere.
+const gitlinkMode = 0160000
+
+var shaRE = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Root is something that keeps an object alive.
+type Root struct {
+	Name string // where it was found: "HEAD", a ref, "index:<path>" or "<ref>@{<n>}"
+	SHA  string
+}
+
+// RootList returns every root of the repository: HEAD, all refs, the
+// blobs staged in the index and every object named in a reflog.
+func RootList(gitRepo *repo.GitRepository) ([]Root, error) {
+	var roots []Root
+
+	head, err := refs.RefResolve(gitRepo, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	if head != "" {
+		roots = append(roots, Root{Name: "HEAD", SHA: head})
+	}
+
+	entries, err := refs.RefListSorted(gitRepo)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.SHA != "" {
+			roots = append(roots, Root{Name: e.Name, SHA: e.SHA})
+		}
+	}
+
+	idx, err := index.IndexRead(gitRepo)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range idx.Entries {
+		if entry.Mode&0170000 != gitlinkMode {
+			roots = append(roots, Root{Name: "index:" + entry.Name, SHA: entry.SHA})
+		}
+	}
+
+	logged, err := refs.ReflogList(gitRepo)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range logged {
+		log, err := refs.ReflogRead(gitRepo, ref)
+		if err != nil {
+			return nil, err
+		}
+		// Number entries newest first, as in ref@{0}
+		for i, e := range log {
+			name := fmt.Sprintf("%s@{%d}", ref, len(log)-1-i)
+			for _, sha := range []string{e.Old, e.New} {
+				if sha != refs.ZeroSHA {
+					roots = append(roots, Root{Name: name, SHA: sha})
+				}
+			}
+		}
+	}
+	return roots, nil
+}
+
+// Mark adds sha and every object reachable from it to seen. Objects already
+// in seen are not walked again, so repeated calls share the work. Blobs are
+// marked without being read. With ignoreMissing, links to objects that are
+// not stored are skipped instead of failing the walk.
+func Mark(gitRepo *repo.GitRepository, seen map[string]bool, sha string, ignoreMissing bool) error {
+	if seen[sha] {
+		return nil
+	}
+	seen[sha] = true
+	stack := []string{sha}
+
+	for len(stack) > 0 {
+		sha := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		links, err := objectLinks(gitRepo, sha)
+		if err != nil {
+			if ignoreMissing {
+				continue
+			}
+			return err
+		}
+		for _, link := range links {
+			if seen[link.sha] {
+				continue
+			}
+			seen[link.sha] = true
+			if link.walk {
+				stack = append(stack, link.sha)
+			}
+		}
+	}
+	return nil
+}
+
+// objectLink is one outgoing reference of an object.
+type objectLink struct {
+	sha  string
+	walk bool // false for blobs, which refer to nothing
+}
+
+// objectLinks lists the objects a commit, tree or tag refers to.
+func objectLinks(gitRepo *repo.GitRepository, sha string) ([]objectLink, error) {
+	if !shaRE.MatchString(sha) {
+		return nil, fmt.Errorf("invalid object name '%s'", sha)
+	}
+	header, r, err := objects.ObjectReader(gitRepo, sha)
+	if err != nil {
+		return nil, err
+	}
+	r.Close()
+	if header.Type == "blob" {
+		return nil, nil
+	}
+
+	obj, err := objects.ObjectRead(gitRepo, sha)
+	if err != nil {
+		return nil, err
+	}
+	var links []objectLink
+	switch o := obj.(type) {
+	case *objects.GitCommit:
+		for _, tree := range o.Kvlm["tree"] {
+			links = append(links, objectLink{sha: tree, walk: true})
+		}
+		for _, parent := range o.Kvlm["parent"] {
+			links = append(links, objectLink{sha: parent, walk: true})
+		}
+	case *objects.GitTag:
+		for _, target := range o.Kvlm["object"] {
+			links = append(links, objectLink{sha: target, walk: true})
+		}
+	case *objects.GitTree:
+		for _, leaf := range o.Items {
+			switch leaf.Mode {
+			case "40000", "040000":
+				links = append(links, objectLink{sha: leaf.SHA, walk: true})
+			case "160000":
+				// Submodule commits live in another repository
+			default:
+				links = append(links, objectLink{sha: leaf.SHA})
+			}
+		}
+	}
+	return links, nil
+}
@@ -0,0 +1,65 @@
+package reachable
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+func writeObject(t *testing.T, gitRepo *repo.GitRepository, objType, data string) string {
+	t.Helper()
+	sha, err := objects.ObjectHash(strings.NewReader(data), objType, gitRepo)
+	if err != nil {
+		t.Fatalf("ObjectHash() failed: %v", err)
+	}
+	return sha
+}
+
+func TestMark(t *testing.T) {
+	gitRepo, err := repo.RepoCreate(t.TempDir())
+	if err != nil {
+		t.Fatalf("RepoCreate() failed: %v", err)
+	}
+
+	ident := "T <t@x> 1700000000 +0000"
+	blob := writeObject(t, gitRepo, "blob", "hello\n")
+	raw := func(sha string) string {
+		b, _ := hex.DecodeString(sha)
+		return string(b)
+	}
+	sub := writeObject(t, gitRepo, "tree", "100644 f\x00"+raw(blob))
+	tree := writeObject(t, gitRepo, "tree", "40000 d\x00"+raw(sub))
+	first := writeObject(t, gitRepo, "commit", "tree "+tree+"\nauthor "+ident+"\ncommitter "+ident+"\n\none\n")
+	second := writeObject(t, gitRepo, "commit", "tree "+tree+"\nparent "+first+"\nauthor "+ident+"\ncommitter "+ident+"\n\ntwo\n")
+	tag := writeObject(t, gitRepo, "tag", "object "+second+"\ntype commit\ntag v1\ntagger "+ident+"\n\nv1\n")
+
+	seen := make(map[string]bool)
+	if err := Mark(gitRepo, seen, tag, false); err != nil {
+		t.Fatalf("Mark() failed: %v", err)
+	}
+	for _, sha := range []string{tag, second, first, tree, sub, blob} {
+		if !seen[sha] {
+			t.Errorf("Expected %s to be reachable", sha)
+		}
+	}
+	if len(seen) != 6 {
+		t.Errorf("Expected 6 reachable objects, got %d", len(seen))
+	}
+
+	// A commit whose parent is missing only walks with ignoreMissing
+	missing := strings.Repeat("1", 40)
+	orphan := writeObject(t, gitRepo, "commit", "tree "+tree+"\nparent "+missing+"\nauthor "+ident+"\ncommitter "+ident+"\n\nthree\n")
+	if err := Mark(gitRepo, make(map[string]bool), orphan, false); err == nil {
+		t.Errorf("Expected Mark() to fail on a missing parent")
+	}
+	seen = make(map[string]bool)
+	if err := Mark(gitRepo, seen, orphan, true); err != nil {
+		t.Fatalf("Mark() failed: %v", err)
+	}
+	if !seen[blob] {
+		t.Errorf("Expected %s to be reachable", blob)
+	}
+}
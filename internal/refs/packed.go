@@ -0,0 +1,78 @@
+package refs
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/lockfile"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// packedRefsRead returns the refs stored in the packed-refs file that
+// `git pack-refs` and `git gc` write. A loose ref of the same name takes
+// precedence over its packed value.
+func packedRefsRead(gitRepo *repo.GitRepository) (map[string]string, error) {
+	f, err := os.Open(repo.RepoPath(gitRepo, "packed-refs"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ret := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Skip the header and the peeled values of annotated tags
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+		sha, name, ok := strings.Cut(line, " ")
+		if ok {
+			ret[name] = sha
+		}
+	}
+	return ret, scanner.Err()
+}
+
+// packedRefsRemove rewrites packed-refs without the given refs, so that
+// deleting a ref does not resurrect its packed value.
+func packedRefsRemove(gitRepo *repo.GitRepository, names ...string) error {
+	path := repo.RepoPath(gitRepo, "packed-refs")
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	remove := make(map[string]bool, len(names))
+	for _, name := range names {
+		remove[name] = true
+	}
+
+	var b strings.Builder
+	changed, skipPeeled := false, false
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "^") && skipPeeled {
+			continue
+		}
+		skipPeeled = false
+		if _, name, ok := strings.Cut(strings.TrimRight(line, "\r\n"), " "); ok && line[0] != '#' && remove[name] {
+			changed, skipPeeled = true, true
+			continue
+		}
+		b.WriteString(line)
+	}
+	if !changed {
+		return nil
+	}
+	return lockfile.WriteFile(path, []byte(b.String()), repo.RepoFsync(gitRepo, "reference"))
+}
@@ -0,0 +1,139 @@
+package refs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Notwinner0/gvcs/internal/lockfile"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// ReflogEntry is one line of a ref's log.
+type ReflogEntry struct {
+	Old       string
+	New       string
+	Committer string // "Name <email> <unix time> <tz>"
+	Message   string
+}
+
+// reflogShouldLog reports whether updates to ref are logged, mirroring
+// core.logAllRefUpdates in a non-bare repository. Refs that already have a
+// log keep being logged.
+func reflogShouldLog(gitRepo *repo.GitRepository, ref string) bool {
+	if ref == "HEAD" {
+		return true
+	}
+	for _, prefix := range []string{"refs/heads/", "refs/remotes/", "refs/notes/", "refs/stash"} {
+		if strings.HasPrefix(ref, prefix) {
+			return true
+		}
+	}
+	_, err := os.Stat(repo.RepoPath(gitRepo, "logs", ref))
+	return err == nil
+}
+
+// ReflogAppend adds an entry to the log of ref, creating it if needed.
+func ReflogAppend(gitRepo *repo.GitRepository, ref string, entry ReflogEntry) error {
+	path, err := repo.RepoFile(gitRepo, true, "logs", ref)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	// Messages are single-line by construction
+	message := strings.ReplaceAll(strings.TrimSpace(entry.Message), "\n", " ")
+	_, err = fmt.Fprintf(f, "%s %s %s\t%s\n", entry.Old, entry.New, entry.Committer, message)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ReflogRead returns the entries of a ref's log, oldest first. A ref
+// without a log has no entries.
+func ReflogRead(gitRepo *repo.GitRepository, ref string) ([]ReflogEntry, error) {
+	f, err := os.Open(repo.RepoPath(gitRepo, "logs", ref))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []ReflogEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		head, message, _ := strings.Cut(line, "\t")
+		fields := strings.SplitN(head, " ", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("malformed reflog entry for %s: %q", ref, line)
+		}
+		entries = append(entries, ReflogEntry{
+			Old:       fields[0],
+			New:       fields[1],
+			Committer: fields[2],
+			Message:   message,
+		})
+	}
+	return entries, scanner.Err()
+}
+
+// ReflogWrite replaces the log of ref with entries, or deletes it when
+// entries is empty.
+func ReflogWrite(gitRepo *repo.GitRepository, ref string, entries []ReflogEntry) error {
+	path := repo.RepoPath(gitRepo, "logs", ref)
+	if len(entries) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	var b strings.Builder
+	for _, e := range entries {
+		fmt.Fprintf(&b, "%s %s %s\t%s\n", e.Old, e.New, e.Committer, e.Message)
+	}
+	return lockfile.WriteFile(path, []byte(b.String()), repo.RepoFsync(gitRepo, "reference"))
+}
+
+// ReflogList returns the names of all refs that have a log.
+func ReflogList(gitRepo *repo.GitRepository) ([]string, error) {
+	var ret []string
+	root := repo.RepoPath(gitRepo, "logs")
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		ret = append(ret, filepath.ToSlash(rel))
+		return nil
+	})
+	return ret, err
+}
+
+// reflogIdent formats an identity with the current time for a log entry.
+func reflogIdent(ident string) string {
+	now := time.Now()
+	return fmt.Sprintf("%s %d %s", ident, now.Unix(), now.Format("-0700"))
+}
@@ -7,42 +7,91 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/Notwinner0/gvcs/internal/lockfile"
 	"github.com/Notwinner0/gvcs/internal/repo"
 )
 
-// RefResolve follows a ref to its ultimate object SHA.
+// RefResolve follows a ref, through any symbolic refs, to its ultimate
+// object SHA. A ref that does not exist resolves to "".
 func RefResolve(gitRepo *repo.GitRepository, ref string) (string, error) {
-	path, err := repo.RepoFile(gitRepo, false, ref)
-	if err != nil {
-		return "", err
-	}
-
-	data, err := os.ReadFile(path)
 	// Special case: In a new repo, HEAD points to 'refs/heads/master',
 	// but that file doesn't exist yet. This is not an error.
+	_, sha, err := refFollow(gitRepo, ref)
+	return sha, err
+}
+
+// refReadDirect reads the value stored in a ref file, or in packed-refs,
+// without following symrefs. A missing ref reads as "".
+func refReadDirect(gitRepo *repo.GitRepository, ref string) (string, error) {
+	data, err := os.ReadFile(repo.RepoPath(gitRepo, ref))
 	if os.IsNotExist(err) {
-		return "", nil
+		packed, err := packedRefsRead(gitRepo)
+		return packed[ref], err
 	}
 	if err != nil {
 		return "", err
 	}
-
-	content := strings.TrimSpace(string(data))
-
-	if strings.HasPrefix(content, "ref: ") {
-		return RefResolve(gitRepo, content[5:])
-	}
-	return content, nil
+	return strings.TrimSpace(string(data)), nil
 }
 
-// RefList recursively collects all refs in a given path.
+// RefList recursively collects all refs in a given path. Regular refs map
+// to their SHA, symbolic refs to a Symref and directories to a nested map.
 func RefList(gitRepo *repo.GitRepository, path string) (map[string]interface{}, error) {
 	if path == "" {
 		path = repo.RepoPath(gitRepo, "refs")
 	}
 
+	ret, err := refListDir(gitRepo, path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Merge in packed refs under path that have no loose version
+	packed, err := packedRefsRead(gitRepo)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := filepath.Rel(gitRepo.Gitdir, path)
+	if err != nil {
+		return nil, err
+	}
+	prefix = filepath.ToSlash(prefix) + "/"
+	for name, sha := range packed {
+		rest, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+		refListInsert(ret, strings.Split(rest, "/"), sha)
+	}
+	return ret, nil
+}
+
+// refListInsert adds a ref to a RefList tree unless something is already
+// stored under its name.
+func refListInsert(m map[string]interface{}, parts []string, sha string) {
+	for _, dir := range parts[:len(parts)-1] {
+		sub, ok := m[dir].(map[string]interface{})
+		if !ok {
+			if _, exists := m[dir]; exists {
+				return
+			}
+			sub = make(map[string]interface{})
+			m[dir] = sub
+		}
+		m = sub
+	}
+	if _, exists := m[parts[len(parts)-1]]; !exists {
+		m[parts[len(parts)-1]] = sha
+	}
+}
+
+func refListDir(gitRepo *repo.GitRepository, path string) (map[string]interface{}, error) {
 	ret := make(map[string]interface{})
 	entries, err := os.ReadDir(path)
+	if os.IsNotExist(err) {
+		// Everything may be packed
+		return ret, nil
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -55,7 +104,7 @@ func RefList(gitRepo *repo.GitRepository, path string) (map[string]interface{},
 	for _, entry := range entries {
 		can := filepath.Join(path, entry.Name())
 		if entry.IsDir() {
-			sub, err := RefList(gitRepo, can)
+			sub, err := refListDir(gitRepo, can)
 			if err != nil {
 				return nil, err
 			}
@@ -66,40 +115,94 @@ func RefList(gitRepo *repo.GitRepository, path string) (map[string]interface{},
 			if err != nil {
 				return nil, err
 			}
+			relPath = filepath.ToSlash(relPath)
+			target, isSymref, err := SymrefRead(gitRepo, relPath)
+			if err != nil {
+				return nil, err
+			}
 			sha, err := RefResolve(gitRepo, relPath)
 			if err != nil {
 				return nil, err
 			}
-			ret[entry.Name()] = sha
+			if isSymref {
+				ret[entry.Name()] = Symref{Target: target, SHA: sha}
+			} else {
+				ret[entry.Name()] = sha
+			}
+		}
+	}
+	return ret, nil
+}
+
+// RefEntry is one ref in a flat listing.
+type RefEntry struct {
+	Name   string // full name, e.g. "refs/heads/master"
+	SHA    string // "" for a symbolic ref to a ref that does not exist yet
+	Symref string // the target if the ref is symbolic
+}
+
+// RefListSorted returns every ref under refs/, sorted by name.
+func RefListSorted(gitRepo *repo.GitRepository) ([]RefEntry, error) {
+	refList, err := RefList(gitRepo, "")
+	if err != nil {
+		return nil, err
+	}
+	var ret []RefEntry
+	var collect func(refMap map[string]interface{}, prefix string)
+	collect = func(refMap map[string]interface{}, prefix string) {
+		for k, v := range refMap {
+			name := prefix + "/" + k
+			switch val := v.(type) {
+			case string:
+				ret = append(ret, RefEntry{Name: name, SHA: val})
+			case Symref:
+				ret = append(ret, RefEntry{Name: name, SHA: val.SHA, Symref: val.Target})
+			case map[string]interface{}:
+				collect(val, name)
+			}
 		}
 	}
+	collect(refList, "refs")
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
 	return ret, nil
 }
 
+// RefCreate points refName at sha, replacing the ref file atomically under
+// its lock.
 func RefCreate(gitRepo *repo.GitRepository, refName, sha string) error {
 	path, err := repo.RepoFile(gitRepo, true, refName)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, []byte(sha+"\n"), 0644)
+	return lockfile.WriteFile(path, []byte(sha+"\n"), repo.RepoFsync(gitRepo, "reference"))
 }
 
 // BranchGetActive reads HEAD to find the current active branch.
 func BranchGetActive(gitRepo *repo.GitRepository) (string, bool, error) {
-	headFile := repo.RepoPath(gitRepo, "HEAD")
-	data, err := os.ReadFile(headFile)
+	target, isSymref, err := SymrefRead(gitRepo, "HEAD")
 	if err != nil {
 		return "", false, err
 	}
-	content := strings.TrimSpace(string(data))
-	if strings.HasPrefix(content, "ref: refs/heads/") {
-		return content[16:], false, nil // false means not detached
+	if isSymref {
+		return strings.TrimPrefix(target, "refs/heads/"), false, nil // false means not detached
+	}
+	sha, err := refReadDirect(gitRepo, "HEAD")
+	if err != nil {
+		return "", false, err
 	}
-	return content, true, nil // true means detached HEAD
+	return sha, true, nil // true means detached HEAD
 }
 
+// ShowRef prints a RefList tree in name order.
 func ShowRef(refs map[string]interface{}, prefix string, withHash bool) {
-	for k, v := range refs {
+	keys := make([]string, 0, len(refs))
+	for k := range refs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := refs[k]
 		fullPath := fmt.Sprintf("%s/%s", prefix, k)
 		switch val := v.(type) {
 		case string:
@@ -108,6 +211,16 @@ func ShowRef(refs map[string]interface{}, prefix string, withHash bool) {
 			} else {
 				fmt.Printf("%s\n", fullPath)
 			}
+		case Symref:
+			sha := val.SHA
+			if sha == "" {
+				sha = ZeroSHA
+			}
+			if withHash {
+				fmt.Printf("%s %s -> %s\n", sha, fullPath, val.Target)
+			} else {
+				fmt.Printf("%s -> %s\n", fullPath, val.Target)
+			}
 		case map[string]interface{}:
 			ShowRef(val, fullPath, withHash)
 		}
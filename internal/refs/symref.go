@@ -0,0 +1,168 @@
+package refs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/lockfile"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// SymrefMaxDepth is how many symbolic refs are followed before giving up,
+// matching git's limit.
+const SymrefMaxDepth = 5
+
+// Symref is how RefList reports a symbolic ref such as
+// refs/remotes/origin/HEAD.
+type Symref struct {
+	Target string // the ref pointed to, e.g. "refs/heads/master"
+	SHA    string // what Target resolves to, "" if it does not exist yet
+}
+
+// SymrefLoopError reports a chain of symbolic refs that loops back on
+// itself or is nested too deeply to follow.
+type SymrefLoopError struct {
+	Chain []string // the refs followed, in order
+	Cycle bool
+}
+
+func (e *SymrefLoopError) Error() string {
+	if e.Cycle {
+		return fmt.Sprintf("symbolic ref cycle: %s", strings.Join(e.Chain, " -> "))
+	}
+	return fmt.Sprintf("symbolic ref nesting too deep: %s", strings.Join(e.Chain, " -> "))
+}
+
+// refFollow follows "ref: " indirections from ref. It returns the name of the
+// ref that finally holds an object name and that name, "" if the ref does
+// not exist yet.
+func refFollow(gitRepo *repo.GitRepository, ref string) (string, string, error) {
+	chain := []string{ref}
+	seen := map[string]bool{}
+	for {
+		content, err := refReadDirect(gitRepo, ref)
+		if err != nil {
+			return "", "", err
+		}
+		if !strings.HasPrefix(content, "ref: ") {
+			return ref, content, nil
+		}
+
+		seen[ref] = true
+		ref = strings.TrimSpace(content[5:])
+		chain = append(chain, ref)
+		if seen[ref] {
+			return "", "", &SymrefLoopError{Chain: chain, Cycle: true}
+		}
+		if len(chain) > SymrefMaxDepth+1 {
+			return "", "", &SymrefLoopError{Chain: chain}
+		}
+	}
+}
+
+// SymrefRead returns the ref that a symbolic ref points to. The boolean is
+// false if ref holds an object name or does not exist.
+func SymrefRead(gitRepo *repo.GitRepository, ref string) (string, bool, error) {
+	content, err := refReadDirect(gitRepo, ref)
+	if err != nil {
+		return "", false, err
+	}
+	if !strings.HasPrefix(content, "ref: ") {
+		return "", false, nil
+	}
+	return strings.TrimSpace(content[5:]), true, nil
+}
+
+// SymrefWrite makes ref a symbolic ref pointing to target. If message is
+// not empty and target exists, the switch is recorded in ref's reflog.
+func SymrefWrite(gitRepo *repo.GitRepository, ref, target, committer, message string) error {
+	if err := CheckRefName(ref); err != nil {
+		return err
+	}
+	if err := CheckRefName(target); err != nil {
+		return err
+	}
+	// The rest of gvcs expects HEAD to name a branch when it is symbolic
+	if ref == "HEAD" && !strings.HasPrefix(target, "refs/heads/") {
+		return fmt.Errorf("refusing to point HEAD outside of refs/heads/")
+	}
+
+	// Refuse to create a loop through target back to ref
+	chain := []string{ref, target}
+	for next := target; ; {
+		if next == ref {
+			return &SymrefLoopError{Chain: chain, Cycle: true}
+		}
+		pointed, isSymref, err := SymrefRead(gitRepo, next)
+		if err != nil {
+			return err
+		}
+		if !isSymref {
+			break
+		}
+		next = pointed
+		chain = append(chain, next)
+		if len(chain) > SymrefMaxDepth+1 {
+			return &SymrefLoopError{Chain: chain}
+		}
+	}
+
+	old, _ := RefResolve(gitRepo, ref)
+	lock, err := lockfile.Acquire(repo.RepoPath(gitRepo, ref), repo.RepoFsync(gitRepo, "reference"))
+	if err != nil {
+		return err
+	}
+	if _, err := lock.Write([]byte("ref: " + target + "\n")); err != nil {
+		lock.Rollback()
+		return err
+	}
+	if err := lock.Commit(); err != nil {
+		return err
+	}
+
+	newSHA, err := RefResolve(gitRepo, target)
+	if message == "" || err != nil || newSHA == "" || !reflogShouldLog(gitRepo, ref) {
+		return nil
+	}
+	if old == "" {
+		old = ZeroSHA
+	}
+	if committer == "" {
+		committer = defaultIdent
+	}
+	return ReflogAppend(gitRepo, ref, ReflogEntry{Old: old, New: newSHA, Committer: reflogIdent(committer), Message: message})
+}
+
+// SymrefDelete removes a symbolic ref, leaving the ref it points to alone.
+func SymrefDelete(gitRepo *repo.GitRepository, ref string) error {
+	if ref == "HEAD" {
+		return fmt.Errorf("deleting '%s' is not allowed", ref)
+	}
+	if _, isSymref, err := SymrefRead(gitRepo, ref); err != nil {
+		return err
+	} else if !isSymref {
+		return fmt.Errorf("cannot delete %s: not a symbolic ref", ref)
+	}
+
+	lock, err := lockfile.Acquire(repo.RepoPath(gitRepo, ref), false)
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
+	if err := os.Remove(repo.RepoPath(gitRepo, ref)); err != nil {
+		return err
+	}
+	return ReflogWrite(gitRepo, ref, nil)
+}
+
+// RefShorten returns the short, unambiguous-in-practice form of a full ref
+// name: refs/heads/master becomes master, refs/tags/v1 becomes v1.
+func RefShorten(ref string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/", "refs/"} {
+		if strings.HasPrefix(ref, prefix) {
+			return ref[len(prefix):]
+		}
+	}
+	return ref
+}
@@ -0,0 +1,131 @@
+package refs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+func writeRef(t *testing.T, gitRepo *repo.GitRepository, ref, content string) {
+	t.Helper()
+	path, err := repo.RepoFile(gitRepo, true, ref)
+	if err != nil {
+		t.Fatalf("RepoFile() failed: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content+"\n"), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+}
+
+func TestSymref_ReadWrite(t *testing.T) {
+	gitRepo := newTestRepo(t)
+	writeRef(t, gitRepo, "refs/heads/dev", shaA)
+
+	if err := SymrefWrite(gitRepo, "HEAD", "refs/heads/dev", "", "checkout: moving to dev"); err != nil {
+		t.Fatalf("SymrefWrite() failed: %v", err)
+	}
+	target, isSymref, err := SymrefRead(gitRepo, "HEAD")
+	if err != nil || !isSymref || target != "refs/heads/dev" {
+		t.Errorf("Expected HEAD -> refs/heads/dev, got %q (symref %v, err %v)", target, isSymref, err)
+	}
+	if branch, detached, _ := BranchGetActive(gitRepo); branch != "dev" || detached {
+		t.Errorf("Expected active branch dev, got %q (detached %v)", branch, detached)
+	}
+	if sha, _ := RefResolve(gitRepo, "HEAD"); sha != shaA {
+		t.Errorf("Expected HEAD to resolve to %s, got %s", shaA, sha)
+	}
+	if entries, _ := ReflogRead(gitRepo, "HEAD"); len(entries) != 1 || entries[0].New != shaA {
+		t.Errorf("Expected one HEAD reflog entry for the switch, got %+v", entries)
+	}
+
+	if _, isSymref, _ := SymrefRead(gitRepo, "refs/heads/dev"); isSymref {
+		t.Errorf("Expected refs/heads/dev not to be a symbolic ref")
+	}
+	if err := SymrefWrite(gitRepo, "HEAD", "refs/tags/v1", "", ""); err == nil {
+		t.Errorf("Expected pointing HEAD at a tag to fail")
+	}
+	if err := SymrefDelete(gitRepo, "HEAD"); err == nil {
+		t.Errorf("Expected deleting HEAD to fail")
+	}
+}
+
+func TestSymref_Cycles(t *testing.T) {
+	gitRepo := newTestRepo(t)
+
+	if err := SymrefWrite(gitRepo, "refs/heads/a", "refs/heads/b", "", ""); err != nil {
+		t.Fatalf("SymrefWrite() failed: %v", err)
+	}
+	var loopErr *SymrefLoopError
+	err := SymrefWrite(gitRepo, "refs/heads/b", "refs/heads/a", "", "")
+	if !errors.As(err, &loopErr) || !loopErr.Cycle {
+		t.Errorf("Expected a cycle error, got %v", err)
+	}
+
+	// A cycle made behind our back is detected when reading
+	writeRef(t, gitRepo, "refs/heads/b", "ref: refs/heads/a")
+	if _, err := RefResolve(gitRepo, "refs/heads/a"); !errors.As(err, &loopErr) || !loopErr.Cycle {
+		t.Errorf("Expected a cycle error, got %v", err)
+	}
+
+	// A long chain without a cycle hits the depth limit
+	for i := 0; i <= SymrefMaxDepth; i++ {
+		writeRef(t, gitRepo, fmt.Sprintf("refs/chain/%d", i), fmt.Sprintf("ref: refs/chain/%d", i+1))
+	}
+	if _, err := RefResolve(gitRepo, "refs/chain/0"); !errors.As(err, &loopErr) || loopErr.Cycle {
+		t.Errorf("Expected a nesting error, got %v", err)
+	}
+}
+
+func TestRefList_Symref(t *testing.T) {
+	gitRepo := newTestRepo(t)
+	writeRef(t, gitRepo, "refs/remotes/origin/main", shaA)
+	if err := SymrefDelete(gitRepo, "refs/remotes/origin/HEAD"); err == nil {
+		t.Errorf("Expected deleting a missing symbolic ref to fail")
+	}
+	if err := SymrefWrite(gitRepo, "refs/remotes/origin/HEAD", "refs/remotes/origin/main", "", ""); err != nil {
+		t.Fatalf("SymrefWrite() failed: %v", err)
+	}
+
+	refList, err := RefList(gitRepo, "")
+	if err != nil {
+		t.Fatalf("RefList() failed: %v", err)
+	}
+	origin := refList["remotes"].(map[string]interface{})["origin"].(map[string]interface{})
+	if got := origin["main"]; got != shaA {
+		t.Errorf("Expected %s, got %v", shaA, got)
+	}
+	want := Symref{Target: "refs/remotes/origin/main", SHA: shaA}
+	if got := origin["HEAD"]; got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	if err := SymrefDelete(gitRepo, "refs/remotes/origin/HEAD"); err != nil {
+		t.Fatalf("SymrefDelete() failed: %v", err)
+	}
+	if sha, _ := RefResolve(gitRepo, "refs/remotes/origin/main"); sha != shaA {
+		t.Errorf("Expected the target to survive, got %q", sha)
+	}
+}
+
+func TestRefShorten(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{ref: "refs/heads/master", want: "master"},
+		{ref: "refs/heads/feature/x", want: "feature/x"},
+		{ref: "refs/tags/v1.0", want: "v1.0"},
+		{ref: "refs/remotes/origin/main", want: "origin/main"},
+		{ref: "refs/notes/commits", want: "notes/commits"},
+		{ref: "HEAD", want: "HEAD"},
+	}
+
+	for _, tt := range tests {
+		if got := RefShorten(tt.ref); got != tt.want {
+			t.Errorf("RefShorten(%q): expected %q, got %q", tt.ref, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package refs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/lockfile"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// ZeroSHA as an expected old value means the ref must not exist yet; as a
+// new value it deletes the ref.
+const ZeroSHA = "0000000000000000000000000000000000000000"
+
+// defaultIdent is used in reflog entries when the caller provides none.
+const defaultIdent = "gvcs <gvcs@example.com>"
+
+// RefMismatchError reports a ref whose current value is not the one a
+// transaction expected, typically because another process moved it.
+type RefMismatchError struct {
+	Ref      string
+	Expected string
+	Actual   string // "" if the ref does not exist
+}
+
+func (e *RefMismatchError) Error() string {
+	switch {
+	case e.Expected == ZeroSHA:
+		return fmt.Sprintf("cannot lock ref '%s': reference already exists", e.Ref)
+	case e.Actual == "":
+		return fmt.Sprintf("cannot lock ref '%s': unable to resolve reference", e.Ref)
+	default:
+		return fmt.Sprintf("cannot lock ref '%s': is at %s but expected %s", e.Ref, e.Actual, e.Expected)
+	}
+}
+
+type refUpdate struct {
+	name    string // the ref as queued, possibly a symref such as HEAD
+	target  string // the ref file actually written, after following symrefs
+	newSHA  string // "" for verify-only updates, ZeroSHA to delete
+	oldSHA  string // "" if the old value is not checked
+	message string
+	current string
+	lock    *lockfile.Lockfile
+}
+
+// RefTransaction applies a batch of ref updates all at once. Every ref is
+// locked and checked against its expected old value before any of them is
+// changed, so either all updates happen or none do.
+type RefTransaction struct {
+	gitRepo   *repo.GitRepository
+	updates   []*refUpdate
+	Committer string // "Name <email>" recorded in reflog entries
+	NoDeref   bool   // update symrefs themselves instead of what they point to
+}
+
+// RefTransactionBegin starts an empty transaction.
+func RefTransactionBegin(gitRepo *repo.GitRepository) *RefTransaction {
+	return &RefTransaction{gitRepo: gitRepo}
+}
+
+// Update queues setting ref to newSHA. If oldSHA is not empty, the ref must
+// currently hold it (ZeroSHA: must not exist).
+func (tx *RefTransaction) Update(ref, newSHA, oldSHA, message string) error {
+	if err := CheckRefName(ref); err != nil {
+		return err
+	}
+	for _, u := range tx.updates {
+		if u.name == ref {
+			return fmt.Errorf("multiple updates for ref '%s' not allowed", ref)
+		}
+	}
+	tx.updates = append(tx.updates, &refUpdate{name: ref, newSHA: newSHA, oldSHA: oldSHA, message: message})
+	return nil
+}
+
+// Create queues creating a ref that must not exist yet.
+func (tx *RefTransaction) Create(ref, newSHA, message string) error {
+	return tx.Update(ref, newSHA, ZeroSHA, message)
+}
+
+// Delete queues removing a ref, optionally checking its old value.
+func (tx *RefTransaction) Delete(ref, oldSHA, message string) error {
+	return tx.Update(ref, ZeroSHA, oldSHA, message)
+}
+
+// Verify queues a check that ref holds oldSHA without changing it.
+func (tx *RefTransaction) Verify(ref, oldSHA string) error {
+	return tx.Update(ref, "", oldSHA, "")
+}
+
+// Commit locks every ref, verifies the expected old values and applies the
+// updates. On any error, all locks are released and no ref is changed.
+func (tx *RefTransaction) Commit() error {
+	for _, u := range tx.updates {
+		u.target = u.name
+		if !tx.NoDeref {
+			target, _, err := refFollow(tx.gitRepo, u.name)
+			if err != nil {
+				return err
+			}
+			u.target = target
+		}
+	}
+
+	// Lock in a stable order so concurrent transactions cannot deadlock
+	// each other into mutual failure.
+	sorted := append([]*refUpdate(nil), tx.updates...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].target < sorted[j].target })
+
+	// Reject two updates of one ref file before any lock is taken
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i-1].target == sorted[i].target {
+			return fmt.Errorf("multiple updates for ref '%s' not allowed", sorted[i].target)
+		}
+	}
+
+	fsync := repo.RepoFsync(tx.gitRepo, "reference")
+	for _, u := range sorted {
+		lock, err := lockfile.Acquire(repo.RepoPath(tx.gitRepo, u.target), fsync)
+		if err != nil {
+			tx.release()
+			return err
+		}
+		u.lock = lock
+	}
+
+	// Verify expected values while holding every lock
+	for _, u := range sorted {
+		current, err := refReadDirect(tx.gitRepo, u.target)
+		if err == nil && strings.HasPrefix(current, "ref: ") {
+			// A symref replaced with NoDeref is at the commit it points to
+			current, err = RefResolve(tx.gitRepo, u.target)
+		}
+		if err != nil {
+			tx.release()
+			return err
+		}
+		u.current = current
+		if u.oldSHA == "" {
+			continue
+		}
+		if (u.oldSHA == ZeroSHA && current != "") || (u.oldSHA != ZeroSHA && current != u.oldSHA) {
+			tx.release()
+			return &RefMismatchError{Ref: u.name, Expected: u.oldSHA, Actual: current}
+		}
+	}
+
+	for _, u := range sorted {
+		if u.newSHA == "" || u.newSHA == ZeroSHA {
+			continue
+		}
+		if _, err := u.lock.Write([]byte(u.newSHA + "\n")); err != nil {
+			tx.release()
+			return err
+		}
+	}
+
+	// Everything is verified; apply the updates
+	var errs []error
+	for _, u := range sorted {
+		switch u.newSHA {
+		case "":
+			u.lock.Rollback()
+		case ZeroSHA:
+			if err := os.Remove(repo.RepoPath(tx.gitRepo, u.target)); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+			if err := packedRefsRemove(tx.gitRepo, u.target); err != nil {
+				errs = append(errs, err)
+			}
+			u.lock.Rollback()
+			if err := ReflogWrite(tx.gitRepo, u.target, nil); err != nil {
+				errs = append(errs, err)
+			}
+		default:
+			if err := u.lock.Commit(); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if err := tx.log(u); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		u.lock = nil
+	}
+	return errors.Join(errs...)
+}
+
+// Abort releases a transaction without applying it.
+func (tx *RefTransaction) Abort() {
+	tx.release()
+	tx.updates = nil
+}
+
+func (tx *RefTransaction) release() {
+	for _, u := range tx.updates {
+		if u.lock != nil {
+			u.lock.Rollback()
+			u.lock = nil
+		}
+	}
+}
+
+// log records an applied update in the reflogs of the written ref and of
+// HEAD when it points there.
+func (tx *RefTransaction) log(u *refUpdate) error {
+	ident := tx.Committer
+	if ident == "" {
+		ident = defaultIdent
+	}
+	old := u.current
+	if old == "" {
+		old = ZeroSHA
+	}
+	entry := ReflogEntry{Old: old, New: u.newSHA, Committer: reflogIdent(ident), Message: u.message}
+
+	logged := map[string]bool{}
+	for _, ref := range []string{u.target, u.name} {
+		if logged[ref] || !reflogShouldLog(tx.gitRepo, ref) {
+			continue
+		}
+		logged[ref] = true
+		if err := ReflogAppend(tx.gitRepo, ref, entry); err != nil {
+			return err
+		}
+	}
+	if !logged["HEAD"] {
+		if head, _, err := refFollow(tx.gitRepo, "HEAD"); err == nil && head == u.target && head != "HEAD" {
+			return ReflogAppend(tx.gitRepo, "HEAD", entry)
+		}
+	}
+	return nil
+}
+
+// CheckRefName validates a ref name against git's naming rules.
+func CheckRefName(ref string) error {
+	bad := func(reason string) error {
+		return fmt.Errorf("invalid ref name '%s': %s", ref, reason)
+	}
+	if ref == "" {
+		return bad("empty")
+	}
+	if !strings.HasPrefix(ref, "refs/") && strings.ToUpper(ref) != ref {
+		return bad("must be HEAD-like or start with refs/")
+	}
+	if strings.HasSuffix(ref, "/") || strings.HasSuffix(ref, ".") || strings.HasSuffix(ref, ".lock") {
+		return bad("bad ending")
+	}
+	if strings.Contains(ref, "..") || strings.Contains(ref, "//") || strings.Contains(ref, "@{") {
+		return bad("bad sequence")
+	}
+	for _, c := range ref {
+		if c < 0x20 || c == 0x7f || strings.ContainsRune(" ~^:?*[\\", c) {
+			return bad(fmt.Sprintf("contains %q", c))
+		}
+	}
+	for _, part := range strings.Split(ref, "/") {
+		if part == "" || strings.HasPrefix(part, ".") {
+			return bad("bad component")
+		}
+	}
+	return nil
+}
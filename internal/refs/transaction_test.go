@@ -0,0 +1,232 @@
+package refs
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+const (
+	shaA = "1111111111111111111111111111111111111111"
+	shaB = "2222222222222222222222222222222222222222"
+)
+
+func newTestRepo(t *testing.T) *repo.GitRepository {
+	t.Helper()
+	gitRepo, err := repo.RepoCreate(t.TempDir())
+	if err != nil {
+		t.Fatalf("RepoCreate() failed: %v", err)
+	}
+	return gitRepo
+}
+
+func readRef(t *testing.T, gitRepo *repo.GitRepository, ref string) string {
+	t.Helper()
+	value, err := refReadDirect(gitRepo, ref)
+	if err != nil {
+		t.Fatalf("reading %s failed: %v", ref, err)
+	}
+	return value
+}
+
+func TestRefTransaction_CompareAndSwap(t *testing.T) {
+	gitRepo := newTestRepo(t)
+
+	tx := RefTransactionBegin(gitRepo)
+	tx.Create("refs/heads/dev", shaA, "branch: Created")
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() failed: %v", err)
+	}
+	if got := readRef(t, gitRepo, "refs/heads/dev"); got != shaA {
+		t.Errorf("Expected %s, got %s", shaA, got)
+	}
+
+	// Creating an existing ref must fail
+	tx = RefTransactionBegin(gitRepo)
+	tx.Create("refs/heads/dev", shaB, "")
+	var mismatch *RefMismatchError
+	if err := tx.Commit(); !errors.As(err, &mismatch) {
+		t.Errorf("Expected a *RefMismatchError, got %v", err)
+	}
+
+	// A stale old value must be rejected and leave the ref alone
+	tx = RefTransactionBegin(gitRepo)
+	tx.Update("refs/heads/dev", shaB, shaB, "")
+	if err := tx.Commit(); !errors.As(err, &mismatch) {
+		t.Errorf("Expected a *RefMismatchError, got %v", err)
+	} else if mismatch.Actual != shaA {
+		t.Errorf("Expected actual value %s, got %s", shaA, mismatch.Actual)
+	}
+	if got := readRef(t, gitRepo, "refs/heads/dev"); got != shaA {
+		t.Errorf("Expected %s after a failed update, got %s", shaA, got)
+	}
+
+	tx = RefTransactionBegin(gitRepo)
+	tx.Update("refs/heads/dev", shaB, shaA, "reset: moving")
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() failed: %v", err)
+	}
+	if got := readRef(t, gitRepo, "refs/heads/dev"); got != shaB {
+		t.Errorf("Expected %s, got %s", shaB, got)
+	}
+
+	entries, err := ReflogRead(gitRepo, "refs/heads/dev")
+	if err != nil {
+		t.Fatalf("ReflogRead() failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 reflog entries, got %d", len(entries))
+	}
+	if entries[0].Old != ZeroSHA || entries[0].New != shaA || entries[0].Message != "branch: Created" {
+		t.Errorf("Unexpected first reflog entry %+v", entries[0])
+	}
+	if entries[1].Old != shaA || entries[1].New != shaB {
+		t.Errorf("Unexpected second reflog entry %+v", entries[1])
+	}
+}
+
+func TestRefTransaction_AllOrNothing(t *testing.T) {
+	gitRepo := newTestRepo(t)
+
+	tx := RefTransactionBegin(gitRepo)
+	tx.Create("refs/heads/master", shaA, "")
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() failed: %v", err)
+	}
+
+	// The failing verify must prevent the other two updates
+	tx = RefTransactionBegin(gitRepo)
+	tx.Create("refs/tags/v1", shaA, "")
+	tx.Update("refs/heads/topic", shaB, "", "")
+	tx.Verify("refs/heads/master", shaB)
+	if err := tx.Commit(); err == nil {
+		t.Fatalf("Expected Commit() to fail")
+	}
+	for _, ref := range []string{"refs/tags/v1", "refs/heads/topic"} {
+		if got := readRef(t, gitRepo, ref); got != "" {
+			t.Errorf("Expected %s to be untouched, got %s", ref, got)
+		}
+	}
+	for _, ref := range []string{"refs/tags/v1", "refs/heads/topic", "refs/heads/master"} {
+		if _, err := os.Stat(repo.RepoPath(gitRepo, ref) + ".lock"); !os.IsNotExist(err) {
+			t.Errorf("Expected the lock on %s to be released", ref)
+		}
+	}
+}
+
+func TestRefTransaction_DuplicateTarget(t *testing.T) {
+	gitRepo := newTestRepo(t)
+
+	// HEAD and refs/heads/master resolve to the same ref file; refs/heads/a
+	// sorts first so that a lock would already be held when the duplicate
+	// is found
+	tx := RefTransactionBegin(gitRepo)
+	tx.Update("refs/heads/a", shaA, "", "")
+	tx.Update("HEAD", shaA, "", "")
+	tx.Update("refs/heads/master", shaB, "", "")
+	if err := tx.Commit(); err == nil {
+		t.Fatalf("Expected Commit() to fail")
+	}
+	for _, ref := range []string{"refs/heads/a", "refs/heads/master"} {
+		if _, err := os.Stat(repo.RepoPath(gitRepo, ref) + ".lock"); !os.IsNotExist(err) {
+			t.Errorf("Expected no lock on %s to be left behind", ref)
+		}
+	}
+
+	tx = RefTransactionBegin(gitRepo)
+	tx.Update("refs/heads/master", shaA, "", "")
+	if err := tx.Commit(); err != nil {
+		t.Errorf("Commit() after a rejected transaction failed: %v", err)
+	}
+}
+
+func TestRefTransaction_DeleteAndDeref(t *testing.T) {
+	gitRepo := newTestRepo(t)
+
+	// HEAD points at refs/heads/master, which does not exist yet
+	tx := RefTransactionBegin(gitRepo)
+	tx.Update("HEAD", shaA, ZeroSHA, "commit (initial): first")
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() failed: %v", err)
+	}
+	if got := readRef(t, gitRepo, "refs/heads/master"); got != shaA {
+		t.Errorf("Expected the update through HEAD to reach master, got %q", got)
+	}
+	if got := readRef(t, gitRepo, "HEAD"); got != "ref: refs/heads/master" {
+		t.Errorf("Expected HEAD to stay symbolic, got %q", got)
+	}
+	if entries, _ := ReflogRead(gitRepo, "HEAD"); len(entries) != 1 {
+		t.Errorf("Expected 1 HEAD reflog entry, got %d", len(entries))
+	}
+
+	tx = RefTransactionBegin(gitRepo)
+	tx.Delete("refs/heads/master", shaA, "")
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() failed: %v", err)
+	}
+	if got := readRef(t, gitRepo, "refs/heads/master"); got != "" {
+		t.Errorf("Expected master to be deleted, got %s", got)
+	}
+	if entries, _ := ReflogRead(gitRepo, "refs/heads/master"); len(entries) != 0 {
+		t.Errorf("Expected the reflog of a deleted ref to be removed")
+	}
+}
+
+func TestRefTransaction_NoDeref(t *testing.T) {
+	gitRepo := newTestRepo(t)
+
+	tx := RefTransactionBegin(gitRepo)
+	tx.Create("refs/heads/master", shaA, "")
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() failed: %v", err)
+	}
+
+	// Detaching HEAD checks and logs the commit it pointed to
+	tx = RefTransactionBegin(gitRepo)
+	tx.NoDeref = true
+	tx.Update("HEAD", shaB, shaA, "checkout: moving")
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() failed: %v", err)
+	}
+	if got := readRef(t, gitRepo, "HEAD"); got != shaB {
+		t.Errorf("Expected HEAD to be detached at %s, got %q", shaB, got)
+	}
+	if got := readRef(t, gitRepo, "refs/heads/master"); got != shaA {
+		t.Errorf("Expected master to stay at %s, got %s", shaA, got)
+	}
+	entries, err := ReflogRead(gitRepo, "HEAD")
+	if err != nil {
+		t.Fatalf("ReflogRead() failed: %v", err)
+	}
+	if last := entries[len(entries)-1]; last.Old != shaA || last.New != shaB {
+		t.Errorf("Unexpected HEAD reflog entry %+v", last)
+	}
+}
+
+func TestCheckRefName(t *testing.T) {
+	tests := []struct {
+		ref     string
+		wantErr bool
+	}{
+		{ref: "HEAD", wantErr: false},
+		{ref: "refs/heads/master", wantErr: false},
+		{ref: "refs/heads/feature/x", wantErr: false},
+		{ref: "master", wantErr: true},
+		{ref: "refs/heads/a..b", wantErr: true},
+		{ref: "refs/heads/a b", wantErr: true},
+		{ref: "refs/heads/x.lock", wantErr: true},
+		{ref: "refs/heads/", wantErr: true},
+		{ref: "refs/heads/.hidden", wantErr: true},
+		{ref: "refs/heads/a@{1}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			if err := CheckRefName(tt.ref); (err != nil) != tt.wantErr {
+				t.Errorf("CheckRefName(%q) error = %v, wantErr %v", tt.ref, err, tt.wantErr)
+			}
+		})
+	}
+}
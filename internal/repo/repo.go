@@ -210,6 +210,36 @@ func repoDefaultConfig() *configparser.ConfigParser {
 	return config
 }
 
+// RepoFsync reports whether writes of the given component ("loose-object",
+// "reference" or "index") should be flushed to disk before they are renamed
+// into place. It follows core.fsync, with core.fsyncObjectFiles honoured
+// for loose objects. Only references are flushed by default.
+func RepoFsync(repo *GitRepository, component string) bool {
+	enabled := map[string]bool{"reference": true}
+	if v, err := repo.Conf.Get("core", "fsyncobjectfiles"); err == nil && v == "true" {
+		enabled["loose-object"] = true
+	}
+	if v, err := repo.Conf.Get("core", "fsync"); err == nil {
+		for _, c := range strings.Split(v, ",") {
+			c = strings.TrimSpace(c)
+			switch {
+			case c == "none":
+				enabled = map[string]bool{}
+			case c == "all":
+				enabled = map[string]bool{"loose-object": true, "reference": true, "index": true}
+			case c == "committed":
+				enabled["loose-object"] = true
+				enabled["reference"] = true
+			case strings.HasPrefix(c, "-"):
+				delete(enabled, c[1:])
+			case c != "":
+				enabled[c] = true
+			}
+		}
+	}
+	return enabled[component]
+}
+
 // repoFind finds the root of the repository.
 func RepoFind(path string, required bool) (*GitRepository, error) {
 	absPath, err := filepath.Abs(path)
@@ -2,6 +2,20 @@
 
 package repo
 
+import (
+	"os"
+	"syscall"
+)
+
 func hideGitDir(path string) {
 	// no-op on non-Windows
 }
+
+// DiskUsage returns the space a file occupies on disk, which is what git
+// reports for object sizes.
+func DiskUsage(info os.FileInfo) int64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int64(st.Blocks) * 512
+	}
+	return info.Size()
+}
@@ -2,7 +2,10 @@
 
 package repo
 
-import "syscall"
+import (
+	"os"
+	"syscall"
+)
 
 func hideGitDir(path string) {
 	pathPtr, err := syscall.UTF16PtrFromString(path)
@@ -10,3 +13,9 @@ func hideGitDir(path string) {
 		_ = syscall.SetFileAttributes(pathPtr, syscall.FILE_ATTRIBUTE_HIDDEN)
 	}
 }
+
+// DiskUsage returns the space a file occupies on disk. Windows does not
+// report allocated blocks, so this is the file size.
+func DiskUsage(info os.FileInfo) int64 {
+	return info.Size()
+}
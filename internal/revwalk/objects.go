@@ -0,0 +1,103 @@
+package revwalk
+
+import (
+	"fmt"
+
+	"github.com/Notwinner0/gvcs/internal/objects"
+)
+
+// Object is a tree or blob listed by Objects.
+type Object struct {
+	SHA  string
+	Type string
+	Path string // "" for the root tree of a commit
+}
+
+// Objects lists the trees and blobs of the given commits that the hidden
+// side of the walk does not already have, as `rev-list --objects` does.
+// Each object is listed once, under the first path it is met at. It must
+// be called after Walk.
+func (w *Walker) Objects(commits []*Commit) ([]Object, error) {
+	seen := make(map[string]bool)
+
+	// What the excluded tips and the hidden parents of walked commits
+	// refer to is already known to the other side
+	var bottoms []string
+	bottoms = append(bottoms, w.exclude...)
+	for _, c := range commits {
+		for _, parent := range c.Parents {
+			if w.hidden[parent] {
+				bottoms = append(bottoms, parent)
+			}
+		}
+	}
+	for _, sha := range bottoms {
+		c, err := w.Lookup(sha)
+		if err != nil {
+			return nil, err
+		}
+		if err := w.treeObjects(commitTree(c), "", seen, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	var list []Object
+	for _, c := range commits {
+		if err := w.treeObjects(commitTree(c), "", seen, &list); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+func commitTree(c *Commit) string {
+	if tree := c.Commit.Kvlm["tree"]; len(tree) > 0 {
+		return tree[0]
+	}
+	return ""
+}
+
+// treeObjects adds a tree and everything below it that is not in seen to
+// seen and, if list is not nil, to list, tree before entries.
+func (w *Walker) treeObjects(sha, path string, seen map[string]bool, list *[]Object) error {
+	if sha == "" || seen[sha] {
+		return nil
+	}
+	seen[sha] = true
+	if list != nil {
+		*list = append(*list, Object{SHA: sha, Type: "tree", Path: path})
+	}
+
+	obj, err := objects.ObjectRead(w.gitRepo, sha)
+	if err != nil {
+		return err
+	}
+	tree, ok := obj.(*objects.GitTree)
+	if !ok {
+		return fmt.Errorf("object %s is not a tree", sha)
+	}
+	for _, leaf := range tree.Items {
+		objType, err := objects.TreeLeafType(leaf.Mode)
+		if err != nil {
+			return err
+		}
+		leafPath := leaf.Path
+		if path != "" {
+			leafPath = path + "/" + leaf.Path
+		}
+		switch objType {
+		case "tree":
+			if err := w.treeObjects(leaf.SHA, leafPath, seen, list); err != nil {
+				return err
+			}
+		case "blob":
+			if !seen[leaf.SHA] {
+				seen[leaf.SHA] = true
+				if list != nil {
+					*list = append(*list, Object{SHA: leaf.SHA, Type: "blob", Path: leafPath})
+				}
+			}
+		}
+	}
+	return nil
+}
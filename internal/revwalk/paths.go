@@ -0,0 +1,119 @@
+package revwalk
+
+import (
+	"github.com/Notwinner0/gvcs/internal/diff"
+)
+
+// simplify decides which parents of c the walk goes on to and whether c
+// changes the limited paths. Without paths every commit is interesting.
+//
+// A commit that is TREESAME to a parent, with no change to the paths
+// relative to it, is not interesting, and only that parent is followed:
+// the history of the paths came from there, so a side branch merged
+// without touching them is pruned. A merge that differs from every
+// parent is kept, along with all its parents.
+func (w *Walker) simplify(c *Commit) ([]string, bool, error) {
+	parents := w.parents(c)
+	if len(w.paths) == 0 {
+		return parents, true, nil
+	}
+
+	tree := commitTree(c)
+	if len(parents) == 0 {
+		changes, err := diff.TreeDiff(w.gitRepo, "", tree, w.paths)
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, len(changes) > 0, nil
+	}
+
+	for _, parent := range parents {
+		p, err := w.Lookup(parent)
+		if err != nil {
+			return nil, false, err
+		}
+		changes, err := diff.TreeDiff(w.gitRepo, commitTree(p), tree, w.paths)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(changes) == 0 {
+			return []string{parent}, false, nil
+		}
+		if w.opts.Follow && len(parents) == 1 {
+			if err := w.followRename(commitTree(p), tree, changes); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+	return parents, true, nil
+}
+
+// followRename switches the followed path to its old name when this
+// commit added it by renaming another file, as rename detection with
+// Options.Renames finds.
+func (w *Walker) followRename(oldTree, newTree string, changes []diff.Change) error {
+	if len(changes) != 1 || changes[0].Status != 'A' || changes[0].NewPath != w.paths[0] {
+		return nil
+	}
+
+	// Only the followed file needs a source, so leave out other additions
+	all, err := diff.TreeDiff(w.gitRepo, oldTree, newTree, nil)
+	if err != nil {
+		return err
+	}
+	candidates := []diff.Change{changes[0]}
+	for _, c := range all {
+		if c.Status == 'D' {
+			candidates = append(candidates, c)
+		}
+	}
+	renamed, _, err := diff.DetectRenames(w.gitRepo, candidates, w.opts.Renames)
+	if err != nil {
+		return err
+	}
+	for _, c := range renamed {
+		if c.Status == 'R' && c.NewPath == w.paths[0] {
+			w.paths = []string{c.OldPath}
+			break
+		}
+	}
+	return nil
+}
+
+// Parents returns the parents of a commit from the last Walk as they
+// appear in its result. Without path limiting these are the parents the
+// walk follows. With it, parents that were pruned from the result are
+// replaced by their nearest ancestors that were not, so a graph of the
+// result stays connected.
+func (w *Walker) Parents(c *Commit) []string {
+	if len(w.opts.Paths) == 0 {
+		return w.parents(c)
+	}
+	var parents []string
+	added := make(map[string]bool)
+	visited := make(map[string]bool)
+	stack := append([]string(nil), c.follow...)
+	for i, j := 0, len(stack)-1; i < j; i, j = i+1, j-1 {
+		stack[i], stack[j] = stack[j], stack[i]
+	}
+	for len(stack) > 0 {
+		sha := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if visited[sha] || !w.seen[sha] {
+			continue
+		}
+		visited[sha] = true
+		p := w.cache[sha]
+		if p.shown {
+			if !added[sha] {
+				added[sha] = true
+				parents = append(parents, sha)
+			}
+			continue
+		}
+		for i := len(p.follow) - 1; i >= 0; i-- {
+			stack = append(stack, p.follow[i])
+		}
+	}
+	return parents
+}
@@ -0,0 +1,91 @@
+package revwalk
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Notwinner0/gvcs/internal/objects"
+)
+
+// AddRevisions adds revisions given in rev-list syntax: "B" walks B,
+// "^A" hides A, "A..B" is "B ^A" and "A...B" walks both sides but hides
+// their merge bases. An omitted side of a range means HEAD. "--not"
+// flips the meaning of the prefix for the revisions that follow it.
+func (w *Walker) AddRevisions(args []string) error {
+	not := false
+	for _, arg := range args {
+		if arg == "--not" {
+			not = !not
+			continue
+		}
+
+		if left, right, ok := strings.Cut(arg, "..."); ok {
+			a, err := w.resolve(left)
+			if err != nil {
+				return err
+			}
+			b, err := w.resolve(right)
+			if err != nil {
+				return err
+			}
+			bases, err := MergeBases(w.gitRepo, a, b)
+			if err != nil {
+				return err
+			}
+			w.add(a, not)
+			w.add(b, not)
+			for _, base := range bases {
+				w.add(base, !not)
+			}
+			continue
+		}
+		if left, right, ok := strings.Cut(arg, ".."); ok {
+			a, err := w.resolve(left)
+			if err != nil {
+				return err
+			}
+			b, err := w.resolve(right)
+			if err != nil {
+				return err
+			}
+			w.add(a, !not)
+			w.add(b, not)
+			continue
+		}
+
+		hide := not
+		if strings.HasPrefix(arg, "^") {
+			arg = arg[1:]
+			hide = !hide
+		}
+		sha, err := w.resolve(arg)
+		if err != nil {
+			return err
+		}
+		w.add(sha, hide)
+	}
+	return nil
+}
+
+func (w *Walker) add(sha string, hide bool) {
+	if hide {
+		w.Hide(sha)
+	} else {
+		w.Push(sha)
+	}
+}
+
+// resolve names a commit, peeling tags.
+func (w *Walker) resolve(name string) (string, error) {
+	if name == "" {
+		name = "HEAD"
+	}
+	sha, err := objects.ObjectFind(w.gitRepo, name, "commit", true)
+	if err != nil {
+		return "", err
+	}
+	if sha == "" {
+		return "", fmt.Errorf("%s is not a commit", name)
+	}
+	return sha, nil
+}
@@ -0,0 +1,362 @@
+package revwalk
+
+import (
+	"container/heap"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Notwinner0/gvcs/internal/diff"
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+// Order is the order in which a Walker returns commits.
+type Order int
+
+const (
+	// OrderDefault returns commits newest first by committer date as the
+	// walk reaches them, so a parent may precede a child with an older
+	// clock.
+	OrderDefault Order = iota
+	// OrderDate never shows a parent before all its children, otherwise
+	// newest first.
+	OrderDate
+	// OrderTopo never shows a parent before all its children and avoids
+	// interleaving lines of history.
+	OrderTopo
+)
+
+// Options selects and orders the commits of a walk.
+type Options struct {
+	MaxCount    int            // stop after this many commits; 0 for no limit
+	Since       time.Time      // only commits newer than this, if not zero
+	Until       time.Time      // only commits older than this, if not zero
+	Author      *regexp.Regexp // only commits whose "Name <email>" matches
+	FirstParent bool           // follow only the first parent of merges
+	Order       Order
+	Paths       []string // only commits that change these paths
+	Follow      bool     // follow the single path in Paths across renames
+	Renames     diff.RenameOptions
+}
+
+// Commit is a commit returned by a walk.
+type Commit struct {
+	SHA     string
+	Commit  *objects.GitCommit
+	Parents []string
+	Time    time.Time // committer date
+	index   int       // order of discovery, to break ties
+	follow  []string  // the parents the walk went on to
+	shown   bool      // whether Walk returned the commit
+}
+
+// Walker enumerates the commits reachable from included commits but not
+// from excluded ones, like `git rev-list B ^A`.
+type Walker struct {
+	gitRepo *repo.GitRepository
+	opts    Options
+	include []string
+	exclude []string
+	hidden  map[string]bool // the excluded commits and their ancestors
+	cache   map[string]*Commit
+	paths   []string        // the current paths, which Follow renames
+	seen    map[string]bool // the commits the walk reached
+}
+
+// New creates a Walker with nothing to walk yet.
+func New(gitRepo *repo.GitRepository, opts Options) *Walker {
+	return &Walker{gitRepo: gitRepo, opts: opts, cache: make(map[string]*Commit), paths: opts.Paths}
+}
+
+// Push adds a commit whose history is walked.
+func (w *Walker) Push(sha string) {
+	w.include = append(w.include, sha)
+}
+
+// Hide excludes a commit and all its ancestors from the walk.
+func (w *Walker) Hide(sha string) {
+	w.exclude = append(w.exclude, sha)
+}
+
+// Lookup reads a commit, caching it for the rest of the walk.
+func (w *Walker) Lookup(sha string) (*Commit, error) {
+	if c, ok := w.cache[sha]; ok {
+		return c, nil
+	}
+	obj, err := objects.ObjectRead(w.gitRepo, sha)
+	if err != nil {
+		return nil, err
+	}
+	commit, ok := obj.(*objects.GitCommit)
+	if !ok {
+		return nil, fmt.Errorf("object %s is not a commit", sha)
+	}
+	c := &Commit{SHA: sha, Commit: commit, Parents: commit.Kvlm["parent"], index: len(w.cache)}
+	if committer := commit.Kvlm["committer"]; len(committer) > 0 {
+		if sig, err := objects.SignatureParse(committer[0]); err == nil {
+			c.Time = sig.When
+		}
+	}
+	w.cache[sha] = c
+	return c, nil
+}
+
+// Walk returns the selected commits in the requested order.
+func (w *Walker) Walk() ([]*Commit, error) {
+	hidden := make(map[string]bool)
+	w.hidden = hidden
+	for _, sha := range w.exclude {
+		if err := w.ancestors(sha, hidden); err != nil {
+			return nil, err
+		}
+	}
+
+	// Walk newest first from the tips, which is also the default order
+	var walked []*Commit
+	seen := make(map[string]bool)
+	w.seen = seen
+	interesting := make(map[string]bool)
+	queue := &commitQueue{}
+	for _, sha := range w.include {
+		if seen[sha] || hidden[sha] {
+			continue
+		}
+		seen[sha] = true
+		c, err := w.Lookup(sha)
+		if err != nil {
+			return nil, err
+		}
+		heap.Push(queue, c)
+	}
+	for queue.Len() > 0 {
+		c := heap.Pop(queue).(*Commit)
+		walked = append(walked, c)
+		follow, changed, err := w.simplify(c)
+		if err != nil {
+			return nil, err
+		}
+		c.follow = follow
+		interesting[c.SHA] = changed
+		for _, parent := range follow {
+			if seen[parent] || hidden[parent] {
+				continue
+			}
+			seen[parent] = true
+			p, err := w.Lookup(parent)
+			if err != nil {
+				return nil, err
+			}
+			heap.Push(queue, p)
+		}
+	}
+
+	if w.opts.Order != OrderDefault {
+		walked = w.sortTopo(walked)
+	}
+
+	var result []*Commit
+	for _, c := range walked {
+		if !interesting[c.SHA] || !w.match(c) {
+			continue
+		}
+		c.shown = true
+		result = append(result, c)
+		if w.opts.MaxCount > 0 && len(result) == w.opts.MaxCount {
+			break
+		}
+	}
+	return result, nil
+}
+
+// parents returns the parents the walk follows.
+func (w *Walker) parents(c *Commit) []string {
+	if w.opts.FirstParent && len(c.Parents) > 1 {
+		return c.Parents[:1]
+	}
+	return c.Parents
+}
+
+// match applies the date and author limits.
+func (w *Walker) match(c *Commit) bool {
+	if !w.opts.Since.IsZero() && c.Time.Before(w.opts.Since) {
+		return false
+	}
+	if !w.opts.Until.IsZero() && c.Time.After(w.opts.Until) {
+		return false
+	}
+	if w.opts.Author != nil {
+		author := c.Commit.Kvlm["author"]
+		if len(author) == 0 {
+			return false
+		}
+		// Match against "Name <email>" without the date
+		ident := author[0]
+		if gt := strings.LastIndex(ident, ">"); gt != -1 {
+			ident = ident[:gt+1]
+		}
+		if !w.opts.Author.MatchString(ident) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortTopo reorders commits so that no parent comes before its children.
+// Ready commits are taken newest first for OrderDate and most recently
+// readied first for OrderTopo, which keeps each line of history together.
+func (w *Walker) sortTopo(commits []*Commit) []*Commit {
+	indegree := make(map[string]int, len(commits))
+	for _, c := range commits {
+		indegree[c.SHA] = 1
+	}
+	for _, c := range commits {
+		for _, parent := range c.follow {
+			if indegree[parent] > 0 {
+				indegree[parent]++
+			}
+		}
+	}
+
+	var stack []*Commit
+	dates := &commitQueue{}
+	for _, c := range commits {
+		if indegree[c.SHA] == 1 {
+			if w.opts.Order == OrderTopo {
+				stack = append(stack, c)
+			} else {
+				heap.Push(dates, c)
+			}
+		}
+	}
+	// Tips come out in the order they were walked
+	for i, j := 0, len(stack)-1; i < j; i, j = i+1, j-1 {
+		stack[i], stack[j] = stack[j], stack[i]
+	}
+
+	sorted := make([]*Commit, 0, len(commits))
+	for len(stack) > 0 || dates.Len() > 0 {
+		var c *Commit
+		if w.opts.Order == OrderTopo {
+			c = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+		} else {
+			c = heap.Pop(dates).(*Commit)
+		}
+		sorted = append(sorted, c)
+		for _, parent := range c.follow {
+			if indegree[parent] == 0 {
+				continue
+			}
+			indegree[parent]--
+			if indegree[parent] == 1 {
+				p := w.cache[parent]
+				if w.opts.Order == OrderTopo {
+					stack = append(stack, p)
+				} else {
+					heap.Push(dates, p)
+				}
+			}
+		}
+	}
+	return sorted
+}
+
+// ancestors adds sha and all its ancestors to seen.
+func (w *Walker) ancestors(sha string, seen map[string]bool) error {
+	if seen[sha] {
+		return nil
+	}
+	seen[sha] = true
+	queue := []string{sha}
+	for len(queue) > 0 {
+		c, err := w.Lookup(queue[0])
+		if err != nil {
+			return err
+		}
+		queue = queue[1:]
+		for _, parent := range c.Parents {
+			if !seen[parent] {
+				seen[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+	}
+	return nil
+}
+
+// Ancestors returns sha and every commit reachable from it.
+func Ancestors(gitRepo *repo.GitRepository, sha string) (map[string]bool, error) {
+	seen := make(map[string]bool)
+	if err := New(gitRepo, Options{}).ancestors(sha, seen); err != nil {
+		return nil, err
+	}
+	return seen, nil
+}
+
+// MergeBases returns the best common ancestors of a and b: the common
+// ancestors that are not ancestors of another common ancestor.
+func MergeBases(gitRepo *repo.GitRepository, a, b string) ([]string, error) {
+	w := New(gitRepo, Options{})
+	fromA := make(map[string]bool)
+	if err := w.ancestors(a, fromA); err != nil {
+		return nil, err
+	}
+	fromB := make(map[string]bool)
+	if err := w.ancestors(b, fromB); err != nil {
+		return nil, err
+	}
+
+	// Common ancestors are closed under parents, so a common ancestor is
+	// not a best one exactly when it is the parent of another
+	common := make(map[string]bool)
+	for sha := range fromA {
+		if fromB[sha] {
+			common[sha] = true
+		}
+	}
+	notBest := make(map[string]bool)
+	for sha := range common {
+		for _, parent := range w.cache[sha].Parents {
+			notBest[parent] = true
+		}
+	}
+
+	var bases []*Commit
+	for sha := range common {
+		if !notBest[sha] {
+			bases = append(bases, w.cache[sha])
+		}
+	}
+	// Newest first, for a stable result
+	q := commitQueue(bases)
+	heap.Init(&q)
+	var shas []string
+	for q.Len() > 0 {
+		shas = append(shas, heap.Pop(&q).(*Commit).SHA)
+	}
+	return shas, nil
+}
+
+// commitQueue is a heap of commits, newest committer date first and in
+// order of discovery among equal dates.
+type commitQueue []*Commit
+
+func (q commitQueue) Len() int { return len(q) }
+func (q commitQueue) Less(i, j int) bool {
+	if !q[i].Time.Equal(q[j].Time) {
+		return q[i].Time.After(q[j].Time)
+	}
+	return q[i].index < q[j].index
+}
+func (q commitQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *commitQueue) Push(x interface{}) {
+	*q = append(*q, x.(*Commit))
+}
+func (q *commitQueue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,204 @@
+package revwalk
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Notwinner0/gvcs/internal/objects"
+	"github.com/Notwinner0/gvcs/internal/repo"
+)
+
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// testHistory writes commits into a new repository and returns their SHAs
+// by name.
+type testHistory struct {
+	t       *testing.T
+	gitRepo *repo.GitRepository
+	shas    map[string]string
+	names   map[string]string
+}
+
+func newTestHistory(t *testing.T) *testHistory {
+	gitRepo, err := repo.RepoCreate(t.TempDir())
+	if err != nil {
+		t.Fatalf("RepoCreate() failed: %v", err)
+	}
+	return &testHistory{t: t, gitRepo: gitRepo, shas: map[string]string{}, names: map[string]string{}}
+}
+
+// commit writes a commit with the given committer time and parents.
+func (h *testHistory) commit(name, author string, when int64, parents ...string) {
+	h.t.Helper()
+	h.commitFiles(name, author, when, nil, parents...)
+}
+
+// commitFiles writes a commit of a flat tree of files.
+func (h *testHistory) commitFiles(name, author string, when int64, files map[string]string, parents ...string) {
+	h.t.Helper()
+	tree := emptyTree
+	if files != nil {
+		t := &objects.GitTree{}
+		for path, content := range files {
+			sha, err := objects.ObjectHash(strings.NewReader(content), "blob", h.gitRepo)
+			if err != nil {
+				h.t.Fatalf("ObjectHash() failed: %v", err)
+			}
+			t.Items = append(t.Items, objects.GitTreeLeaf{Mode: "100644", Path: path, SHA: sha})
+		}
+		var err error
+		if tree, err = objects.ObjectWrite(t, h.gitRepo); err != nil {
+			h.t.Fatalf("ObjectWrite() failed: %v", err)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "tree %s\n", tree)
+	for _, p := range parents {
+		fmt.Fprintf(&b, "parent %s\n", h.shas[p])
+	}
+	fmt.Fprintf(&b, "author %s <%s@x> %d +0000\n", author, author, when)
+	fmt.Fprintf(&b, "committer C <c@x> %d +0000\n\n%s\n", when, name)
+	sha, err := objects.ObjectHash(strings.NewReader(b.String()), "commit", h.gitRepo)
+	if err != nil {
+		h.t.Fatalf("ObjectHash() failed: %v", err)
+	}
+	h.shas[name] = sha
+	h.names[sha] = name
+}
+
+func (h *testHistory) walk(opts Options, revisions ...string) string {
+	h.t.Helper()
+	w := New(h.gitRepo, opts)
+	for i, rev := range revisions {
+		for name, sha := range h.shas {
+			rev = strings.ReplaceAll(rev, "<"+name+">", sha)
+		}
+		revisions[i] = rev
+	}
+	if err := w.AddRevisions(revisions); err != nil {
+		h.t.Fatalf("AddRevisions() failed: %v", err)
+	}
+	commits, err := w.Walk()
+	if err != nil {
+		h.t.Fatalf("Walk() failed: %v", err)
+	}
+	var names []string
+	for _, c := range commits {
+		names = append(names, h.names[c.SHA])
+	}
+	return strings.Join(names, " ")
+}
+
+func TestWalker(t *testing.T) {
+	// a - b - m1 ---- m
+	//      \         /
+	//       s1 - s2 -
+	// s1 has an older clock than b, so the default order shows b first
+	h := newTestHistory(t)
+	h.commit("a", "alice", 50)
+	h.commit("b", "bob", 200, "a")
+	h.commit("s1", "alice", 100, "b")
+	h.commit("s2", "bob", 300, "s1")
+	h.commit("m1", "alice", 400, "b")
+	h.commit("m", "bob", 600, "m1", "s2")
+
+	tests := []struct {
+		name      string
+		opts      Options
+		revisions []string
+		want      string
+	}{
+		{"default order", Options{}, []string{"<m>"}, "m m1 s2 b s1 a"},
+		{"date order", Options{Order: OrderDate}, []string{"<m>"}, "m m1 s2 s1 b a"},
+		{"topo order", Options{Order: OrderTopo}, []string{"<m>"}, "m s2 s1 m1 b a"},
+		{"first parent", Options{FirstParent: true}, []string{"<m>"}, "m m1 b a"},
+		{"range", Options{}, []string{"<m1>..<m>"}, "m s2 s1"},
+		{"exclusion", Options{}, []string{"<m>", "^<s1>"}, "m m1 s2"},
+		{"not", Options{}, []string{"<m>", "--not", "<s2>", "^<a>"}, "m m1"},
+		{"symmetric difference", Options{}, []string{"<m1>...<s2>"}, "m1 s2 s1"},
+		{"max count", Options{MaxCount: 2}, []string{"<m>"}, "m m1"},
+		{"author", Options{Author: regexp.MustCompile("^bob")}, []string{"<m>"}, "m s2 b"},
+		{"dates", Options{Since: time.Unix(200, 0), Until: time.Unix(400, 0)}, []string{"<m>"}, "m1 s2 b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.walk(tt.opts, tt.revisions...); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWalker_Paths(t *testing.T) {
+	// a - b ------ m - r
+	//      \      /
+	//       s1 - s2
+	// The side branch changes only g, and m takes it unchanged; r renames
+	// f to h with a small change
+	body := "1\n2\n3\n4\n5\n6\n7\n8\n"
+	h := newTestHistory(t)
+	h.commitFiles("a", "a", 100, map[string]string{"f": body, "g": "g\n"})
+	h.commitFiles("b", "a", 200, map[string]string{"f": body + "9\n", "g": "g\n"}, "a")
+	h.commitFiles("s1", "a", 300, map[string]string{"f": body, "g": "g2\n"}, "a")
+	h.commitFiles("s2", "a", 400, map[string]string{"f": body, "g": "g3\n"}, "s1")
+	h.commitFiles("m", "a", 500, map[string]string{"f": body + "9\n", "g": "g3\n"}, "b", "s2")
+	h.commitFiles("r", "a", 600, map[string]string{"h": body + "9\n10\n", "g": "g3\n"}, "m")
+
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{"file", Options{Paths: []string{"f"}}, "r b a"},
+		{"merged file", Options{Paths: []string{"g"}}, "s2 s1 a"},
+		{"both", Options{Paths: []string{"f", "g"}}, "r m s2 s1 b a"},
+		{"renamed", Options{Paths: []string{"h"}}, "r"},
+		{"follow", Options{Paths: []string{"h"}, Follow: true}, "r b a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.walk(tt.opts, "<r>"); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	// Pruned commits are skipped in the parents of those shown
+	w := New(h.gitRepo, Options{Paths: []string{"g"}})
+	w.Push(h.shas["r"])
+	commits, err := w.Walk()
+	if err != nil {
+		t.Fatalf("Walk() failed: %v", err)
+	}
+	if got := h.names[w.Parents(commits[1])[0]]; got != "a" {
+		t.Errorf("Expected parent %q, got %q", "a", got)
+	}
+}
+
+func TestMergeBases(t *testing.T) {
+	// Criss-cross merge: x and y both merge p and q
+	h := newTestHistory(t)
+	h.commit("root", "a", 100)
+	h.commit("p", "a", 200, "root")
+	h.commit("q", "a", 300, "root")
+	h.commit("x", "a", 400, "p", "q")
+	h.commit("y", "a", 500, "q", "p")
+
+	bases, err := MergeBases(h.gitRepo, h.shas["x"], h.shas["y"])
+	if err != nil {
+		t.Fatalf("MergeBases() failed: %v", err)
+	}
+	var names []string
+	for _, sha := range bases {
+		names = append(names, h.names[sha])
+	}
+	if got := strings.Join(names, " "); got != "q p" {
+		t.Errorf("Expected %q, got %q", "q p", got)
+	}
+}